@@ -0,0 +1,265 @@
+package bsontools
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// The functions below edit BSON arrays. Unlike RemoveFromRaw & co., they
+// renumber the array’s keys so that the array stays valid. For each, the
+// pointer refers to the array; an empty pointer means that the given buffer
+// is itself an array (e.g., a bson.RawArray).
+//
+// As with other edits, bytes outside the array (aside from enclosing length
+// headers) are left as they were. Array elements before the edit keep their
+// bytes as well.
+
+// RemoveFromRawArray removes the element at the given index from an array.
+// The returned bool indicates whether the element was found, i.e., whether
+// the array exists and has that index.
+//
+// Example usage (removes /tags/1):
+//
+//	rawDoc, found, err = RemoveFromRawArray(rawDoc, 1, "tags")
+func RemoveFromRawArray[T ~[]byte](raw T, index int, pointer ...string) (T, bool, error) {
+	if index < 0 {
+		return nil, false, fmt.Errorf("array index (%d) must not be negative", index)
+	}
+
+	docAts, found, err := locateArray([]byte(raw), pointer)
+	if err != nil || !found {
+		return raw, false, wrapArrayEditErr(err, pointer)
+	}
+
+	buf, removed, err := spliceArrayAt([]byte(raw), docAts, index, 1)
+	if err != nil {
+		return nil, false, wrapArrayEditErr(err, pointer)
+	}
+
+	return T(buf), removed > 0, nil
+}
+
+// InsertIntoRawArray inserts values into an array at the given index. The
+// index may equal the array’s length, in which case the values are appended.
+// A missing array, or an index past the end, is an error.
+//
+// Example usage (inserts a value at /tags/0):
+//
+//	rawDoc, err = InsertIntoRawArray(rawDoc, 0, []bson.RawValue{newTag}, "tags")
+func InsertIntoRawArray[T ~[]byte](
+	raw T,
+	index int,
+	values []bson.RawValue,
+	pointer ...string,
+) (T, error) {
+	if index < 0 {
+		return nil, fmt.Errorf("array index (%d) must not be negative", index)
+	}
+
+	return editExistingArray(raw, pointer, index, 0, values...)
+}
+
+// AppendToRawArray appends values to an array. A missing array is an error.
+//
+// Example usage (appends a value to /tags):
+//
+//	rawDoc, err = AppendToRawArray(rawDoc, []bson.RawValue{newTag}, "tags")
+func AppendToRawArray[T ~[]byte](raw T, values []bson.RawValue, pointer ...string) (T, error) {
+	return editExistingArray(raw, pointer, appendIndex, 0, values...)
+}
+
+// TruncateRawArray shortens an array to the given length. If the array is
+// already that short, it is left as-is. A missing array is an error.
+//
+// This is how to replay a change event’s `truncatedArrays`.
+//
+// Example usage (truncates /tags to 2 elements):
+//
+//	rawDoc, err = TruncateRawArray(rawDoc, 2, "tags")
+func TruncateRawArray[T ~[]byte](raw T, length int, pointer ...string) (T, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("array length (%d) must not be negative", length)
+	}
+
+	return editExistingArray(raw, pointer, length, truncateCount)
+}
+
+const (
+	// appendIndex tells spliceArrayAt to start at the array’s end.
+	appendIndex = -1
+
+	// truncateCount tells spliceArrayAt to delete to the array’s end.
+	truncateCount = -1
+)
+
+func editExistingArray[T ~[]byte](
+	raw T,
+	pointer []string,
+	start, deleteCount int,
+	values ...bson.RawValue,
+) (T, error) {
+	docAts, found, err := locateArray([]byte(raw), pointer)
+	if err == nil && !found {
+		err = errors.New("array not found")
+	}
+
+	if err != nil {
+		return nil, wrapArrayEditErr(err, pointer)
+	}
+
+	buf, _, err := spliceArrayAt([]byte(raw), docAts, start, deleteCount, values...)
+	if err != nil {
+		return nil, wrapArrayEditErr(err, pointer)
+	}
+
+	return T(buf), nil
+}
+
+// locateArray finds the array that the pointer references. It returns the
+// offsets of the array’s enclosing documents, starting with the top-level
+// document’s (i.e., 0) and ending with the array’s.
+func locateArray(buf []byte, pointer []string) ([]int, bool, error) {
+	if len(pointer) == 0 {
+		return []int{0}, true, nil
+	}
+
+	docAts, _, found, err := locateParentDocuments(buf, pointer)
+	if err != nil || !found {
+		return nil, false, err
+	}
+
+	info, _, found, err := locateElement(buf, docAts[len(docAts)-1], pointer[len(pointer)-1])
+	if err != nil || !found {
+		return nil, false, err
+	}
+
+	if info.bsonType != bson.TypeArray {
+		return nil, false, fmt.Errorf("expected array but found %s", info.bsonType)
+	}
+
+	return append(docAts, info.valueAt), true, nil
+}
+
+// spliceArrayAt deletes deleteCount elements, starting at the given index,
+// from the array at the last of the given offsets. It inserts the given
+// values in their place and renumbers subsequent keys. It returns the updated
+// buffer and the number of elements deleted.
+//
+// A start of appendIndex means the array’s end; a deleteCount of
+// truncateCount means all elements from start onward.
+func spliceArrayAt(
+	buf []byte,
+	docAts []int,
+	start, deleteCount int,
+	values ...bson.RawValue,
+) ([]byte, int, error) {
+	arrayAt := docAts[len(docAts)-1]
+
+	elsBlock, err := elementsBlock(buf[arrayAt:min(len(buf), arrayAt+docLength(buf, arrayAt))])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	elsAt := arrayAt + 4
+
+	// elOffsets[i] is the i-th element’s offset within elsBlock. The final
+	// entry is elsBlock’s length.
+	var elOffsets []int
+
+	for offset := 0; ; {
+		elOffsets = append(elOffsets, offset)
+
+		if offset == len(elsBlock) {
+			break
+		}
+
+		el, _, ok := bsoncore.ReadElement(elsBlock[offset:])
+		if !ok {
+			return nil, 0, fmt.Errorf("invalid BSON array element at offset %d", elsAt+offset)
+		}
+
+		offset += len(el)
+	}
+
+	count := len(elOffsets) - 1
+
+	switch {
+	case start == appendIndex:
+		start = count
+	case start > count && len(values) > 0:
+		return nil, 0, fmt.Errorf("index %d exceeds array length (%d)", start, count)
+	case start > count:
+		// Deleting past the array’s end is a no-op.
+		return buf, 0, nil
+	}
+
+	end := count
+	if deleteCount != truncateCount {
+		end = min(start+deleteCount, count)
+	}
+
+	newTail := make([]byte, 0, len(elsBlock)-elOffsets[start])
+
+	idx := start
+
+	for _, value := range values {
+		newTail = bsoncore.AppendValueElement(newTail, strconv.Itoa(idx), bsoncore.Value{
+			Type: bsoncore.Type(value.Type),
+			Data: value.Value,
+		})
+		idx++
+	}
+
+	for i := end; i < count; i++ {
+		el := bsoncore.Element(elsBlock[elOffsets[i]:elOffsets[i+1]])
+
+		newTail = bsoncore.AppendHeader(newTail, bsoncore.Type(el[0]), strconv.Itoa(idx))
+		newTail = append(newTail, el[len(el.KeyBytes())+2:]...)
+		idx++
+	}
+
+	delta := len(newTail) - (len(elsBlock) - elOffsets[start])
+
+	buf = slices.Replace(buf, elsAt+elOffsets[start], elsAt+len(elsBlock), newTail...)
+
+	for _, docAt := range docAts {
+		if err := addToDocLength(buf, docAt, delta); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return buf, end - start, nil
+}
+
+// docLength returns the length header of the document at the given offset,
+// or 0 if the header is truncated or negative.
+func docLength(buf []byte, docAt int) int {
+	length, _, ok := bsoncore.ReadLength(buf[docAt:])
+	if !ok || length < 0 {
+		return 0
+	}
+
+	return int(length)
+}
+
+func wrapArrayEditErr(err error, pointer []string) error {
+	if err == nil {
+		return nil
+	}
+
+	var pe PointerTooDeepError
+	if errors.As(err, &pe) {
+		return pe
+	}
+
+	if len(pointer) == 0 {
+		return fmt.Errorf("editing array: %w", err)
+	}
+
+	return fmt.Errorf("editing array %#q: %w", formatPointerForDisplay(pointer), err)
+}
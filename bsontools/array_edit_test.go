@@ -0,0 +1,163 @@
+package bsontools
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestArrayEdits(t *testing.T) {
+	in := bson.D{
+		{"a", int32(1)},
+		{"sub", bson.D{{"arr", bson.A{"zero", "one", bson.D{{"k", "v"}}, "three"}}}},
+		{"z", true},
+	}
+
+	withArr := func(arr bson.A) bson.Raw {
+		return lo.Must(bson.Marshal(bson.D{
+			{"a", int32(1)},
+			{"sub", bson.D{{"arr", arr}}},
+			{"z", true},
+		}))
+	}
+
+	newVals := []bson.RawValue{ToRawValue("x"), ToRawValue(int64(2))}
+
+	cases := []struct {
+		label  string
+		edit   func(bson.Raw) (bson.Raw, error)
+		expect bson.A
+	}{
+		{
+			label: "remove middle",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				raw, found, err := RemoveFromRawArray(raw, 1, "sub", "arr")
+				assert.True(t, found)
+				return raw, err
+			},
+			expect: bson.A{"zero", bson.D{{"k", "v"}}, "three"},
+		},
+		{
+			label: "remove last",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				raw, found, err := RemoveFromRawArray(raw, 3, "sub", "arr")
+				assert.True(t, found)
+				return raw, err
+			},
+			expect: bson.A{"zero", "one", bson.D{{"k", "v"}}},
+		},
+		{
+			label: "remove past end",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				raw, found, err := RemoveFromRawArray(raw, 9, "sub", "arr")
+				assert.False(t, found)
+				return raw, err
+			},
+			expect: bson.A{"zero", "one", bson.D{{"k", "v"}}, "three"},
+		},
+		{
+			label: "insert at start",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				return InsertIntoRawArray(raw, 0, newVals, "sub", "arr")
+			},
+			expect: bson.A{"x", int64(2), "zero", "one", bson.D{{"k", "v"}}, "three"},
+		},
+		{
+			label: "insert in middle",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				return InsertIntoRawArray(raw, 2, newVals, "sub", "arr")
+			},
+			expect: bson.A{"zero", "one", "x", int64(2), bson.D{{"k", "v"}}, "three"},
+		},
+		{
+			label: "insert at end",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				return InsertIntoRawArray(raw, 4, newVals, "sub", "arr")
+			},
+			expect: bson.A{"zero", "one", bson.D{{"k", "v"}}, "three", "x", int64(2)},
+		},
+		{
+			label: "append",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				return AppendToRawArray(raw, newVals, "sub", "arr")
+			},
+			expect: bson.A{"zero", "one", bson.D{{"k", "v"}}, "three", "x", int64(2)},
+		},
+		{
+			label: "truncate",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				return TruncateRawArray(raw, 1, "sub", "arr")
+			},
+			expect: bson.A{"zero"},
+		},
+		{
+			label: "truncate to empty",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				return TruncateRawArray(raw, 0, "sub", "arr")
+			},
+			expect: bson.A{},
+		},
+		{
+			label: "truncate to longer",
+			edit: func(raw bson.Raw) (bson.Raw, error) {
+				return TruncateRawArray(raw, 10, "sub", "arr")
+			},
+			expect: bson.A{"zero", "one", bson.D{{"k", "v"}}, "three"},
+		},
+	}
+
+	for _, c := range cases {
+		raw, err := c.edit(lo.Must(bson.Marshal(in)))
+		require.NoError(t, err, c.label)
+		require.NoError(t, raw.Validate(), c.label)
+
+		assert.Equal(t, withArr(c.expect), raw, c.label)
+	}
+}
+
+func TestArrayEdits_TopLevel(t *testing.T) {
+	_, arrBytes := lo.Must2(bson.MarshalValue(bson.A{"a", "b", "c"}))
+	arr := bson.RawArray(arrBytes)
+
+	arr, found, err := RemoveFromRawArray(arr, 0)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	arr, err = AppendToRawArray(arr, []bson.RawValue{ToRawValue("d")})
+	require.NoError(t, err)
+
+	_, expected := lo.Must2(bson.MarshalValue(bson.A{"b", "c", "d"}))
+	assert.Equal(t, bson.RawArray(expected), arr)
+}
+
+func TestArrayEdits_Errors(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"arr", bson.A{int32(1)}},
+	}))
+
+	_, err := AppendToRawArray(raw, nil, "missing")
+	assert.ErrorContains(t, err, "not found")
+
+	_, found, err := RemoveFromRawArray(raw, 0, "missing")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = TruncateRawArray(raw, 0, "a")
+	assert.ErrorContains(t, err, "expected array")
+
+	_, err = InsertIntoRawArray(raw, 2, []bson.RawValue{ToRawValue("x")}, "arr")
+	assert.ErrorContains(t, err, "exceeds")
+
+	_, err = InsertIntoRawArray(raw, -1, nil, "arr")
+	assert.ErrorContains(t, err, "negative")
+
+	_, err = TruncateRawArray(raw, 0, "a", "b", "c")
+
+	var pe PointerTooDeepError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, []string{"a"}, pe.elementPointer)
+}
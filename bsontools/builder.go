@@ -0,0 +1,421 @@
+package bsontools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// Builder builds a BSON document by appending typed elements directly to a
+// byte buffer. Unlike MarshalD, this boxes no values in `any`, and since
+// Reset reuses the buffer, steady-state building doesn’t allocate.
+//
+// Builder’s methods return the Builder so that calls can chain. Misuse
+// (e.g., unbalanced nesting or a key that contains NUL) doesn’t panic;
+// instead, the Builder ignores all further appends, and Build returns an
+// error that describes the first misuse.
+//
+// Within an array, the Builder supplies the element keys ("0", "1", etc.),
+// so the key given to an append method must be empty.
+//
+// Example usage:
+//
+//	b := &bsontools.Builder{}
+//	doc, err := b.
+//		AppendString("insert", "coll").
+//		StartArray("documents").
+//		StartDocument("").AppendInt64("_id", 1).EndDocument().
+//		EndArray().
+//		Build()
+//
+// The zero value is an empty document, ready for use.
+type Builder struct {
+	buf []byte
+
+	// frames are the open documents & arrays. The first is the top-level
+	// document, which Build closes.
+	frames []builderFrame
+
+	built bool
+	err   error
+}
+
+type builderFrame struct {
+	// start is the offset of the document’s length header.
+	start int
+
+	isArray bool
+
+	// nextIndex is an array’s next element index.
+	nextIndex int
+}
+
+// Reset empties the Builder so that it can build another document. The
+// Builder keeps its buffer, so any document that Build returned before
+// will be overwritten.
+func (b *Builder) Reset() *Builder {
+	b.buf = b.buf[:0]
+	b.frames = b.frames[:0]
+	b.built = false
+	b.err = nil
+
+	return b
+}
+
+// Build closes the top-level document and returns it. The returned
+// document aliases the Builder’s buffer; it is valid until the next Reset.
+//
+// This fails if any embedded document or array is still open, or if any
+// earlier call misused the Builder.
+func (b *Builder) Build() (bson.Raw, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	if b.built {
+		return bson.Raw(b.buf), nil
+	}
+
+	b.start()
+
+	if len(b.frames) > 1 {
+		return nil, fmt.Errorf("cannot build while an %s is open", b.innermostName())
+	}
+
+	if !b.closeFrame() {
+		return nil, b.err
+	}
+
+	b.built = true
+
+	return bson.Raw(b.buf), nil
+}
+
+// AppendDouble appends a double.
+func (b *Builder) AppendDouble(key string, value float64) *Builder {
+	if b.appendHeader(bson.TypeDouble, key) {
+		b.buf = bsoncore.AppendDouble(b.buf, value)
+	}
+
+	return b
+}
+
+// AppendString appends a string.
+func (b *Builder) AppendString(key, value string) *Builder {
+	if b.appendHeader(bson.TypeString, key) {
+		b.buf = bsoncore.AppendString(b.buf, value)
+	}
+
+	return b
+}
+
+// AppendDocument appends an already-built embedded document. A malformed
+// document is a misuse of the Builder.
+func (b *Builder) AppendDocument(key string, doc bson.Raw) *Builder {
+	return b.appendRaw(bson.TypeEmbeddedDocument, key, doc)
+}
+
+// AppendArray appends an already-built array. A malformed array is a
+// misuse of the Builder.
+func (b *Builder) AppendArray(key string, arr bson.RawArray) *Builder {
+	return b.appendRaw(bson.TypeArray, key, arr)
+}
+
+// AppendBinary appends a binary.
+func (b *Builder) AppendBinary(key string, subtype byte, data []byte) *Builder {
+	if b.appendHeader(bson.TypeBinary, key) {
+		b.buf = bsoncore.AppendBinary(b.buf, subtype, data)
+	}
+
+	return b
+}
+
+// AppendObjectID appends an ObjectID.
+func (b *Builder) AppendObjectID(key string, oid bson.ObjectID) *Builder {
+	if b.appendHeader(bson.TypeObjectID, key) {
+		b.buf = bsoncore.AppendObjectID(b.buf, oid)
+	}
+
+	return b
+}
+
+// AppendBoolean appends a boolean.
+func (b *Builder) AppendBoolean(key string, value bool) *Builder {
+	if b.appendHeader(bson.TypeBoolean, key) {
+		b.buf = bsoncore.AppendBoolean(b.buf, value)
+	}
+
+	return b
+}
+
+// AppendDateTime appends a datetime.
+func (b *Builder) AppendDateTime(key string, dt bson.DateTime) *Builder {
+	if b.appendHeader(bson.TypeDateTime, key) {
+		b.buf = bsoncore.AppendDateTime(b.buf, int64(dt))
+	}
+
+	return b
+}
+
+// AppendNull appends a null.
+func (b *Builder) AppendNull(key string) *Builder {
+	b.appendHeader(bson.TypeNull, key)
+
+	return b
+}
+
+// AppendInt32 appends an int32.
+func (b *Builder) AppendInt32(key string, value int32) *Builder {
+	if b.appendHeader(bson.TypeInt32, key) {
+		b.buf = bsoncore.AppendInt32(b.buf, value)
+	}
+
+	return b
+}
+
+// AppendTimestamp appends a timestamp.
+func (b *Builder) AppendTimestamp(key string, ts bson.Timestamp) *Builder {
+	if b.appendHeader(bson.TypeTimestamp, key) {
+		b.buf = bsoncore.AppendTimestamp(b.buf, ts.T, ts.I)
+	}
+
+	return b
+}
+
+// AppendInt64 appends an int64.
+func (b *Builder) AppendInt64(key string, value int64) *Builder {
+	if b.appendHeader(bson.TypeInt64, key) {
+		b.buf = bsoncore.AppendInt64(b.buf, value)
+	}
+
+	return b
+}
+
+// AppendDecimal128 appends a Decimal128.
+func (b *Builder) AppendDecimal128(key string, dec bson.Decimal128) *Builder {
+	if b.appendHeader(bson.TypeDecimal128, key) {
+		h, l := dec.GetBytes()
+		b.buf = bsoncore.AppendDecimal128(b.buf, h, l)
+	}
+
+	return b
+}
+
+// AppendValue appends a value of any type. This is useful for types that
+// lack a dedicated append method. A malformed value is a misuse of the
+// Builder.
+func (b *Builder) AppendValue(key string, val bson.RawValue) *Builder {
+	if val.Type == 0 {
+		b.fail(fmt.Errorf("cannot append missing value (key: %#q)", key))
+
+		return b
+	}
+
+	return b.appendRaw(val.Type, key, val.Value)
+}
+
+// StartDocument opens an embedded document. Subsequent appends go into it
+// until the matching EndDocument.
+func (b *Builder) StartDocument(key string) *Builder {
+	return b.startFrame(key, false)
+}
+
+// EndDocument closes the innermost open embedded document.
+func (b *Builder) EndDocument() *Builder {
+	return b.endFrame(false)
+}
+
+// StartArray opens an array. Subsequent appends go into it until the
+// matching EndArray.
+func (b *Builder) StartArray(key string) *Builder {
+	return b.startFrame(key, true)
+}
+
+// EndArray closes the innermost open array.
+func (b *Builder) EndArray() *Builder {
+	return b.endFrame(true)
+}
+
+func (b *Builder) startFrame(key string, isArray bool) *Builder {
+	bsonType := bson.TypeEmbeddedDocument
+	if isArray {
+		bsonType = bson.TypeArray
+	}
+
+	if b.appendHeader(bsonType, key) {
+		b.frames = append(b.frames, builderFrame{start: len(b.buf), isArray: isArray})
+		b.buf = append(b.buf, 0, 0, 0, 0)
+	}
+
+	return b
+}
+
+func (b *Builder) endFrame(isArray bool) *Builder {
+	if !b.start() {
+		return b
+	}
+
+	wanted, method := "embedded document", "EndDocument"
+	if isArray {
+		wanted, method = "array", "EndArray"
+	}
+
+	if len(b.frames) == 1 {
+		b.fail(fmt.Errorf("%s called without an open %s", method, wanted))
+
+		return b
+	}
+
+	if b.frames[len(b.frames)-1].isArray != isArray {
+		b.fail(fmt.Errorf("%s called while an %s is open", method, b.innermostName()))
+
+		return b
+	}
+
+	b.closeFrame()
+
+	return b
+}
+
+// closeFrame closes the innermost frame and patches its length header.
+func (b *Builder) closeFrame() bool {
+	frame := b.frames[len(b.frames)-1]
+	b.frames = b.frames[:len(b.frames)-1]
+
+	b.buf = append(b.buf, 0)
+
+	if err := putDocLength(b.buf, frame.start); err != nil {
+		b.fail(err)
+
+		return false
+	}
+
+	return true
+}
+
+func (b *Builder) innermostName() string {
+	if b.frames[len(b.frames)-1].isArray {
+		return "array"
+	}
+
+	return "embedded document"
+}
+
+// start opens the top-level document if needed. It returns false if the
+// Builder can’t accept further appends.
+func (b *Builder) start() bool {
+	switch {
+	case b.err != nil:
+		return false
+	case b.built:
+		b.fail(fmt.Errorf("cannot modify built document (call Reset first)"))
+
+		return false
+	}
+
+	if len(b.frames) == 0 {
+		b.frames = append(b.frames, builderFrame{start: len(b.buf)})
+		b.buf = append(b.buf, 0, 0, 0, 0)
+	}
+
+	return true
+}
+
+// appendRaw appends a caller-provided value after validating it.
+func (b *Builder) appendRaw(bsonType bson.Type, key string, data []byte) *Builder {
+	if b.err != nil {
+		return b
+	}
+
+	if err := validateRawValue(bsonType, data); err != nil {
+		b.fail(fmt.Errorf("cannot append invalid %s (key: %#q): %w", bsonType, key, err))
+
+		return b
+	}
+
+	if b.appendHeader(bsonType, key) {
+		b.buf = append(b.buf, data...)
+	}
+
+	return b
+}
+
+// validateRawValue checks that the given bytes are exactly one well-formed
+// BSON value of the given type. Embedded documents & arrays have their
+// elements validated but are not recursed into.
+func validateRawValue(bsonType bson.Type, data []byte) error {
+	switch bsonType {
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+		// RawElements accepts an empty buffer, but a value can’t be empty.
+		if len(data) == 0 {
+			return fmt.Errorf("value is empty")
+		}
+
+		for _, err := range RawElements(bson.Raw(data)) {
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	_, rem, ok := bsoncore.ReadValue(data, bsoncore.Type(bsonType))
+	if !ok {
+		return bsoncore.NewInsufficientBytesError(data, rem)
+	}
+
+	if len(rem) > 0 {
+		return fmt.Errorf("value has %d extra byte(s)", len(rem))
+	}
+
+	return nil
+}
+
+// appendHeader appends an element’s type & key. It returns false if the
+// caller should not append the element’s value.
+func (b *Builder) appendHeader(bsonType bson.Type, key string) bool {
+	if !b.start() {
+		return false
+	}
+
+	frame := &b.frames[len(b.frames)-1]
+
+	if frame.isArray {
+		if key != "" {
+			b.fail(fmt.Errorf("array elements’ keys are automatic, but key %#q was given", key))
+
+			return false
+		}
+
+		b.buf = append(b.buf, byte(bsonType))
+		b.buf = strconv.AppendInt(b.buf, int64(frame.nextIndex), 10)
+		b.buf = append(b.buf, 0)
+
+		frame.nextIndex++
+
+		return true
+	}
+
+	if strings.ContainsRune(key, 0) {
+		b.fail(fmt.Errorf("field name (%#q) contains NUL", key))
+
+		return false
+	}
+
+	b.buf = append(b.buf, byte(bsonType))
+	b.buf = append(b.buf, key...)
+	b.buf = append(b.buf, 0)
+
+	return true
+}
+
+// fail records the Builder’s first error.
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -0,0 +1,205 @@
+package bsontools
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestBuilder(t *testing.T) {
+	oid := bson.NewObjectID()
+	dec := lo.Must(bson.ParseDecimal128("1.50"))
+	sub := lo.Must(bson.Marshal(bson.D{{"x", int32(1)}}))
+
+	doc, err := (&Builder{}).
+		AppendDouble("double", 1.25).
+		AppendString("string", "abc").
+		AppendDocument("doc", sub).
+		AppendArray("arr", lo.Must(MarshalA([]byte(nil), bson.A{"a", "b"}))).
+		AppendBinary("bin", bson.TypeBinaryGeneric, []byte{1, 2}).
+		AppendObjectID("oid", oid).
+		AppendBoolean("bool", true).
+		AppendDateTime("dt", bson.DateTime(1234)).
+		AppendNull("null").
+		AppendInt32("i32", 32).
+		AppendTimestamp("ts", bson.Timestamp{T: 1, I: 2}).
+		AppendInt64("i64", 64).
+		AppendDecimal128("dec", dec).
+		AppendValue("sym", ToRawValue(bson.Symbol("sym"))).
+		StartDocument("nested").
+		AppendString("a", "b").
+		StartArray("empty").EndArray().
+		EndDocument().
+		StartArray("docs").
+		StartDocument("").AppendInt64("_id", 1).EndDocument().
+		StartArray("").AppendInt32("", 2).AppendInt32("", 3).EndArray().
+		AppendString("", "last").
+		EndArray().
+		Build()
+	require.NoError(t, err)
+
+	expected := lo.Must(bson.Marshal(bson.D{
+		{"double", 1.25},
+		{"string", "abc"},
+		{"doc", bson.Raw(sub)},
+		{"arr", bson.A{"a", "b"}},
+		{"bin", bson.Binary{Data: []byte{1, 2}}},
+		{"oid", oid},
+		{"bool", true},
+		{"dt", bson.DateTime(1234)},
+		{"null", nil},
+		{"i32", int32(32)},
+		{"ts", bson.Timestamp{T: 1, I: 2}},
+		{"i64", int64(64)},
+		{"dec", dec},
+		{"sym", bson.Symbol("sym")},
+		{"nested", bson.D{
+			{"a", "b"},
+			{"empty", bson.A{}},
+		}},
+		{"docs", bson.A{
+			bson.D{{"_id", int64(1)}},
+			bson.A{int32(2), int32(3)},
+			"last",
+		}},
+	}))
+
+	assert.Equal(t, bson.Raw(expected), doc)
+}
+
+func TestBuilder_Empty(t *testing.T) {
+	doc, err := (&Builder{}).Build()
+	require.NoError(t, err)
+	assert.Equal(t, bson.Raw(lo.Must(bson.Marshal(bson.D{}))), doc)
+}
+
+func TestBuilder_Reset(t *testing.T) {
+	b := &Builder{}
+
+	doc, err := b.AppendInt32("a", 1).Build()
+	require.NoError(t, err)
+	assert.Equal(t, bson.Raw(lo.Must(bson.Marshal(bson.D{{"a", int32(1)}}))), doc)
+
+	_, err = b.AppendInt32("b", 2).Build()
+	assert.ErrorContains(t, err, "Reset", "append after Build")
+
+	doc, err = b.Reset().AppendString("c", "d").Build()
+	require.NoError(t, err)
+	assert.Equal(t, bson.Raw(lo.Must(bson.Marshal(bson.D{{"c", "d"}}))), doc)
+
+	allocs := testing.AllocsPerRun(10, func() {
+		lo.Must(b.Reset().
+			AppendString("insert", "coll").
+			StartArray("documents").
+			StartDocument("").AppendInt64("_id", 1).EndDocument().
+			EndArray().
+			Build())
+	})
+	assert.Zero(t, allocs, "reused buffer should not allocate")
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	cases := []struct {
+		label  string
+		build  func(*Builder) *Builder
+		reason string
+	}{
+		{
+			label:  "unclosed document",
+			build:  func(b *Builder) *Builder { return b.StartDocument("a") },
+			reason: "embedded document is open",
+		},
+		{
+			label:  "unclosed array",
+			build:  func(b *Builder) *Builder { return b.StartDocument("a").StartArray("b") },
+			reason: "array is open",
+		},
+		{
+			label:  "extra EndDocument",
+			build:  func(b *Builder) *Builder { return b.EndDocument() },
+			reason: "without an open embedded document",
+		},
+		{
+			label:  "mismatched end",
+			build:  func(b *Builder) *Builder { return b.StartArray("a").EndDocument() },
+			reason: "EndDocument called while an array is open",
+		},
+		{
+			label:  "key in array",
+			build:  func(b *Builder) *Builder { return b.StartArray("a").AppendInt32("0", 1).EndArray() },
+			reason: "automatic",
+		},
+		{
+			label:  "NUL in key",
+			build:  func(b *Builder) *Builder { return b.AppendNull("a\x00b") },
+			reason: "NUL",
+		},
+		{
+			label:  "missing value",
+			build:  func(b *Builder) *Builder { return b.AppendValue("a", bson.RawValue{}) },
+			reason: "missing",
+		},
+		{
+			label: "nil document",
+			build: func(b *Builder) *Builder {
+				return b.AppendDocument("x", nil).AppendInt32("y", 1)
+			},
+			reason: "invalid embedded document (key: `x`)",
+		},
+		{
+			label:  "malformed array",
+			build:  func(b *Builder) *Builder { return b.AppendArray("x", bson.RawArray{1, 2, 3}) },
+			reason: "invalid array (key: `x`)",
+		},
+		{
+			label: "array missing NUL",
+			build: func(b *Builder) *Builder {
+				return b.AppendArray("x", bson.RawArray{5, 0, 0, 0, 1})
+			},
+			reason: "NUL",
+		},
+		{
+			label: "document with extra bytes",
+			build: func(b *Builder) *Builder {
+				return b.AppendDocument("x", bson.Raw{5, 0, 0, 0, 0, 0})
+			},
+			reason: "mismatches",
+		},
+		{
+			label: "malformed element in document",
+			build: func(b *Builder) *Builder {
+				return b.AppendDocument("x", bson.Raw{8, 0, 0, 0, 0x10, 'a', 0, 0})
+			},
+			reason: "invalid embedded document",
+		},
+		{
+			label: "empty string value",
+			build: func(b *Builder) *Builder {
+				return b.AppendValue("x", bson.RawValue{Type: bson.TypeString})
+			},
+			reason: "invalid string (key: `x`)",
+		},
+		{
+			label: "value with extra bytes",
+			build: func(b *Builder) *Builder {
+				return b.AppendValue("x", bson.RawValue{Type: bson.TypeInt32, Value: []byte{1, 0, 0, 0, 0}})
+			},
+			reason: "extra",
+		},
+		{
+			label: "first error wins",
+			build: func(b *Builder) *Builder {
+				return b.EndArray().AppendNull("a\x00b").StartDocument("x")
+			},
+			reason: "EndArray called without an open array",
+		},
+	}
+
+	for _, tc := range cases {
+		_, err := tc.build(&Builder{}).Build()
+		assert.ErrorContains(t, err, tc.reason, tc.label)
+	}
+}
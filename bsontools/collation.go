@@ -0,0 +1,287 @@
+package bsontools
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// SimpleLocale is the collation locale that denotes bytewise string comparison.
+const SimpleLocale = "simple"
+
+// Collation describes a [MongoDB collation]. See ParseCollation.
+//
+// [MongoDB collation]: https://www.mongodb.com/docs/manual/reference/collation/
+type Collation struct {
+	Locale          string
+	CaseLevel       bool
+	CaseFirst       string
+	Strength        int
+	NumericOrdering bool
+	Alternate       string
+	MaxVariable     string
+	Backwards       bool
+}
+
+// ParseCollation parses a collation document (e.g., from a collection’s
+// options or an index spec) into a Collation. Omitted fields receive the
+// server’s defaults.
+//
+// This rejects unknown fields as well as settings that StringCollator cannot
+// honor (e.g., caseFirst other than “off”).
+//
+//nolint:cyclop,funlen
+func ParseCollation[D ~[]byte](doc D) (Collation, error) {
+	coll := Collation{
+		CaseFirst:   "off",
+		Strength:    3,
+		Alternate:   "non-ignorable",
+		MaxVariable: "punct",
+	}
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return Collation{}, fmt.Errorf("parsing collation: %w", err)
+		}
+
+		key := el.Key()
+
+		val, err := el.ValueErr()
+		if err != nil {
+			return Collation{}, fmt.Errorf("parsing collation’s %#q: %w", key, err)
+		}
+
+		switch key {
+		case "locale":
+			coll.Locale, err = RawValueToString(val)
+		case "caseLevel":
+			coll.CaseLevel, err = RawValueTo[bool](val)
+		case "caseFirst":
+			coll.CaseFirst, err = RawValueToString(val)
+		case "strength":
+			coll.Strength, err = RawValueToInt(val)
+		case "numericOrdering":
+			coll.NumericOrdering, err = RawValueTo[bool](val)
+		case "alternate":
+			coll.Alternate, err = RawValueToString(val)
+		case "maxVariable":
+			coll.MaxVariable, err = RawValueToString(val)
+		case "backwards":
+			coll.Backwards, err = RawValueTo[bool](val)
+		case "normalization":
+			// Unicode normalization affects only performance, not results,
+			// since the collator always normalizes its input.
+			_, err = RawValueTo[bool](val)
+		case "version":
+			// The server reports this, but it has no effect on comparison.
+			_, err = RawValueToString(val)
+		default:
+			return Collation{}, fmt.Errorf("unknown collation field %#q", key)
+		}
+
+		if err != nil {
+			return Collation{}, fmt.Errorf("parsing collation’s %#q: %w", key, err)
+		}
+	}
+
+	if coll.Locale == "" {
+		return Collation{}, fmt.Errorf("collation lacks %#q", "locale")
+	}
+
+	if coll.Strength < 1 || coll.Strength > 5 {
+		return Collation{}, fmt.Errorf("collation strength (%d) must be 1-5", coll.Strength)
+	}
+
+	if coll.CaseFirst != "off" {
+		return Collation{}, fmt.Errorf("unsupported collation caseFirst: %#q", coll.CaseFirst)
+	}
+
+	switch coll.Alternate {
+	case "non-ignorable", "shifted":
+	default:
+		return Collation{}, fmt.Errorf("unsupported collation alternate: %#q", coll.Alternate)
+	}
+
+	if coll.MaxVariable != "punct" {
+		return Collation{}, fmt.Errorf(
+			"unsupported collation maxVariable: %#q",
+			coll.MaxVariable,
+		)
+	}
+
+	return coll, nil
+}
+
+// StringCollator compares BSON strings per a Collation. It uses the CLDR
+// collation tables in golang.org/x/text/collate, which closely track the ICU
+// tables that the server uses. A locale without its own tailoring there
+// (e.g., “en”) sorts per the root collation, as it does in ICU.
+//
+// Locales (and collation variants) that have no tables in x/text/collate
+// are unsupported, except for a few that the server sorts per the root
+// collation anyway (e.g., “it”).
+//
+// A StringCollator is not safe for concurrent use.
+type StringCollator struct {
+	collator *collate.Collator
+}
+
+// NewStringCollator creates a StringCollator for the given Collation.
+func NewStringCollator(coll Collation) (*StringCollator, error) {
+	if coll.Locale == SimpleLocale {
+		return &StringCollator{}, nil
+	}
+
+	tag, err := collationToTag(coll)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StringCollator{
+		collator: collate.New(tag),
+	}, nil
+}
+
+// CompareStrings is like the package-level CompareStrings but honors the
+// collation. Like the server, it treats BSON symbols as strings.
+func (sc *StringCollator) CompareStrings(a, b bson.RawValue) (int, error) {
+	aBytes, err := collatableStringBytes(a)
+	if err != nil {
+		return 0, err
+	}
+
+	bBytes, err := collatableStringBytes(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return sc.compareBytes(aBytes, bBytes), nil
+}
+
+// CompareValues is like the package-level CompareValues but compares strings
+// & symbols—including those inside documents & arrays—per the collation,
+// just as the server does. Field names are still compared bytewise.
+func (sc *StringCollator) CompareValues(a, b bson.RawValue) (int, error) {
+	return valueComparer{compareStrings: sc.compareBytes}.compare(a, b)
+}
+
+func (sc *StringCollator) compareBytes(a, b []byte) int {
+	if sc.collator == nil {
+		return bytes.Compare(a, b)
+	}
+
+	return sc.collator.Compare(a, b)
+}
+
+func collatableStringBytes(in bson.RawValue) ([]byte, error) {
+	switch in.Type {
+	case bson.TypeString, bson.TypeSymbol:
+		return readStringBytes(in.Value)
+	}
+
+	return nil, fmt.Errorf("expected BSON %s but found %s", bson.TypeString, in.Type)
+}
+
+// collationToTag expresses a Collation as a BCP 47 tag with Unicode (“-u-”)
+// collation extensions, which is how x/text/collate accepts options.
+func collationToTag(coll Collation) (language.Tag, error) {
+	locale := coll.Locale
+
+	// ICU locale IDs can specify a collation variant, e.g.,
+	// “de@collation=phonebook”. BCP 47 expresses that as “de-u-co-phonebk”.
+	var variant string
+	if base, kw, found := strings.Cut(locale, "@"); found {
+		key, val, _ := strings.Cut(kw, "=")
+		if key != "collation" || val == "" {
+			return language.Tag{}, fmt.Errorf("unsupported locale keyword in %#q", locale)
+		}
+
+		locale, variant = base, val
+	}
+
+	tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+	if err != nil {
+		return language.Tag{}, fmt.Errorf("parsing collation locale %#q: %w", coll.Locale, err)
+	}
+
+	if variant != "" {
+		tag, err = tag.SetTypeForKey("co", icuToBCP47Collation(variant))
+		if err != nil {
+			return language.Tag{}, fmt.Errorf("applying collation variant %#q: %w", variant, err)
+		}
+	}
+
+	// Otherwise x/text/collate would silently fall back to the root
+	// collation, whereas the server rejects unknown locales.
+	if !collationLocales.Contains(tag.String()) {
+		return language.Tag{}, fmt.Errorf("unsupported collation locale %#q", coll.Locale)
+	}
+
+	settings := [][2]string{
+		{"ks", strengthToLevel[coll.Strength]},
+		{"kc", fmt.Sprint(coll.CaseLevel)},
+		{"kn", fmt.Sprint(coll.NumericOrdering)},
+		{"kb", fmt.Sprint(coll.Backwards)},
+	}
+
+	if coll.Alternate == "shifted" {
+		settings = append(settings, [2]string{"ka", "shifted"})
+	}
+
+	for _, setting := range settings {
+		tag, err = tag.SetTypeForKey(setting[0], setting[1])
+		if err != nil {
+			return language.Tag{}, fmt.Errorf(
+				"applying collation setting %s=%s: %w",
+				setting[0],
+				setting[1],
+				err,
+			)
+		}
+	}
+
+	return tag, nil
+}
+
+// collationLocales are the supported locales as BCP 47 tags, including any
+// collation variant: those that x/text/collate has tables for, plus server
+// locales that have no CLDR tailoring and thus use the root collation.
+var collationLocales = func() mapset.Set[string] {
+	locales := mapset.NewSet("ga", "id", "it", "lb", "ms", "nl", "pt", "sw")
+
+	for _, tag := range collate.Supported() {
+		if tag != language.Und {
+			locales.Add(tag.String())
+		}
+	}
+
+	return locales
+}()
+
+var strengthToLevel = map[int]string{
+	1: "level1",
+	2: "level2",
+	3: "level3",
+	4: "level4",
+	5: "identic",
+}
+
+// icuToBCP47Collation converts ICU’s collation-variant names to BCP 47’s,
+// which are limited to 8 characters.
+func icuToBCP47Collation(variant string) string {
+	switch variant {
+	case "phonebook":
+		return "phonebk"
+	case "dictionary":
+		return "dict"
+	case "traditional":
+		return "trad"
+	}
+
+	return variant
+}
@@ -0,0 +1,177 @@
+package bsontools
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParseCollation(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"locale", "fr"},
+		{"strength", int32(2)},
+		{"numericOrdering", true},
+		{"normalization", false},
+	}))
+
+	coll, err := ParseCollation(raw)
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		Collation{
+			Locale:          "fr",
+			CaseFirst:       "off",
+			Strength:        2,
+			NumericOrdering: true,
+			Alternate:       "non-ignorable",
+			MaxVariable:     "punct",
+		},
+		coll,
+	)
+
+	for _, bad := range []bson.D{
+		{},
+		{{"locale", "en"}, {"strength", int32(6)}},
+		{{"locale", "en"}, {"caseFirst", "upper"}},
+		{{"locale", "en"}, {"alternate", "bogus"}},
+		{{"locale", "en"}, {"bogus", true}},
+		{{"locale", int32(1)}},
+	} {
+		_, err := ParseCollation(lo.Must(bson.Marshal(bad)))
+		assert.Error(t, err, "%v", bad)
+	}
+}
+
+func TestStringCollator_CompareStrings(t *testing.T) {
+	cases := []struct {
+		collation bson.D
+		a, b      string
+		expect    int
+	}{
+		{bson.D{{"locale", "simple"}}, "B", "a", -1},
+		{bson.D{{"locale", "en"}}, "B", "a", 1},
+		{bson.D{{"locale", "en"}}, "a", "A", -1},
+		{bson.D{{"locale", "en"}, {"strength", int32(2)}}, "a", "A", 0},
+		{bson.D{{"locale", "en"}, {"strength", int32(2)}}, "e", "é", -1},
+		{bson.D{{"locale", "en"}, {"strength", int32(1)}}, "E", "é", 0},
+		{bson.D{{"locale", "en"}, {"strength", int32(1)}, {"caseLevel", true}}, "e", "E", -1},
+		{bson.D{{"locale", "en"}}, "a10", "a9", -1},
+		{bson.D{{"locale", "en"}, {"numericOrdering", true}}, "a10", "a9", 1},
+		{bson.D{{"locale", "en"}}, "a-b", "ab", -1},
+		{
+			bson.D{{"locale", "en"}, {"alternate", "shifted"}, {"strength", int32(3)}},
+			"a-b",
+			"ab",
+			0,
+		},
+		{bson.D{{"locale", "sv"}}, "ä", "z", 1},
+		{bson.D{{"locale", "de"}}, "ä", "z", -1},
+	}
+
+	for _, c := range cases {
+		coll, err := ParseCollation(lo.Must(bson.Marshal(c.collation)))
+		require.NoError(t, err, "%v", c.collation)
+
+		collator, err := NewStringCollator(coll)
+		require.NoError(t, err, "%v", c.collation)
+
+		got, err := collator.CompareStrings(ToRawValue(c.a), ToRawValue(c.b))
+		require.NoError(t, err)
+
+		assert.Equal(t, c.expect, got, "%v: %#q cmp %#q", c.collation, c.a, c.b)
+
+		got, err = collator.CompareStrings(ToRawValue(bson.Symbol(c.b)), ToRawValue(c.a))
+		require.NoError(t, err)
+
+		assert.Equal(t, -c.expect, got, "%v: %#q cmp %#q (reversed)", c.collation, c.b, c.a)
+	}
+
+	collator, err := NewStringCollator(Collation{Locale: "en", Strength: 3})
+	require.NoError(t, err)
+
+	_, err = collator.CompareStrings(ToRawValue(int32(1)), ToRawValue("a"))
+	assert.Error(t, err)
+}
+
+func TestNewStringCollator_Locales(t *testing.T) {
+	supported := []string{
+		"simple",
+		"en",
+		"en_US",
+		"en_US_POSIX",
+		"de@collation=phonebook",
+		"zh_Hant",
+		"sr_Latn",
+		"fi@collation=standard",
+		"it",
+	}
+
+	for _, locale := range supported {
+		_, err := NewStringCollator(Collation{Locale: locale, Strength: 3})
+		assert.NoError(t, err, "%#q", locale)
+	}
+
+	unsupported := []string{
+		"zz",
+		"en_UU",
+		"xh",
+		"en_GB",
+		"de@collation=bogus",
+		"es@collation=traditional",
+		"de@calendar=gregorian",
+	}
+
+	for _, locale := range unsupported {
+		_, err := NewStringCollator(Collation{Locale: locale, Strength: 3})
+		assert.Error(t, err, "%#q", locale)
+	}
+}
+
+func TestStringCollator_CompareValues(t *testing.T) {
+	collator, err := NewStringCollator(Collation{Locale: "en", Strength: 2})
+	require.NoError(t, err)
+
+	values := []any{
+		bson.D{{"x", "B"}},
+		bson.D{{"x", "a"}},
+		bson.D{{"X", "a"}},
+		bson.A{"b", int32(1)},
+		bson.A{"A", int32(2)},
+		int32(5),
+	}
+
+	slices.SortStableFunc(values, func(a, b any) int {
+		aType, aBuf := lo.Must2(bson.MarshalValue(a))
+		bType, bBuf := lo.Must2(bson.MarshalValue(b))
+
+		return lo.Must(collator.CompareValues(
+			bson.RawValue{Type: aType, Value: aBuf},
+			bson.RawValue{Type: bType, Value: bBuf},
+		))
+	})
+
+	assert.Equal(
+		t,
+		[]any{
+			int32(5),
+			bson.D{{"X", "a"}}, // field names are compared bytewise
+			bson.D{{"x", "a"}},
+			bson.D{{"x", "B"}},
+			bson.A{"A", int32(2)},
+			bson.A{"b", int32(1)},
+		},
+		values,
+	)
+
+	got, err := collator.CompareValues(
+		ToRawValue(bson.JavaScript("a")),
+		ToRawValue(bson.JavaScript("A")),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got, "JavaScript code ignores collation")
+}
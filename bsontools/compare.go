@@ -3,9 +3,13 @@ package bsontools
 import (
 	"bytes"
 	"cmp"
+	"fmt"
+	"math"
+	"math/big"
 
 	mapset "github.com/deckarep/golang-set/v2"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
 )
 
 var (
@@ -16,7 +20,8 @@ var (
 	}
 )
 
-// GetComparableTypes returns a Set of BSON types that this library can compare.
+// GetComparableTypes returns a Set of BSON types that this library can compare
+// via a type-specific comparator. (CompareValues compares all BSON types.)
 func GetComparableTypes() mapset.Set[bson.Type] {
 	return mapset.NewSetFromMapKeys(comparatorByType)
 }
@@ -75,3 +80,471 @@ func CompareBinaries(a, b bson.RawValue) (int, error) {
 
 	return bytes.Compare(aGo.Data, bGo.Data), nil
 }
+
+// canonicalTypeOrder gives each BSON type’s rank in the server’s sort order.
+// Types that share a rank (e.g., all numeric types) compare by value.
+//
+// This mirrors canonicalizeBSONType() in the server’s bsontypes.h.
+var canonicalTypeOrder = map[bson.Type]int{
+	bson.TypeMinKey:           -1,
+	bson.TypeUndefined:        0,
+	bson.TypeNull:             5,
+	bson.TypeDouble:           10,
+	bson.TypeInt32:            10,
+	bson.TypeInt64:            10,
+	bson.TypeDecimal128:       10,
+	bson.TypeString:           15,
+	bson.TypeSymbol:           15,
+	bson.TypeEmbeddedDocument: 20,
+	bson.TypeArray:            25,
+	bson.TypeBinary:           30,
+	bson.TypeObjectID:         35,
+	bson.TypeBoolean:          40,
+	bson.TypeDateTime:         45,
+	bson.TypeTimestamp:        47,
+	bson.TypeRegex:            50,
+	bson.TypeDBPointer:        55,
+	bson.TypeJavaScript:       60,
+	bson.TypeCodeWithScope:    65,
+	bson.TypeMaxKey:           127,
+}
+
+// CompareValues compares any two BSON values per [BSON sort order]. This is
+// the same total order that the server uses to sort & index values, so it is
+// suitable for sorting or merge-joining values of arbitrary (and mixed)
+// types, e.g., `_id` values.
+//
+// In particular:
+//   - Values of different types compare by the types’ canonical order.
+//   - All numeric types compare by mathematical value, so int32(1), int64(1),
+//     1.0, and Decimal128 1.00 are all equal. NaN (whether double or
+//     Decimal128) sorts before all other numbers, and -0 equals 0.
+//   - Strings and symbols compare with each other bytewise (i.e., without
+//     collation).
+//   - Embedded documents & arrays compare element by element: first by
+//     canonical type, then by field name, then by value.
+//
+// An error is returned if either value is malformed or of an unknown type.
+//
+// [BSON sort order]: https://www.mongodb.com/docs/manual/reference/bson-type-comparison-order/
+func CompareValues(a, b bson.RawValue) (int, error) {
+	return valueComparer{}.compare(a, b)
+}
+
+// valueComparer implements BSON sort order. If compareStrings is set, it
+// replaces bytewise comparison of strings & symbols (e.g., for collation).
+type valueComparer struct {
+	compareStrings func(a, b []byte) int
+}
+
+func (vc valueComparer) compare(a, b bson.RawValue) (int, error) {
+	aOrder, ok := canonicalTypeOrder[a.Type]
+	if !ok {
+		return 0, fmt.Errorf("cannot compare unknown BSON type %s", a.Type)
+	}
+
+	bOrder, ok := canonicalTypeOrder[b.Type]
+	if !ok {
+		return 0, fmt.Errorf("cannot compare unknown BSON type %s", b.Type)
+	}
+
+	if ret := cmp.Compare(aOrder, bOrder); ret != 0 {
+		return ret, nil
+	}
+
+	return vc.compareSameCanonicalType(a, b)
+}
+
+//nolint:cyclop
+func (vc valueComparer) compareSameCanonicalType(a, b bson.RawValue) (int, error) {
+	switch a.Type {
+	case bson.TypeMinKey, bson.TypeMaxKey, bson.TypeUndefined, bson.TypeNull:
+		return 0, nil
+	case bson.TypeDouble, bson.TypeInt32, bson.TypeInt64, bson.TypeDecimal128:
+		return compareNumbers(a, b)
+	case bson.TypeString, bson.TypeSymbol:
+		return compareStringLike(a, b, vc.compareStrings)
+	case bson.TypeJavaScript:
+		return compareStringLike(a, b, nil)
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+		return vc.compareDocuments(a.Value, b.Value)
+	case bson.TypeBinary:
+		return CompareBinaries(a, b)
+	case bson.TypeObjectID:
+		return compareFixedWidth(a, b, 12)
+	case bson.TypeBoolean:
+		aBool, aOK := a.BooleanOK()
+		bBool, bOK := b.BooleanOK()
+		if !aOK || !bOK {
+			return 0, fmt.Errorf("invalid BSON %s", a.Type)
+		}
+
+		return cmp.Compare(boolToInt(aBool), boolToInt(bBool)), nil
+	case bson.TypeDateTime:
+		aTime, aOK := a.DateTimeOK()
+		bTime, bOK := b.DateTimeOK()
+		if !aOK || !bOK {
+			return 0, fmt.Errorf("invalid BSON %s", a.Type)
+		}
+
+		return cmp.Compare(aTime, bTime), nil
+	case bson.TypeTimestamp:
+		aT, aI, aOK := a.TimestampOK()
+		bT, bI, bOK := b.TimestampOK()
+		if !aOK || !bOK {
+			return 0, fmt.Errorf("invalid BSON %s", a.Type)
+		}
+
+		if ret := cmp.Compare(aT, bT); ret != 0 {
+			return ret, nil
+		}
+
+		return cmp.Compare(aI, bI), nil
+	case bson.TypeRegex:
+		return compareRegexes(a, b)
+	case bson.TypeDBPointer:
+		return compareDBPointers(a, b)
+	case bson.TypeCodeWithScope:
+		return vc.compareCodeWithScopes(a, b)
+	}
+
+	panic(fmt.Sprintf("missing comparison logic for BSON %s", a.Type))
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func compareFixedWidth(a, b bson.RawValue, width int) (int, error) {
+	if len(a.Value) != width || len(b.Value) != width {
+		return 0, fmt.Errorf(
+			"BSON %s must be %d bytes (found %d & %d)",
+			a.Type,
+			width,
+			len(a.Value),
+			len(b.Value),
+		)
+	}
+
+	return bytes.Compare(a.Value, b.Value), nil
+}
+
+func compareStringLike(a, b bson.RawValue, compareFn func(a, b []byte) int) (int, error) {
+	aBytes, err := readStringBytes(a.Value)
+	if err != nil {
+		return 0, fmt.Errorf("parsing BSON %s: %w", a.Type, err)
+	}
+
+	bBytes, err := readStringBytes(b.Value)
+	if err != nil {
+		return 0, fmt.Errorf("parsing BSON %s: %w", b.Type, err)
+	}
+
+	if compareFn == nil {
+		compareFn = bytes.Compare
+	}
+
+	return compareFn(aBytes, bBytes), nil
+}
+
+// compareDocuments compares two documents (or arrays) as the server’s
+// BSONObj::woCompare() does when it considers field names.
+func (vc valueComparer) compareDocuments(a, b []byte) (int, error) {
+	aRem, err := elementsBlock(a)
+	if err != nil {
+		return 0, err
+	}
+
+	bRem, err := elementsBlock(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		switch {
+		case len(aRem) == 0 && len(bRem) == 0:
+			return 0, nil
+		case len(aRem) == 0:
+			return -1, nil
+		case len(bRem) == 0:
+			return 1, nil
+		}
+
+		var aEl, bEl bsoncore.Element
+		var ok bool
+
+		aEl, aRem, ok = bsoncore.ReadElement(aRem)
+		if !ok {
+			return 0, bsoncore.NewInsufficientBytesError(a, aRem)
+		}
+
+		bEl, bRem, ok = bsoncore.ReadElement(bRem)
+		if !ok {
+			return 0, bsoncore.NewInsufficientBytesError(b, bRem)
+		}
+
+		ret, err := vc.compareElements(bson.RawElement(aEl), bson.RawElement(bEl))
+		if err != nil || ret != 0 {
+			return ret, err
+		}
+	}
+}
+
+// elementsBlock validates a BSON document’s framing (i.e., its length header
+// and trailing NUL) and returns the bytes in between.
+func elementsBlock(doc []byte) ([]byte, error) {
+	length, _, ok := bsoncore.ReadLength(doc)
+	if !ok || length < 5 || int(length) != len(doc) || doc[len(doc)-1] != 0 {
+		return nil, fmt.Errorf("invalid BSON document framing (%d bytes)", len(doc))
+	}
+
+	return doc[4 : len(doc)-1], nil
+}
+
+func (vc valueComparer) compareElements(a, b bson.RawElement) (int, error) {
+	aVal, err := a.ValueErr()
+	if err != nil {
+		return 0, err
+	}
+
+	bVal, err := b.ValueErr()
+	if err != nil {
+		return 0, err
+	}
+
+	aOrder, ok := canonicalTypeOrder[aVal.Type]
+	if !ok {
+		return 0, fmt.Errorf("cannot compare unknown BSON type %s", aVal.Type)
+	}
+
+	bOrder, ok := canonicalTypeOrder[bVal.Type]
+	if !ok {
+		return 0, fmt.Errorf("cannot compare unknown BSON type %s", bVal.Type)
+	}
+
+	if ret := cmp.Compare(aOrder, bOrder); ret != 0 {
+		return ret, nil
+	}
+
+	aKey := bsoncore.Element(a).KeyBytes()
+	bKey := bsoncore.Element(b).KeyBytes()
+
+	if ret := bytes.Compare(aKey, bKey); ret != 0 {
+		return ret, nil
+	}
+
+	ret, err := vc.compareSameCanonicalType(aVal, bVal)
+	if err != nil {
+		return 0, fmt.Errorf("comparing %#q: %w", aKey, err)
+	}
+
+	return ret, nil
+}
+
+func compareRegexes(a, b bson.RawValue) (int, error) {
+	aPattern, aOpts, aOK := a.RegexOK()
+	bPattern, bOpts, bOK := b.RegexOK()
+	if !aOK || !bOK {
+		return 0, fmt.Errorf("invalid BSON %s", a.Type)
+	}
+
+	if ret := cmp.Compare(aPattern, bPattern); ret != 0 {
+		return ret, nil
+	}
+
+	return cmp.Compare(aOpts, bOpts), nil
+}
+
+// The server compares DBPointers by namespace length first, then by the
+// namespace & ObjectID bytes.
+func compareDBPointers(a, b bson.RawValue) (int, error) {
+	aNS, aOID, aOK := a.DBPointerOK()
+	bNS, bOID, bOK := b.DBPointerOK()
+	if !aOK || !bOK {
+		return 0, fmt.Errorf("invalid BSON %s", a.Type)
+	}
+
+	if ret := cmp.Compare(len(aNS), len(bNS)); ret != 0 {
+		return ret, nil
+	}
+
+	if ret := cmp.Compare(aNS, bNS); ret != 0 {
+		return ret, nil
+	}
+
+	return bytes.Compare(aOID[:], bOID[:]), nil
+}
+
+func (vc valueComparer) compareCodeWithScopes(a, b bson.RawValue) (int, error) {
+	aCode, aScope, aOK := a.CodeWithScopeOK()
+	bCode, bScope, bOK := b.CodeWithScopeOK()
+	if !aOK || !bOK {
+		return 0, fmt.Errorf("invalid BSON %s", a.Type)
+	}
+
+	if ret := cmp.Compare(aCode, bCode); ret != 0 {
+		return ret, nil
+	}
+
+	ret, err := vc.compareDocuments(aScope, bScope)
+	if err != nil {
+		return 0, fmt.Errorf("comparing scopes: %w", err)
+	}
+
+	return ret, nil
+}
+
+// compareNumbers compares any two BSON numbers by their mathematical values.
+func compareNumbers(a, b bson.RawValue) (int, error) {
+	if a.Type == bson.TypeDecimal128 || b.Type == bson.TypeDecimal128 {
+		return compareNumbersAsDecimals(a, b)
+	}
+
+	if a.Type == bson.TypeDouble || b.Type == bson.TypeDouble {
+		return compareNumbersWithDouble(a, b)
+	}
+
+	aInt, aOK := a.AsInt64OK()
+	bInt, bOK := b.AsInt64OK()
+	if !aOK || !bOK {
+		return 0, fmt.Errorf("invalid BSON %s or %s", a.Type, b.Type)
+	}
+
+	return cmp.Compare(aInt, bInt), nil
+}
+
+func compareNumbersWithDouble(a, b bson.RawValue) (int, error) {
+	if a.Type == bson.TypeDouble && b.Type == bson.TypeDouble {
+		aFloat, aOK := a.DoubleOK()
+		bFloat, bOK := b.DoubleOK()
+		if !aOK || !bOK {
+			return 0, fmt.Errorf("invalid BSON %s", a.Type)
+		}
+
+		// NB: cmp.Compare sorts NaN first & considers -0 equal to 0,
+		// just as the server does.
+		return cmp.Compare(aFloat, bFloat), nil
+	}
+
+	if b.Type == bson.TypeDouble {
+		ret, err := compareNumbersWithDouble(b, a)
+		return -ret, err
+	}
+
+	// Now `a` is the double, and `b` is an integer.
+	aFloat, aOK := a.DoubleOK()
+	bInt, bOK := b.AsInt64OK()
+	if !aOK || !bOK {
+		return 0, fmt.Errorf("invalid BSON %s or %s", a.Type, b.Type)
+	}
+
+	return -compareInt64ToFloat64(bInt, aFloat), nil
+}
+
+// compareInt64ToFloat64 compares an int64 with a float64 exactly, i.e.,
+// without the precision loss of converting the int64 to a float64.
+func compareInt64ToFloat64(i int64, f float64) int {
+	switch {
+	case math.IsNaN(f):
+		return 1
+	case f >= math.MaxInt64:
+		// NB: float64(math.MaxInt64) is 2^63.
+		return -1
+	case f < math.MinInt64:
+		return 1
+	}
+
+	truncated := int64(f)
+	if ret := cmp.Compare(i, truncated); ret != 0 {
+		return ret
+	}
+
+	// The integer parts are equal, so the fractional part decides.
+	return cmp.Compare(0, f-float64(truncated))
+}
+
+// numericValue is an exact representation of any BSON number.
+type numericValue struct {
+	isNaN bool
+
+	// -1, 0, or 1
+	infSign int
+
+	rat *big.Rat
+}
+
+func (nv numericValue) compare(other numericValue) int {
+	switch {
+	case nv.isNaN || other.isNaN:
+		return cmp.Compare(boolToInt(!nv.isNaN), boolToInt(!other.isNaN))
+	case nv.infSign != 0 || other.infSign != 0:
+		return cmp.Compare(nv.infSign, other.infSign)
+	}
+
+	return nv.rat.Cmp(other.rat)
+}
+
+func toNumericValue(in bson.RawValue) (numericValue, error) {
+	switch in.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		i64, ok := in.AsInt64OK()
+		if !ok {
+			return numericValue{}, fmt.Errorf("invalid BSON %s", in.Type)
+		}
+
+		return numericValue{rat: new(big.Rat).SetInt64(i64)}, nil
+	case bson.TypeDouble:
+		f, ok := in.DoubleOK()
+		if !ok {
+			return numericValue{}, fmt.Errorf("invalid BSON %s", in.Type)
+		}
+
+		switch {
+		case math.IsNaN(f):
+			return numericValue{isNaN: true}, nil
+		case math.IsInf(f, 0):
+			return numericValue{infSign: cmp.Compare(f, 0)}, nil
+		}
+
+		return numericValue{rat: new(big.Rat).SetFloat64(f)}, nil
+	case bson.TypeDecimal128:
+		dec, ok := in.Decimal128OK()
+		if !ok {
+			return numericValue{}, fmt.Errorf("invalid BSON %s", in.Type)
+		}
+
+		parts := decomposeDecimal128(dec)
+
+		switch parts.form {
+		case decimalNaN:
+			return numericValue{isNaN: true}, nil
+		case decimalInf:
+			return numericValue{infSign: parts.sign()}, nil
+		}
+
+		return numericValue{rat: parts.rat()}, nil
+	}
+
+	return numericValue{}, fmt.Errorf("BSON %s is not numeric", in.Type)
+}
+
+// This is slower than the other numeric comparisons, but Decimal128 makes it
+// necessary. Every BSON number has an exact decimal value, so comparing
+// those is exact.
+func compareNumbersAsDecimals(a, b bson.RawValue) (int, error) {
+	aParts, err := toDecimalParts(a)
+	if err != nil {
+		return 0, err
+	}
+
+	bParts, err := toDecimalParts(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return aParts.compare(bParts), nil
+}
@@ -1,6 +1,8 @@
 package bsontools
 
 import (
+	"cmp"
+	"math"
 	"slices"
 	"testing"
 
@@ -118,3 +120,139 @@ func TestCompareStrings(t *testing.T) {
 		assert.Equal(t, cur.expect, got, "%v cmp %v", cur.a, cur.b)
 	}
 }
+
+func TestCompareValues(t *testing.T) {
+	oid1 := lo.Must(bson.ObjectIDFromHex("000000000000000000000001"))
+	oid2 := lo.Must(bson.ObjectIDFromHex("000000000000000000000002"))
+
+	// Each inner slice is a group of values that compare as equal. The groups
+	// are in ascending order.
+	expectedOrder := [][]any{
+		{bson.MinKey{}},
+		{bson.Undefined{}},
+		{bson.Null{}},
+		{math.NaN(), lo.Must(bson.ParseDecimal128("NaN"))},
+		{math.Inf(-1), lo.Must(bson.ParseDecimal128("-Infinity"))},
+		{lo.Must(bson.ParseDecimal128("-1E+400"))},
+		{int64(math.MinInt64)},
+		{int64(math.MinInt64) + 1},
+		{-1.5, lo.Must(bson.ParseDecimal128("-1.50"))},
+		{
+			int32(0),
+			int64(0),
+			0.0,
+			math.Copysign(0, -1),
+			lo.Must(bson.ParseDecimal128("0")),
+			lo.Must(bson.ParseDecimal128("-0.00")),
+		},
+		{lo.Must(bson.ParseDecimal128("0.1"))},
+		{0.1}, // float64(0.1) is slightly more than 1/10.
+		{int32(1), int64(1), 1.0, lo.Must(bson.ParseDecimal128("1.000"))},
+		{1.5},
+		{int64(1<<53 + 1)},
+		{float64(1<<53 + 2)},
+		{int64(math.MaxInt64)},
+		{lo.Must(bson.ParseDecimal128("9223372036854775807.5"))},
+		{float64(math.MaxInt64), lo.Must(bson.ParseDecimal128("9.223372036854775808E+18"))}, // i.e., 2^63
+		{lo.Must(bson.ParseDecimal128("1E+400"))},
+		{math.Inf(1), lo.Must(bson.ParseDecimal128("Infinity"))},
+		{"", bson.Symbol("")},
+		{"a", bson.Symbol("a")},
+		{"ab"},
+		{"b"},
+		{bson.D{}},
+		{bson.D{{"a", nil}}},
+		{bson.D{{"a", int32(1)}}, bson.D{{"a", 1.0}}},
+		{bson.D{{"a", int32(1)}, {"b", nil}}},
+		// Canonical type takes precedence over field name.
+		{bson.D{{"b", int32(0)}}},
+		{bson.D{{"a", "x"}}},
+		{bson.D{{"b", "a"}}},
+		{bson.A{}},
+		{bson.A{int32(1)}},
+		{bson.A{int32(1), int32(2)}},
+		{bson.A{int32(2)}},
+		{bson.Binary{Data: []byte("z")}},
+		{bson.Binary{Subtype: 4, Data: []byte("a")}},
+		{bson.Binary{Data: []byte("aa")}},
+		{oid1},
+		{oid2},
+		{false},
+		{true},
+		{bson.DateTime(-1)},
+		{bson.DateTime(0)},
+		{bson.Timestamp{T: 1, I: 2}},
+		{bson.Timestamp{T: 2, I: 1}},
+		{bson.Regex{Pattern: "a", Options: "i"}},
+		{bson.Regex{Pattern: "a", Options: "m"}},
+		{bson.Regex{Pattern: "b"}},
+		{bson.DBPointer{DB: "zz", Pointer: oid1}},
+		{bson.DBPointer{DB: "aaa", Pointer: oid1}},
+		{bson.DBPointer{DB: "aaa", Pointer: oid2}},
+		{bson.JavaScript("a")},
+		{bson.JavaScript("b")},
+		{bson.CodeWithScope{Code: "a", Scope: bson.D{{"x", int32(2)}}}},
+		{bson.CodeWithScope{Code: "a", Scope: bson.D{{"x", int32(3)}}}},
+		{bson.CodeWithScope{Code: "b", Scope: bson.D{}}},
+		{bson.MaxKey{}},
+	}
+
+	type rankedValue struct {
+		rank int
+		val  any
+		rv   bson.RawValue
+	}
+
+	var values []rankedValue
+
+	for rank, group := range expectedOrder {
+		for _, val := range group {
+			bType, buf, err := bson.MarshalValue(val)
+			require.NoError(t, err, "marshal %v", val)
+
+			values = append(values, rankedValue{
+				rank: rank,
+				val:  val,
+				rv:   bson.RawValue{Type: bType, Value: buf},
+			})
+		}
+	}
+
+	for _, a := range values {
+		for _, b := range values {
+			got, err := CompareValues(a.rv, b.rv)
+			require.NoError(t, err, "compare %v & %v", a.val, b.val)
+
+			assert.Equal(
+				t,
+				cmp.Compare(a.rank, b.rank),
+				got,
+				"%v (%s) cmp %v (%s)",
+				a.val,
+				a.rv.Type,
+				b.val,
+				b.rv.Type,
+			)
+		}
+	}
+}
+
+func TestCompareValues_Errors(t *testing.T) {
+	_, err := CompareValues(
+		bson.RawValue{Type: bson.TypeString, Value: []byte{1, 0}},
+		ToRawValue("abc"),
+	)
+	assert.Error(t, err, "malformed string")
+
+	_, err = CompareValues(
+		bson.RawValue{Type: bson.Type(0x77)},
+		ToRawValue("abc"),
+	)
+	assert.ErrorContains(t, err, "unknown")
+
+	_, err = CompareValues(
+		bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: []byte{5, 0, 0, 0, 1}},
+		ToRawValue(bson.Raw{5, 0, 0, 0, 0}),
+	)
+	assert.Error(t, err, "malformed document")
+}
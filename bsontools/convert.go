@@ -0,0 +1,400 @@
+package bsontools
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb-labs/migration-tools/option"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ConversionError indicates that a value cannot be converted to the
+// requested type, as the server’s `$convert` would fail.
+type ConversionError struct {
+	From, To bson.Type
+
+	// Reason describes why the conversion failed.
+	Reason string
+}
+
+func (ce ConversionError) Error() string {
+	return fmt.Sprintf("cannot convert %s to %s: %s", ce.From, ce.To, ce.Reason)
+}
+
+// ConvertOptions configures Convert. These correspond to `$convert`’s
+// arguments of the same names.
+type ConvertOptions struct {
+	// OnError, if set, is returned in lieu of a ConversionError.
+	OnError option.Option[bson.RawValue]
+
+	// OnNull, if set, is returned when the value is null, undefined, or
+	// missing. Otherwise such values convert to null.
+	OnNull option.Option[bson.RawValue]
+}
+
+// Convert converts a BSON value to the target type with the semantics of
+// the server’s `$convert` aggregation operator. Unlike RawValueTo, this
+// coerces between types:
+//   - Doubles & Decimal128s truncate toward zero when converted to
+//     integers or dates. Non-finite or out-of-range values fail.
+//   - Strings parse as base-10 numbers; hexadecimal, underscores, and
+//     (for integer targets) fractions fail.
+//   - Strings parse as ISO-8601 dates & as hex ObjectIDs.
+//   - Everything converts to bool per the server’s truthiness rules.
+//
+// The supported targets are double, string, ObjectID, bool, date, int32,
+// int64, and Decimal128. A zero-value bson.RawValue denotes a missing
+// value, which (like null & undefined) converts to null.
+//
+// Failed conversions return ConversionError, unless opts.OnError is set.
+// Other errors (e.g., from malformed BSON) are returned regardless.
+//
+// Example usage:
+//
+//	i32Val, err := bsontools.Convert(val, bson.TypeInt32, bsontools.ConvertOptions{})
+func Convert(val bson.RawValue, target bson.Type, opts ConvertOptions) (bson.RawValue, error) {
+	switch target {
+	case bson.TypeDouble, bson.TypeString, bson.TypeObjectID, bson.TypeBoolean,
+		bson.TypeDateTime, bson.TypeInt32, bson.TypeInt64, bson.TypeDecimal128:
+	default:
+		return bson.RawValue{}, fmt.Errorf("unsupported conversion target: %s", target)
+	}
+
+	if isNullish(val) {
+		return opts.OnNull.OrElse(nullValue), nil
+	}
+
+	result, err := convertValue(val, target)
+
+	var convErr ConversionError
+	if onError, hasOnError := opts.OnError.Get(); hasOnError && errors.As(err, &convErr) {
+		return onError, nil
+	}
+
+	return result, err
+}
+
+func conversionError(val bson.RawValue, target bson.Type, reason string) error {
+	return ConversionError{From: val.Type, To: target, Reason: reason}
+}
+
+func unsupportedConversion(val bson.RawValue, target bson.Type) error {
+	return conversionError(val, target, "unsupported conversion")
+}
+
+// convertValue converts a non-nullish value to the given type with the
+// semantics of the server’s $convert. Conversion failures are returned as
+// ConversionError.
+func convertValue(val bson.RawValue, target bson.Type) (bson.RawValue, error) {
+	if val.Type == target {
+		return val, nil
+	}
+
+	switch target {
+	case bson.TypeDouble:
+		return convertToDouble(val)
+	case bson.TypeString:
+		return convertToString(val)
+	case bson.TypeObjectID:
+		return convertToObjectID(val)
+	case bson.TypeBoolean:
+		return convertToBool(val)
+	case bson.TypeDateTime:
+		return convertToDate(val)
+	case bson.TypeInt32, bson.TypeInt64:
+		return convertToInteger(val, target)
+	case bson.TypeDecimal128:
+		return convertToDecimal(val)
+	}
+
+	return bson.RawValue{}, unsupportedConversion(val, target)
+}
+
+func convertToDouble(val bson.RawValue) (bson.RawValue, error) {
+	switch val.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		return ToRawValue(val.AsFloat64()), nil
+	case bson.TypeDecimal128:
+		dec := val.Decimal128()
+
+		f, _ := Decimal128ToFloat64(dec, big.ToNearestEven)
+		if math.IsInf(f, 0) && dec.IsInf() == 0 {
+			return bson.RawValue{}, conversionError(val, bson.TypeDouble, "value is out of range")
+		}
+
+		return ToRawValue(f), nil
+	case bson.TypeBoolean:
+		return ToRawValue(float64(boolToInt(val.Boolean()))), nil
+	case bson.TypeDateTime:
+		return ToRawValue(float64(val.DateTime())), nil
+	case bson.TypeString:
+		str := val.StringValue()
+
+		if special, ok := parseSpecialFloat(str); ok {
+			return ToRawValue(special), nil
+		}
+
+		if !numericStringRegex.MatchString(str) {
+			return bson.RawValue{}, conversionError(val, bson.TypeDouble, fmt.Sprintf("cannot parse %#q", str))
+		}
+
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return bson.RawValue{}, conversionError(val, bson.TypeDouble, fmt.Sprintf("%#q is out of range", str))
+		}
+
+		return ToRawValue(f), nil
+	}
+
+	return bson.RawValue{}, unsupportedConversion(val, bson.TypeDouble)
+}
+
+// numericStringRegex matches the decimal number strings that $convert
+// parses. Unlike strconv, it rejects hexadecimal & underscores.
+var numericStringRegex = regexp.MustCompile(`^[+-]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][+-]?[0-9]+)?$`)
+
+// integerStringRegex matches the integer strings that $convert parses.
+var integerStringRegex = regexp.MustCompile(`^[+-]?[0-9]+$`)
+
+func parseSpecialFloat(str string) (float64, bool) {
+	switch strings.ToLower(str) {
+	case "nan", "+nan", "-nan":
+		return math.NaN(), true
+	case "inf", "+inf", "infinity", "+infinity":
+		return math.Inf(1), true
+	case "-inf", "-infinity":
+		return math.Inf(-1), true
+	}
+
+	return 0, false
+}
+
+func convertToString(val bson.RawValue) (bson.RawValue, error) {
+	var str string
+
+	switch val.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		str = strconv.FormatInt(val.AsInt64(), 10)
+	case bson.TypeDouble:
+		str = formatExprDouble(val.Double())
+	case bson.TypeDecimal128:
+		str = val.Decimal128().String()
+	case bson.TypeBoolean:
+		str = strconv.FormatBool(val.Boolean())
+	case bson.TypeDateTime:
+		str = val.Time().UTC().Format("2006-01-02T15:04:05.000Z")
+	case bson.TypeObjectID:
+		str = val.ObjectID().Hex()
+	case bson.TypeSymbol:
+		str = val.Symbol()
+	default:
+		return bson.RawValue{}, unsupportedConversion(val, bson.TypeString)
+	}
+
+	return ToRawValue(str), nil
+}
+
+// formatExprDouble formats a double as the server does when converting it
+// to a string: the shortest representation that round-trips, in fixed
+// notation if the decimal exponent is in [-4, 16) and in exponential
+// notation otherwise.
+func formatExprDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	sci := strconv.FormatFloat(f, 'e', -1, 64)
+
+	exp := lo.Must(strconv.Atoi(sci[strings.IndexByte(sci, 'e')+1:]))
+	if exp >= -4 && exp < 16 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	return sci
+}
+
+func convertToObjectID(val bson.RawValue) (bson.RawValue, error) {
+	if val.Type != bson.TypeString {
+		return bson.RawValue{}, unsupportedConversion(val, bson.TypeObjectID)
+	}
+
+	oid, err := bson.ObjectIDFromHex(val.StringValue())
+	if err != nil {
+		return bson.RawValue{}, conversionError(val, bson.TypeObjectID, fmt.Sprintf("cannot parse %#q", val.StringValue()))
+	}
+
+	return ToRawValue(oid), nil
+}
+
+func convertToBool(val bson.RawValue) (bson.RawValue, error) {
+	truthy, err := isTruthy(val)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	return ToRawValue(truthy), nil
+}
+
+// dateStringLayouts are the formats that $convert parses as dates.
+var dateStringLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+func convertToDate(val bson.RawValue) (bson.RawValue, error) {
+	switch val.Type {
+	case bson.TypeInt64:
+		return ToRawValue(bson.DateTime(val.Int64())), nil
+	case bson.TypeDouble, bson.TypeDecimal128:
+		millis, err := truncateToInt64(val, bson.TypeDateTime)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+
+		return ToRawValue(bson.DateTime(millis)), nil
+	case bson.TypeTimestamp:
+		t, _ := val.Timestamp()
+
+		return ToRawValue(bson.DateTime(int64(t) * 1000)), nil
+	case bson.TypeObjectID:
+		return ToRawValue(bson.NewDateTimeFromTime(val.ObjectID().Timestamp())), nil
+	case bson.TypeString:
+		for _, layout := range dateStringLayouts {
+			t, err := time.Parse(layout, val.StringValue())
+			if err == nil {
+				return ToRawValue(bson.NewDateTimeFromTime(t)), nil
+			}
+		}
+
+		return bson.RawValue{}, conversionError(val, bson.TypeDateTime, fmt.Sprintf("cannot parse %#q", val.StringValue()))
+	}
+
+	return bson.RawValue{}, unsupportedConversion(val, bson.TypeDateTime)
+}
+
+// truncateToInt64 truncates a double or Decimal128 toward zero. Non-finite
+// and out-of-range values are conversion errors.
+func truncateToInt64(val bson.RawValue, target bson.Type) (int64, error) {
+	if val.Type == bson.TypeDouble {
+		f := val.Double()
+
+		switch {
+		case math.IsNaN(f) || math.IsInf(f, 0):
+			return 0, conversionError(val, target, "value is not finite")
+		case f < math.MinInt64 || f >= math.MaxInt64:
+			// NB: float64(math.MaxInt64) is 2^63.
+			return 0, conversionError(val, target, "value is out of range")
+		}
+
+		return int64(f), nil
+	}
+
+	dec := val.Decimal128()
+	if dec.IsNaN() || dec.IsInf() != 0 {
+		return 0, conversionError(val, target, "value is not finite")
+	}
+
+	i64, _, err := Decimal128ToInt64(dec, big.ToZero)
+	if err != nil {
+		return 0, conversionError(val, target, "value is out of range")
+	}
+
+	return i64, nil
+}
+
+func convertToInteger(val bson.RawValue, target bson.Type) (bson.RawValue, error) {
+	var i64 int64
+
+	switch val.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		i64 = val.AsInt64()
+	case bson.TypeDouble, bson.TypeDecimal128:
+		var err error
+
+		i64, err = truncateToInt64(val, target)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+	case bson.TypeBoolean:
+		i64 = int64(boolToInt(val.Boolean()))
+	case bson.TypeDateTime:
+		if target != bson.TypeInt64 {
+			return bson.RawValue{}, unsupportedConversion(val, target)
+		}
+
+		i64 = val.DateTime()
+	case bson.TypeString:
+		str := val.StringValue()
+
+		parsed, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || !integerStringRegex.MatchString(str) {
+			return bson.RawValue{}, conversionError(val, target, fmt.Sprintf("cannot parse %#q", str))
+		}
+
+		i64 = parsed
+	default:
+		return bson.RawValue{}, unsupportedConversion(val, target)
+	}
+
+	if target == bson.TypeInt64 {
+		return ToRawValue(i64), nil
+	}
+
+	if i64 != int64(int32(i64)) {
+		return bson.RawValue{}, conversionError(val, target, "value is out of range")
+	}
+
+	return ToRawValue(int32(i64)), nil
+}
+
+func convertToDecimal(val bson.RawValue) (bson.RawValue, error) {
+	var str string
+
+	switch val.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		str = strconv.FormatInt(val.AsInt64(), 10)
+	case bson.TypeDouble:
+		// As with the server, doubles are rounded to 15 significant digits.
+		f := val.Double()
+
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			str = formatExprDouble(f)
+		} else {
+			str = strconv.FormatFloat(f, 'E', 14, 64)
+		}
+	case bson.TypeBoolean:
+		str = strconv.Itoa(boolToInt(val.Boolean()))
+	case bson.TypeDateTime:
+		str = strconv.FormatInt(val.DateTime(), 10)
+	case bson.TypeString:
+		str = val.StringValue()
+
+		if _, ok := parseSpecialFloat(str); !ok && !numericStringRegex.MatchString(str) {
+			return bson.RawValue{}, conversionError(val, bson.TypeDecimal128, fmt.Sprintf("cannot parse %#q", str))
+		}
+	default:
+		return bson.RawValue{}, unsupportedConversion(val, bson.TypeDecimal128)
+	}
+
+	dec, err := bson.ParseDecimal128(str)
+	if err != nil {
+		return bson.RawValue{}, conversionError(val, bson.TypeDecimal128, fmt.Sprintf("cannot parse %#q", str))
+	}
+
+	return ToRawValue(dec), nil
+}
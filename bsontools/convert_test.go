@@ -0,0 +1,139 @@
+package bsontools
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb-labs/migration-tools/option"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestConvert(t *testing.T) {
+	date := bson.NewDateTimeFromTime(time.Date(2024, 5, 6, 7, 8, 9, 123_000_000, time.UTC))
+	oid := lo.Must(bson.ObjectIDFromHex("65f1e0d2a1b2c3d4e5f60718"))
+	dec := func(str string) bson.Decimal128 {
+		return lo.Must(bson.ParseDecimal128(str))
+	}
+
+	cases := []struct {
+		input    any
+		target   bson.Type
+		expected any
+	}{
+		{int32(5), bson.TypeInt32, int32(5)},
+		{int64(5), bson.TypeInt32, int32(5)},
+		{2.9, bson.TypeInt32, int32(2)},
+		{-2.9, bson.TypeInt32, int32(-2)},
+		{dec("-7.5"), bson.TypeInt64, int64(-7)},
+		{true, bson.TypeInt32, int32(1)},
+		{"+12", bson.TypeInt32, int32(12)},
+		{"-9000000000", bson.TypeInt64, int64(-9_000_000_000)},
+		{date, bson.TypeInt64, int64(date)},
+		{int32(-1), bson.TypeDouble, -1.0},
+		{"1e3", bson.TypeDouble, 1000.0},
+		{".5", bson.TypeDouble, 0.5},
+		{"-Infinity", bson.TypeDouble, math.Inf(-1)},
+		{dec("1.5"), bson.TypeDouble, 1.5},
+		{date, bson.TypeDouble, float64(date)},
+		{0.1, bson.TypeDecimal128, dec("0.100000000000000")},
+		{int64(math.MaxInt64), bson.TypeDecimal128, dec("9223372036854775807")},
+		{"1.50", bson.TypeDecimal128, dec("1.50")},
+		{1e21, bson.TypeString, "1e+21"},
+		{1e6, bson.TypeString, "1000000"},
+		{123456789.0, bson.TypeString, "123456789"},
+		{1e15 + 0.5, bson.TypeString, "1000000000000000.5"},
+		{1e16, bson.TypeString, "1e+16"},
+		{0.0001, bson.TypeString, "0.0001"},
+		{0.00001, bson.TypeString, "1e-05"},
+		{int64(-3), bson.TypeString, "-3"},
+		{dec("1.50"), bson.TypeString, "1.50"},
+		{false, bson.TypeString, "false"},
+		{date, bson.TypeString, "2024-05-06T07:08:09.123Z"},
+		{oid, bson.TypeString, "65f1e0d2a1b2c3d4e5f60718"},
+		{"65f1e0d2a1b2c3d4e5f60718", bson.TypeObjectID, oid},
+		{"2024-05-06T07:08:09.123Z", bson.TypeDateTime, date},
+		{"2024-05-06T09:08:09.123+02:00", bson.TypeDateTime, date},
+		{int64(date), bson.TypeDateTime, date},
+		{float64(date) + 0.5, bson.TypeDateTime, date},
+		{oid, bson.TypeDateTime, bson.NewDateTimeFromTime(oid.Timestamp())},
+		{math.NaN(), bson.TypeBoolean, true},
+		{dec("-0"), bson.TypeBoolean, false},
+		{"", bson.TypeBoolean, true},
+		{bson.D{}, bson.TypeBoolean, true},
+	}
+
+	for _, c := range cases {
+		input := marshalTestValue(t, c.input)
+
+		result, err := Convert(input, c.target, ConvertOptions{})
+
+		require.NoError(t, err, "%v to %s", input, c.target)
+
+		expected := marshalTestValue(t, c.expected)
+		assert.Equal(t, expected.Type, result.Type, "%v to %s", input, c.target)
+		assert.Equal(t, expected.Value, result.Value, "%v to %s: got %v", input, c.target, result)
+	}
+}
+
+func TestConvert_Errors(t *testing.T) {
+	cases := []struct {
+		input  any
+		target bson.Type
+	}{
+		{int64(math.MaxInt32) + 1, bson.TypeInt32},
+		{float64(math.MinInt32) - 1, bson.TypeInt32},
+		{1e19, bson.TypeInt64},
+		{math.Inf(1), bson.TypeInt64},
+		{math.NaN(), bson.TypeDateTime},
+		{"1.5", bson.TypeInt32},
+		{"0x10", bson.TypeInt64},
+		{"1_000", bson.TypeDouble},
+		{"abc", bson.TypeDecimal128},
+		{"not a date", bson.TypeDateTime},
+		{"65f1e0d2", bson.TypeObjectID},
+		{" 12", bson.TypeDouble},
+		{bson.DateTime(0), bson.TypeInt32},
+		{bson.A{}, bson.TypeString},
+		{int32(1), bson.TypeObjectID},
+	}
+
+	for _, c := range cases {
+		input := marshalTestValue(t, c.input)
+
+		_, err := Convert(input, c.target, ConvertOptions{})
+
+		var convErr ConversionError
+		require.True(t, errors.As(err, &convErr), "%v to %s: %v", input, c.target, err)
+		assert.Equal(t, input.Type, convErr.From, "%v to %s", input, c.target)
+		assert.Equal(t, c.target, convErr.To, "%v to %s", input, c.target)
+
+		fallback := ToRawValue("fallback")
+
+		result, err := Convert(input, c.target, ConvertOptions{OnError: option.Some(fallback)})
+		require.NoError(t, err, "%v to %s with onError", input, c.target)
+		assert.Equal(t, fallback, result, "%v to %s with onError", input, c.target)
+	}
+}
+
+func TestConvert_Null(t *testing.T) {
+	for _, input := range []bson.RawValue{{}, nullValue, {Type: bson.TypeUndefined}} {
+		result, err := Convert(input, bson.TypeInt32, ConvertOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, bson.TypeNull, result.Type, "%v", input)
+
+		result, err = Convert(input, bson.TypeInt32, ConvertOptions{
+			OnNull:  option.Some(ToRawValue(int32(0))),
+			OnError: option.Some(ToRawValue("error")),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, ToRawValue(int32(0)), result, "%v", input)
+	}
+
+	_, err := Convert(nullValue, bson.TypeArray, ConvertOptions{})
+	assert.Error(t, err, "unsupported target should fail even for null")
+}
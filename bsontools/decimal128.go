@@ -0,0 +1,794 @@
+package bsontools
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// maxDecimal128Digits is Decimal128’s precision in decimal digits.
+const maxDecimal128Digits = 34
+
+const decimal128SignBit = uint64(1) << 63
+
+// Decimal128’s maximum coefficient, 10^34-1, as 64-bit halves.
+const (
+	maxDecimal128CoefHigh = 0x1ED09BEAD87C0
+	maxDecimal128CoefLow  = 0x378D8E63FFFFFFFF
+)
+
+var (
+	decimal128NaN    = bson.NewDecimal128(0x1F<<58, 0)
+	decimal128PosInf = bson.NewDecimal128(0x1E<<58, 0)
+	decimal128NegInf = bson.NewDecimal128(decimal128SignBit|0x1E<<58, 0)
+)
+
+// Decimal128IsZero indicates whether a Decimal128 is numerically zero. This
+// includes negative zero and zeros of every exponent (e.g., 0E+3 & -0.00).
+func Decimal128IsZero(dec bson.Decimal128) bool {
+	if dec.IsNaN() || dec.IsInf() != 0 {
+		return false
+	}
+
+	high, low := dec.GetBytes()
+
+	// A coefficient encoded with the “11” combination-field prefix exceeds
+	// Decimal128’s maximum, so the spec says to treat it as zero.
+	if high>>61&3 == 3 {
+		return true
+	}
+
+	coefHigh := high & (1<<49 - 1)
+
+	switch {
+	case coefHigh == 0 && low == 0:
+		return true
+	case coefHigh > maxDecimal128CoefHigh:
+		// Likewise for other coefficients that exceed the maximum.
+		return true
+	case coefHigh == maxDecimal128CoefHigh:
+		return low > maxDecimal128CoefLow
+	}
+
+	return false
+}
+
+// CompareDecimal128 compares two Decimal128s by their numeric values, as the
+// server does. Thus, NaN sorts before all other values (and equals itself),
+// -0 equals 0, and members of a cohort are equal (e.g., 1.0 & 1.00).
+//
+// It returns -1 if a < b, 0 if a == b, or 1 if a > b.
+func CompareDecimal128(a, b bson.Decimal128) int {
+	return decomposeDecimal128(a).compare(decomposeDecimal128(b))
+}
+
+// decimalStringRegex matches the finite decimal strings that
+// ParseDecimal128 accepts.
+var decimalStringRegex = regexp.MustCompile(`^([+-]?)([0-9]*)(?:\.([0-9]*))?(?:[eE]([+-]?[0-9]+))?$`)
+
+// ParseDecimal128 parses a decimal string as the server does. Unlike
+// bson.ParseDecimal128, which rejects values that Decimal128 can’t represent
+// exactly, this rounds such values by the given mode. (The server rounds
+// ToNearestEven.) The returned accuracy indicates the direction of any
+// rounding.
+//
+// Along with decimal & scientific notation, this accepts “NaN”, “Inf”, &
+// “Infinity”, case-insensitively and with an optional sign.
+//
+// The coefficient’s trailing zeros are preserved; e.g., “1.50” parses to
+// 150E-2 rather than 15E-1.
+func ParseDecimal128(str string, mode big.RoundingMode) (bson.Decimal128, big.Accuracy, error) {
+	unsigned := strings.TrimLeft(str, "+-")
+
+	if len(str)-len(unsigned) <= 1 {
+		switch strings.ToLower(unsigned) {
+		case "nan":
+			return decimal128NaN, big.Exact, nil
+		case "inf", "infinity":
+			if str[0] == '-' {
+				return decimal128NegInf, big.Exact, nil
+			}
+
+			return decimal128PosInf, big.Exact, nil
+		}
+	}
+
+	matches := decimalStringRegex.FindStringSubmatch(str)
+	if matches == nil || len(matches[2])+len(matches[3]) == 0 {
+		return bson.Decimal128{}, big.Exact, fmt.Errorf("cannot parse %#q as %s", str, bson.TypeDecimal128)
+	}
+
+	coef, _ := new(big.Int).SetString(matches[2]+matches[3], 10)
+
+	var exp int64
+
+	if matches[4] != "" {
+		// On overflow this yields the extreme int32, which is far enough
+		// beyond Decimal128’s range to round correctly.
+		exp, _ = strconv.ParseInt(matches[4], 10, 32)
+	}
+
+	parts := decimalParts{
+		negative: matches[1] == "-",
+		coef:     coef,
+		exp:      int(exp) - len(matches[3]),
+	}
+
+	dec, acc := parts.toDecimal128(mode)
+
+	return dec, acc, nil
+}
+
+// FormatDecimal128Fixed formats a Decimal128 in fixed-point notation, i.e.,
+// without an exponent. For example, 1.50E+3 formats as “1500”, and 1E-7 as
+// “0.0000001”. NaN & infinities format as bson.Decimal128.String does.
+//
+// (bson.Decimal128.String gives the canonical, possibly-scientific form
+// that the server & Extended JSON use.)
+func FormatDecimal128Fixed(dec bson.Decimal128) string {
+	parts := decomposeDecimal128(dec)
+	if parts.form != decimalFinite {
+		return dec.String()
+	}
+
+	digits := parts.coef.Text(10)
+
+	switch {
+	case parts.exp > 0:
+		if parts.coef.Sign() != 0 {
+			digits += strings.Repeat("0", parts.exp)
+		}
+	case parts.exp < 0:
+		fracLen := -parts.exp
+		if len(digits) <= fracLen {
+			digits = strings.Repeat("0", fracLen-len(digits)+1) + digits
+		}
+
+		digits = digits[:len(digits)-fracLen] + "." + digits[len(digits)-fracLen:]
+	}
+
+	if parts.negative {
+		return "-" + digits
+	}
+
+	return digits
+}
+
+// Decimal128FromInt64 converts an int64 to a Decimal128. This is always
+// exact.
+func Decimal128FromInt64(i64 int64) bson.Decimal128 {
+	dec, acc := decimalParts{
+		negative: i64 < 0,
+		coef:     new(big.Int).Abs(big.NewInt(i64)),
+	}.toDecimal128(big.ToNearestEven)
+
+	lo.Assertf(acc == big.Exact, "int64 %d must convert exactly", i64)
+
+	return dec
+}
+
+// Decimal128FromFloat64 converts a float64’s exact binary value to a
+// Decimal128, rounding by the given mode if the value needs more than 34
+// digits. For example, 0.1 converts to
+// 0.1000000000000000055511151231257827 (rounded down).
+//
+// NB: This differs from the server’s `$toDecimal`, which rounds doubles to
+// 15 digits.
+func Decimal128FromFloat64(f float64, mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	return floatToDecimalParts(f).toDecimal128(mode)
+}
+
+// Decimal128ToInt64 converts a Decimal128 to an int64, rounding any
+// fractional part by the given mode. (The server’s `$toLong` truncates,
+// i.e., rounds ToZero.) It fails if the Decimal128 is NaN, infinite, or
+// outside int64’s range after rounding.
+func Decimal128ToInt64(dec bson.Decimal128, mode big.RoundingMode) (int64, big.Accuracy, error) {
+	parts := decomposeDecimal128(dec)
+	if parts.form != decimalFinite {
+		return 0, big.Exact, fmt.Errorf("%s %s is not finite", bson.TypeDecimal128, dec)
+	}
+
+	coef, acc := parts.coef, big.Exact
+
+	switch {
+	case coef.Sign() == 0:
+		return 0, big.Exact, nil
+	case parts.exp > 0:
+		// Skip obviously-too-large scaling.
+		if decimalDigits(coef)+parts.exp > len(strconv.FormatInt(math.MaxInt64, 10)) {
+			return 0, big.Exact, fmt.Errorf("%s %s exceeds %T’s range", bson.TypeDecimal128, dec, int64(0))
+		}
+
+		coef = new(big.Int).Mul(coef, pow10(parts.exp))
+	case parts.exp < 0:
+		coef, acc = dropDecimalDigits(coef, parts.negative, -parts.exp, mode)
+	}
+
+	if parts.negative {
+		coef = new(big.Int).Neg(coef)
+	}
+
+	if !coef.IsInt64() {
+		return 0, big.Exact, fmt.Errorf("%s %s exceeds %T’s range", bson.TypeDecimal128, dec, int64(0))
+	}
+
+	return coef.Int64(), acc, nil
+}
+
+// Decimal128ToFloat64 converts a Decimal128 to the float64 that the given
+// rounding mode selects. Values beyond
+// float64’s range round to an infinity or to ±math.MaxFloat64, per the mode.
+// NaN & infinities convert exactly.
+func Decimal128ToFloat64(dec bson.Decimal128, mode big.RoundingMode) (float64, big.Accuracy) {
+	parts := decomposeDecimal128(dec)
+
+	switch parts.form {
+	case decimalNaN:
+		return math.NaN(), big.Exact
+	case decimalInf:
+		return math.Inf(lo.Ternary(parts.negative, -1, 1)), big.Exact
+	}
+
+	if parts.coef.Sign() == 0 {
+		return math.Copysign(0, lo.Ternary(parts.negative, -1.0, 1.0)), big.Exact
+	}
+
+	return ratToFloat64(parts.rat(), mode)
+}
+
+// AddDecimal128 adds two Decimal128s per IEEE 754, as the server does. The
+// exact sum is rounded to 34 digits by the given mode. (The server rounds
+// ToNearestEven.) Exact sums keep the smaller of the operands’ exponents,
+// so 1.10 + 1 is 2.10.
+func AddDecimal128(a, b bson.Decimal128, mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	return addDecimalParts(decomposeDecimal128(a), decomposeDecimal128(b), mode)
+}
+
+// SubtractDecimal128 is like AddDecimal128 but subtracts b from a.
+func SubtractDecimal128(a, b bson.Decimal128, mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	bParts := decomposeDecimal128(b)
+	bParts.negative = !bParts.negative
+
+	return addDecimalParts(decomposeDecimal128(a), bParts, mode)
+}
+
+// MultiplyDecimal128 multiplies two Decimal128s, rounding as AddDecimal128
+// does. Exact products’ exponents are the sum of the operands’ exponents, so
+// 1.10 × 3 is 3.30.
+func MultiplyDecimal128(a, b bson.Decimal128, mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	aParts, bParts := decomposeDecimal128(a), decomposeDecimal128(b)
+	negative := aParts.negative != bParts.negative
+
+	switch {
+	case aParts.form == decimalNaN || bParts.form == decimalNaN:
+		return decimal128NaN, big.Exact
+	case aParts.form == decimalInf || bParts.form == decimalInf:
+		if aParts.sign() == 0 || bParts.sign() == 0 {
+			return decimal128NaN, big.Exact
+		}
+
+		return lo.Ternary(negative, decimal128NegInf, decimal128PosInf), big.Exact
+	}
+
+	return decimalParts{
+		negative: negative,
+		coef:     new(big.Int).Mul(aParts.coef, bParts.coef),
+		exp:      aParts.exp + bParts.exp,
+	}.toDecimal128(mode)
+}
+
+// DivideDecimal128 divides a by b, rounding as AddDecimal128 does. Exact
+// quotients’ exponents are as close as possible to the difference of the
+// operands’ exponents, so 6.00 ÷ 2 is 3.00, and 1 ÷ 4 is 0.25. As IEEE 754
+// requires, dividing a nonzero number by zero yields an infinity, and 0 ÷ 0
+// yields NaN.
+func DivideDecimal128(a, b bson.Decimal128, mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	aParts, bParts := decomposeDecimal128(a), decomposeDecimal128(b)
+	negative := aParts.negative != bParts.negative
+
+	switch {
+	case aParts.form == decimalNaN || bParts.form == decimalNaN:
+		return decimal128NaN, big.Exact
+	case aParts.form == decimalInf && bParts.form == decimalInf:
+		return decimal128NaN, big.Exact
+	case aParts.form == decimalInf:
+		return lo.Ternary(negative, decimal128NegInf, decimal128PosInf), big.Exact
+	case bParts.form == decimalInf:
+		return decimalParts{
+			negative: negative,
+			coef:     new(big.Int),
+			exp:      bson.MinDecimal128Exp,
+		}.toDecimal128(mode)
+	case bParts.coef.Sign() == 0:
+		if aParts.coef.Sign() == 0 {
+			return decimal128NaN, big.Exact
+		}
+
+		return lo.Ternary(negative, decimal128NegInf, decimal128PosInf), big.Exact
+	}
+
+	preferredExp := aParts.exp - bParts.exp
+
+	if aParts.coef.Sign() == 0 {
+		return decimalParts{negative: negative, coef: new(big.Int), exp: preferredExp}.toDecimal128(mode)
+	}
+
+	// Scale the dividend so that the integer quotient has at least one
+	// digit beyond Decimal128’s precision.
+	shift := max(0, maxDecimal128Digits+1+decimalDigits(bParts.coef)-decimalDigits(aParts.coef))
+
+	quo, rem := new(big.Int).QuoRem(
+		new(big.Int).Mul(aParts.coef, pow10(shift)),
+		bParts.coef,
+		new(big.Int),
+	)
+	exp := preferredExp - shift
+
+	if rem.Sign() != 0 {
+		// Append a “sticky” digit so that rounding sees the nonzero
+		// remainder. Since the quotient already has a digit beyond
+		// Decimal128’s precision, this can’t change the rounding
+		// direction.
+		quo.Add(quo.Mul(quo, big.NewInt(10)), big.NewInt(1))
+		exp--
+	} else {
+		// The quotient is exact, so remove trailing zeros to approach the
+		// preferred exponent.
+		ten, digit := big.NewInt(10), new(big.Int)
+
+		for exp < preferredExp {
+			shorter, _ := new(big.Int).QuoRem(quo, ten, digit)
+			if digit.Sign() != 0 {
+				break
+			}
+
+			quo = shorter
+			exp++
+		}
+	}
+
+	return decimalParts{negative: negative, coef: quo, exp: exp}.toDecimal128(mode)
+}
+
+// ModDecimal128 returns the remainder of a ÷ b, with the quotient truncated
+// toward zero as the server’s `$mod` does. The remainder has a’s sign and
+// the smaller of the operands’ exponents, so 7.50 mod 2 is 1.50. An
+// infinite dividend or a zero divisor yields NaN.
+func ModDecimal128(a, b bson.Decimal128, mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	aParts, bParts := decomposeDecimal128(a), decomposeDecimal128(b)
+
+	switch {
+	case aParts.form == decimalNaN || bParts.form == decimalNaN:
+		return decimal128NaN, big.Exact
+	case aParts.form == decimalInf:
+		return decimal128NaN, big.Exact
+	case bParts.form == decimalInf:
+		return aParts.toDecimal128(mode)
+	case bParts.coef.Sign() == 0:
+		return decimal128NaN, big.Exact
+	}
+
+	exp := min(aParts.exp, bParts.exp)
+
+	aScaled, bScaled := aParts.scaledTo(exp), bParts.scaledTo(exp)
+
+	return decimalParts{
+		negative: aParts.negative,
+		coef:     new(big.Int).Rem(aScaled.Abs(aScaled), bScaled.Abs(bScaled)),
+		exp:      exp,
+	}.toDecimal128(mode)
+}
+
+func addDecimalParts(a, b decimalParts, mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	switch {
+	case a.form == decimalNaN || b.form == decimalNaN:
+		return decimal128NaN, big.Exact
+	case a.form == decimalInf && b.form == decimalInf && a.negative != b.negative:
+		return decimal128NaN, big.Exact
+	case a.form == decimalInf:
+		return a.toDecimal128(mode)
+	case b.form == decimalInf:
+		return b.toDecimal128(mode)
+	}
+
+	exp := min(a.exp, b.exp)
+
+	sum := new(big.Int).Add(a.scaledTo(exp), b.scaledTo(exp))
+
+	negative := sum.Sign() < 0
+	if sum.Sign() == 0 {
+		// IEEE 754 says that an exact zero sum is negative only if both
+		// operands are, or if rounding toward -Inf.
+		negative = (a.negative && b.negative) ||
+			(a.negative != b.negative && mode == big.ToNegativeInf)
+	}
+
+	return decimalParts{
+		negative: negative,
+		coef:     sum.Abs(sum),
+		exp:      exp,
+	}.toDecimal128(mode)
+}
+
+type decimalForm int
+
+const (
+	decimalFinite decimalForm = iota
+	decimalInf
+	decimalNaN
+)
+
+// decimalParts is an exact decimal number. If finite, its value is
+// coef × 10^exp, negated if `negative` is set. Unlike Decimal128, the
+// coefficient & exponent are unbounded.
+type decimalParts struct {
+	form     decimalForm
+	negative bool
+
+	// coef is nonnegative. It is nil unless the form is finite.
+	coef *big.Int
+	exp  int
+}
+
+func decomposeDecimal128(dec bson.Decimal128) decimalParts {
+	high, _ := dec.GetBytes()
+
+	parts := decimalParts{negative: high&decimal128SignBit != 0}
+
+	switch {
+	case dec.IsNaN():
+		parts.form = decimalNaN
+	case dec.IsInf() != 0:
+		parts.form = decimalInf
+	default:
+		// NB: This only fails for NaN & infinities.
+		coef, exp := lo.Must2(dec.BigInt())
+
+		parts.coef = coef.Abs(coef)
+		parts.exp = exp
+
+		// As with Decimal128IsZero, an out-of-range coefficient is zero.
+		if decimalDigits(parts.coef) > maxDecimal128Digits {
+			parts.coef.SetInt64(0)
+		}
+	}
+
+	return parts
+}
+
+// toDecimalParts converts any BSON number to its exact decimal value.
+func toDecimalParts(val bson.RawValue) (decimalParts, error) {
+	switch val.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		i64, ok := val.AsInt64OK()
+		if !ok {
+			return decimalParts{}, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		return decimalParts{
+			negative: i64 < 0,
+			coef:     new(big.Int).Abs(big.NewInt(i64)),
+		}, nil
+	case bson.TypeDouble:
+		f, ok := val.DoubleOK()
+		if !ok {
+			return decimalParts{}, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		return floatToDecimalParts(f), nil
+	case bson.TypeDecimal128:
+		dec, ok := val.Decimal128OK()
+		if !ok {
+			return decimalParts{}, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		return decomposeDecimal128(dec), nil
+	}
+
+	return decimalParts{}, fmt.Errorf("BSON %s is not numeric", val.Type)
+}
+
+func floatToDecimalParts(f float64) decimalParts {
+	parts := decimalParts{negative: math.Signbit(f)}
+
+	switch {
+	case math.IsNaN(f):
+		parts.form = decimalNaN
+	case math.IsInf(f, 0):
+		parts.form = decimalInf
+	default:
+		// A finite float64 is n / 2^k, which equals n × 5^k / 10^k.
+		rat := new(big.Rat).SetFloat64(math.Abs(f))
+		k := rat.Denom().BitLen() - 1
+
+		parts.coef = new(big.Int).Mul(rat.Num(), new(big.Int).Exp(big.NewInt(5), big.NewInt(int64(k)), nil))
+		parts.exp = -k
+	}
+
+	return parts
+}
+
+// sign returns -1, 0, or 1. It must not be called on NaN.
+func (p decimalParts) sign() int {
+	if p.form == decimalFinite && p.coef.Sign() == 0 {
+		return 0
+	}
+
+	return lo.Ternary(p.negative, -1, 1)
+}
+
+func (p decimalParts) compare(other decimalParts) int {
+	if p.form == decimalNaN || other.form == decimalNaN {
+		return cmp.Compare(boolToInt(p.form != decimalNaN), boolToInt(other.form != decimalNaN))
+	}
+
+	pSign, otherSign := p.sign(), other.sign()
+
+	if pSign != otherSign || pSign == 0 {
+		return cmp.Compare(pSign, otherSign)
+	}
+
+	return pSign * p.compareMagnitude(other)
+}
+
+// compareMagnitude compares two nonzero, non-NaN values’ absolute values.
+func (p decimalParts) compareMagnitude(other decimalParts) int {
+	if p.form == decimalInf || other.form == decimalInf {
+		return cmp.Compare(boolToInt(p.form == decimalInf), boolToInt(other.form == decimalInf))
+	}
+
+	// The “adjusted exponent” is that of the leading digit, so it decides
+	// unless the two are equal.
+	adjusted := decimalDigits(p.coef) + p.exp
+	otherAdjusted := decimalDigits(other.coef) + other.exp
+
+	if adjusted != otherAdjusted {
+		return cmp.Compare(adjusted, otherAdjusted)
+	}
+
+	exp := min(p.exp, other.exp)
+
+	return p.scaledTo(exp).CmpAbs(other.scaledTo(exp))
+}
+
+// scaledTo returns a finite value’s signed coefficient for the given
+// exponent, which must not exceed the value’s own.
+func (p decimalParts) scaledTo(exp int) *big.Int {
+	scaled := new(big.Int).Mul(p.coef, pow10(p.exp-exp))
+	if p.negative {
+		scaled.Neg(scaled)
+	}
+
+	return scaled
+}
+
+// rat returns a finite value as a big.Rat.
+func (p decimalParts) rat() *big.Rat {
+	rat := new(big.Rat)
+
+	switch {
+	case p.exp < 0:
+		rat.SetFrac(p.coef, pow10(-p.exp))
+	default:
+		rat.SetInt(new(big.Int).Mul(p.coef, pow10(p.exp)))
+	}
+
+	if p.negative {
+		rat.Neg(rat)
+	}
+
+	return rat
+}
+
+// toDecimal128 rounds the value to Decimal128’s precision & exponent range
+// by the given mode. Exact values keep their exponent if possible.
+func (p decimalParts) toDecimal128(mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	switch p.form {
+	case decimalNaN:
+		return decimal128NaN, big.Exact
+	case decimalInf:
+		return lo.Ternary(p.negative, decimal128NegInf, decimal128PosInf), big.Exact
+	}
+
+	coef, exp, acc := p.coef, p.exp, big.Exact
+
+	// Drop digits beyond Decimal128’s precision or below its minimum exponent.
+	if drop := max(decimalDigits(coef)-maxDecimal128Digits, bson.MinDecimal128Exp-exp); drop > 0 {
+		coef, acc = dropDecimalDigits(coef, p.negative, drop, mode)
+		exp += drop
+
+		// Rounding up may have added a digit (e.g., 999 → 1000).
+		if decimalDigits(coef) > maxDecimal128Digits {
+			coef.Quo(coef, big.NewInt(10))
+			exp++
+		}
+	}
+
+	switch {
+	case coef.Sign() == 0:
+		exp = min(max(exp, bson.MinDecimal128Exp), bson.MaxDecimal128Exp)
+	case exp > bson.MaxDecimal128Exp:
+		// A large exponent can be “clamped” by padding the coefficient
+		// with zeros, as long as the coefficient has room.
+		if decimalDigits(coef)+exp-bson.MaxDecimal128Exp > maxDecimal128Digits {
+			return decimal128Overflow(p.negative, mode)
+		}
+
+		coef = new(big.Int).Mul(coef, pow10(exp-bson.MaxDecimal128Exp))
+		exp = bson.MaxDecimal128Exp
+	}
+
+	signed := coef
+	if p.negative {
+		signed = new(big.Int).Neg(coef)
+	}
+
+	dec, ok := bson.ParseDecimal128FromBigInt(signed, exp)
+	lo.Assertf(ok, "%se%d must be a valid %s", signed, exp, bson.TypeDecimal128)
+
+	if p.negative && coef.Sign() == 0 {
+		high, low := dec.GetBytes()
+		dec = bson.NewDecimal128(high|decimal128SignBit, low)
+	}
+
+	return dec, acc
+}
+
+// decimal128Overflow returns the Decimal128 that a value beyond its range
+// rounds to: an infinity, or the largest finite value of the same sign.
+func decimal128Overflow(negative bool, mode big.RoundingMode) (bson.Decimal128, big.Accuracy) {
+	toInfinity := true
+
+	switch mode {
+	case big.ToZero:
+		toInfinity = false
+	case big.ToNegativeInf:
+		toInfinity = negative
+	case big.ToPositiveInf:
+		toInfinity = !negative
+	}
+
+	if toInfinity {
+		return lo.Ternary(negative, decimal128NegInf, decimal128PosInf), magnitudeAccuracy(true, negative)
+	}
+
+	maxCoef := new(big.Int).Sub(pow10(maxDecimal128Digits), big.NewInt(1))
+	if negative {
+		maxCoef.Neg(maxCoef)
+	}
+
+	dec, ok := bson.ParseDecimal128FromBigInt(maxCoef, bson.MaxDecimal128Exp)
+	lo.Assertf(ok, "maximum %s must be valid", bson.TypeDecimal128)
+
+	return dec, magnitudeAccuracy(false, negative)
+}
+
+// dropDecimalDigits removes count trailing digits from a nonnegative
+// coefficient, rounding by the given mode. The accuracy is that of the
+// signed value.
+func dropDecimalDigits(
+	coef *big.Int,
+	negative bool,
+	count int,
+	mode big.RoundingMode,
+) (*big.Int, big.Accuracy) {
+	// Past this point all digits are dropped, and only the remainder’s
+	// nonzero-ness matters.
+	count = min(count, decimalDigits(coef)+1)
+
+	divisor := pow10(count)
+	quo, rem := new(big.Int).QuoRem(coef, divisor, new(big.Int))
+
+	if rem.Sign() == 0 {
+		return quo, big.Exact
+	}
+
+	var roundUp bool
+
+	switch mode {
+	case big.ToNearestEven, big.ToNearestAway:
+		half := rem.Lsh(rem, 1).Cmp(divisor)
+		roundUp = half > 0 || (half == 0 && (mode == big.ToNearestAway || quo.Bit(0) == 1))
+	case big.ToZero:
+	case big.AwayFromZero:
+		roundUp = true
+	case big.ToNegativeInf:
+		roundUp = negative
+	case big.ToPositiveInf:
+		roundUp = !negative
+	}
+
+	if roundUp {
+		quo.Add(quo, big.NewInt(1))
+	}
+
+	return quo, magnitudeAccuracy(roundUp, negative)
+}
+
+// magnitudeAccuracy returns the accuracy of an inexact result whose
+// magnitude was rounded up or down.
+func magnitudeAccuracy(magnitudeUp, negative bool) big.Accuracy {
+	if magnitudeUp != negative {
+		return big.Above
+	}
+
+	return big.Below
+}
+
+// ratToFloat64 converts a rational number to the float64 that the given
+// rounding mode selects.
+func ratToFloat64(rat *big.Rat, mode big.RoundingMode) (float64, big.Accuracy) {
+	// Rat.Float64 rounds ToNearestEven, so other modes adjust from there.
+	nearest, _ := rat.Float64()
+	if nearest == 0 && rat.Sign() < 0 {
+		nearest = math.Copysign(0, -1)
+	}
+
+	diff := compareRatToFloat64(rat, nearest)
+	if diff == 0 {
+		return nearest, big.Exact
+	}
+
+	// The neighboring float64 on the far side of the exact value.
+	neighbor := math.Nextafter(nearest, math.Inf(diff))
+
+	result := nearest
+
+	switch mode {
+	case big.ToNearestEven:
+	case big.ToNearestAway:
+		if !math.IsInf(neighbor, 0) && math.Abs(neighbor) > math.Abs(nearest) {
+			midpoint := new(big.Rat).Add(new(big.Rat).SetFloat64(nearest), new(big.Rat).SetFloat64(neighbor))
+			if midpoint.Cmp(new(big.Rat).Add(rat, rat)) == 0 {
+				result = neighbor
+			}
+		}
+	case big.ToZero:
+		if diff != rat.Sign() {
+			result = neighbor
+		}
+	case big.AwayFromZero:
+		if diff == rat.Sign() {
+			result = neighbor
+		}
+	case big.ToNegativeInf:
+		if diff < 0 {
+			result = neighbor
+		}
+	case big.ToPositiveInf:
+		if diff > 0 {
+			result = neighbor
+		}
+	}
+
+	if compareRatToFloat64(rat, result) < 0 {
+		return result, big.Above
+	}
+
+	return result, big.Below
+}
+
+// compareRatToFloat64 compares a rational number with a non-NaN float64.
+func compareRatToFloat64(rat *big.Rat, f float64) int {
+	if math.IsInf(f, 0) {
+		return lo.Ternary(f > 0, -1, 1)
+	}
+
+	return rat.Cmp(new(big.Rat).SetFloat64(f))
+}
+
+// decimalDigits returns the number of digits in a nonnegative integer.
+func decimalDigits(n *big.Int) int {
+	return len(n.Text(10))
+}
+
+func pow10(exp int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
@@ -0,0 +1,351 @@
+package bsontools
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func mustParseDecimal(str string) bson.Decimal128 {
+	return lo.Must(bson.ParseDecimal128(str))
+}
+
+func TestDecimal128IsZero(t *testing.T) {
+	for _, str := range []string{"0", "-0", "0E+3", "-0.00", "0E-6176"} {
+		assert.True(t, Decimal128IsZero(mustParseDecimal(str)), str)
+	}
+
+	for _, str := range []string{"1", "-1E-6176", "NaN", "Infinity", "-Infinity"} {
+		assert.False(t, Decimal128IsZero(mustParseDecimal(str)), str)
+	}
+
+	// A coefficient in the “11” combination form is out of range and
+	// thus zero.
+	assert.True(t, Decimal128IsZero(bson.NewDecimal128(3<<61, 1)), "noncanonical coefficient")
+
+	// So is a coefficient above 10^34-1 in the normal form.
+	assert.False(
+		t,
+		Decimal128IsZero(bson.NewDecimal128(maxDecimal128CoefHigh, maxDecimal128CoefLow)),
+		"maximum coefficient",
+	)
+	assert.True(
+		t,
+		Decimal128IsZero(bson.NewDecimal128(maxDecimal128CoefHigh, maxDecimal128CoefLow+1)),
+		"coefficient just above the maximum",
+	)
+	assert.True(t, Decimal128IsZero(bson.NewDecimal128(1<<49-1, 0)), "largest encodable coefficient")
+	assert.Zero(
+		t,
+		CompareDecimal128(bson.NewDecimal128(1<<49-1, 0), mustParseDecimal("0")),
+		"out-of-range coefficient compares as zero",
+	)
+}
+
+func TestCompareDecimal128(t *testing.T) {
+	// Each inner slice is a group of values that compare as equal. The groups
+	// are in ascending order.
+	expectedOrder := [][]string{
+		{"NaN", "-NaN"},
+		{"-Infinity"},
+		{"-9.999999999999999999999999999999999E+6144"},
+		{"-10", "-1.0E+1", "-10.000"},
+		{"-9.99"},
+		{"-1E-6176"},
+		{"0", "-0", "0E+300", "-0E-300"},
+		{"1E-6176"},
+		{"0.1", "0.10", "1E-1"},
+		{"0.1000000000000000000000000000000001"},
+		{"1", "1.0", "1.000000000000000000000000000000000"},
+		{"100", "1E+2", "1.00E+2"},
+		{"9.999999999999999999999999999999999E+6144"},
+		{"Infinity"},
+	}
+
+	for i, group := range expectedOrder {
+		for _, aStr := range group {
+			for j, otherGroup := range expectedOrder {
+				for _, bStr := range otherGroup {
+					assert.Equal(
+						t,
+						cmpInts(i, j),
+						CompareDecimal128(mustParseDecimal(aStr), mustParseDecimal(bStr)),
+						"%s vs. %s",
+						aStr,
+						bStr,
+					)
+				}
+			}
+		}
+	}
+}
+
+func cmpInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+func TestParseDecimal128(t *testing.T) {
+	cases := []struct {
+		input    string
+		mode     big.RoundingMode
+		expected string
+		accuracy big.Accuracy
+	}{
+		{"1.50", big.ToNearestEven, "1.50", big.Exact},
+		{"+.5", big.ToNearestEven, "0.5", big.Exact},
+		{"7.", big.ToNearestEven, "7", big.Exact},
+		{"-0", big.ToNearestEven, "-0", big.Exact},
+		{"1.5e3", big.ToNearestEven, "1.5E+3", big.Exact},
+		{"infinity", big.ToNearestEven, "Infinity", big.Exact},
+		{"-Inf", big.ToNearestEven, "-Infinity", big.Exact},
+		{"nan", big.ToNearestEven, "NaN", big.Exact},
+
+		// 35 digits: the last is a tie.
+		{"12345678901234567890123456789012345", big.ToNearestEven, "1.234567890123456789012345678901234E+34", big.Below},
+		{"12345678901234567890123456789012345", big.ToNearestAway, "1.234567890123456789012345678901235E+34", big.Above},
+		{"-12345678901234567890123456789012345", big.ToNearestEven, "-1.234567890123456789012345678901234E+34", big.Above},
+		{"-12345678901234567890123456789012341", big.ToNegativeInf, "-1.234567890123456789012345678901235E+34", big.Below},
+		{"99999999999999999999999999999999999", big.ToNearestEven, "1.000000000000000000000000000000000E+35", big.Above},
+
+		// Clamping & overflow
+		{"1E+6144", big.ToNearestEven, "1.000000000000000000000000000000000E+6144", big.Exact},
+		{"1E+6145", big.ToNearestEven, "Infinity", big.Above},
+		{"-1E+6145", big.ToZero, "-9.999999999999999999999999999999999E+6144", big.Above},
+		{"1E+99999999999", big.ToPositiveInf, "Infinity", big.Above},
+		{"0E+99999", big.ToNearestEven, "0E+6111", big.Exact},
+
+		// Subnormals & underflow
+		{"1E-6176", big.ToNearestEven, "1E-6176", big.Exact},
+		{"1.5E-6176", big.ToNearestEven, "2E-6176", big.Above},
+		{"1E-6177", big.ToNearestEven, "0E-6176", big.Below},
+		{"1E-6177", big.AwayFromZero, "1E-6176", big.Above},
+		{"-1E-99999999999", big.ToNearestEven, "-0E-6176", big.Above},
+	}
+
+	for _, c := range cases {
+		dec, acc, err := ParseDecimal128(c.input, c.mode)
+		require.NoError(t, err, c.input)
+
+		assert.Equal(t, c.expected, dec.String(), "%s (%s)", c.input, c.mode)
+		assert.Equal(t, c.accuracy, acc, "%s (%s)", c.input, c.mode)
+	}
+
+	for _, input := range []string{"", "-", ".", "e5", "1e", "+-1", "1.2.3", "0x10", " 1", "infinite"} {
+		_, _, err := ParseDecimal128(input, big.ToNearestEven)
+		assert.Error(t, err, "%#q", input)
+	}
+}
+
+func TestFormatDecimal128Fixed(t *testing.T) {
+	cases := map[string]string{
+		"1.50E+3":  "1500",
+		"1E-7":     "0.0000001",
+		"-123.45":  "-123.45",
+		"0.012":    "0.012",
+		"-0.00":    "-0.00",
+		"0E+3":     "0",
+		"NaN":      "NaN",
+		"Infinity": "Infinity",
+	}
+
+	for input, expected := range cases {
+		assert.Equal(t, expected, FormatDecimal128Fixed(mustParseDecimal(input)), input)
+	}
+}
+
+func TestDecimal128FromNumbers(t *testing.T) {
+	assert.Equal(t, "-9223372036854775808", Decimal128FromInt64(math.MinInt64).String())
+	assert.Equal(t, "0", Decimal128FromInt64(0).String())
+
+	cases := []struct {
+		input    float64
+		mode     big.RoundingMode
+		expected string
+		accuracy big.Accuracy
+	}{
+		{0.5, big.ToNearestEven, "0.5", big.Exact},
+		{1000, big.ToNearestEven, "1000", big.Exact},
+		{math.Copysign(0, -1), big.ToNearestEven, "-0", big.Exact},
+		{0.1, big.ToNearestEven, "0.1000000000000000055511151231257827", big.Below},
+		{0.1, big.ToPositiveInf, "0.1000000000000000055511151231257828", big.Above},
+		{-0.1, big.ToZero, "-0.1000000000000000055511151231257827", big.Above},
+		{math.NaN(), big.ToNearestEven, "NaN", big.Exact},
+		{math.Inf(-1), big.ToNearestEven, "-Infinity", big.Exact},
+	}
+
+	for _, c := range cases {
+		dec, acc := Decimal128FromFloat64(c.input, c.mode)
+
+		assert.Equal(t, c.expected, dec.String(), "%v (%s)", c.input, c.mode)
+		assert.Equal(t, c.accuracy, acc, "%v (%s)", c.input, c.mode)
+	}
+}
+
+func TestDecimal128ToInt64(t *testing.T) {
+	cases := []struct {
+		input    string
+		mode     big.RoundingMode
+		expected int64
+		accuracy big.Accuracy
+	}{
+		{"2.5", big.ToNearestEven, 2, big.Below},
+		{"2.5", big.ToNearestAway, 3, big.Above},
+		{"-2.5", big.ToZero, -2, big.Above},
+		{"-0.4", big.ToNegativeInf, -1, big.Below},
+		{"0.4", big.AwayFromZero, 1, big.Above},
+		{"1.00E+18", big.ToZero, 1e18, big.Exact},
+		{"-0E+50", big.ToZero, 0, big.Exact},
+		{"1E-6176", big.ToZero, 0, big.Below},
+		{"9223372036854775807", big.ToZero, math.MaxInt64, big.Exact},
+		{"-9223372036854775808.9", big.ToZero, math.MinInt64, big.Above},
+	}
+
+	for _, c := range cases {
+		i64, acc, err := Decimal128ToInt64(mustParseDecimal(c.input), c.mode)
+		require.NoError(t, err, "%s (%s)", c.input, c.mode)
+
+		assert.Equal(t, c.expected, i64, "%s (%s)", c.input, c.mode)
+		assert.Equal(t, c.accuracy, acc, "%s (%s)", c.input, c.mode)
+	}
+
+	for _, input := range []string{"9223372036854775808", "-9223372036854775808.6", "1E+19", "NaN", "-Infinity"} {
+		_, _, err := Decimal128ToInt64(mustParseDecimal(input), big.ToNearestEven)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestDecimal128ToFloat64(t *testing.T) {
+	cases := []struct {
+		input    string
+		mode     big.RoundingMode
+		expected float64
+		accuracy big.Accuracy
+	}{
+		{"2.50", big.ToNearestEven, 2.5, big.Exact},
+		{"-0", big.ToNearestEven, math.Copysign(0, -1), big.Exact},
+		{"0.1", big.ToNearestEven, 0.1, big.Above},
+		{"0.1", big.ToZero, math.Nextafter(0.1, 0), big.Below},
+		{"0.1", big.AwayFromZero, 0.1, big.Above},
+
+		// 2^53 + 1 is a tie between 2^53 & 2^53 + 2.
+		{"9007199254740993", big.ToNearestEven, 1 << 53, big.Below},
+		{"9007199254740993", big.ToNearestAway, 1<<53 + 2, big.Above},
+		{"-9007199254740993", big.ToNearestAway, -(1<<53 + 2), big.Below},
+
+		{"1E+400", big.ToNearestEven, math.Inf(1), big.Above},
+		{"1E+400", big.ToZero, math.MaxFloat64, big.Below},
+		{"-1E+400", big.ToPositiveInf, -math.MaxFloat64, big.Above},
+		{"1E-400", big.ToNearestEven, 0, big.Below},
+		{"1E-400", big.ToPositiveInf, math.SmallestNonzeroFloat64, big.Above},
+		{"-1E-400", big.ToNearestEven, math.Copysign(0, -1), big.Above},
+		{"-Infinity", big.ToZero, math.Inf(-1), big.Exact},
+	}
+
+	for _, c := range cases {
+		f, acc := Decimal128ToFloat64(mustParseDecimal(c.input), c.mode)
+
+		assert.Equal(t, c.expected, f, "%s (%s)", c.input, c.mode)
+		assert.Equal(t, math.Signbit(c.expected), math.Signbit(f), "%s (%s) sign", c.input, c.mode)
+		assert.Equal(t, c.accuracy, acc, "%s (%s)", c.input, c.mode)
+	}
+
+	f, acc := Decimal128ToFloat64(mustParseDecimal("NaN"), big.ToNearestEven)
+	assert.True(t, math.IsNaN(f), "NaN")
+	assert.Equal(t, big.Exact, acc, "NaN")
+}
+
+func TestDecimal128Arithmetic(t *testing.T) {
+	type arithFunc func(a, b bson.Decimal128, mode big.RoundingMode) (bson.Decimal128, big.Accuracy)
+
+	cases := []struct {
+		name     string
+		fn       arithFunc
+		a, b     string
+		mode     big.RoundingMode
+		expected string
+		accuracy big.Accuracy
+	}{
+		{"add", AddDecimal128, "1.10", "1", big.ToNearestEven, "2.10", big.Exact},
+		{"add", AddDecimal128, "1E+3", "1E+1", big.ToNearestEven, "1.01E+3", big.Exact},
+		{"add", AddDecimal128, "-0", "-0", big.ToNearestEven, "-0", big.Exact},
+		{"add", AddDecimal128, "-0", "0", big.ToNearestEven, "0", big.Exact},
+		{"add", AddDecimal128, "-0", "0", big.ToNegativeInf, "-0", big.Exact},
+		{"add", AddDecimal128, "Infinity", "-Infinity", big.ToNearestEven, "NaN", big.Exact},
+		{"add", AddDecimal128, "Infinity", "-1E+6144", big.ToNearestEven, "Infinity", big.Exact},
+		{"add", AddDecimal128, "NaN", "1", big.ToNearestEven, "NaN", big.Exact},
+		{
+			"add", AddDecimal128,
+			"9999999999999999999999999999999999", "1",
+			big.ToNearestEven, "1.000000000000000000000000000000000E+34", big.Exact,
+		},
+		{
+			"add", AddDecimal128,
+			"1E+34", "0.5",
+			big.ToNearestEven, "1.000000000000000000000000000000000E+34", big.Below,
+		},
+		{
+			"add", AddDecimal128,
+			"9.999999999999999999999999999999999E+6144", "1E+6111",
+			big.ToNearestEven, "Infinity", big.Above,
+		},
+		{"subtract", SubtractDecimal128, "1", "1", big.ToNearestEven, "0", big.Exact},
+		{"subtract", SubtractDecimal128, "1", "1", big.ToNegativeInf, "-0", big.Exact},
+		{"subtract", SubtractDecimal128, "1.5", "2.25", big.ToNearestEven, "-0.75", big.Exact},
+		{"subtract", SubtractDecimal128, "Infinity", "Infinity", big.ToNearestEven, "NaN", big.Exact},
+		{"multiply", MultiplyDecimal128, "1.10", "3", big.ToNearestEven, "3.30", big.Exact},
+		{"multiply", MultiplyDecimal128, "0.1", "0.1", big.ToNearestEven, "0.01", big.Exact},
+		{"multiply", MultiplyDecimal128, "1.5", "-0", big.ToNearestEven, "-0.0", big.Exact},
+		{"multiply", MultiplyDecimal128, "Infinity", "0", big.ToNearestEven, "NaN", big.Exact},
+		{"multiply", MultiplyDecimal128, "-2", "Infinity", big.ToNearestEven, "-Infinity", big.Exact},
+		{"multiply", MultiplyDecimal128, "1E+6111", "1E+100", big.ToZero, "9.999999999999999999999999999999999E+6144", big.Below},
+		{"multiply", MultiplyDecimal128, "1E-6176", "0.1", big.ToNearestEven, "0E-6176", big.Below},
+		{
+			"multiply", MultiplyDecimal128,
+			"1111111111111111111111111111111111", "3",
+			big.ToNearestEven, "3333333333333333333333333333333333", big.Exact,
+		},
+		{
+			"multiply", MultiplyDecimal128,
+			"3333333333333333333333333333333334", "3",
+			big.ToNearestEven, "1.000000000000000000000000000000000E+34", big.Below,
+		},
+		{"divide", DivideDecimal128, "6.00", "2", big.ToNearestEven, "3.00", big.Exact},
+		{"divide", DivideDecimal128, "1", "4", big.ToNearestEven, "0.25", big.Exact},
+		{"divide", DivideDecimal128, "1.0E+3", "10", big.ToNearestEven, "1E+2", big.Exact},
+		{"divide", DivideDecimal128, "0.00", "-5", big.ToNearestEven, "-0.00", big.Exact},
+		{"divide", DivideDecimal128, "1", "3", big.ToNearestEven, "0.3333333333333333333333333333333333", big.Below},
+		{"divide", DivideDecimal128, "-2", "3", big.ToNearestEven, "-0.6666666666666666666666666666666667", big.Below},
+		{"divide", DivideDecimal128, "2", "3", big.ToZero, "0.6666666666666666666666666666666666", big.Below},
+		{"divide", DivideDecimal128, "1E+6144", "1E-10", big.ToNearestEven, "Infinity", big.Above},
+		{"divide", DivideDecimal128, "1E-6176", "3", big.ToNearestEven, "0E-6176", big.Below},
+		{"divide", DivideDecimal128, "1", "0", big.ToNearestEven, "Infinity", big.Exact},
+		{"divide", DivideDecimal128, "0", "0", big.ToNearestEven, "NaN", big.Exact},
+		{"divide", DivideDecimal128, "-1", "Infinity", big.ToNearestEven, "-0E-6176", big.Exact},
+		{"divide", DivideDecimal128, "Infinity", "Infinity", big.ToNearestEven, "NaN", big.Exact},
+		{"mod", ModDecimal128, "7.50", "2", big.ToNearestEven, "1.50", big.Exact},
+		{"mod", ModDecimal128, "-7", "3", big.ToNearestEven, "-1", big.Exact},
+		{"mod", ModDecimal128, "6", "-3", big.ToNearestEven, "0", big.Exact},
+		{"mod", ModDecimal128, "5", "Infinity", big.ToNearestEven, "5", big.Exact},
+		{"mod", ModDecimal128, "Infinity", "1", big.ToNearestEven, "NaN", big.Exact},
+		{"mod", ModDecimal128, "1", "0", big.ToNearestEven, "NaN", big.Exact},
+	}
+
+	for _, c := range cases {
+		result, acc := c.fn(mustParseDecimal(c.a), mustParseDecimal(c.b), c.mode)
+
+		assert.Equal(t, c.expected, result.String(), "%s %s & %s (%s)", c.name, c.a, c.b, c.mode)
+		assert.Equal(t, c.accuracy, acc, "%s %s & %s (%s)", c.name, c.a, c.b, c.mode)
+	}
+}
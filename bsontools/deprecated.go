@@ -0,0 +1,244 @@
+package bsontools
+
+import (
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// IsDeprecatedType indicates whether the BSON spec deprecates the given type,
+// i.e., whether it is Undefined, DBPointer, Symbol, or CodeWithScope. Some
+// drivers & destinations handle these poorly or not at all.
+func IsDeprecatedType(t bson.Type) bool {
+	switch t {
+	case bson.TypeUndefined, bson.TypeDBPointer, bson.TypeSymbol, bson.TypeCodeWithScope:
+		return true
+	}
+
+	return false
+}
+
+// DeprecatedValue describes one value that FindDeprecatedValues found.
+type DeprecatedValue struct {
+	// Pointer is the value’s location. Array elements are given by index.
+	Pointer []string
+
+	Type bson.Type
+}
+
+func (dv DeprecatedValue) String() string {
+	return fmt.Sprintf("%s at %s", dv.Type, formatPointerForDisplay(dv.Pointer))
+}
+
+// FindDeprecatedValues scans a BSON document, recursively, for values of
+// deprecated types. (See IsDeprecatedType.) It reports them in document
+// order.
+//
+// A CodeWithScope’s scope is not scanned since it isn’t addressable by
+// document pointer.
+func FindDeprecatedValues(doc bson.Raw) ([]DeprecatedValue, error) {
+	var found []DeprecatedValue
+
+	err := walkDeprecatedValues(doc, nil, func(val bson.RawValue, pointer []string) error {
+		found = append(found, DeprecatedValue{
+			Pointer: pointer,
+			Type:    val.Type,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+func walkDeprecatedValues(
+	doc bson.Raw,
+	pointer []string,
+	visit func(bson.RawValue, []string) error,
+) error {
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", formatPointerForDisplay(pointer), err)
+		}
+
+		key, err := el.KeyErr()
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", formatPointerForDisplay(pointer), err)
+		}
+
+		elPointer := append(slices.Clip(pointer), key)
+
+		val, err := el.ValueErr()
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", formatPointerForDisplay(elPointer), err)
+		}
+
+		switch {
+		case val.Type == bson.TypeEmbeddedDocument || val.Type == bson.TypeArray:
+			if err := walkDeprecatedValues(val.Value, elPointer, visit); err != nil {
+				return err
+			}
+		case IsDeprecatedType(val.Type):
+			if err := visit(val, elPointer); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeprecatedValueConverter converts a value of a deprecated type to some
+// other BSON value.
+type DeprecatedValueConverter func(bson.RawValue) (bson.RawValue, error)
+
+// DeprecatedValueOptions configures ConvertDeprecatedValues.
+type DeprecatedValueOptions struct {
+	// Converters maps deprecated types to their conversions. Values of
+	// types that aren’t in the map are left as-is. If this is nil,
+	// DefaultDeprecatedValueConverters is used.
+	Converters map[bson.Type]DeprecatedValueConverter
+}
+
+// DefaultDeprecatedValueConverters returns the conversions that
+// ConvertDeprecatedValues uses by default:
+//   - Undefined becomes null. (See UndefinedToNull.)
+//   - Symbol becomes string. (See SymbolToString.)
+//   - DBPointer becomes a DBRef document. (See DBPointerToDBRef.)
+//   - CodeWithScope becomes a document. (See CodeWithScopeToDocument.)
+//
+// The returned map is the caller’s to modify.
+func DefaultDeprecatedValueConverters() map[bson.Type]DeprecatedValueConverter {
+	return map[bson.Type]DeprecatedValueConverter{
+		bson.TypeUndefined:     UndefinedToNull,
+		bson.TypeSymbol:        SymbolToString,
+		bson.TypeDBPointer:     DBPointerToDBRef,
+		bson.TypeCodeWithScope: CodeWithScopeToDocument,
+	}
+}
+
+// ConvertDeprecatedValues rewrites a BSON document’s deprecated values,
+// recursively, per the given options. (See FindDeprecatedValues.) The input
+// document is not modified. This returns the new document and the number of
+// values that were converted.
+//
+// Example usage (converts everything but CodeWithScope):
+//
+//	converters := bsontools.DefaultDeprecatedValueConverters()
+//	delete(converters, bson.TypeCodeWithScope)
+//
+//	newDoc, converted, err := bsontools.ConvertDeprecatedValues(
+//		doc,
+//		bsontools.DeprecatedValueOptions{Converters: converters},
+//	)
+func ConvertDeprecatedValues(doc bson.Raw, opts DeprecatedValueOptions) (bson.Raw, int, error) {
+	converters := opts.Converters
+	if converters == nil {
+		converters = DefaultDeprecatedValueConverters()
+	}
+
+	// Validate the converters’ keys up-front so that a typo doesn’t go
+	// unnoticed just because a document lacks the type.
+	for t := range converters {
+		if !IsDeprecatedType(t) {
+			return nil, 0, fmt.Errorf("BSON %s is not a deprecated type", t)
+		}
+	}
+
+	plan := &EditPlan{}
+
+	err := walkDeprecatedValues(doc, nil, func(val bson.RawValue, pointer []string) error {
+		converter, ok := converters[val.Type]
+		if !ok {
+			return nil
+		}
+
+		newVal, err := converter(val)
+		if err != nil {
+			return fmt.Errorf("converting %s: %w", formatPointerForDisplay(pointer), err)
+		}
+
+		return plan.Replace(newVal, pointer...)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return plan.Apply(nil, doc)
+}
+
+// UndefinedToNull converts Undefined to null.
+func UndefinedToNull(val bson.RawValue) (bson.RawValue, error) {
+	if val.Type != bson.TypeUndefined {
+		return bson.RawValue{}, cannotCastError[bson.Undefined]{val.Type}
+	}
+
+	return ToRawValue(bson.Null{}), nil
+}
+
+// SymbolToString converts a Symbol to a string with the same content.
+func SymbolToString(val bson.RawValue) (bson.RawValue, error) {
+	symbol, err := RawValueTo[bson.Symbol](val)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	return ToRawValue(string(symbol)), nil
+}
+
+// DBPointerToDBRef converts a DBPointer to a DBRef document, i.e., one
+// whose `$ref` is the DBPointer’s namespace and whose `$id` is its ObjectID.
+func DBPointerToDBRef(val bson.RawValue) (bson.RawValue, error) {
+	ptr, err := RawValueTo[bson.DBPointer](val)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	return ToRawValue(bson.Raw(
+		bsoncore.NewDocumentBuilder().
+			AppendString("$ref", ptr.DB).
+			AppendObjectID("$id", ptr.Pointer).
+			Build(),
+	)), nil
+}
+
+// CodeWithScopeToDocument converts a CodeWithScope to a document whose
+// `code` is the JavaScript code and whose `scope` is the scope document.
+func CodeWithScopeToDocument(val bson.RawValue) (bson.RawValue, error) {
+	code, scope, ok := val.CodeWithScopeOK()
+	if !ok {
+		return bson.RawValue{}, cannotCastError[bson.CodeWithScope]{val.Type}
+	}
+
+	return ToRawValue(bson.Raw(
+		bsoncore.NewDocumentBuilder().
+			AppendJavaScript("code", code).
+			AppendDocument("scope", scope).
+			Build(),
+	)), nil
+}
+
+// CodeWithScopeToJavaScript converts a CodeWithScope to plain JavaScript
+// code. To avoid losing data, this fails if the scope is nonempty.
+func CodeWithScopeToJavaScript(val bson.RawValue) (bson.RawValue, error) {
+	code, scope, ok := val.CodeWithScopeOK()
+	if !ok {
+		return bson.RawValue{}, cannotCastError[bson.CodeWithScope]{val.Type}
+	}
+
+	count, err := CountRawElements(scope)
+	if err != nil {
+		return bson.RawValue{}, fmt.Errorf("parsing scope: %w", err)
+	}
+
+	if count > 0 {
+		return bson.RawValue{}, fmt.Errorf("cannot drop nonempty scope (%d fields)", count)
+	}
+
+	return ToRawValue(bson.JavaScript(code)), nil
+}
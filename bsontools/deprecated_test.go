@@ -0,0 +1,128 @@
+package bsontools
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func deprecatedTestDoc(t *testing.T, oid bson.ObjectID) bson.Raw {
+	t.Helper()
+
+	return lo.Must(bson.Marshal(bson.D{
+		{"_id", 1},
+		{"u", bson.Undefined{}},
+		{"sub", bson.D{
+			{"sym", bson.Symbol("abc")},
+			{"ok", "fine"},
+		}},
+		{"arr", bson.A{
+			int32(1),
+			bson.DBPointer{DB: "db.coll", Pointer: oid},
+			bson.A{bson.CodeWithScope{Code: "x + y", Scope: bson.D{{"x", int32(1)}}}},
+		}},
+	}))
+}
+
+func TestFindDeprecatedValues(t *testing.T) {
+	doc := deprecatedTestDoc(t, bson.NewObjectID())
+
+	found, err := FindDeprecatedValues(doc)
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		[]DeprecatedValue{
+			{[]string{"u"}, bson.TypeUndefined},
+			{[]string{"sub", "sym"}, bson.TypeSymbol},
+			{[]string{"arr", "1"}, bson.TypeDBPointer},
+			{[]string{"arr", "2", "0"}, bson.TypeCodeWithScope},
+		},
+		found,
+	)
+
+	found, err = FindDeprecatedValues(lo.Must(bson.Marshal(bson.D{{"a", bson.A{"b"}}})))
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	_, err = FindDeprecatedValues(doc[:len(doc)-3])
+	assert.Error(t, err, "truncated document")
+}
+
+func TestConvertDeprecatedValues(t *testing.T) {
+	oid := bson.NewObjectID()
+	doc := deprecatedTestDoc(t, oid)
+	original := slices.Clone(doc)
+
+	converted, count, err := ConvertDeprecatedValues(doc, DeprecatedValueOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, original, doc, "input is unchanged")
+
+	expected := lo.Must(bson.Marshal(bson.D{
+		{"_id", 1},
+		{"u", nil},
+		{"sub", bson.D{
+			{"sym", "abc"},
+			{"ok", "fine"},
+		}},
+		{"arr", bson.A{
+			int32(1),
+			bson.D{{"$ref", "db.coll"}, {"$id", oid}},
+			bson.A{bson.D{
+				{"code", bson.JavaScript("x + y")},
+				{"scope", bson.D{{"x", int32(1)}}},
+			}},
+		}},
+	}))
+
+	assert.Equal(t, bson.Raw(expected), converted)
+	assert.Empty(t, lo.Must(FindDeprecatedValues(converted)))
+}
+
+func TestConvertDeprecatedValues_Options(t *testing.T) {
+	doc := deprecatedTestDoc(t, bson.NewObjectID())
+
+	converters := DefaultDeprecatedValueConverters()
+	delete(converters, bson.TypeCodeWithScope)
+	delete(converters, bson.TypeDBPointer)
+
+	converted, count, err := ConvertDeprecatedValues(doc, DeprecatedValueOptions{Converters: converters})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	assert.Equal(
+		t,
+		[]DeprecatedValue{
+			{[]string{"arr", "1"}, bson.TypeDBPointer},
+			{[]string{"arr", "2", "0"}, bson.TypeCodeWithScope},
+		},
+		lo.Must(FindDeprecatedValues(converted)),
+	)
+
+	_, _, err = ConvertDeprecatedValues(doc, DeprecatedValueOptions{
+		Converters: map[bson.Type]DeprecatedValueConverter{bson.TypeCodeWithScope: CodeWithScopeToJavaScript},
+	})
+	assert.ErrorContains(t, err, "nonempty scope")
+	assert.ErrorContains(t, err, "arr.2.0")
+
+	_, _, err = ConvertDeprecatedValues(doc, DeprecatedValueOptions{
+		Converters: map[bson.Type]DeprecatedValueConverter{bson.TypeString: SymbolToString},
+	})
+	assert.ErrorContains(t, err, "not a deprecated type")
+}
+
+func TestCodeWithScopeToJavaScript(t *testing.T) {
+	val := mustConvertToRawValue(t, bson.CodeWithScope{Code: "f()", Scope: bson.D{}})
+
+	js, err := CodeWithScopeToJavaScript(val)
+	require.NoError(t, err)
+	assert.Equal(t, ToRawValue(bson.JavaScript("f()")), js)
+
+	_, err = CodeWithScopeToJavaScript(ToRawValue("f()"))
+	assert.Error(t, err, "not CodeWithScope")
+}
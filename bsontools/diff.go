@@ -0,0 +1,279 @@
+package bsontools
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// DiffKind indicates how two documents differ at a given path.
+type DiffKind int
+
+const (
+	// DiffAdded means that only the second document has the path.
+	DiffAdded DiffKind = iota + 1
+
+	// DiffRemoved means that only the first document has the path.
+	DiffRemoved
+
+	// DiffValueChanged means that the documents have different values at
+	// the path. The values’ BSON types may or may not match.
+	DiffValueChanged
+
+	// DiffTypeChanged means that the documents have values at the path that
+	// are equal (per CompareValues) but of different BSON types, e.g.,
+	// int32(1) vs. int64(1).
+	DiffTypeChanged
+
+	// DiffFieldOrder means that the path is an embedded document (or the
+	// top-level document, if the path is empty) whose shared fields are in
+	// different orders.
+	DiffFieldOrder
+)
+
+func (dk DiffKind) String() string {
+	switch dk {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffValueChanged:
+		return "value changed"
+	case DiffTypeChanged:
+		return "type changed"
+	case DiffFieldOrder:
+		return "field order differs"
+	}
+
+	return fmt.Sprintf("DiffKind(%d)", int(dk))
+}
+
+// DocDiff describes one difference between two BSON documents.
+type DocDiff struct {
+	Kind DiffKind
+
+	// Path is the location of the difference. Array elements’ indexes are
+	// given as strings, as in BSON.
+	Path []string
+
+	// A & B are the two documents’ values at Path. If Kind is DiffAdded,
+	// A is zero; if Kind is DiffRemoved, B is zero.
+	//
+	// NB: These refer to the compared documents’ buffers.
+	A, B bson.RawValue
+}
+
+func (dd DocDiff) String() string {
+	switch dd.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("%s %#q: %s", dd.Kind, dd.Path, describeRawValue(dd.B))
+	case DiffRemoved:
+		return fmt.Sprintf("%s %#q: %s", dd.Kind, dd.Path, describeRawValue(dd.A))
+	case DiffFieldOrder:
+		return fmt.Sprintf("%s %#q", dd.Kind, dd.Path)
+	}
+
+	return fmt.Sprintf(
+		"%s %#q: %s -> %s",
+		dd.Kind,
+		dd.Path,
+		describeRawValue(dd.A),
+		describeRawValue(dd.B),
+	)
+}
+
+func describeRawValue(rv bson.RawValue) string {
+	return fmt.Sprintf("%s (%s)", rv, rv.Type)
+}
+
+// Diff walks two BSON documents and reports their differences path by path.
+// Unlike a comparison of the documents’ full contents, this lets you pinpoint
+// the mismatches between large documents.
+//
+// Embedded documents are compared field by field, and arrays are compared
+// index by index. Values are otherwise compared bytewise; values that are
+// bytewise-unequal but equal per CompareValues (e.g., int32(1) & 1.0) are
+// reported as DiffTypeChanged if their types differ or DiffValueChanged if
+// not (e.g., Decimal128 1.0 & 1.00).
+//
+// Field-order differences are reported once per embedded document and only
+// consider fields that both documents contain.
+//
+// If a document contains duplicate field names, only the first instance of
+// each name is compared.
+//
+// An empty return means the documents are identical.
+func Diff[D ~[]byte](a, b D) ([]DocDiff, error) {
+	return diffDocuments(nil, bson.Raw(a), bson.Raw(b), nil)
+}
+
+type diffField struct {
+	key   string
+	value bson.RawValue
+}
+
+func readDiffFields(doc bson.Raw) ([]diffField, map[string]int, error) {
+	var fields []diffField
+	fieldIndex := map[string]int{}
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key := string(bsoncore.Element(el).KeyBytes())
+		if _, dupe := fieldIndex[key]; dupe {
+			continue
+		}
+
+		val, err := el.ValueErr()
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing %#q: %w", key, err)
+		}
+
+		fieldIndex[key] = len(fields)
+		fields = append(fields, diffField{key, val})
+	}
+
+	return fields, fieldIndex, nil
+}
+
+func diffDocuments(diffs []DocDiff, a, b bson.Raw, path []string) ([]DocDiff, error) {
+	if bytes.Equal(a, b) {
+		return diffs, nil
+	}
+
+	aFields, aIndex, err := readDiffFields(a)
+	if err != nil {
+		return nil, fmt.Errorf("parsing document A at %#q: %w", path, err)
+	}
+
+	bFields, bIndex, err := readDiffFields(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing document B at %#q: %w", path, err)
+	}
+
+	var sharedInA []string
+
+	for _, aField := range aFields {
+		fieldPath := appendPath(path, aField.key)
+
+		bIdx, inB := bIndex[aField.key]
+		if !inB {
+			diffs = append(diffs, DocDiff{
+				Kind: DiffRemoved,
+				Path: fieldPath,
+				A:    aField.value,
+			})
+
+			continue
+		}
+
+		sharedInA = append(sharedInA, aField.key)
+
+		diffs, err = diffValues(diffs, aField.value, bFields[bIdx].value, fieldPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var sharedInB []string
+
+	for _, bField := range bFields {
+		if _, inA := aIndex[bField.key]; inA {
+			sharedInB = append(sharedInB, bField.key)
+
+			continue
+		}
+
+		diffs = append(diffs, DocDiff{
+			Kind: DiffAdded,
+			Path: appendPath(path, bField.key),
+			B:    bField.value,
+		})
+	}
+
+	if !slices.Equal(sharedInA, sharedInB) {
+		diffs = append(diffs, DocDiff{
+			Kind: DiffFieldOrder,
+			Path: slices.Clone(path),
+			A:    ToRawValue(a),
+			B:    ToRawValue(b),
+		})
+	}
+
+	return diffs, nil
+}
+
+func diffArrays(diffs []DocDiff, a, b bson.RawArray, path []string) ([]DocDiff, error) {
+	if bytes.Equal(a, b) {
+		return diffs, nil
+	}
+
+	aVals, err := a.Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing array A at %#q: %w", path, err)
+	}
+
+	bVals, err := b.Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing array B at %#q: %w", path, err)
+	}
+
+	for i := range max(len(aVals), len(bVals)) {
+		elPath := appendPath(path, fmt.Sprint(i))
+
+		switch {
+		case i >= len(bVals):
+			diffs = append(diffs, DocDiff{Kind: DiffRemoved, Path: elPath, A: aVals[i]})
+		case i >= len(aVals):
+			diffs = append(diffs, DocDiff{Kind: DiffAdded, Path: elPath, B: bVals[i]})
+		default:
+			diffs, err = diffValues(diffs, aVals[i], bVals[i], elPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return diffs, nil
+}
+
+func diffValues(diffs []DocDiff, a, b bson.RawValue, path []string) ([]DocDiff, error) {
+	if a.Type == b.Type {
+		switch a.Type {
+		case bson.TypeEmbeddedDocument:
+			return diffDocuments(diffs, a.Value, b.Value, path)
+		case bson.TypeArray:
+			return diffArrays(diffs, a.Value, b.Value, path)
+		}
+
+		if bytes.Equal(a.Value, b.Value) {
+			return diffs, nil
+		}
+	}
+
+	kind := DiffValueChanged
+
+	if a.Type != b.Type {
+		cmpResult, err := CompareValues(a, b)
+		if err != nil {
+			return nil, fmt.Errorf("comparing values at %#q: %w", path, err)
+		}
+
+		if cmpResult == 0 {
+			kind = DiffTypeChanged
+		}
+	}
+
+	return append(diffs, DocDiff{Kind: kind, Path: path, A: a, B: b}), nil
+}
+
+// appendPath appends to a copy of the given path so that each DocDiff
+// gets its own Path.
+func appendPath(path []string, key string) []string {
+	return append(path[:len(path):len(path)], key)
+}
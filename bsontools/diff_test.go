@@ -0,0 +1,111 @@
+package bsontools
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestDiff_Identical(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"b", bson.D{{"c", bson.A{"x", "y"}}}},
+	}))
+
+	diffs, err := Diff(doc, doc)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestDiff(t *testing.T) {
+	a := lo.Must(bson.Marshal(bson.D{
+		{"_id", int32(1)},
+		{"gone", "x"},
+		{"num", int32(5)},
+		{"str", "old"},
+		{"sub", bson.D{
+			{"x", int32(1)},
+			{"y", int32(2)},
+		}},
+		{"arr", bson.A{"a", "b", "c"}},
+		{"dec", lo.Must(bson.ParseDecimal128("1.0"))},
+	}))
+
+	b := lo.Must(bson.Marshal(bson.D{
+		{"_id", int32(1)},
+		{"num", int64(5)},
+		{"str", int32(1)},
+		{"sub", bson.D{
+			{"y", int32(2)},
+			{"x", int32(1)},
+		}},
+		{"arr", bson.A{"a", "B"}},
+		{"dec", lo.Must(bson.ParseDecimal128("1.00"))},
+		{"new", true},
+	}))
+
+	diffs, err := Diff(a, b)
+	require.NoError(t, err)
+
+	type summary struct {
+		kind  DiffKind
+		path  []string
+		aType bson.Type
+		bType bson.Type
+	}
+
+	summaries := lo.Map(diffs, func(d DocDiff, _ int) summary {
+		return summary{d.Kind, d.Path, d.A.Type, d.B.Type}
+	})
+
+	assert.Equal(
+		t,
+		[]summary{
+			{DiffRemoved, []string{"gone"}, bson.TypeString, 0},
+			{DiffTypeChanged, []string{"num"}, bson.TypeInt32, bson.TypeInt64},
+			{DiffValueChanged, []string{"str"}, bson.TypeString, bson.TypeInt32},
+			{
+				DiffFieldOrder,
+				[]string{"sub"},
+				bson.TypeEmbeddedDocument,
+				bson.TypeEmbeddedDocument,
+			},
+			{DiffValueChanged, []string{"arr", "1"}, bson.TypeString, bson.TypeString},
+			{DiffRemoved, []string{"arr", "2"}, bson.TypeString, 0},
+			{DiffValueChanged, []string{"dec"}, bson.TypeDecimal128, bson.TypeDecimal128},
+			{DiffAdded, []string{"new"}, 0, bson.TypeBoolean},
+		},
+		summaries,
+	)
+
+	assert.Equal(t, "removed [`gone`]: \"x\" (string)", diffs[0].String())
+	assert.Equal(
+		t,
+		"type changed [`num`]: "+
+			`{"$numberInt":"5"} (32-bit integer) -> {"$numberLong":"5"} (64-bit integer)`,
+		diffs[1].String(),
+	)
+}
+
+func TestDiff_TopLevelFieldOrder(t *testing.T) {
+	a := lo.Must(bson.Marshal(bson.D{{"a", int32(1)}, {"b", int32(2)}, {"c", int32(3)}}))
+	b := lo.Must(bson.Marshal(bson.D{{"b", int32(2)}, {"a", int32(1)}}))
+
+	diffs, err := Diff(a, b)
+	require.NoError(t, err)
+	require.Len(t, diffs, 2)
+
+	assert.Equal(t, DiffRemoved, diffs[0].Kind)
+	assert.Equal(t, DiffFieldOrder, diffs[1].Kind)
+	assert.Empty(t, diffs[1].Path)
+}
+
+func TestDiff_Invalid(t *testing.T) {
+	good := lo.Must(bson.Marshal(bson.D{{"a", int32(1)}}))
+
+	_, err := Diff(good, bson.Raw{6, 0, 0, 0, 0})
+	assert.Error(t, err)
+}
@@ -22,9 +22,9 @@ type PointerTooDeepError struct {
 
 func (pe PointerTooDeepError) Error() string {
 	return fmt.Sprintf(
-		"cannot delete %#q from BSON doc because %#q is of a simple type (%s)",
-		pe.givenPointer,
-		pe.elementPointer,
+		"cannot reach %#q in BSON doc because %#q is of a simple type (%s)",
+		formatPointerForDisplay(pe.givenPointer),
+		formatPointerForDisplay(pe.elementPointer),
 		pe.elementType,
 	)
 }
@@ -60,6 +60,9 @@ func ReplaceInRaw[T ~[]byte](raw T, newValue bson.RawValue, pointer ...string) (
 
 // RemoveFromRaw is like ReplaceInRaw, but it removes the element.
 //
+// NB: Removing an array element this way leaves a gap in the array’s keys.
+// Use RemoveFromRawArray to keep the array valid.
+//
 // Example usage (replaces /role/title):
 //
 //	rawDoc, found, err = RemoveFromRaw(rawDoc, "role", "title")
@@ -72,6 +75,10 @@ func replaceOrRemoveInRaw[T ~[]byte](
 	replacement *bson.RawValue,
 	pointer []string,
 ) (T, bool, error) {
+	if len(pointer) == 0 {
+		return nil, false, fmt.Errorf("document pointer must not be empty")
+	}
+
 	sizeFromHeader, _, ok := bsoncore.ReadLength(raw)
 	if !ok {
 		return nil, false, fmt.Errorf("too few bytes to read BSON length")
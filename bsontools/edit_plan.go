@@ -0,0 +1,451 @@
+package bsontools
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+type editOpKind int
+
+const (
+	editReplace editOpKind = iota + 1
+	editRemove
+	editSet
+)
+
+// EditConflictError indicates that an EditPlan’s edits overlap, e.g., if one
+// edit removes /a while another replaces /a/b.
+type EditConflictError struct {
+	ExistingPointer []string
+	NewPointer      []string
+}
+
+func (ece EditConflictError) Error() string {
+	return fmt.Sprintf(
+		"edit of %#q conflicts with edit of %#q",
+		formatPointerForDisplay(ece.NewPointer),
+		formatPointerForDisplay(ece.ExistingPointer),
+	)
+}
+
+// EditPlan applies many edits to a BSON document in a single pass. This is
+// much faster than successive calls to ReplaceInRaw, RemoveFromRaw, and
+// SetInRaw, each of which rescans (and may reallocate) the document.
+//
+// An EditPlan’s edits must not overlap: no edit’s pointer may equal or
+// contain another’s. Violations cause an EditConflictError.
+//
+// Once built, an EditPlan may be applied to any number of documents, and
+// concurrently. (Building the plan is not concurrency-safe, though.)
+//
+// Example usage:
+//
+//	plan := &EditPlan{}
+//	err := plan.Remove("password")
+//	...
+//	err = plan.Set(bsontools.ToRawValue(true), "meta", "redacted")
+//	...
+//	for _, doc := range docs {
+//		buf, _, err = plan.Apply(buf[:0], doc)
+//		...
+//	}
+//
+// The zero value is an empty plan, ready for use.
+type EditPlan struct {
+	root editNode
+}
+
+type editNode struct {
+	pointer []string
+
+	// For final nodes:
+	op    editOpKind
+	value bson.RawValue
+
+	// For nonfinal nodes:
+	children      map[string]*editNode
+	childrenOrder []*editNode
+	hasSet        bool
+
+	// This node’s position in its parent’s childrenOrder.
+	idx int
+}
+
+// Replace adds an edit that replaces the pointer’s referent, if it exists.
+// This is equivalent to ReplaceInRaw.
+func (ep *EditPlan) Replace(value bson.RawValue, pointer ...string) error {
+	return ep.add(editReplace, value, pointer)
+}
+
+// Remove adds an edit that removes the pointer’s referent, if it exists.
+// This is equivalent to RemoveFromRaw.
+func (ep *EditPlan) Remove(pointer ...string) error {
+	return ep.add(editRemove, bson.RawValue{}, pointer)
+}
+
+// Set adds an edit that sets the pointer’s referent, creating it (and any
+// missing intermediate documents) if needed. This is equivalent to SetInRaw.
+func (ep *EditPlan) Set(value bson.RawValue, pointer ...string) error {
+	return ep.add(editSet, value, pointer)
+}
+
+func (ep *EditPlan) add(op editOpKind, value bson.RawValue, pointer []string) error {
+	if len(pointer) == 0 {
+		return fmt.Errorf("document pointer must not be empty")
+	}
+
+	if existing := ep.findConflict(pointer); existing != nil {
+		return EditConflictError{
+			ExistingPointer: existing,
+			NewPointer:      slices.Clone(pointer),
+		}
+	}
+
+	node := &ep.root
+
+	for i, segment := range pointer {
+		if op == editSet {
+			node.hasSet = true
+		}
+
+		child, exists := node.children[segment]
+		if !exists {
+			if node.children == nil {
+				node.children = map[string]*editNode{}
+			}
+
+			child = &editNode{
+				pointer: slices.Clone(pointer[:i+1]),
+				idx:     len(node.childrenOrder),
+			}
+
+			node.children[segment] = child
+			node.childrenOrder = append(node.childrenOrder, child)
+		}
+
+		node = child
+	}
+
+	node.op = op
+	node.value = value
+	node.hasSet = op == editSet
+
+	return nil
+}
+
+// findConflict returns the pointer of an existing edit that overlaps the
+// given pointer, or nil if there is none.
+func (ep *EditPlan) findConflict(pointer []string) []string {
+	node := &ep.root
+
+	for _, segment := range pointer {
+		node = node.children[segment]
+
+		switch {
+		case node == nil:
+			return nil
+		case node.op != 0:
+			return node.pointer
+		}
+	}
+
+	return firstEditPointer(node)
+}
+
+func firstEditPointer(node *editNode) []string {
+	for node.op == 0 {
+		node = node.childrenOrder[0]
+	}
+
+	return node.pointer
+}
+
+// Apply applies the plan’s edits to a document and appends the result to
+// dst. It returns the new document (i.e., the appended part of dst) as well
+// as the number of edits that applied. (Replace & Remove edits whose
+// referents are missing do not apply; Set edits always apply.)
+//
+// The input document is not modified. If dst has enough capacity, this
+// allocates only for plan nodes that have more than 16 children.
+//
+// As with ReplaceInRaw, if any nonfinal pointer node is a scalar value, a
+// PointerTooDeepError is returned.
+func (ep *EditPlan) Apply(dst, doc []byte) (bson.Raw, int, error) {
+	start := len(dst)
+
+	out, applied, err := ep.root.applyToDoc(dst, doc, false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return bson.Raw(out[start:]), applied, nil
+}
+
+//nolint:cyclop,funlen
+func (node *editNode) applyToDoc(out, doc []byte, isArray bool) ([]byte, int, error) {
+	remaining, err := elementsBlock(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// NB: This usually avoids heap allocation.
+	var seenBuf [16]bool
+
+	var seen []bool
+	if len(node.childrenOrder) <= len(seenBuf) {
+		seen = seenBuf[:len(node.childrenOrder)]
+	} else {
+		seen = make([]bool, len(node.childrenOrder))
+	}
+
+	docAt := len(out)
+	out = append(out, 0, 0, 0, 0)
+
+	applied := 0
+	elsCount := 0
+
+	for len(remaining) > 0 {
+		var el bsoncore.Element
+		var ok bool
+
+		el, remaining, ok = bsoncore.ReadElement(remaining)
+		if !ok {
+			return nil, 0, bsoncore.NewInsufficientBytesError(doc, remaining)
+		}
+
+		elsCount++
+
+		keyBytes := el.KeyBytes()
+
+		child := node.children[string(keyBytes)]
+		if child == nil || seen[child.idx] {
+			out = append(out, el...)
+			continue
+		}
+
+		seen[child.idx] = true
+
+		elType := bson.Type(el[0])
+
+		switch child.op {
+		case editRemove:
+			applied++
+		case editReplace, editSet:
+			out = appendRawElement(out, keyBytes, child.value)
+			applied++
+		default:
+			if elType != bson.TypeEmbeddedDocument && elType != bson.TypeArray {
+				return nil, 0, PointerTooDeepError{
+					givenPointer:   firstEditPointer(child),
+					elementType:    elType,
+					elementPointer: child.pointer,
+				}
+			}
+
+			out = append(out, el[:len(keyBytes)+2]...)
+
+			var subApplied int
+			out, subApplied, err = child.applyToDoc(
+				out,
+				el[len(keyBytes)+2:],
+				elType == bson.TypeArray,
+			)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			applied += subApplied
+		}
+	}
+
+	if node.hasSet {
+		var created int
+		out, created, err = node.appendMissing(out, seen, isArray, elsCount)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		applied += created
+	}
+
+	out = append(out, 0)
+
+	if err := putDocLength(out, docAt); err != nil {
+		return nil, 0, err
+	}
+
+	return out, applied, nil
+}
+
+// appendMissing appends the elements that the node’s Set edits create.
+func (node *editNode) appendMissing(
+	out []byte,
+	seen []bool,
+	isArray bool,
+	elsCount int,
+) ([]byte, int, error) {
+	if isArray {
+		return node.appendMissingToArray(out, seen, elsCount)
+	}
+
+	applied := 0
+
+	for _, child := range node.childrenOrder {
+		if seen[child.idx] || !child.hasSet {
+			continue
+		}
+
+		var created int
+		var err error
+
+		out, created, err = child.appendCreated(out)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		applied += created
+	}
+
+	return out, applied, nil
+}
+
+type missingArrayElement struct {
+	index int
+	node  *editNode
+}
+
+// appendMissingToArray is like appendMissing but for arrays, where the new
+// elements go in index order and nulls pad any gaps.
+func (node *editNode) appendMissingToArray(
+	out []byte,
+	seen []bool,
+	elsCount int,
+) ([]byte, int, error) {
+	// NB: This usually avoids heap allocation.
+	var missingBuf [16]missingArrayElement
+
+	missing := missingBuf[:0]
+
+	for _, child := range node.childrenOrder {
+		if seen[child.idx] || !child.hasSet {
+			continue
+		}
+
+		index, err := parseArrayIndex(child.pointer[len(child.pointer)-1])
+		if err != nil {
+			return nil, 0, fmt.Errorf(
+				"setting %#q: %w",
+				formatPointerForDisplay(firstSetPointer(child)),
+				err,
+			)
+		}
+
+		missing = append(missing, missingArrayElement{index, child})
+	}
+
+	slices.SortFunc(missing, func(a, b missingArrayElement) int {
+		return cmp.Compare(a.index, b.index)
+	})
+
+	applied := 0
+
+	for _, m := range missing {
+		for ; elsCount < m.index; elsCount++ {
+			out = append(out, byte(bson.TypeNull))
+			out = strconv.AppendInt(out, int64(elsCount), 10)
+			out = append(out, 0)
+		}
+
+		elsCount++
+
+		var created int
+		var err error
+
+		out, created, err = m.node.appendCreated(out)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		applied += created
+	}
+
+	return out, applied, nil
+}
+
+func firstSetPointer(node *editNode) []string {
+	for node.op == 0 {
+		for _, child := range node.childrenOrder {
+			if child.hasSet {
+				node = child
+				break
+			}
+		}
+	}
+
+	return node.pointer
+}
+
+// appendCreated appends an element that contains only the node’s Set edits.
+func (node *editNode) appendCreated(out []byte) ([]byte, int, error) {
+	key := node.pointer[len(node.pointer)-1]
+
+	if node.op == editSet {
+		return appendRawElement(out, []byte(key), node.value), 1, nil
+	}
+
+	out = bsoncore.AppendHeader(out, bsoncore.TypeEmbeddedDocument, key)
+	docAt := len(out)
+	out = append(out, 0, 0, 0, 0)
+
+	applied := 0
+
+	for _, child := range node.childrenOrder {
+		if !child.hasSet {
+			continue
+		}
+
+		var created int
+		var err error
+
+		out, created, err = child.appendCreated(out)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		applied += created
+	}
+
+	out = append(out, 0)
+
+	return out, applied, putDocLength(out, docAt)
+}
+
+func appendRawElement(out, key []byte, value bson.RawValue) []byte {
+	out = append(out, byte(value.Type))
+	out = append(out, key...)
+	out = append(out, 0)
+
+	return append(out, value.Value...)
+}
+
+// putDocLength writes the length header of the just-finished document that
+// starts at the given offset.
+//
+// NB: Unlike addToDocLength, this avoids safecast, which allocates.
+func putDocLength(out []byte, docAt int) error {
+	length := len(out) - docAt
+	if length < 0 || length > math.MaxInt32 {
+		return fmt.Errorf("invalid document length (%d)", length)
+	}
+
+	binary.LittleEndian.PutUint32(out[docAt:], uint32(length))
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package bsontools
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestEditPlan(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"secret", "hunter2"},
+		{"sub", bson.D{{"x", "y"}, {"drop", true}}},
+		{"arr", bson.A{"zero", bson.D{{"k", "v"}}}},
+		{"z", true},
+	}))
+
+	plan := &EditPlan{}
+	require.NoError(t, plan.Replace(ToRawValue("replaced"), "a"))
+	require.NoError(t, plan.Remove("secret"))
+	require.NoError(t, plan.Remove("sub", "drop"))
+	require.NoError(t, plan.Set(ToRawValue(int64(2)), "sub", "added"))
+	require.NoError(t, plan.Set(ToRawValue("four"), "arr", "4"))
+	require.NoError(t, plan.Set(ToRawValue("two"), "arr", "2"))
+	require.NoError(t, plan.Set(ToRawValue("v2"), "arr", "1", "k"))
+	require.NoError(t, plan.Set(ToRawValue(int32(1)), "new", "deep", "x"))
+	require.NoError(t, plan.Set(ToRawValue(int32(2)), "new", "deep", "y"))
+	require.NoError(t, plan.Replace(ToRawValue("nope"), "missing", "field"))
+	require.NoError(t, plan.Remove("missing2"))
+
+	out, applied, err := plan.Apply(nil, raw)
+	require.NoError(t, err)
+	require.NoError(t, out.Validate())
+	assert.Equal(t, 9, applied, "applied count")
+
+	expected := lo.Must(bson.Marshal(bson.D{
+		{"a", "replaced"},
+		{"sub", bson.D{{"x", "y"}, {"added", int64(2)}}},
+		{"arr", bson.A{"zero", bson.D{{"k", "v2"}}, "two", nil, "four"}},
+		{"z", true},
+		{"new", bson.D{{"deep", bson.D{{"x", int32(1)}, {"y", int32(2)}}}}},
+	}))
+	assert.Equal(t, bson.Raw(expected), out)
+
+	// The plan is reusable, and the input is untouched.
+	prefix := []byte("prefix")
+	out2, _, err := plan.Apply(prefix, raw)
+	require.NoError(t, err)
+	assert.Equal(t, out, out2)
+}
+
+func TestEditPlan_MatchesSingleEdits(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"b", bson.D{{"c", "d"}, {"e", "f"}}},
+		{"g", bson.A{int32(1), int32(2)}},
+	}))
+
+	plan := &EditPlan{}
+	require.NoError(t, plan.Remove("b", "c"))
+	require.NoError(t, plan.Replace(ToRawValue(true), "g", "1"))
+	require.NoError(t, plan.Set(ToRawValue("h"), "b", "i"))
+
+	fromPlan, _, err := plan.Apply(nil, raw)
+	require.NoError(t, err)
+
+	expected, _, err := RemoveFromRaw(bson.Raw(raw), "b", "c")
+	require.NoError(t, err)
+	expected, _, err = ReplaceInRaw(expected, ToRawValue(true), "g", "1")
+	require.NoError(t, err)
+	expected, err = SetInRaw(expected, ToRawValue("h"), "b", "i")
+	require.NoError(t, err)
+
+	assert.Equal(t, expected, fromPlan)
+}
+
+func TestEditPlan_Conflicts(t *testing.T) {
+	plan := &EditPlan{}
+	require.NoError(t, plan.Remove("a", "b"))
+	require.NoError(t, plan.Remove("a", "c"))
+
+	cases := []struct {
+		pointer  []string
+		existing []string
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]string{"a"}, []string{"a", "b"}},
+		{[]string{"a", "c", "d"}, []string{"a", "c"}},
+	}
+
+	for _, c := range cases {
+		err := plan.Set(ToRawValue(int32(1)), c.pointer...)
+
+		var conflict EditConflictError
+		require.ErrorAs(t, err, &conflict, "%#q", c.pointer)
+		assert.Equal(t, c.pointer, conflict.NewPointer)
+		assert.Equal(t, c.existing, conflict.ExistingPointer)
+	}
+
+	assert.Error(t, plan.Remove())
+
+	require.NoError(t, plan.Remove("x", "y", "z"))
+	assert.Error(t, plan.Set(ToRawValue(int32(1)), "x", "y"))
+
+	// Failed additions leave the plan as it was.
+	raw := lo.Must(bson.Marshal(bson.D{{"a", bson.D{{"b", 1}, {"c", 2}, {"d", 3}}}}))
+	out, applied, err := plan.Apply(nil, raw)
+	require.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.Equal(
+		t,
+		bson.Raw(lo.Must(bson.Marshal(bson.D{{"a", bson.D{{"d", 3}}}}))),
+		out,
+	)
+}
+
+func TestEditPlan_Errors(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"arr", bson.A{int32(1)}},
+	}))
+
+	plan := &EditPlan{}
+	require.NoError(t, plan.Replace(ToRawValue("x"), "a", "b", "c"))
+
+	_, _, err := plan.Apply(nil, raw)
+
+	var pe PointerTooDeepError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, []string{"a", "b", "c"}, pe.givenPointer)
+	assert.Equal(t, []string{"a"}, pe.elementPointer)
+
+	plan = &EditPlan{}
+	require.NoError(t, plan.Set(ToRawValue("x"), "arr", "foo"))
+
+	_, _, err = plan.Apply(nil, raw)
+	assert.ErrorContains(t, err, "array index")
+	assert.ErrorContains(t, err, "arr.foo")
+
+	_, _, err = plan.Apply(nil, raw[:len(raw)-1])
+	assert.Error(t, err, "truncated document")
+}
+
+func TestEditPlan_NoAllocations(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"sub", bson.D{{"x", "y"}, {"drop", true}}},
+		{"arr", bson.A{}},
+	}))
+
+	plan := &EditPlan{}
+	require.NoError(t, plan.Remove("sub", "drop"))
+	require.NoError(t, plan.Replace(ToRawValue("b"), "a"))
+	require.NoError(t, plan.Set(ToRawValue(int32(2)), "sub", "new", "x"))
+	require.NoError(t, plan.Set(ToRawValue(int32(3)), "arr", "2"))
+	require.NoError(t, plan.Set(ToRawValue(int32(4)), "arr", "0"))
+
+	for _, key := range []string{"s1", "s2", "s3", "s4", "s5", "s6"} {
+		require.NoError(t, plan.Set(ToRawValue(key), key))
+	}
+
+	buf := make([]byte, 0, 4*len(raw))
+
+	edited, applied, err := plan.Apply(buf[:0], raw)
+	require.NoError(t, err)
+	assert.Equal(t, 11, applied)
+	assert.Equal(
+		t,
+		bson.Raw(lo.Must(bson.Marshal(bson.D{
+			{"a", "b"},
+			{"sub", bson.D{{"x", "y"}, {"new", bson.D{{"x", int32(2)}}}}},
+			{"arr", bson.A{int32(4), nil, int32(3)}},
+			{"s1", "s1"},
+			{"s2", "s2"},
+			{"s3", "s3"},
+			{"s4", "s4"},
+			{"s5", "s5"},
+			{"s6", "s6"},
+		}))),
+		edited,
+	)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _, err := plan.Apply(buf[:0], raw)
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	assert.Zero(t, allocs)
+}
@@ -0,0 +1,253 @@
+package bsontools
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// EqualityMode determines how EqualIgnoringOrder treats field order.
+type EqualityMode int
+
+const (
+	// EqualBytewise means the documents must be bytewise identical.
+	// EqualOptions.Doubles is ignored.
+	EqualBytewise EqualityMode = iota
+
+	// EqualIgnoreOrder ignores field order in every embedded document
+	// (including the top-level document). Array elements’ order always
+	// matters.
+	EqualIgnoreOrder
+
+	// EqualIgnoreOrderAtPaths ignores field order only in the embedded
+	// documents at EqualOptions.UnorderedPaths.
+	EqualIgnoreOrderAtPaths
+)
+
+// DoubleEquality determines how EqualIgnoringOrder compares doubles.
+type DoubleEquality int
+
+const (
+	// DoublesBitwise compares doubles’ binary representations, so a NaN
+	// equals an identical NaN, but -0 does not equal 0.
+	DoublesBitwise DoubleEquality = iota
+
+	// DoublesServer compares doubles as the server does: -0 equals 0, and
+	// all NaNs are equal.
+	DoublesServer
+)
+
+// EqualOptions configures EqualIgnoringOrder.
+type EqualOptions struct {
+	Mode EqualityMode
+
+	// UnorderedPaths lists document pointers to the embedded documents
+	// whose field order EqualIgnoreOrderAtPaths ignores. An empty pointer
+	// refers to the top-level document. Array elements are given by index.
+	UnorderedPaths [][]string
+
+	Doubles DoubleEquality
+}
+
+// EqualIgnoringOrder compares two BSON documents for equality, optionally
+// ignoring the order of their fields. (See EqualityMode.)
+//
+// Except in EqualBytewise mode, values must be of the same BSON type to be
+// equal; e.g., int32(1) does not equal int64(1). Doubles compare according
+// to opts.Doubles; all other scalar values compare bytewise.
+//
+// When field order is ignored and a document contains duplicate field names,
+// the duplicates’ relative order still matters, as with SortFields.
+//
+// This avoids unmarshaling, and it only allocates when field order actually
+// differs. An error is returned if either document is malformed.
+func EqualIgnoringOrder[D ~[]byte](a, b D, opts EqualOptions) (bool, error) {
+	if opts.Mode == EqualBytewise {
+		if _, err := elementsBlock(a); err != nil {
+			return false, fmt.Errorf("parsing document A: %w", err)
+		}
+
+		if _, err := elementsBlock(b); err != nil {
+			return false, fmt.Errorf("parsing document B: %w", err)
+		}
+
+		return bytes.Equal(a, b), nil
+	}
+
+	eq := equalityChecker{opts: opts}
+
+	return eq.documentsEqual(a, b, !eq.isUnorderedPath())
+}
+
+type equalityChecker struct {
+	opts EqualOptions
+
+	// path is the current document pointer, which we only track for
+	// EqualIgnoreOrderAtPaths.
+	path []string
+}
+
+func (eq *equalityChecker) isUnorderedPath() bool {
+	switch eq.opts.Mode {
+	case EqualIgnoreOrder:
+		return true
+	case EqualIgnoreOrderAtPaths:
+		return slices.ContainsFunc(eq.opts.UnorderedPaths, func(p []string) bool {
+			return slices.Equal(p, eq.path)
+		})
+	}
+
+	return false
+}
+
+func (eq *equalityChecker) documentsEqual(a, b []byte, ordered bool) (bool, error) {
+	aRem, err := elementsBlock(a)
+	if err != nil {
+		return false, fmt.Errorf("parsing document A at %#q: %w", eq.path, err)
+	}
+
+	bRem, err := elementsBlock(b)
+	if err != nil {
+		return false, fmt.Errorf("parsing document B at %#q: %w", eq.path, err)
+	}
+
+	// Compare elements pairwise for as long as their keys match. This
+	// handles all ordered comparisons as well as unordered ones whose
+	// orders happen to match.
+	for len(aRem) > 0 && len(bRem) > 0 {
+		aEl, aNext, ok := bsoncore.ReadElement(aRem)
+		if !ok {
+			return false, bsoncore.NewInsufficientBytesError(a, aRem)
+		}
+
+		bEl, bNext, ok := bsoncore.ReadElement(bRem)
+		if !ok {
+			return false, bsoncore.NewInsufficientBytesError(b, bRem)
+		}
+
+		if !bytes.Equal(aEl.KeyBytes(), bEl.KeyBytes()) {
+			if ordered {
+				return false, nil
+			}
+
+			break
+		}
+
+		equal, err := eq.elementsEqual(aEl, bEl)
+		if err != nil || !equal {
+			return false, err
+		}
+
+		aRem, bRem = aNext, bNext
+	}
+
+	if len(aRem) == 0 || len(bRem) == 0 {
+		return len(aRem) == len(bRem), nil
+	}
+
+	return eq.unorderedElementsEqual(aRem, bRem)
+}
+
+// unorderedElementsEqual compares two documents’ element blocks after
+// stably sorting each by key.
+func (eq *equalityChecker) unorderedElementsEqual(aRem, bRem []byte) (bool, error) {
+	aEls, err := readElementsBlock(aRem)
+	if err != nil {
+		return false, fmt.Errorf("parsing document A at %#q: %w", eq.path, err)
+	}
+
+	bEls, err := readElementsBlock(bRem)
+	if err != nil {
+		return false, fmt.Errorf("parsing document B at %#q: %w", eq.path, err)
+	}
+
+	if len(aEls) != len(bEls) {
+		return false, nil
+	}
+
+	byKey := func(x, y bsoncore.Element) int {
+		return bytes.Compare(x.KeyBytes(), y.KeyBytes())
+	}
+
+	slices.SortStableFunc(aEls, byKey)
+	slices.SortStableFunc(bEls, byKey)
+
+	for i := range aEls {
+		if byKey(aEls[i], bEls[i]) != 0 {
+			return false, nil
+		}
+
+		equal, err := eq.elementsEqual(aEls[i], bEls[i])
+		if err != nil || !equal {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func readElementsBlock(block []byte) ([]bsoncore.Element, error) {
+	var els []bsoncore.Element
+
+	for rem := block; len(rem) > 0; {
+		var el bsoncore.Element
+		var ok bool
+
+		el, rem, ok = bsoncore.ReadElement(rem)
+		if !ok {
+			return nil, bsoncore.NewInsufficientBytesError(block, rem)
+		}
+
+		els = append(els, el)
+	}
+
+	return els, nil
+}
+
+// elementsEqual compares two elements’ values. The caller has already
+// compared the keys.
+func (eq *equalityChecker) elementsEqual(a, b bsoncore.Element) (bool, error) {
+	aVal, err := a.ValueErr()
+	if err != nil {
+		return false, fmt.Errorf("parsing %#q in document A: %w", a.Key(), err)
+	}
+
+	bVal, err := b.ValueErr()
+	if err != nil {
+		return false, fmt.Errorf("parsing %#q in document B: %w", b.Key(), err)
+	}
+
+	if aVal.Type != bVal.Type {
+		return false, nil
+	}
+
+	switch bson.Type(aVal.Type) {
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+		if eq.opts.Mode == EqualIgnoreOrderAtPaths {
+			eq.path = append(eq.path, string(a.KeyBytes()))
+			defer func() { eq.path = eq.path[:len(eq.path)-1] }()
+		}
+
+		ordered := bson.Type(aVal.Type) == bson.TypeArray || !eq.isUnorderedPath()
+
+		return eq.documentsEqual(aVal.Data, bVal.Data, ordered)
+	case bson.TypeDouble:
+		if eq.opts.Doubles == DoublesServer {
+			aFloat, aOK := aVal.DoubleOK()
+			bFloat, bOK := bVal.DoubleOK()
+			if !aOK || !bOK {
+				return false, fmt.Errorf("invalid BSON %s at %#q", bson.TypeDouble, a.Key())
+			}
+
+			// NB: cmp.Compare considers all NaNs equal & -0 equal to 0, as
+			// does the server.
+			return cmp.Compare(aFloat, bFloat) == 0, nil
+		}
+	}
+
+	return bytes.Equal(aVal.Data, bVal.Data), nil
+}
@@ -0,0 +1,141 @@
+package bsontools
+
+import (
+	"math"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestEqualIgnoringOrder(t *testing.T) {
+	doc := bson.D{
+		{"a", int32(1)},
+		{"b", bson.D{{"x", "x"}, {"y", bson.A{bson.D{{"p", 1}, {"q", 2}}}}}},
+		{"nan", math.NaN()},
+	}
+
+	topSwapped := bson.D{doc[1], doc[0], doc[2]}
+
+	nestedSwapped := bson.D{
+		{"a", int32(1)},
+		{"b", bson.D{{"y", bson.A{bson.D{{"q", 2}, {"p", 1}}}}, {"x", "x"}}},
+		{"nan", math.NaN()},
+	}
+
+	allSwapped := bson.D{nestedSwapped[2], nestedSwapped[1], nestedSwapped[0]}
+
+	type testCase struct {
+		other  bson.D
+		opts   EqualOptions
+		expect bool
+	}
+
+	unorderedAt := func(paths ...[]string) EqualOptions {
+		return EqualOptions{Mode: EqualIgnoreOrderAtPaths, UnorderedPaths: paths}
+	}
+
+	for i, tc := range []testCase{
+		{doc, EqualOptions{}, true},
+		{topSwapped, EqualOptions{}, false},
+		{doc, EqualOptions{Mode: EqualIgnoreOrder}, true},
+		{topSwapped, EqualOptions{Mode: EqualIgnoreOrder}, true},
+		{allSwapped, EqualOptions{Mode: EqualIgnoreOrder}, true},
+		{doc, unorderedAt(), true},
+		{topSwapped, unorderedAt(), false},
+		{topSwapped, unorderedAt([]string{}), true},
+		{allSwapped, unorderedAt([]string{}), false},
+		{allSwapped, unorderedAt([]string{}, []string{"b"}), false},
+		{allSwapped, unorderedAt([]string{}, []string{"b"}, []string{"b", "y", "0"}), true},
+		{nestedSwapped, unorderedAt([]string{"b"}, []string{"b", "y", "0"}), true},
+		{
+			bson.D{{"a", int64(1)}, doc[1], doc[2]},
+			EqualOptions{Mode: EqualIgnoreOrder},
+			false,
+		},
+		{
+			bson.D{doc[0], doc[1]},
+			EqualOptions{Mode: EqualIgnoreOrder},
+			false,
+		},
+		{
+			bson.D{doc[0], doc[1], doc[2], {"extra", 1}},
+			EqualOptions{Mode: EqualIgnoreOrder},
+			false,
+		},
+	} {
+		a := lo.Must(bson.Marshal(doc))
+		b := lo.Must(bson.Marshal(tc.other))
+
+		equal, err := EqualIgnoringOrder(a, b, tc.opts)
+		require.NoError(t, err, "case %d", i)
+		assert.Equal(t, tc.expect, equal, "case %d: %v vs. %v (%+v)", i, doc, tc.other, tc.opts)
+
+		equal, err = EqualIgnoringOrder(b, a, tc.opts)
+		require.NoError(t, err, "case %d (reversed)", i)
+		assert.Equal(t, tc.expect, equal, "case %d (reversed)", i)
+	}
+}
+
+func TestEqualIgnoringOrder_Arrays(t *testing.T) {
+	a := lo.Must(bson.Marshal(bson.D{{"arr", bson.A{1, 2}}}))
+	b := lo.Must(bson.Marshal(bson.D{{"arr", bson.A{2, 1}}}))
+
+	equal, err := EqualIgnoringOrder(a, b, EqualOptions{Mode: EqualIgnoreOrder})
+	require.NoError(t, err)
+	assert.False(t, equal, "array order should matter")
+}
+
+func TestEqualIgnoringOrder_DuplicateKeys(t *testing.T) {
+	a := lo.Must(bson.Marshal(bson.D{{"x", 1}, {"y", 2}, {"x", 3}}))
+	b := lo.Must(bson.Marshal(bson.D{{"y", 2}, {"x", 1}, {"x", 3}}))
+	c := lo.Must(bson.Marshal(bson.D{{"y", 2}, {"x", 3}, {"x", 1}}))
+
+	opts := EqualOptions{Mode: EqualIgnoreOrder}
+
+	equal, err := EqualIgnoringOrder(a, b, opts)
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	equal, err = EqualIgnoringOrder(a, c, opts)
+	require.NoError(t, err)
+	assert.False(t, equal, "duplicates’ relative order should matter")
+}
+
+func TestEqualIgnoringOrder_Doubles(t *testing.T) {
+	negZero := lo.Must(bson.Marshal(bson.D{{"n", math.Copysign(0, -1)}}))
+	posZero := lo.Must(bson.Marshal(bson.D{{"n", 0.0}}))
+	nan1 := lo.Must(bson.Marshal(bson.D{{"n", math.NaN()}}))
+	nan2 := lo.Must(bson.Marshal(bson.D{{"n", math.Float64frombits(0x7ff8000000000000)}}))
+
+	bitwise := EqualOptions{Mode: EqualIgnoreOrder, Doubles: DoublesBitwise}
+	server := EqualOptions{Mode: EqualIgnoreOrder, Doubles: DoublesServer}
+
+	for _, tc := range []struct {
+		a, b   bson.Raw
+		opts   EqualOptions
+		expect bool
+	}{
+		{nan1, nan1, bitwise, true},
+		{nan1, nan2, bitwise, false},
+		{nan1, nan2, server, true},
+		{negZero, posZero, bitwise, false},
+		{negZero, posZero, server, true},
+		{nan1, posZero, server, false},
+	} {
+		equal, err := EqualIgnoringOrder(tc.a, tc.b, tc.opts)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expect, equal, "%v vs. %v (%+v)", tc.a, tc.b, tc.opts)
+	}
+}
+
+func TestEqualIgnoringOrder_Invalid(t *testing.T) {
+	valid := lo.Must(bson.Marshal(bson.D{{"a", 1}}))
+
+	for _, mode := range []EqualityMode{EqualBytewise, EqualIgnoreOrder} {
+		_, err := EqualIgnoringOrder(valid, valid[:len(valid)-1], EqualOptions{Mode: mode})
+		assert.Error(t, err, "mode %d", mode)
+	}
+}
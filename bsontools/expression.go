@@ -0,0 +1,509 @@
+package bsontools
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// ExpressionError indicates that an aggregation expression is invalid or
+// uses unsupported features, or that its evaluation failed as it would on
+// the server (e.g., `$toInt` of a non-numeric string).
+type ExpressionError struct {
+	// Operator is the operator at fault (e.g., `$add`), or empty if the
+	// problem isn’t specific to one operator.
+	Operator string
+
+	// Reason describes what is wrong.
+	Reason string
+}
+
+func (ee ExpressionError) Error() string {
+	if ee.Operator == "" {
+		return "invalid expression: " + ee.Reason
+	}
+
+	return fmt.Sprintf("%s: %s", ee.Operator, ee.Reason)
+}
+
+// Expression is a compiled aggregation expression. It evaluates against
+// documents client-side with the server’s semantics, including its handling
+// of null & missing values and of numeric overflow.
+//
+// The supported expressions are:
+//   - literals, field paths (e.g., `"$a.b"`), and the `$$ROOT`, `$$CURRENT`,
+//     and `$$REMOVE` variables
+//   - documents & arrays of expressions
+//   - `$literal`
+//   - arithmetic: `$add`, `$subtract`, `$multiply`, `$divide`, `$mod`, &
+//     `$abs`
+//   - comparison: `$eq`, `$ne`, `$gt`, `$gte`, `$lt`, `$lte`, & `$cmp`
+//   - conditionals: `$cond`, `$ifNull`, & `$switch`
+//   - `$concat`
+//   - type handling: `$type`, `$convert`, `$toBool`, `$toDate`,
+//     `$toDecimal`, `$toDouble`, `$toInt`, `$toLong`, `$toObjectId`, &
+//     `$toString`
+//   - `$getField` & `$setField`
+//
+// Strings compare bytewise, as with the simple collation.
+//
+// An Expression is safe for concurrent use.
+type Expression struct {
+	root exprNode
+}
+
+// CompileExpression parses an aggregation expression. A failure to parse
+// the expression is returned as ExpressionError.
+//
+// Example usage:
+//
+//	expr, err := bsontools.CompileExpression(bsontools.ToRawValue(bson.Raw(spec)))
+//	...
+//	result, err := expr.Evaluate(doc)
+func CompileExpression(expr bson.RawValue) (*Expression, error) {
+	root, err := compileExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Expression{root: root}, nil
+}
+
+// Evaluate evaluates the expression against the given document. If the
+// result is missing (e.g., a field path that the document lacks), this
+// returns a zero RawValue.
+//
+// An error is returned if the document is malformed or if evaluation fails
+// as it would on the server; the latter is an ExpressionError.
+func (e *Expression) Evaluate(doc bson.Raw) (bson.RawValue, error) {
+	ctx := &exprContext{
+		root: bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: doc},
+	}
+
+	return e.root.evaluate(ctx)
+}
+
+type exprContext struct {
+	root bson.RawValue
+}
+
+// exprNode is a compiled expression. A zero RawValue indicates a missing
+// value.
+type exprNode interface {
+	evaluate(ctx *exprContext) (bson.RawValue, error)
+}
+
+// exprFunc adapts a function to exprNode.
+type exprFunc func(ctx *exprContext) (bson.RawValue, error)
+
+func (ef exprFunc) evaluate(ctx *exprContext) (bson.RawValue, error) {
+	return ef(ctx)
+}
+
+type literalExpr struct {
+	val bson.RawValue
+}
+
+func (le literalExpr) evaluate(*exprContext) (bson.RawValue, error) {
+	return le.val, nil
+}
+
+func compileExpr(val bson.RawValue) (exprNode, error) {
+	switch val.Type {
+	case bson.TypeString:
+		str := val.StringValue()
+
+		switch {
+		case strings.HasPrefix(str, "$$"):
+			return compileVariable(str)
+		case strings.HasPrefix(str, "$"):
+			return compileFieldPath(str)
+		}
+	case bson.TypeEmbeddedDocument:
+		return compileDocumentExpr(val.Document())
+	case bson.TypeArray:
+		return compileArrayExpr(bson.RawArray(val.Value))
+	}
+
+	return literalExpr{val}, nil
+}
+
+func compileExprs(values []bson.RawValue) ([]exprNode, error) {
+	nodes := make([]exprNode, 0, len(values))
+
+	for _, val := range values {
+		node, err := compileExpr(val)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func compileVariable(str string) (exprNode, error) {
+	name, rest, _ := strings.Cut(str[2:], ".")
+
+	var path []string
+	if rest != "" {
+		var err error
+
+		path, err = splitFieldPath(rest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch name {
+	case "ROOT", "CURRENT":
+		return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+			return evaluateFieldPath(ctx.root, path)
+		}), nil
+	case "REMOVE":
+		return literalExpr{}, nil
+	}
+
+	return nil, ExpressionError{Reason: fmt.Sprintf("unsupported variable %#q", "$$"+name)}
+}
+
+func compileFieldPath(str string) (exprNode, error) {
+	path, err := splitFieldPath(str[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+		return evaluateFieldPath(ctx.root, path)
+	}), nil
+}
+
+func splitFieldPath(str string) ([]string, error) {
+	path := strings.Split(str, ".")
+
+	for _, field := range path {
+		switch {
+		case field == "":
+			return nil, ExpressionError{Reason: fmt.Sprintf("field path %#q has an empty field name", str)}
+		case strings.HasPrefix(field, "$"):
+			return nil, ExpressionError{Reason: fmt.Sprintf("field path %#q has a $-prefixed field name", str)}
+		}
+	}
+
+	return path, nil
+}
+
+// evaluateFieldPath follows a path from the given value. As with the server,
+// a path through an array yields an array of the values that the rest of
+// the path reaches from the array’s documents and arrays.
+func evaluateFieldPath(val bson.RawValue, path []string) (bson.RawValue, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+
+	switch val.Type {
+	case bson.TypeEmbeddedDocument:
+		child, err := bson.Raw(val.Value).LookupErr(path[0])
+		if errors.Is(err, bsoncore.ErrElementNotFound) {
+			return bson.RawValue{}, nil
+		}
+
+		if err != nil {
+			return bson.RawValue{}, fmt.Errorf("reading %#q: %w", path[0], err)
+		}
+
+		return evaluateFieldPath(child, path[1:])
+	case bson.TypeArray:
+		elements, err := bson.RawArray(val.Value).Values()
+		if err != nil {
+			return bson.RawValue{}, fmt.Errorf("reading array: %w", err)
+		}
+
+		results := make([]bson.RawValue, 0, len(elements))
+
+		for _, el := range elements {
+			if el.Type != bson.TypeEmbeddedDocument && el.Type != bson.TypeArray {
+				continue
+			}
+
+			result, elErr := evaluateFieldPath(el, path)
+			if elErr != nil {
+				return bson.RawValue{}, elErr
+			}
+
+			if result.Type != 0 {
+				results = append(results, result)
+			}
+		}
+
+		return buildRawArray(results)
+	}
+
+	return bson.RawValue{}, nil
+}
+
+func compileDocumentExpr(doc bson.Raw) (exprNode, error) {
+	first, err := doc.IndexErr(0)
+	if errors.Is(err, bsoncore.ErrOutOfBounds) {
+		return literalExpr{bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: doc}}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression: %w", err)
+	}
+
+	if strings.HasPrefix(first.Key(), "$") {
+		count, countErr := CountRawElements(doc)
+		if countErr != nil {
+			return nil, fmt.Errorf("parsing expression: %w", countErr)
+		}
+
+		if count != 1 {
+			return nil, ExpressionError{
+				Operator: first.Key(),
+				Reason:   "an expression document must contain exactly one field",
+			}
+		}
+
+		return compileOperatorExpr(first.Key(), first.Value())
+	}
+
+	return compileObjectExpr(doc)
+}
+
+type objectExprField struct {
+	key  string
+	node exprNode
+}
+
+func compileObjectExpr(doc bson.Raw) (exprNode, error) {
+	var fields []objectExprField
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return nil, fmt.Errorf("parsing expression: %w", err)
+		}
+
+		key := el.Key()
+
+		switch {
+		case strings.HasPrefix(key, "$"):
+			return nil, ExpressionError{Reason: fmt.Sprintf("field name %#q cannot start with $", key)}
+		case strings.Contains(key, "."):
+			return nil, ExpressionError{Reason: fmt.Sprintf("field name %#q cannot contain .", key)}
+		}
+
+		node, nodeErr := compileExpr(el.Value())
+		if nodeErr != nil {
+			return nil, nodeErr
+		}
+
+		fields = append(fields, objectExprField{key, node})
+	}
+
+	return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+		out := []byte{0, 0, 0, 0}
+
+		for _, field := range fields {
+			val, err := field.node.evaluate(ctx)
+			if err != nil {
+				return bson.RawValue{}, err
+			}
+
+			// As with the server, missing values are omitted.
+			if val.Type != 0 {
+				out = appendRawElement(out, []byte(field.key), val)
+			}
+		}
+
+		out = append(out, 0)
+
+		if err := putDocLength(out, 0); err != nil {
+			return bson.RawValue{}, err
+		}
+
+		return bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: out}, nil
+	}), nil
+}
+
+func compileArrayExpr(arr bson.RawArray) (exprNode, error) {
+	values, err := arr.Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression: %w", err)
+	}
+
+	nodes, err := compileExprs(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+		results, evalErr := evaluateExprs(ctx, nodes)
+		if evalErr != nil {
+			return bson.RawValue{}, evalErr
+		}
+
+		// As with the server, missing values become null.
+		for i, result := range results {
+			if result.Type == 0 {
+				results[i] = bson.RawValue{Type: bson.TypeNull}
+			}
+		}
+
+		return buildRawArray(results)
+	}), nil
+}
+
+func evaluateExprs(ctx *exprContext, nodes []exprNode) ([]bson.RawValue, error) {
+	results := make([]bson.RawValue, len(nodes))
+
+	for i, node := range nodes {
+		var err error
+
+		results[i], err = node.evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func buildRawArray(values []bson.RawValue) (bson.RawValue, error) {
+	out := []byte{0, 0, 0, 0}
+
+	for i, val := range values {
+		out = appendRawElement(out, strconv.AppendInt(nil, int64(i), 10), val)
+	}
+
+	out = append(out, 0)
+
+	if err := putDocLength(out, 0); err != nil {
+		return bson.RawValue{}, err
+	}
+
+	return bson.RawValue{Type: bson.TypeArray, Value: out}, nil
+}
+
+// isNullish indicates whether a value is null, undefined, or missing, which
+// most operators treat alike.
+func isNullish(val bson.RawValue) bool {
+	switch val.Type {
+	case 0, bson.TypeNull, bson.TypeUndefined:
+		return true
+	}
+
+	return false
+}
+
+var nullValue = bson.RawValue{Type: bson.TypeNull}
+
+//nolint:cyclop
+func compileOperatorExpr(op string, arg bson.RawValue) (exprNode, error) {
+	switch op {
+	case "$literal":
+		return literalExpr{arg}, nil
+	case "$add", "$subtract", "$multiply", "$divide", "$mod", "$abs":
+		return compileArithmetic(op, arg)
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$cmp":
+		return compileComparison(op, arg)
+	case "$cond":
+		return compileCond(arg)
+	case "$ifNull":
+		return compileIfNull(arg)
+	case "$switch":
+		return compileSwitch(arg)
+	case "$concat":
+		return compileConcat(arg)
+	case "$type":
+		return compileTypeExpr(arg)
+	case "$convert":
+		return compileConvert(arg)
+	case "$toBool", "$toDate", "$toDecimal", "$toDouble", "$toInt", "$toLong", "$toObjectId", "$toString":
+		return compileToType(op, arg)
+	case "$getField":
+		return compileGetField(arg)
+	case "$setField":
+		return compileSetField(arg)
+	}
+
+	return nil, ExpressionError{Operator: op, Reason: "unsupported operator"}
+}
+
+// compileOperands compiles an operator’s arguments. As with the server, a
+// non-array argument is a single operand. If minCount or maxCount is
+// nonnegative, it constrains the number of operands.
+func compileOperands(op string, arg bson.RawValue, minCount, maxCount int) ([]exprNode, error) {
+	values := []bson.RawValue{arg}
+
+	if arr, ok := arg.ArrayOK(); ok {
+		var err error
+
+		values, err = arr.Values()
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", op, err)
+		}
+	}
+
+	switch {
+	case minCount >= 0 && len(values) < minCount, maxCount >= 0 && len(values) > maxCount:
+		var reason string
+
+		switch {
+		case minCount == maxCount:
+			reason = fmt.Sprintf("expected %d arguments but got %d", minCount, len(values))
+		case maxCount < 0:
+			reason = fmt.Sprintf("expected at least %d arguments but got %d", minCount, len(values))
+		default:
+			reason = fmt.Sprintf("expected %d to %d arguments but got %d", minCount, maxCount, len(values))
+		}
+
+		return nil, ExpressionError{Operator: op, Reason: reason}
+	}
+
+	return compileExprs(values)
+}
+
+// compileNamedArgs compiles an operator’s document of named arguments.
+// Required arguments that are absent, and unknown arguments, are errors.
+// Optional arguments that are absent are nil in the returned map.
+func compileNamedArgs(op string, arg bson.RawValue, required, optional []string) (map[string]exprNode, error) {
+	doc, ok := arg.DocumentOK()
+	if !ok {
+		return nil, ExpressionError{Operator: op, Reason: "argument must be a document"}
+	}
+
+	args := map[string]exprNode{}
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", op, err)
+		}
+
+		name := el.Key()
+		if !slices.Contains(required, name) && !slices.Contains(optional, name) {
+			return nil, ExpressionError{Operator: op, Reason: fmt.Sprintf("unknown argument %#q", name)}
+		}
+
+		node, nodeErr := compileExpr(el.Value())
+		if nodeErr != nil {
+			return nil, nodeErr
+		}
+
+		args[name] = node
+	}
+
+	for _, name := range required {
+		if args[name] == nil {
+			return nil, ExpressionError{Operator: op, Reason: fmt.Sprintf("missing argument %#q", name)}
+		}
+	}
+
+	return args, nil
+}
@@ -0,0 +1,388 @@
+package bsontools
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type arithOp int
+
+const (
+	arithAdd arithOp = iota
+	arithSubtract
+	arithMultiply
+	arithDivide
+	arithMod
+)
+
+// operatorExpr evaluates its operands and then applies a function to them.
+func operatorExpr(nodes []exprNode, apply func([]bson.RawValue) (bson.RawValue, error)) exprNode {
+	return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+		values, err := evaluateExprs(ctx, nodes)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+
+		return apply(values)
+	})
+}
+
+func compileArithmetic(op string, arg bson.RawValue) (exprNode, error) {
+	var minCount, maxCount int
+	var apply func([]bson.RawValue) (bson.RawValue, error)
+
+	switch op {
+	case "$add":
+		minCount, maxCount, apply = 0, -1, addValues
+	case "$multiply":
+		minCount, maxCount, apply = 0, -1, multiplyValues
+	case "$subtract":
+		minCount, maxCount, apply = 2, 2, subtractValues
+	case "$divide":
+		minCount, maxCount, apply = 2, 2, func(values []bson.RawValue) (bson.RawValue, error) {
+			return divideValues(op, arithDivide, values[0], values[1])
+		}
+	case "$mod":
+		minCount, maxCount, apply = 2, 2, func(values []bson.RawValue) (bson.RawValue, error) {
+			return divideValues(op, arithMod, values[0], values[1])
+		}
+	case "$abs":
+		minCount, maxCount, apply = 1, 1, absValue
+	}
+
+	nodes, err := compileOperands(op, arg, minCount, maxCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return operatorExpr(nodes, apply), nil
+}
+
+func isNumeric(val bson.RawValue) bool {
+	switch val.Type {
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble, bson.TypeDecimal128:
+		return true
+	}
+
+	return false
+}
+
+func addValues(values []bson.RawValue) (bson.RawValue, error) {
+	sum := ToRawValue(int32(0))
+	var date bson.RawValue
+
+	for _, val := range values {
+		var err error
+
+		switch {
+		case isNullish(val):
+			return nullValue, nil
+		case val.Type == bson.TypeDateTime:
+			if date.Type != 0 {
+				return bson.RawValue{}, ExpressionError{Operator: "$add", Reason: "only one date allowed"}
+			}
+
+			date = val
+		case isNumeric(val):
+			sum, err = arithmetic(arithAdd, sum, val)
+			if err != nil {
+				return bson.RawValue{}, err
+			}
+		default:
+			return bson.RawValue{}, ExpressionError{
+				Operator: "$add",
+				Reason:   fmt.Sprintf("only supports numeric or date types, not %s", val.Type),
+			}
+		}
+	}
+
+	if date.Type == 0 {
+		return sum, nil
+	}
+
+	return addToDate("$add", date, sum, 1)
+}
+
+// addToDate adds the given number of milliseconds, times sign, to a date.
+// As with the server, the number is rounded to an integer.
+func addToDate(op string, date, millis bson.RawValue, sign int64) (bson.RawValue, error) {
+	delta, err := roundToInt64(millis)
+	if err != nil {
+		return bson.RawValue{}, ExpressionError{Operator: op, Reason: err.Error()}
+	}
+
+	result := new(big.Int).Mul(big.NewInt(delta), big.NewInt(sign))
+	result.Add(result, big.NewInt(date.DateTime()))
+
+	if !result.IsInt64() {
+		return bson.RawValue{}, ExpressionError{Operator: op, Reason: "date overflow"}
+	}
+
+	return ToRawValue(bson.DateTime(result.Int64())), nil
+}
+
+// roundToInt64 rounds a number to the nearest int64, with halves rounded
+// away from zero.
+func roundToInt64(val bson.RawValue) (int64, error) {
+	if val.Type == bson.TypeInt32 || val.Type == bson.TypeInt64 {
+		return val.AsInt64(), nil
+	}
+
+	num, err := toNumericValue(val)
+	if err != nil {
+		return 0, err
+	}
+
+	if num.isNaN || num.infSign != 0 {
+		return 0, fmt.Errorf("%s is not finite", val)
+	}
+
+	half := big.NewRat(int64(num.rat.Sign()), 2)
+	rounded := new(big.Rat).Add(num.rat, half)
+	truncated := new(big.Int).Quo(rounded.Num(), rounded.Denom())
+
+	if !truncated.IsInt64() {
+		return 0, fmt.Errorf("%s is out of range", val)
+	}
+
+	return truncated.Int64(), nil
+}
+
+func subtractValues(values []bson.RawValue) (bson.RawValue, error) {
+	a, b := values[0], values[1]
+
+	switch {
+	case isNullish(a) || isNullish(b):
+		return nullValue, nil
+	case isNumeric(a) && isNumeric(b):
+		return arithmetic(arithSubtract, a, b)
+	case a.Type == bson.TypeDateTime && b.Type == bson.TypeDateTime:
+		diff := new(big.Int).Sub(big.NewInt(a.DateTime()), big.NewInt(b.DateTime()))
+		if !diff.IsInt64() {
+			return bson.RawValue{}, ExpressionError{Operator: "$subtract", Reason: "date difference overflow"}
+		}
+
+		return ToRawValue(diff.Int64()), nil
+	case a.Type == bson.TypeDateTime && isNumeric(b):
+		return addToDate("$subtract", a, b, -1)
+	}
+
+	return bson.RawValue{}, ExpressionError{
+		Operator: "$subtract",
+		Reason:   fmt.Sprintf("cannot subtract %s from %s", b.Type, a.Type),
+	}
+}
+
+func multiplyValues(values []bson.RawValue) (bson.RawValue, error) {
+	product := ToRawValue(int32(1))
+
+	for _, val := range values {
+		var err error
+
+		switch {
+		case isNullish(val):
+			return nullValue, nil
+		case isNumeric(val):
+			product, err = arithmetic(arithMultiply, product, val)
+			if err != nil {
+				return bson.RawValue{}, err
+			}
+		default:
+			return bson.RawValue{}, ExpressionError{
+				Operator: "$multiply",
+				Reason:   fmt.Sprintf("only supports numeric types, not %s", val.Type),
+			}
+		}
+	}
+
+	return product, nil
+}
+
+func divideValues(op string, arith arithOp, a, b bson.RawValue) (bson.RawValue, error) {
+	switch {
+	case isNullish(a) || isNullish(b):
+		return nullValue, nil
+	case !isNumeric(a) || !isNumeric(b):
+		return bson.RawValue{}, ExpressionError{
+			Operator: op,
+			Reason:   fmt.Sprintf("only supports numeric types, not %s and %s", a.Type, b.Type),
+		}
+	}
+
+	divisor, err := toNumericValue(b)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	if !divisor.isNaN && divisor.infSign == 0 && divisor.rat.Sign() == 0 {
+		return bson.RawValue{}, ExpressionError{Operator: op, Reason: "cannot divide by zero"}
+	}
+
+	return arithmetic(arith, a, b)
+}
+
+func absValue(values []bson.RawValue) (bson.RawValue, error) {
+	val := values[0]
+
+	switch val.Type {
+	case 0, bson.TypeNull, bson.TypeUndefined:
+		return nullValue, nil
+	case bson.TypeInt32:
+		i32 := val.Int32()
+		if i32 == math.MinInt32 {
+			return ToRawValue(-int64(i32)), nil
+		}
+
+		return ToRawValue(max(i32, -i32)), nil
+	case bson.TypeInt64:
+		i64 := val.Int64()
+		if i64 == math.MinInt64 {
+			return bson.RawValue{}, ExpressionError{Operator: "$abs", Reason: "cannot take the absolute value of the minimum long"}
+		}
+
+		return ToRawValue(max(i64, -i64)), nil
+	case bson.TypeDouble:
+		return ToRawValue(math.Abs(val.Double())), nil
+	case bson.TypeDecimal128:
+		high, low := val.Decimal128().GetBytes()
+
+		return ToRawValue(bson.NewDecimal128(high&^(1<<63), low)), nil
+	}
+
+	return bson.RawValue{}, ExpressionError{
+		Operator: "$abs",
+		Reason:   fmt.Sprintf("only supports numeric types, not %s", val.Type),
+	}
+}
+
+// numericRank orders BSON’s numeric types by width. Arithmetic yields the
+// wider of its operands’ types.
+var numericRank = map[bson.Type]int{
+	bson.TypeInt32:      1,
+	bson.TypeInt64:      2,
+	bson.TypeDouble:     3,
+	bson.TypeDecimal128: 4,
+}
+
+// arithmetic applies an operation to two numbers with the server’s type
+// rules:
+//   - An int operation that overflows yields a long, and a long operation
+//     that overflows yields a double.
+//   - Division yields a double unless an operand is a Decimal128.
+//
+// It assumes that division & modulus have a nonzero divisor.
+func arithmetic(op arithOp, a, b bson.RawValue) (bson.RawValue, error) {
+	widest := a.Type
+	if numericRank[b.Type] > numericRank[widest] {
+		widest = b.Type
+	}
+
+	switch {
+	case widest == bson.TypeDecimal128:
+		return decimalArithmetic(op, a, b)
+	case widest == bson.TypeDouble || op == arithDivide:
+		return ToRawValue(floatArithmetic(op, a.AsFloat64(), b.AsFloat64())), nil
+	}
+
+	aInt, bInt := big.NewInt(a.AsInt64()), big.NewInt(b.AsInt64())
+
+	result := new(big.Int)
+
+	switch op {
+	case arithAdd:
+		result.Add(aInt, bInt)
+	case arithSubtract:
+		result.Sub(aInt, bInt)
+	case arithMultiply:
+		result.Mul(aInt, bInt)
+	case arithMod:
+		result.Rem(aInt, bInt)
+	default:
+		panic(fmt.Sprintf("unknown arithmetic op %d", op))
+	}
+
+	switch {
+	case !result.IsInt64():
+		return ToRawValue(floatArithmetic(op, a.AsFloat64(), b.AsFloat64())), nil
+	case widest == bson.TypeInt32 && result.Int64() == int64(int32(result.Int64())):
+		return ToRawValue(int32(result.Int64())), nil
+	}
+
+	return ToRawValue(result.Int64()), nil
+}
+
+func floatArithmetic(op arithOp, a, b float64) float64 {
+	switch op {
+	case arithAdd:
+		return a + b
+	case arithSubtract:
+		return a - b
+	case arithMultiply:
+		return a * b
+	case arithDivide:
+		return a / b
+	case arithMod:
+		return math.Mod(a, b)
+	}
+
+	panic(fmt.Sprintf("unknown arithmetic op %d", op))
+}
+
+func decimalArithmetic(op arithOp, a, b bson.RawValue) (bson.RawValue, error) {
+	aDec, err := decimalOperand(a)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	bDec, err := decimalOperand(b)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	var result bson.Decimal128
+
+	switch op {
+	case arithAdd:
+		result, _ = AddDecimal128(aDec, bDec, big.ToNearestEven)
+	case arithSubtract:
+		result, _ = SubtractDecimal128(aDec, bDec, big.ToNearestEven)
+	case arithMultiply:
+		result, _ = MultiplyDecimal128(aDec, bDec, big.ToNearestEven)
+	case arithDivide:
+		result, _ = DivideDecimal128(aDec, bDec, big.ToNearestEven)
+	case arithMod:
+		result, _ = ModDecimal128(aDec, bDec, big.ToNearestEven)
+	default:
+		panic(fmt.Sprintf("unknown arithmetic op %d", op))
+	}
+
+	return ToRawValue(result), nil
+}
+
+// decimalOperand converts a number to a Decimal128 for Decimal128
+// arithmetic. As with the server, doubles are first rounded to 15
+// significant digits.
+func decimalOperand(val bson.RawValue) (bson.Decimal128, error) {
+	switch val.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		return Decimal128FromInt64(val.AsInt64()), nil
+	case bson.TypeDouble:
+		f := val.Double()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			dec, _ := Decimal128FromFloat64(f, big.ToNearestEven)
+			return dec, nil
+		}
+
+		dec, _, err := ParseDecimal128(strconv.FormatFloat(f, 'E', 14, 64), big.ToNearestEven)
+
+		return dec, err
+	case bson.TypeDecimal128:
+		return val.Decimal128(), nil
+	}
+
+	return bson.Decimal128{}, fmt.Errorf("BSON %s is not numeric", val.Type)
+}
@@ -0,0 +1,111 @@
+package bsontools
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// convertOperatorTypes maps the $toX operators to their target types.
+var convertOperatorTypes = map[string]bson.Type{
+	"$toBool":     bson.TypeBoolean,
+	"$toDate":     bson.TypeDateTime,
+	"$toDecimal":  bson.TypeDecimal128,
+	"$toDouble":   bson.TypeDouble,
+	"$toInt":      bson.TypeInt32,
+	"$toLong":     bson.TypeInt64,
+	"$toObjectId": bson.TypeObjectID,
+	"$toString":   bson.TypeString,
+}
+
+func compileToType(op string, arg bson.RawValue) (exprNode, error) {
+	nodes, err := compileOperands(op, arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	target := convertOperatorTypes[op]
+
+	return operatorExpr(nodes, func(values []bson.RawValue) (bson.RawValue, error) {
+		if isNullish(values[0]) {
+			return nullValue, nil
+		}
+
+		return convertExprValue(values[0], target)
+	}), nil
+}
+
+func compileConvert(arg bson.RawValue) (exprNode, error) {
+	args, err := compileNamedArgs("$convert", arg, []string{"input", "to"}, []string{"onError", "onNull"})
+	if err != nil {
+		return nil, err
+	}
+
+	return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+		input, err := args["input"].evaluate(ctx)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+
+		toVal, err := args["to"].evaluate(ctx)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+
+		if isNullish(input) || isNullish(toVal) {
+			if onNull := args["onNull"]; onNull != nil {
+				return onNull.evaluate(ctx)
+			}
+
+			return nullValue, nil
+		}
+
+		target, err := convertTarget(toVal)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+
+		result, err := convertExprValue(input, target)
+
+		var exprErr ExpressionError
+		if errors.As(err, &exprErr) && args["onError"] != nil {
+			return args["onError"].evaluate(ctx)
+		}
+
+		return result, err
+	}), nil
+}
+
+// convertTarget parses $convert’s `to` argument, which is either a type
+// alias or a numeric type code.
+func convertTarget(toVal bson.RawValue) (bson.Type, error) {
+	var target bson.Type
+
+	if alias, ok := toVal.StringValueOK(); ok {
+		target = typeAliases[alias]
+	} else if code, ok := wholeNumberFilterArg(toVal); ok && code == int64(int8(code)) {
+		target = bson.Type(code)
+	}
+
+	switch target {
+	case bson.TypeDouble, bson.TypeString, bson.TypeObjectID, bson.TypeBoolean,
+		bson.TypeDateTime, bson.TypeInt32, bson.TypeInt64, bson.TypeDecimal128:
+		return target, nil
+	}
+
+	return 0, ExpressionError{Operator: "$convert", Reason: fmt.Sprintf("unsupported conversion target: %s", toVal)}
+}
+
+// convertExprValue is convertValue, but it reports conversion failures as
+// ExpressionError.
+func convertExprValue(val bson.RawValue, target bson.Type) (bson.RawValue, error) {
+	result, err := convertValue(val, target)
+
+	var convErr ConversionError
+	if errors.As(err, &convErr) {
+		return bson.RawValue{}, ExpressionError{Operator: "$convert", Reason: convErr.Error()}
+	}
+
+	return result, err
+}
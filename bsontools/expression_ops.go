@@ -0,0 +1,453 @@
+package bsontools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+func compileComparison(op string, arg bson.RawValue) (exprNode, error) {
+	nodes, err := compileOperands(op, arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return operatorExpr(nodes, func(values []bson.RawValue) (bson.RawValue, error) {
+		result, err := compareExprValues(values[0], values[1])
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+
+		switch op {
+		case "$eq":
+			return ToRawValue(result == 0), nil
+		case "$ne":
+			return ToRawValue(result != 0), nil
+		case "$gt":
+			return ToRawValue(result > 0), nil
+		case "$gte":
+			return ToRawValue(result >= 0), nil
+		case "$lt":
+			return ToRawValue(result < 0), nil
+		case "$lte":
+			return ToRawValue(result <= 0), nil
+		}
+
+		return ToRawValue(int32(result)), nil
+	}), nil
+}
+
+// compareExprValues compares values per BSON sort order. As with the server,
+// missing values compare equal to undefined, i.e., below null.
+func compareExprValues(a, b bson.RawValue) (int, error) {
+	if a.Type == 0 {
+		a.Type = bson.TypeUndefined
+	}
+
+	if b.Type == 0 {
+		b.Type = bson.TypeUndefined
+	}
+
+	return CompareValues(a, b)
+}
+
+// isTruthy implements the server’s coercion of values to booleans: false,
+// null, undefined, missing, and numeric zeros are false, and all else is
+// true.
+func isTruthy(val bson.RawValue) (bool, error) {
+	switch val.Type {
+	case 0, bson.TypeNull, bson.TypeUndefined:
+		return false, nil
+	case bson.TypeBoolean:
+		return val.Boolean(), nil
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble, bson.TypeDecimal128:
+		num, err := toNumericValue(val)
+		if err != nil {
+			return false, err
+		}
+
+		return num.isNaN || num.infSign != 0 || num.rat.Sign() != 0, nil
+	}
+
+	return true, nil
+}
+
+func compileCond(arg bson.RawValue) (exprNode, error) {
+	var ifNode, thenNode, elseNode exprNode
+
+	if arg.Type == bson.TypeEmbeddedDocument {
+		args, err := compileNamedArgs("$cond", arg, []string{"if", "then", "else"}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		ifNode, thenNode, elseNode = args["if"], args["then"], args["else"]
+	} else {
+		nodes, err := compileOperands("$cond", arg, 3, 3)
+		if err != nil {
+			return nil, err
+		}
+
+		ifNode, thenNode, elseNode = nodes[0], nodes[1], nodes[2]
+	}
+
+	return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+		cond, err := ifNode.evaluate(ctx)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+
+		truthy, err := isTruthy(cond)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+
+		if truthy {
+			return thenNode.evaluate(ctx)
+		}
+
+		return elseNode.evaluate(ctx)
+	}), nil
+}
+
+func compileIfNull(arg bson.RawValue) (exprNode, error) {
+	nodes, err := compileOperands("$ifNull", arg, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+		for _, node := range nodes[:len(nodes)-1] {
+			val, err := node.evaluate(ctx)
+			if err != nil || !isNullish(val) {
+				return val, err
+			}
+		}
+
+		return nodes[len(nodes)-1].evaluate(ctx)
+	}), nil
+}
+
+type switchBranch struct {
+	caseNode, thenNode exprNode
+}
+
+func compileSwitch(arg bson.RawValue) (exprNode, error) {
+	doc, ok := arg.DocumentOK()
+	if !ok {
+		return nil, ExpressionError{Operator: "$switch", Reason: "argument must be a document"}
+	}
+
+	var branches []switchBranch
+	var defaultNode exprNode
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return nil, fmt.Errorf("parsing $switch: %w", err)
+		}
+
+		switch el.Key() {
+		case "branches":
+			branches, err = compileSwitchBranches(el.Value())
+		case "default":
+			defaultNode, err = compileExpr(el.Value())
+		default:
+			err = ExpressionError{Operator: "$switch", Reason: fmt.Sprintf("unknown argument %#q", el.Key())}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(branches) == 0 {
+		return nil, ExpressionError{Operator: "$switch", Reason: "requires at least one branch"}
+	}
+
+	return exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+		for _, branch := range branches {
+			cond, err := branch.caseNode.evaluate(ctx)
+			if err != nil {
+				return bson.RawValue{}, err
+			}
+
+			truthy, err := isTruthy(cond)
+			if err != nil {
+				return bson.RawValue{}, err
+			}
+
+			if truthy {
+				return branch.thenNode.evaluate(ctx)
+			}
+		}
+
+		if defaultNode == nil {
+			return bson.RawValue{}, ExpressionError{
+				Operator: "$switch",
+				Reason:   "no branch matched, and no default was given",
+			}
+		}
+
+		return defaultNode.evaluate(ctx)
+	}), nil
+}
+
+func compileSwitchBranches(arg bson.RawValue) ([]switchBranch, error) {
+	arr, ok := arg.ArrayOK()
+	if !ok {
+		return nil, ExpressionError{Operator: "$switch", Reason: "branches must be an array"}
+	}
+
+	values, err := arr.Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing $switch: %w", err)
+	}
+
+	branches := make([]switchBranch, 0, len(values))
+
+	for _, val := range values {
+		args, err := compileNamedArgs("$switch", val, []string{"case", "then"}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		branches = append(branches, switchBranch{caseNode: args["case"], thenNode: args["then"]})
+	}
+
+	return branches, nil
+}
+
+func compileConcat(arg bson.RawValue) (exprNode, error) {
+	nodes, err := compileOperands("$concat", arg, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return operatorExpr(nodes, func(values []bson.RawValue) (bson.RawValue, error) {
+		var sb strings.Builder
+
+		for _, val := range values {
+			switch {
+			case isNullish(val):
+				return nullValue, nil
+			case val.Type != bson.TypeString:
+				return bson.RawValue{}, ExpressionError{
+					Operator: "$concat",
+					Reason:   fmt.Sprintf("only supports strings, not %s", val.Type),
+				}
+			}
+
+			str, err := readStringBytes(val.Value)
+			if err != nil {
+				return bson.RawValue{}, fmt.Errorf("parsing string: %w", err)
+			}
+
+			sb.Write(str)
+		}
+
+		return ToRawValue(sb.String()), nil
+	}), nil
+}
+
+// typeAliasNames maps BSON types to $type’s string aliases.
+var typeAliasNames = lo.Invert(typeAliases)
+
+func compileTypeExpr(arg bson.RawValue) (exprNode, error) {
+	nodes, err := compileOperands("$type", arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return operatorExpr(nodes, func(values []bson.RawValue) (bson.RawValue, error) {
+		if values[0].Type == 0 {
+			return ToRawValue("missing"), nil
+		}
+
+		name, ok := typeAliasNames[values[0].Type]
+		if !ok {
+			return bson.RawValue{}, fmt.Errorf("unknown BSON type %s", values[0].Type)
+		}
+
+		return ToRawValue(name), nil
+	}), nil
+}
+
+// compileFieldName compiles $getField’s & $setField’s `field` argument,
+// which must be a constant string: either a string that isn’t a field path
+// or a `$literal` string.
+func compileFieldName(op string, arg bson.RawValue) (string, error) {
+	if literal, isLiteral := literalOperand(arg); isLiteral {
+		if field, ok := literal.StringValueOK(); ok {
+			return field, nil
+		}
+	} else if field, ok := arg.StringValueOK(); ok && !strings.HasPrefix(field, "$") {
+		return field, nil
+	}
+
+	return "", ExpressionError{Operator: op, Reason: "field must be a constant string"}
+}
+
+// literalOperand returns the argument of a `$literal` expression.
+func literalOperand(arg bson.RawValue) (bson.RawValue, bool) {
+	doc, ok := arg.DocumentOK()
+	if !ok {
+		return bson.RawValue{}, false
+	}
+
+	first, err := doc.IndexErr(0)
+	if err != nil || first.Key() != "$literal" {
+		return bson.RawValue{}, false
+	}
+
+	if _, err := doc.IndexErr(1); err == nil {
+		return bson.RawValue{}, false
+	}
+
+	return first.Value(), true
+}
+
+// currentExpr evaluates to `$$CURRENT`.
+var currentExpr = exprFunc(func(ctx *exprContext) (bson.RawValue, error) {
+	return ctx.root, nil
+})
+
+func compileGetField(arg bson.RawValue) (exprNode, error) {
+	fieldArg := arg
+	input := exprNode(currentExpr)
+
+	if doc, ok := arg.DocumentOK(); ok && doc.Lookup("field").Type != 0 {
+		for el, err := range RawElements(doc) {
+			if err != nil {
+				return nil, fmt.Errorf("parsing $getField: %w", err)
+			}
+
+			switch el.Key() {
+			case "field":
+				fieldArg = el.Value()
+			case "input":
+				input, err = compileExpr(el.Value())
+				if err != nil {
+					return nil, err
+				}
+			default:
+				return nil, ExpressionError{
+					Operator: "$getField",
+					Reason:   fmt.Sprintf("unknown argument %#q", el.Key()),
+				}
+			}
+		}
+	}
+
+	field, err := compileFieldName("$getField", fieldArg)
+	if err != nil {
+		return nil, err
+	}
+
+	return operatorExpr([]exprNode{input}, func(values []bson.RawValue) (bson.RawValue, error) {
+		doc, err := exprInputDocument("$getField", values[0])
+		if err != nil || doc == nil {
+			return nullValue, err
+		}
+
+		val, err := doc.LookupErr(field)
+		if errors.Is(err, bsoncore.ErrElementNotFound) {
+			return bson.RawValue{}, nil
+		}
+
+		return val, err
+	}), nil
+}
+
+// exprInputDocument checks $getField’s & $setField’s `input`. It returns nil
+// if the input is nullish.
+func exprInputDocument(op string, input bson.RawValue) (bson.Raw, error) {
+	switch input.Type {
+	case 0, bson.TypeNull, bson.TypeUndefined:
+		return nil, nil
+	case bson.TypeEmbeddedDocument:
+		return input.Document(), nil
+	}
+
+	return nil, ExpressionError{
+		Operator: op,
+		Reason:   fmt.Sprintf("input must be a document, not %s", input.Type),
+	}
+}
+
+func compileSetField(arg bson.RawValue) (exprNode, error) {
+	doc, ok := arg.DocumentOK()
+	if !ok {
+		return nil, ExpressionError{Operator: "$setField", Reason: "argument must be a document"}
+	}
+
+	field, err := compileFieldName("$setField", doc.Lookup("field"))
+	if err != nil {
+		return nil, err
+	}
+
+	fieldless, _, err := RemoveFromRaw(doc, "field")
+	if err != nil {
+		return nil, fmt.Errorf("parsing $setField: %w", err)
+	}
+
+	args, err := compileNamedArgs(
+		"$setField",
+		bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: fieldless},
+		[]string{"input", "value"},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return operatorExpr(
+		[]exprNode{args["input"], args["value"]},
+		func(values []bson.RawValue) (bson.RawValue, error) {
+			input, err := exprInputDocument("$setField", values[0])
+			if err != nil || input == nil {
+				return nullValue, err
+			}
+
+			return setDocumentField(input, field, values[1])
+		},
+	), nil
+}
+
+// setDocumentField returns a copy of the document with the given field set
+// to the given value, or removed if the value is missing. A new field goes
+// at the end.
+func setDocumentField(doc bson.Raw, field string, val bson.RawValue) (bson.RawValue, error) {
+	out := []byte{0, 0, 0, 0}
+	found := false
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return bson.RawValue{}, fmt.Errorf("parsing $setField input: %w", err)
+		}
+
+		switch {
+		case el.Key() != field:
+			out = append(out, el...)
+		case !found && val.Type != 0:
+			out = appendRawElement(out, []byte(field), val)
+		}
+
+		found = found || el.Key() == field
+	}
+
+	if !found && val.Type != 0 {
+		out = appendRawElement(out, []byte(field), val)
+	}
+
+	out = append(out, 0)
+
+	if err := putDocLength(out, 0); err != nil {
+		return bson.RawValue{}, err
+	}
+
+	return bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: out}, nil
+}
@@ -0,0 +1,252 @@
+package bsontools
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// missingValue stands for a missing result in expression tests.
+type missingValue struct{}
+
+func marshalTestValue(t *testing.T, val any) bson.RawValue {
+	t.Helper()
+
+	switch val.(type) {
+	case missingValue:
+		return bson.RawValue{}
+	case nil:
+		return bson.RawValue{Type: bson.TypeNull}
+	}
+
+	valType, valBytes, err := bson.MarshalValue(val)
+	require.NoError(t, err, "%v", val)
+
+	return bson.RawValue{Type: valType, Value: valBytes}
+}
+
+func evaluateTestExpression(t *testing.T, expr any, doc bson.D) (bson.RawValue, error) {
+	t.Helper()
+
+	compiled, err := CompileExpression(marshalTestValue(t, expr))
+	require.NoError(t, err, "%v", expr)
+
+	return compiled.Evaluate(lo.Must(bson.Marshal(doc)))
+}
+
+func TestExpression(t *testing.T) {
+	date := bson.NewDateTimeFromTime(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	oid := lo.Must(bson.ObjectIDFromHex("65f1e0d2a1b2c3d4e5f60718"))
+
+	doc := bson.D{
+		{"i", int32(7)},
+		{"l", int64(math.MaxInt64)},
+		{"d", 2.5},
+		{"dec", lo.Must(bson.ParseDecimal128("1.10"))},
+		{"s", "abc"},
+		{"n", nil},
+		{"t", true},
+		{"date", date},
+		{"oid", oid},
+		{"sub", bson.D{{"x", int32(1)}, {"a.b", "dotted"}}},
+		{"arr", bson.A{bson.D{{"x", int32(1)}}, int32(2), bson.D{{"y", int32(3)}}, bson.D{{"x", "two"}}}},
+	}
+
+	cases := []struct {
+		expr     any
+		expected any
+	}{
+		// literals & paths
+		{int32(5), int32(5)},
+		{"plain", "plain"},
+		{"$i", int32(7)},
+		{"$sub.x", int32(1)},
+		{"$nope", missingValue{}},
+		{"$s.x", missingValue{}},
+		{"$arr.x", bson.A{int32(1), "two"}},
+		{"$$ROOT.i", int32(7)},
+		{"$$CURRENT.sub.x", int32(1)},
+		{"$$REMOVE", missingValue{}},
+		{bson.D{{"$literal", "$i"}}, "$i"},
+		{bson.D{{"a", "$i"}, {"b", "$nope"}}, bson.D{{"a", int32(7)}}},
+		{bson.A{"$i", "$nope"}, bson.A{int32(7), nil}},
+
+		// arithmetic
+		{bson.D{{"$add", bson.A{"$i", int32(1)}}}, int32(8)},
+		{bson.D{{"$add", bson.A{int32(math.MaxInt32), int32(1)}}}, int64(math.MaxInt32) + 1},
+		{bson.D{{"$add", bson.A{"$l", int64(1)}}}, float64(math.MaxInt64) + 1},
+		{bson.D{{"$add", bson.A{"$i", "$d"}}}, 9.5},
+		{bson.D{{"$add", bson.A{"$i", "$dec"}}}, lo.Must(bson.ParseDecimal128("8.10"))},
+		{bson.D{{"$add", bson.A{"$i", "$n"}}}, nil},
+		{bson.D{{"$add", bson.A{"$i", "$nope"}}}, nil},
+		{bson.D{{"$add", bson.A{}}}, int32(0)},
+		{bson.D{{"$add", bson.A{"$date", int32(1000)}}}, date + 1000},
+		{bson.D{{"$add", bson.A{"$date", 1.5}}}, date + 2},
+		{bson.D{{"$subtract", bson.A{"$date", "$date"}}}, int64(0)},
+		{bson.D{{"$subtract", bson.A{"$date", int64(9)}}}, date - 9},
+		{bson.D{{"$subtract", bson.A{"$i", 0.5}}}, 6.5},
+		{bson.D{{"$multiply", bson.A{"$i", int32(3)}}}, int32(21)},
+		{bson.D{{"$multiply", bson.A{"$l", int32(2)}}}, float64(math.MaxInt64) * 2},
+		{bson.D{{"$multiply", bson.A{"$dec", int32(3)}}}, lo.Must(bson.ParseDecimal128("3.30"))},
+		{bson.D{{"$divide", bson.A{"$i", int32(2)}}}, 3.5},
+		{bson.D{{"$divide", bson.A{int32(1), "$dec"}}}, lo.Must(bson.ParseDecimal128("0.9090909090909090909090909090909091"))},
+		{bson.D{{"$mod", bson.A{"$i", int32(3)}}}, int32(1)},
+		{bson.D{{"$mod", bson.A{int32(-7), int64(3)}}}, int64(-1)},
+		{bson.D{{"$mod", bson.A{"$d", int32(2)}}}, 0.5},
+		{bson.D{{"$divide", bson.A{lo.Must(bson.ParseDecimal128("6.00")), int32(2)}}}, lo.Must(bson.ParseDecimal128("3.00"))},
+		{bson.D{{"$mod", bson.A{lo.Must(bson.ParseDecimal128("7.50")), int32(2)}}}, lo.Must(bson.ParseDecimal128("1.50"))},
+		{bson.D{{"$abs", int32(-3)}}, int32(3)},
+		{bson.D{{"$abs", int32(math.MinInt32)}}, -int64(math.MinInt32)},
+		{bson.D{{"$abs", "$nope"}}, nil},
+
+		// comparison
+		{bson.D{{"$eq", bson.A{"$i", 7.0}}}, true},
+		{bson.D{{"$eq", bson.A{"$nope", nil}}}, false},
+		{bson.D{{"$lt", bson.A{"$nope", nil}}}, true},
+		{bson.D{{"$gt", bson.A{"$s", int32(100)}}}, true},
+		{bson.D{{"$lte", bson.A{"$d", 2.5}}}, true},
+		{bson.D{{"$ne", bson.A{"$s", "abc"}}}, false},
+		{bson.D{{"$cmp", bson.A{"$i", int32(8)}}}, int32(-1)},
+
+		// conditionals
+		{bson.D{{"$cond", bson.A{"$t", "yes", "no"}}}, "yes"},
+		{bson.D{{"$cond", bson.D{{"if", int32(0)}, {"then", "yes"}, {"else", "no"}}}}, "no"},
+		{bson.D{{"$cond", bson.A{"$s", "yes", "no"}}}, "yes"},
+		{bson.D{{"$ifNull", bson.A{"$nope", "$n", "fallback"}}}, "fallback"},
+		{bson.D{{"$ifNull", bson.A{"$nope", "$i", "fallback"}}}, int32(7)},
+		{bson.D{{"$ifNull", bson.A{"$n", "$nope"}}}, missingValue{}},
+		{
+			bson.D{{"$switch", bson.D{
+				{"branches", bson.A{
+					bson.D{{"case", bson.D{{"$gt", bson.A{"$i", int32(10)}}}}, {"then", "big"}},
+					bson.D{{"case", bson.D{{"$gt", bson.A{"$i", int32(5)}}}}, {"then", "medium"}},
+				}},
+				{"default", "small"},
+			}}},
+			"medium",
+		},
+
+		// strings
+		{bson.D{{"$concat", bson.A{"$s", "-", "def"}}}, "abc-def"},
+		{bson.D{{"$concat", bson.A{"$s", "$nope"}}}, nil},
+
+		// types
+		{bson.D{{"$type", "$i"}}, "int"},
+		{bson.D{{"$type", "$nope"}}, "missing"},
+		{bson.D{{"$type", bson.A{"$arr"}}}, "array"},
+		{bson.D{{"$toInt", 2.9}}, int32(2)},
+		{bson.D{{"$toInt", "-42"}}, int32(-42)},
+		{bson.D{{"$toInt", "$t"}}, int32(1)},
+		{bson.D{{"$toInt", "$nope"}}, nil},
+		{bson.D{{"$toLong", "$date"}}, int64(date)},
+		{bson.D{{"$toDouble", "1.5e3"}}, 1500.0},
+		{bson.D{{"$toDouble", "$dec"}}, 1.1},
+		{bson.D{{"$toDecimal", 2.5}}, lo.Must(bson.ParseDecimal128("2.50000000000000"))},
+		{bson.D{{"$toString", "$d"}}, "2.5"},
+		{bson.D{{"$toString", 3.0}}, "3"},
+		{bson.D{{"$toString", "$date"}}, "2024-05-06T07:08:09.000Z"},
+		{bson.D{{"$toString", "$oid"}}, "65f1e0d2a1b2c3d4e5f60718"},
+		{bson.D{{"$toString", "$dec"}}, "1.10"},
+		{bson.D{{"$toBool", int32(0)}}, false},
+		{bson.D{{"$toBool", ""}}, true},
+		{bson.D{{"$toObjectId", "65f1e0d2a1b2c3d4e5f60718"}}, oid},
+		{bson.D{{"$toDate", "2024-05-06T07:08:09Z"}}, date},
+		{bson.D{{"$toDate", "$oid"}}, bson.NewDateTimeFromTime(oid.Timestamp())},
+		{bson.D{{"$convert", bson.D{{"input", "abc"}, {"to", "int"}, {"onError", int32(-1)}}}}, int32(-1)},
+		{bson.D{{"$convert", bson.D{{"input", "$nope"}, {"to", "int"}, {"onNull", int32(0)}}}}, int32(0)},
+		{bson.D{{"$convert", bson.D{{"input", "12"}, {"to", int32(18)}}}}, int64(12)},
+		{bson.D{{"$convert", bson.D{{"input", "$l"}, {"to", "int"}, {"onError", "overflow"}}}}, "overflow"},
+
+		// fields
+		{bson.D{{"$getField", "s"}}, "abc"},
+		{bson.D{{"$getField", bson.D{{"field", "a.b"}, {"input", "$sub"}}}}, "dotted"},
+		{bson.D{{"$getField", bson.D{{"field", bson.D{{"$literal", "$x"}}}, {"input", bson.D{{"$literal", bson.D{{"$x", int32(9)}}}}}}}}, int32(9)},
+		{bson.D{{"$getField", bson.D{{"field", "x"}, {"input", "$nope"}}}}, nil},
+		{bson.D{{"$getField", bson.D{{"field", "zzz"}, {"input", "$sub"}}}}, missingValue{}},
+		{
+			bson.D{{"$setField", bson.D{{"field", "x"}, {"input", "$sub"}, {"value", "new"}}}},
+			bson.D{{"x", "new"}, {"a.b", "dotted"}},
+		},
+		{
+			bson.D{{"$setField", bson.D{{"field", "z"}, {"input", "$sub"}, {"value", int32(0)}}}},
+			bson.D{{"x", int32(1)}, {"a.b", "dotted"}, {"z", int32(0)}},
+		},
+		{
+			bson.D{{"$setField", bson.D{{"field", "x"}, {"input", "$sub"}, {"value", "$$REMOVE"}}}},
+			bson.D{{"a.b", "dotted"}},
+		},
+	}
+
+	for _, c := range cases {
+		result, err := evaluateTestExpression(t, c.expr, doc)
+		require.NoError(t, err, "%v", c.expr)
+
+		expected := marshalTestValue(t, c.expected)
+		assert.Equal(t, expected.Type, result.Type, "%v: type of %v", c.expr, result)
+		assert.Equal(t, expected.Value, result.Value, "%v: got %v; expected %v", c.expr, result, expected)
+	}
+}
+
+func TestExpression_EvaluationErrors(t *testing.T) {
+	doc := bson.D{{"s", "abc"}, {"l", int64(math.MinInt64)}, {"date", bson.DateTime(0)}}
+
+	cases := []struct {
+		expr     bson.D
+		operator string
+	}{
+		{bson.D{{"$add", bson.A{"$s", int32(1)}}}, "$add"},
+		{bson.D{{"$add", bson.A{"$date", "$date"}}}, "$add"},
+		{bson.D{{"$subtract", bson.A{int32(1), "$date"}}}, "$subtract"},
+		{bson.D{{"$divide", bson.A{int32(1), int32(0)}}}, "$divide"},
+		{bson.D{{"$mod", bson.A{int32(1), 0.0}}}, "$mod"},
+		{bson.D{{"$abs", "$l"}}, "$abs"},
+		{bson.D{{"$concat", bson.A{"$s", int32(1)}}}, "$concat"},
+		{bson.D{{"$toInt", "$s"}}, "$convert"},
+		{bson.D{{"$toInt", "$l"}}, "$convert"},
+		{bson.D{{"$toInt", "0x10"}}, "$convert"},
+		{bson.D{{"$toInt", math.NaN()}}, "$convert"},
+		{bson.D{{"$toObjectId", int32(1)}}, "$convert"},
+		{bson.D{{"$getField", bson.D{{"field", "x"}, {"input", "$s"}}}}, "$getField"},
+		{bson.D{{"$switch", bson.D{{"branches", bson.A{bson.D{{"case", false}, {"then", int32(1)}}}}}}}, "$switch"},
+	}
+
+	for _, c := range cases {
+		_, err := evaluateTestExpression(t, c.expr, doc)
+		require.Error(t, err, "%v", c.expr)
+
+		var exprErr ExpressionError
+		require.True(t, errors.As(err, &exprErr), "%v: %v", c.expr, err)
+		assert.Equal(t, c.operator, exprErr.Operator, "%v: %v", c.expr, err)
+	}
+}
+
+func TestCompileExpression_Errors(t *testing.T) {
+	cases := []any{
+		bson.D{{"$nope", int32(1)}},
+		bson.D{{"$add", int32(1)}, {"$subtract", int32(1)}},
+		bson.D{{"a", int32(1)}, {"$b", int32(1)}},
+		bson.D{{"a.b", int32(1)}},
+		"$a..b",
+		"$$NOW",
+		bson.D{{"$subtract", bson.A{int32(1)}}},
+		bson.D{{"$cond", bson.D{{"if", true}, {"then", int32(1)}}}},
+		bson.D{{"$convert", bson.D{{"input", int32(1)}}}},
+		bson.D{{"$getField", "$a"}},
+		bson.D{{"$setField", bson.D{{"field", "a"}, {"input", "$$ROOT"}}}},
+		bson.D{{"$switch", bson.D{{"branches", bson.A{}}}}},
+	}
+
+	for _, expr := range cases {
+		_, err := CompileExpression(marshalTestValue(t, expr))
+		require.Error(t, err, "%v", expr)
+
+		var exprErr ExpressionError
+		assert.True(t, errors.As(err, &exprErr), "%v: %v", expr, err)
+	}
+}
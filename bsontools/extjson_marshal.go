@@ -0,0 +1,415 @@
+package bsontools
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// ExtJSONMode selects an Extended JSON v2 output format.
+type ExtJSONMode int
+
+const (
+	// ExtJSONCanonical is Extended JSON’s canonical format, which preserves
+	// all BSON type information.
+	ExtJSONCanonical ExtJSONMode = iota
+
+	// ExtJSONRelaxed is Extended JSON’s relaxed format, which writes numbers
+	// & most dates as plain JSON.
+	ExtJSONRelaxed
+)
+
+func (m ExtJSONMode) String() string {
+	switch m {
+	case ExtJSONCanonical:
+		return "canonical"
+	case ExtJSONRelaxed:
+		return "relaxed"
+	}
+
+	return fmt.Sprintf("ExtJSONMode(%d)", int(m))
+}
+
+// extJSONTimeFormat is how relaxed Extended JSON formats datetimes.
+const extJSONTimeFormat = "2006-01-02T15:04:05.999Z07:00"
+
+// MarshalExtJSON encodes a BSON document to Extended JSON v2, yielding the
+// same result as bson.MarshalExtJSON() (with HTML escaping disabled). Like
+// MarshalD, it avoids reflection and appends to a preexisting buffer, which
+// lets you minimize GC churn.
+//
+// An error is returned if the document is malformed.
+//
+// Example usage:
+//
+//	buf, err = MarshalExtJSON(buf[:0], doc, ExtJSONRelaxed)
+func MarshalExtJSON(buf []byte, doc bson.Raw, mode ExtJSONMode) ([]byte, error) {
+	out, err := appendExtJSONDocument(buf, doc, mode, '{', '}')
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// MarshalValueExtJSON is like MarshalExtJSON but encodes a single value.
+func MarshalValueExtJSON(buf []byte, val bson.RawValue, mode ExtJSONMode) ([]byte, error) {
+	return appendExtJSONValue(buf, val, mode)
+}
+
+func appendExtJSONDocument(buf []byte, doc []byte, mode ExtJSONMode, open, closer byte) ([]byte, error) {
+	rem, err := elementsBlock(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	buf = append(buf, open)
+
+	for first := true; len(rem) > 0; first = false {
+		var el bsoncore.Element
+		var ok bool
+
+		el, rem, ok = bsoncore.ReadElement(rem)
+		if !ok {
+			return nil, bsoncore.NewInsufficientBytesError(doc, rem)
+		}
+
+		if !first {
+			buf = append(buf, ',')
+		}
+
+		key, err := el.KeyBytesErr()
+		if err != nil {
+			return nil, err
+		}
+
+		if open == '{' {
+			buf = appendExtJSONString(buf, key)
+			buf = append(buf, ':')
+		}
+
+		val, err := el.ValueErr()
+		if err != nil {
+			return nil, fmt.Errorf("parsing %#q: %w", key, err)
+		}
+
+		buf, err = appendExtJSONValue(
+			buf,
+			bson.RawValue{Type: bson.Type(val.Type), Value: val.Data},
+			mode,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %#q: %w", key, err)
+		}
+	}
+
+	return append(buf, closer), nil
+}
+
+//nolint:cyclop,funlen,gocyclo
+func appendExtJSONValue(buf []byte, val bson.RawValue, mode ExtJSONMode) ([]byte, error) {
+	canonical := mode == ExtJSONCanonical
+
+	switch val.Type {
+	case bson.TypeDouble:
+		f, ok := val.DoubleOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		return appendExtJSONDouble(buf, f, canonical), nil
+	case bson.TypeString:
+		str, err := readStringBytes(val.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		return appendExtJSONString(buf, str), nil
+	case bson.TypeEmbeddedDocument:
+		return appendExtJSONDocument(buf, val.Value, mode, '{', '}')
+	case bson.TypeArray:
+		return appendExtJSONDocument(buf, val.Value, mode, '[', ']')
+	case bson.TypeBinary:
+		subtype, data, ok := val.BinaryOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		buf = append(buf, `{"$binary":{"base64":"`...)
+		buf = base64.StdEncoding.AppendEncode(buf, data)
+		buf = append(buf, `","subType":"`...)
+		buf = appendHexByte(buf, subtype)
+
+		return append(buf, `"}}`...), nil
+	case bson.TypeUndefined:
+		return append(buf, `{"$undefined":true}`...), nil
+	case bson.TypeObjectID:
+		oid, ok := val.ObjectIDOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		return appendExtJSONObjectID(buf, `{"$oid":"`, oid), nil
+	case bson.TypeBoolean:
+		b, ok := val.BooleanOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		return strconv.AppendBool(buf, b), nil
+	case bson.TypeDateTime:
+		dt, ok := val.DateTimeOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		return appendExtJSONDateTime(buf, dt, canonical), nil
+	case bson.TypeNull:
+		return append(buf, "null"...), nil
+	case bson.TypeRegex:
+		pattern, opts, ok := val.RegexOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		// To match the driver:
+		optRunes := []rune(opts)
+		slices.Sort(optRunes)
+
+		buf = append(buf, `{"$regularExpression":{"pattern":`...)
+		buf = appendExtJSONString(buf, []byte(pattern))
+		buf = append(buf, `,"options":`...)
+		buf = appendExtJSONString(buf, []byte(string(optRunes)))
+
+		return append(buf, `}}`...), nil
+	case bson.TypeDBPointer:
+		ns, oid, ok := val.DBPointerOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		// NB: The driver doesn’t escape the namespace.
+		buf = append(buf, `{"$dbPointer":{"$ref":"`...)
+		buf = append(buf, ns...)
+		buf = appendExtJSONObjectID(buf, `","$id":{"$oid":"`, oid)
+
+		return append(buf, `}}`...), nil
+	case bson.TypeJavaScript, bson.TypeSymbol:
+		str, err := readStringBytes(val.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		if val.Type == bson.TypeSymbol {
+			buf = append(buf, `{"$symbol":`...)
+		} else {
+			buf = append(buf, `{"$code":`...)
+		}
+
+		buf = appendExtJSONString(buf, str)
+
+		return append(buf, '}'), nil
+	case bson.TypeCodeWithScope:
+		code, scope, ok := val.CodeWithScopeOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		buf = append(buf, `{"$code":`...)
+		buf = appendExtJSONString(buf, []byte(code))
+		buf = append(buf, `,"$scope":`...)
+
+		buf, err := appendExtJSONDocument(buf, scope, mode, '{', '}')
+		if err != nil {
+			return nil, fmt.Errorf("encoding scope: %w", err)
+		}
+
+		return append(buf, '}'), nil
+	case bson.TypeInt32, bson.TypeInt64:
+		i64, ok := val.AsInt64OK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		if !canonical {
+			return strconv.AppendInt(buf, i64, 10), nil
+		}
+
+		if val.Type == bson.TypeInt32 {
+			buf = append(buf, `{"$numberInt":"`...)
+		} else {
+			buf = append(buf, `{"$numberLong":"`...)
+		}
+
+		buf = strconv.AppendInt(buf, i64, 10)
+
+		return append(buf, `"}`...), nil
+	case bson.TypeTimestamp:
+		t, i, ok := val.TimestampOK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		buf = append(buf, `{"$timestamp":{"t":`...)
+		buf = strconv.AppendUint(buf, uint64(t), 10)
+		buf = append(buf, `,"i":`...)
+		buf = strconv.AppendUint(buf, uint64(i), 10)
+
+		return append(buf, `}}`...), nil
+	case bson.TypeDecimal128:
+		dec, ok := val.Decimal128OK()
+		if !ok {
+			return nil, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		buf = append(buf, `{"$numberDecimal":"`...)
+		buf = append(buf, dec.String()...)
+
+		return append(buf, `"}`...), nil
+	case bson.TypeMinKey:
+		return append(buf, `{"$minKey":1}`...), nil
+	case bson.TypeMaxKey:
+		return append(buf, `{"$maxKey":1}`...), nil
+	}
+
+	return nil, fmt.Errorf("cannot encode unknown BSON type %s", val.Type)
+}
+
+const hexDigits = "0123456789abcdef"
+
+func appendHexByte(buf []byte, b byte) []byte {
+	return append(buf, hexDigits[b>>4], hexDigits[b&0xf])
+}
+
+func appendExtJSONObjectID(buf []byte, prefix string, oid bson.ObjectID) []byte {
+	buf = append(buf, prefix...)
+
+	for _, b := range oid {
+		buf = appendHexByte(buf, b)
+	}
+
+	return append(buf, `"}`...)
+}
+
+func appendExtJSONDouble(buf []byte, f float64, canonical bool) []byte {
+	var special string
+
+	switch {
+	case math.IsInf(f, 1):
+		special = "Infinity"
+	case math.IsInf(f, -1):
+		special = "-Infinity"
+	case math.IsNaN(f):
+		special = "NaN"
+	}
+
+	if canonical || special != "" {
+		buf = append(buf, `{"$numberDouble":"`...)
+	}
+
+	if special != "" {
+		buf = append(buf, special...)
+	} else {
+		// As the driver does, print integers with exactly one decimal
+		// place, and otherwise print as many as needed.
+		start := len(buf)
+		buf = strconv.AppendFloat(buf, f, 'G', -1, 64)
+
+		if !slices.ContainsFunc(buf[start:], func(c byte) bool { return c == 'E' || c == '.' }) {
+			buf = append(buf, ".0"...)
+		}
+	}
+
+	if canonical || special != "" {
+		buf = append(buf, `"}`...)
+	}
+
+	return buf
+}
+
+func appendExtJSONDateTime(buf []byte, dt int64, canonical bool) []byte {
+	t := time.Unix(dt/1e3, dt%1e3*1e6).UTC()
+
+	if canonical || t.Year() < 1970 || t.Year() > 9999 {
+		buf = append(buf, `{"$date":{"$numberLong":"`...)
+		buf = strconv.AppendInt(buf, dt, 10)
+
+		return append(buf, `"}}`...)
+	}
+
+	buf = append(buf, `{"$date":"`...)
+	buf = t.AppendFormat(buf, extJSONTimeFormat)
+
+	return append(buf, `"}`...)
+}
+
+// appendExtJSONString appends a JSON string literal. It escapes exactly as
+// the driver does (without HTML escaping): invalid UTF-8 becomes U+FFFD, and
+// U+2028 & U+2029 are always escaped.
+func appendExtJSONString(buf []byte, s []byte) []byte {
+	buf = append(buf, '"')
+	start := 0
+
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+
+			buf = append(buf, s[start:i]...)
+
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			case '\b':
+				buf = append(buf, '\\', 'b')
+			case '\f':
+				buf = append(buf, '\\', 'f')
+			default:
+				buf = append(buf, `\u00`...)
+				buf = appendHexByte(buf, c)
+			}
+
+			i++
+			start = i
+
+			continue
+		}
+
+		r, size := utf8.DecodeRune(s[i:])
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\ufffd`...)
+		case r == '\u2028' || r == '\u2029':
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\u202`...)
+			buf = append(buf, hexDigits[r&0xf])
+		default:
+			i += size
+			continue
+		}
+
+		i += size
+		start = i
+	}
+
+	buf = append(buf, s[start:]...)
+
+	return append(buf, '"')
+}
@@ -0,0 +1,385 @@
+package bsontools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// DefaultMaxExtJSONDocumentSize is ReadExtJSONDocuments’s default maximum
+// size for a single document’s Extended JSON text. Extended JSON is much
+// larger than the equivalent BSON, so this exceeds BSON’s own limit.
+const DefaultMaxExtJSONDocumentSize = 64 * 1024 * 1024
+
+// ExtJSONStreamError indicates a failure to read a document from an Extended
+// JSON stream. Line and Column are 1-based; Column counts characters, not
+// bytes.
+type ExtJSONStreamError struct {
+	// Document is the 0-based index of the document that failed.
+	Document int
+
+	Line   int
+	Column int
+
+	Err error
+}
+
+func (se ExtJSONStreamError) Error() string {
+	return fmt.Sprintf(
+		"reading Extended JSON document %d (line %d, column %d): %v",
+		se.Document,
+		se.Line,
+		se.Column,
+		se.Err,
+	)
+}
+
+func (se ExtJSONStreamError) Unwrap() error {
+	return se.Err
+}
+
+// ReadExtJSONDocuments returns an iterator over the documents in an
+// Extended JSON stream, as mongoexport writes. The stream may either be a
+// single JSON array of objects or a sequence of whitespace-separated
+// objects (e.g., newline-delimited JSON); the first non-whitespace byte
+// determines which.
+//
+// Each document is decoded as UnmarshalExtJSON does. Each document’s text is
+// limited to maxSize bytes; if maxSize is 0, DefaultMaxExtJSONDocumentSize
+// is used. Memory use is thus bounded regardless of the stream’s length.
+//
+// Failures are returned as ExtJSONStreamError, which gives the failure’s
+// line & column in the stream.
+//
+// As with ReadDocuments, each yielded document reuses a single buffer, so
+// it is only valid until the next iteration. If the iterator returns an
+// error but the caller continues iterating, a panic will ensue.
+//
+// Example usage:
+//
+//	for doc, err := range bsontools.ReadExtJSONDocuments(file, 0) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func ReadExtJSONDocuments(r io.Reader, maxSize int) iter.Seq2[bson.Raw, error] {
+	if maxSize == 0 {
+		maxSize = DefaultMaxExtJSONDocumentSize
+	}
+
+	return func(yield func(bson.Raw, error) bool) {
+		sc := extJSONScanner{
+			r:       bufio.NewReaderSize(r, streamBufferSize),
+			maxSize: maxSize,
+			line:    1,
+			column:  1,
+		}
+
+		yieldErr := func(err error) {
+			if yield(nil, err) {
+				panic(fmt.Errorf("must stop iteration after error (%w)", err))
+			}
+		}
+
+		var doc []byte
+
+		for {
+			more, err := sc.next()
+			if err != nil {
+				yieldErr(err)
+				return
+			}
+
+			if !more {
+				return
+			}
+
+			doc, err = UnmarshalExtJSON(doc[:0], sc.text)
+			if err != nil {
+				yieldErr(sc.textError(err))
+				return
+			}
+
+			if !yield(bson.Raw(doc), nil) {
+				return
+			}
+
+			sc.docNum++
+		}
+	}
+}
+
+// extJSONScanner splits an Extended JSON stream into its documents’ texts.
+// It only validates the JSON enough to find each object’s end;
+// UnmarshalExtJSON does the rest.
+type extJSONScanner struct {
+	r       *bufio.Reader
+	maxSize int
+
+	// line & column give the position of the next byte to read.
+	line, column int
+
+	// started is set once the stream’s first byte has been examined,
+	// inArray once the stream is known to be a JSON array, and arrayDone
+	// once that array’s closing bracket has been read.
+	started, inArray, arrayDone bool
+
+	docNum int
+
+	// text is the current document’s JSON text, and textLine & textColumn
+	// give its position in the stream.
+	text                 []byte
+	textLine, textColumn int
+}
+
+// next reads the next document’s text into sc.text. It returns false if the
+// stream has no more documents.
+func (sc *extJSONScanner) next() (bool, error) {
+	c, err := sc.skipSpace()
+	if errors.Is(err, io.EOF) {
+		if sc.inArray && !sc.arrayDone {
+			return false, sc.errorf("unterminated array")
+		}
+
+		return false, nil
+	}
+
+	if err != nil {
+		return false, sc.errorf("%w", err)
+	}
+
+	if !sc.started {
+		sc.started = true
+
+		if c == '[' {
+			sc.inArray = true
+			sc.consume(c)
+
+			c, err = sc.skipSpace()
+			if err != nil {
+				return false, sc.errorf("unterminated array")
+			}
+
+			if c == ']' {
+				sc.consume(c)
+				sc.arrayDone = true
+
+				return sc.finishArray()
+			}
+		}
+	} else if sc.inArray {
+		switch c {
+		case ']':
+			sc.consume(c)
+			sc.arrayDone = true
+
+			return sc.finishArray()
+		case ',':
+			sc.consume(c)
+
+			c, err = sc.skipSpace()
+			if err != nil {
+				return false, sc.errorf("unterminated array")
+			}
+		default:
+			return false, sc.errorf("expected ',' or ']' but found %#q", c)
+		}
+	}
+
+	if c != '{' {
+		return false, sc.errorf("expected an object but found %#q", c)
+	}
+
+	return true, sc.readObject()
+}
+
+// finishArray ensures that nothing but whitespace follows the array.
+func (sc *extJSONScanner) finishArray() (bool, error) {
+	c, err := sc.skipSpace()
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, sc.errorf("%w", err)
+	}
+
+	return false, sc.errorf("unexpected %#q after array", c)
+}
+
+// readObject reads a JSON object into sc.text. The reader must be at the
+// object’s opening brace.
+func (sc *extJSONScanner) readObject() error {
+	sc.text = sc.text[:0]
+	sc.textLine, sc.textColumn = sc.line, sc.column
+
+	var depth int
+	var inString, escaped bool
+
+	for {
+		c, err := sc.readByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return sc.errorf("unterminated object")
+			}
+
+			return sc.errorf("%w", err)
+		}
+
+		if len(sc.text) == sc.maxSize {
+			return sc.errorf("document exceeds maximum size (%d bytes)", sc.maxSize)
+		}
+
+		sc.text = append(sc.text, c)
+
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		default:
+			switch c {
+			case '"':
+				inString = true
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// skipSpace skips whitespace and returns the next byte without consuming it.
+func (sc *extJSONScanner) skipSpace() (byte, error) {
+	for {
+		next, err := sc.r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+
+		switch next[0] {
+		case ' ', '\t', '\n', '\r':
+			sc.consume(next[0])
+		default:
+			return next[0], nil
+		}
+	}
+}
+
+// consume advances past a byte that skipSpace has already peeked.
+func (sc *extJSONScanner) consume(c byte) {
+	lo.Must(sc.r.Discard(1))
+
+	sc.line, sc.column = advancePosition(sc.line, sc.column, c)
+}
+
+func (sc *extJSONScanner) readByte() (byte, error) {
+	c, err := sc.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	sc.line, sc.column = advancePosition(sc.line, sc.column, c)
+
+	return c, nil
+}
+
+func (sc *extJSONScanner) errorf(format string, args ...any) error {
+	return ExtJSONStreamError{
+		Document: sc.docNum,
+		Line:     sc.line,
+		Column:   sc.column,
+		Err:      fmt.Errorf(format, args...),
+	}
+}
+
+// textError converts an error from parsing sc.text to an
+// ExtJSONStreamError.
+func (sc *extJSONScanner) textError(err error) error {
+	line, column := sc.textLine, sc.textColumn
+
+	var syntaxErr ExtJSONSyntaxError
+	if errors.As(err, &syntaxErr) {
+		for _, c := range sc.text[:min(syntaxErr.Offset, len(sc.text))] {
+			line, column = advancePosition(line, column, c)
+		}
+	}
+
+	return ExtJSONStreamError{
+		Document: sc.docNum,
+		Line:     line,
+		Column:   column,
+		Err:      err,
+	}
+}
+
+// advancePosition returns the line & column after the given byte. UTF-8
+// continuation bytes don’t advance the column.
+func advancePosition(line, column int, c byte) (int, int) {
+	switch {
+	case c == '\n':
+		return line + 1, 1
+	case c&0xc0 == 0x80:
+		return line, column
+	}
+
+	return line, column + 1
+}
+
+// ExtJSONWriter writes documents as newline-delimited Extended JSON, as
+// mongoexport does by default.
+//
+// Example usage:
+//
+//	ew := bsontools.NewExtJSONWriter(bufferedWriter, bsontools.ExtJSONRelaxed)
+//	for _, doc := range docs {
+//		if err := ew.WriteDocument(doc); err != nil {
+//			return err
+//		}
+//	}
+type ExtJSONWriter struct {
+	w    io.Writer
+	mode ExtJSONMode
+	buf  []byte
+}
+
+// NewExtJSONWriter returns an ExtJSONWriter that writes to the given writer
+// in the given mode. The given writer should be buffered.
+func NewExtJSONWriter(w io.Writer, mode ExtJSONMode) *ExtJSONWriter {
+	return &ExtJSONWriter{w: w, mode: mode}
+}
+
+// WriteDocument writes a document followed by a newline. Its internal
+// buffer is reused across calls, so memory use is bounded by the largest
+// document.
+func (ew *ExtJSONWriter) WriteDocument(doc bson.Raw) error {
+	var err error
+
+	ew.buf, err = MarshalExtJSON(ew.buf[:0], doc, ew.mode)
+	if err != nil {
+		return err
+	}
+
+	ew.buf = append(ew.buf, '\n')
+
+	if _, err := ew.w.Write(ew.buf); err != nil {
+		return fmt.Errorf("writing %d-byte Extended JSON document: %w", len(ew.buf), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package bsontools
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func readAllExtJSON(t *testing.T, stream string) ([]bson.Raw, error) {
+	t.Helper()
+
+	var docs []bson.Raw
+
+	for doc, err := range ReadExtJSONDocuments(strings.NewReader(stream), 0) {
+		if err != nil {
+			return docs, err
+		}
+
+		docs = append(docs, slices.Clone(doc))
+	}
+
+	return docs, nil
+}
+
+func TestReadWriteExtJSONDocuments(t *testing.T) {
+	docs := []bson.Raw{
+		lo.Must(bson.Marshal(bson.D{{"_id", int32(1)}, {"s", "with } and ] and \"quotes\""}})),
+		lo.Must(bson.Marshal(bson.D{})),
+		lo.Must(bson.Marshal(bson.D{{"_id", int32(3)}, {"a", bson.A{bson.D{{"x", 1.5}}}}})),
+	}
+
+	for _, mode := range []ExtJSONMode{ExtJSONCanonical, ExtJSONRelaxed} {
+		var stream bytes.Buffer
+
+		ew := NewExtJSONWriter(&stream, mode)
+		for _, doc := range docs {
+			require.NoError(t, ew.WriteDocument(doc), mode)
+		}
+
+		assert.Equal(t, len(docs), strings.Count(stream.String(), "\n"), mode)
+
+		got, err := readAllExtJSON(t, stream.String())
+		require.NoError(t, err, mode)
+		assert.Equal(t, docs, got, mode)
+	}
+}
+
+func TestReadExtJSONDocuments_Array(t *testing.T) {
+	expected := []bson.Raw{
+		lo.Must(bson.Marshal(bson.D{{"a", int32(1)}})),
+		lo.Must(bson.Marshal(bson.D{{"b", bson.A{}}})),
+	}
+
+	for _, stream := range []string{
+		`[{"a":1},{"b":[]}]`,
+		"\n[\n  {\"a\": 1},\n  {\"b\": []}\n]\n",
+	} {
+		got, err := readAllExtJSON(t, stream)
+		require.NoError(t, err, stream)
+		assert.Equal(t, expected, got, stream)
+	}
+
+	for _, stream := range []string{``, " \n ", `[]`, ` [ ] `} {
+		got, err := readAllExtJSON(t, stream)
+		require.NoError(t, err, "%#q", stream)
+		assert.Empty(t, got, "%#q", stream)
+	}
+}
+
+func TestReadExtJSONDocuments_Errors(t *testing.T) {
+	cases := []struct {
+		stream       string
+		docs         int
+		line, column int
+		errSubstring string
+	}{
+		{stream: "{\"a\":1}\n{\"a\":tru}\n", docs: 1, line: 2, column: 6, errSubstring: "tru"},
+		{stream: "{\"a\":1}\n{\"é\":1,\n  \"b\":x}", docs: 1, line: 3, column: 7},
+		{stream: "{\"a\":1}\n[]", docs: 1, line: 2, column: 1, errSubstring: "expected an object"},
+		{stream: "{\"a\":1}\n{\"a\":", docs: 1, line: 2, column: 6, errSubstring: "unterminated object"},
+		{stream: `[{"a":1} {"a":2}]`, docs: 1, line: 1, column: 10, errSubstring: "expected ','"},
+		{stream: `[{"a":1},`, docs: 1, line: 1, column: 10, errSubstring: "unterminated array"},
+		{stream: `[{"a":1}`, docs: 1, line: 1, column: 9, errSubstring: "unterminated array"},
+		{stream: `[{"a":1}] {}`, docs: 1, line: 1, column: 11, errSubstring: "after array"},
+		{stream: `[1]`, docs: 0, line: 1, column: 2, errSubstring: "expected an object"},
+	}
+
+	for _, c := range cases {
+		docs, err := readAllExtJSON(t, c.stream)
+		require.Error(t, err, "%#q", c.stream)
+		assert.Len(t, docs, c.docs, "%#q", c.stream)
+
+		var streamErr ExtJSONStreamError
+		require.True(t, errors.As(err, &streamErr), "%#q: %v", c.stream, err)
+
+		assert.Equal(t, c.docs, streamErr.Document, "%#q: %v", c.stream, err)
+		assert.Equal(t, c.line, streamErr.Line, "%#q: line: %v", c.stream, err)
+		assert.Equal(t, c.column, streamErr.Column, "%#q: column: %v", c.stream, err)
+		assert.ErrorContains(t, err, c.errSubstring, "%#q", c.stream)
+	}
+}
+
+func TestReadExtJSONDocuments_MaxSize(t *testing.T) {
+	stream := `{"a":"0123456789"}`
+
+	for _, err := range ReadExtJSONDocuments(strings.NewReader(stream), len(stream)) {
+		require.NoError(t, err)
+	}
+
+	var gotErr error
+	for _, err := range ReadExtJSONDocuments(strings.NewReader(stream), len(stream)-1) {
+		if err != nil {
+			gotErr = err
+			break
+		}
+	}
+
+	assert.ErrorContains(t, gotErr, "maximum size")
+}
@@ -0,0 +1,191 @@
+package bsontools
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+func extJSONTestDoc(t *testing.T) bson.Raw {
+	t.Helper()
+
+	oid := lo.Must(bson.ObjectIDFromHex("0123456789abcdef01234567"))
+
+	return lo.Must(bson.Marshal(bson.D{
+		{"_id", oid},
+		{"double", 1.5},
+		{"doubleInt", 3.0},
+		{"doubleBig", 1e21},
+		{"doubleSmall", 1e-7},
+		{"doubleNegZero", math.Copysign(0, -1)},
+		{"nan", math.NaN()},
+		{"inf", math.Inf(1)},
+		{"negInf", math.Inf(-1)},
+		{"string", "hello \"world\"\n\t\\ <&> \x01\x7f é 😀   "},
+		{"badUTF8", string([]byte{'a', 0xff, 'b'})},
+		{"doc", bson.D{{"a", int32(1)}, {"b", bson.D{}}}},
+		{"array", bson.A{int32(1), "two", bson.A{}, bson.D{{"x", nil}}}},
+		{"emptyArray", bson.A{}},
+		{"binary", bson.Binary{Subtype: 0x80, Data: []byte("binary data")}},
+		{"uuid", bson.Binary{Subtype: bson.TypeBinaryUUID, Data: make([]byte, 16)}},
+		{"undefined", bson.Undefined{}},
+		{"true", true},
+		{"false", false},
+		{"date", bson.NewDateTimeFromTime(time.Date(2024, 2, 29, 1, 2, 3, 450_000_000, time.UTC))},
+		{"dateWholeSecond", bson.DateTime(1_000)},
+		{"datePre1970", bson.DateTime(-1)},
+		{"dateFarFuture", bson.DateTime(253_402_300_800_000)},
+		{"null", nil},
+		{"regex", bson.Regex{Pattern: `^a"b\d$`, Options: "xmi"}},
+		{"dbPointer", bson.DBPointer{DB: "db.coll", Pointer: oid}},
+		{"code", bson.JavaScript(`function() { return "x"; }`)},
+		{"symbol", bson.Symbol("sym")},
+		{"codeWithScope", bson.CodeWithScope{
+			Code:  "function() { return y; }",
+			Scope: bson.D{{"y", int64(2)}},
+		}},
+		{"int32", int32(-42)},
+		{"timestamp", bson.Timestamp{T: math.MaxUint32, I: 7}},
+		{"int64", int64(math.MinInt64)},
+		{"int64Small", int64(1)},
+		{"decimal", lo.Must(bson.ParseDecimal128("-1.2300E+40"))},
+		{"decimalNaN", lo.Must(bson.ParseDecimal128("NaN"))},
+		{"minKey", bson.MinKey{}},
+		{"maxKey", bson.MaxKey{}},
+		{"$dollar.dotted", "key"},
+	}))
+}
+
+func TestMarshalExtJSON(t *testing.T) {
+	doc := extJSONTestDoc(t)
+
+	for _, mode := range []ExtJSONMode{ExtJSONCanonical, ExtJSONRelaxed} {
+		expected, err := bson.MarshalExtJSON(doc, mode == ExtJSONCanonical, false)
+		require.NoError(t, err, mode)
+
+		got, err := MarshalExtJSON(nil, doc, mode)
+		require.NoError(t, err, mode)
+
+		assert.Equal(t, string(expected), string(got), mode)
+	}
+}
+
+func TestMarshalExtJSON_Append(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{{"a", int32(1)}}))
+
+	buf, err := MarshalExtJSON([]byte("prefix "), doc, ExtJSONRelaxed)
+	require.NoError(t, err)
+	assert.Equal(t, `prefix {"a":1}`, string(buf))
+
+	buf, err = MarshalExtJSON(nil, bson.Raw{}, ExtJSONRelaxed)
+	assert.Error(t, err, "empty buffer isn’t a document")
+	assert.Nil(t, buf)
+}
+
+func TestMarshalValueExtJSON(t *testing.T) {
+	got, err := MarshalValueExtJSON(nil, ToRawValue(int64(5)), ExtJSONCanonical)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"$numberLong":"5"}`, string(got))
+}
+
+func TestUnmarshalExtJSON_RoundTrip(t *testing.T) {
+	doc := extJSONTestDoc(t)
+
+	for _, mode := range []ExtJSONMode{ExtJSONCanonical, ExtJSONRelaxed} {
+		extJSON := lo.Must(MarshalExtJSON(nil, doc, mode))
+
+		var expected bson.Raw
+		require.NoError(t, bson.UnmarshalExtJSON(extJSON, false, &expected), mode)
+
+		got, err := UnmarshalExtJSON(nil, extJSON)
+		require.NoError(t, err, mode)
+
+		assert.Equal(t, expected, got, "%s: %s", mode, extJSON)
+	}
+}
+
+func TestUnmarshalExtJSON(t *testing.T) {
+	cases := []string{
+		`{}`,
+		` { "a" : [ ] , "b" : { } } `,
+		`{"int":2147483647,"long":2147483648,"negLong":-2147483649,"huge":9223372036854775808}`,
+		`{"float":1.0,"exp":1e3,"negExp":-2.5E-3,"zero":0,"negZero":-0}`,
+		`{"s":"esc \" \\ \/ \b \f \n \r \t é 😀"}`,
+		`{"lone":"\ud83d!","badPair":"\ud83dA"}`,
+		`{"$oid":"0123456789abcdef01234567"}`,
+		`{"a":{"$numberInt":"-5"},"b":{"$numberLong":"5"},"c":{"$numberDouble":"-Infinity"}}`,
+		`{"a":{"$binary":{"subType":"5","base64":"AAE="}}}`,
+		`{"a":{"$binary":"AAE=","$type":"80"}}`,
+		`{"a":{"$uuid":"01234567-89ab-cdef-0123-456789abcdef"}}`,
+		`{"a":{"$date":"2024-01-02T03:04:05Z"},"b":{"$date":"2024-01-02T03:04:05.6+0100"}}`,
+		`{"a":{"$date":1234},"b":{"$date":{"$numberLong":"-5"}}}`,
+		`{"a":{"$regularExpression":{"options":"smi","pattern":"x"}}}`,
+		`{"a":{"$timestamp":{"i":1,"t":2}}}`,
+		`{"a":{"$dbPointer":{"$id":{"$oid":"0123456789abcdef01234567"},"$ref":"x.y"}}}`,
+		`{"a":{"$code":"x"},"b":{"$code":"y","$scope":{"z":{"$minKey":1}}}}`,
+		`{"a":{"$maxKey":1},"b":{"$undefined":true},"c":{"$symbol":"s"}}`,
+		`{"a":{"$numberDecimal":"1.0E-5"},"b":{"$notAWrapper":1},"c":{"x":1,"$oid":2}}`,
+		`{"a":[{"$numberLong":"1"},[1,[2]],null,true,false]}`,
+	}
+
+	for _, extJSON := range cases {
+		var expected bson.Raw
+		require.NoError(t, bson.UnmarshalExtJSON([]byte(extJSON), false, &expected), extJSON)
+
+		got, err := UnmarshalExtJSON(nil, []byte(extJSON))
+		require.NoError(t, err, extJSON)
+
+		assert.Equal(t, expected, got, extJSON)
+	}
+}
+
+func TestUnmarshalExtJSON_Buffer(t *testing.T) {
+	buf := []byte("garbage")
+
+	doc, err := UnmarshalExtJSON(buf, []byte(`{"a":1}`))
+	require.NoError(t, err)
+	assert.Equal(t, bsoncore.NewDocumentBuilder().AppendInt32("a", 1).Build(), bsoncore.Document(doc))
+}
+
+func TestUnmarshalExtJSON_Errors(t *testing.T) {
+	cases := map[string]int{
+		``:                                  0,
+		`[]`:                                0,
+		`{"a":1} x`:                         8,
+		`{"a":01}`:                          5,
+		`{"a":1.}`:                          7,
+		`{"a":tru}`:                         5,
+		`{"a" 1}`:                           5,
+		`{"a":1,}`:                          7,
+		`{"a":[1 2]}`:                       8,
+		`{"a":"unterminated}`:               19,
+		`{"a":"\x"}`:                        6,
+		`{"a\u0000":1}`:                     1,
+		`{"a":{"$numberInt":"2147483648"}}`: 31,
+		`{"a":{"$oid":"xyz"}}`:              18,
+		`{"a":{"$oid":"0123456789abcdef01234567","x":1}}`: 39,
+		`{"a":{"$binary":{"base64":""}}}`:                 28,
+		`{"a":{"$binary":{"base64":"","base64":""}}}`:     29,
+		`{"a":{"$scope":{}}}`:                             15,
+		`{"a":{"$minKey":2}}`:                             17,
+		`{"a":{"$date":1.5}}`:                             17,
+		`{"a":{"$uuid":"0123"}}`:                          20,
+		`{"a":{"$timestamp":{"t":-1,"i":0}}}`:             26,
+	}
+
+	for extJSON, offset := range cases {
+		_, err := UnmarshalExtJSON(nil, []byte(extJSON))
+		require.Error(t, err, extJSON)
+
+		var syntaxErr ExtJSONSyntaxError
+		require.True(t, errors.As(err, &syntaxErr), "%#q: %v", extJSON, err)
+		assert.Equal(t, offset, syntaxErr.Offset, "%#q: %v", extJSON, err)
+	}
+}
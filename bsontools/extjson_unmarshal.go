@@ -0,0 +1,1190 @@
+package bsontools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/ccoveille/go-safecast/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// ExtJSONSyntaxError indicates that Extended JSON could not be parsed.
+type ExtJSONSyntaxError struct {
+	// Offset is the 0-based byte offset in the input where parsing failed.
+	Offset int
+
+	// Reason describes what went wrong.
+	Reason string
+}
+
+func (se ExtJSONSyntaxError) Error() string {
+	return fmt.Sprintf("invalid Extended JSON at offset %d: %s", se.Offset, se.Reason)
+}
+
+// UnmarshalExtJSON decodes an Extended JSON object (canonical or relaxed,
+// v1 or v2) into a BSON document, yielding the same result as
+// bson.UnmarshalExtJSON() into a bson.Raw. This avoids reflection and
+// writes directly into the given buffer (which may be nil), which lets you
+// minimize GC churn.
+//
+// As with the driver, type wrappers (e.g., `{"$oid": …}`) are recognized
+// anywhere except as the top-level object, and relaxed-format numbers
+// become int32, int64, or double according to their form & magnitude.
+//
+// Parse failures are returned as ExtJSONSyntaxError.
+//
+// Example usage:
+//
+//	doc, err := UnmarshalExtJSON(buf[:0], jsonBytes)
+func UnmarshalExtJSON(buf []byte, data []byte) (bson.Raw, error) {
+	p := extJSONParser{data: data, out: buf}
+	start := len(buf)
+
+	p.skipSpace()
+
+	if c, ok := p.peek(); !ok || c != '{' {
+		return nil, p.errorf("expected an object")
+	}
+
+	if _, err := p.parseObject(true); err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+
+	if p.pos != len(p.data) {
+		return nil, p.errorf("unexpected data after object")
+	}
+
+	return bson.Raw(p.out[start:]), nil
+}
+
+type extJSONParser struct {
+	data []byte
+	pos  int
+
+	// out is the BSON that the parser writes.
+	out []byte
+
+	// scratch holds type wrappers’ string values.
+	scratch []byte
+}
+
+func (p *extJSONParser) errorf(format string, args ...any) error {
+	return ExtJSONSyntaxError{
+		Offset: p.pos,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *extJSONParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *extJSONParser) peek() (byte, bool) {
+	if p.pos >= len(p.data) {
+		return 0, false
+	}
+
+	return p.data[p.pos], true
+}
+
+// consume skips whitespace then consumes the given character.
+func (p *extJSONParser) consume(c byte) error {
+	p.skipSpace()
+
+	if got, ok := p.peek(); !ok || got != c {
+		if !ok {
+			return p.errorf("expected %#q but found end of input", c)
+		}
+
+		return p.errorf("expected %#q but found %#q", c, got)
+	}
+
+	p.pos++
+
+	return nil
+}
+
+// consumeLiteral consumes a JSON literal (true, false, or null).
+func (p *extJSONParser) consumeLiteral(literal string) error {
+	if !bytes.HasPrefix(p.data[p.pos:], []byte(literal)) {
+		return p.errorf("invalid literal (expected %#q)", literal)
+	}
+
+	p.pos += len(literal)
+
+	return nil
+}
+
+// patchLength writes the length of p.out[at:] as an int32 at p.out[at].
+func (p *extJSONParser) patchLength(at int) error {
+	l, err := safecast.Convert[int32](len(p.out) - at)
+	if err != nil {
+		return p.errorf("value too large for BSON (%d bytes)", len(p.out)-at)
+	}
+
+	binary.LittleEndian.PutUint32(p.out[at:], uint32(l))
+
+	return nil
+}
+
+// parseValue appends a JSON value’s BSON encoding to p.out and returns its
+// BSON type.
+func (p *extJSONParser) parseValue() (bson.Type, error) {
+	p.skipSpace()
+
+	c, ok := p.peek()
+	if !ok {
+		return 0, p.errorf("expected a value but found end of input")
+	}
+
+	switch {
+	case c == '{':
+		return p.parseObject(false)
+	case c == '[':
+		return bson.TypeArray, p.parseArray()
+	case c == '"':
+		return bson.TypeString, p.appendBSONString()
+	case c == 't', c == 'f':
+		lit := "true"
+		if c == 'f' {
+			lit = "false"
+		}
+
+		if err := p.consumeLiteral(lit); err != nil {
+			return 0, err
+		}
+
+		p.out = bsoncore.AppendBoolean(p.out, c == 't')
+
+		return bson.TypeBoolean, nil
+	case c == 'n':
+		return bson.TypeNull, p.consumeLiteral("null")
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	}
+
+	return 0, p.errorf("unexpected character %#q", c)
+}
+
+// parseObject parses a JSON object, which may be a type wrapper unless
+// it’s the top-level object.
+func (p *extJSONParser) parseObject(topLevel bool) (bson.Type, error) {
+	start := len(p.out)
+
+	p.pos++ // {
+	p.skipSpace()
+
+	if c, ok := p.peek(); ok && c == '}' {
+		p.pos++
+		p.out = append(p.out, 5, 0, 0, 0, 0)
+
+		return bson.TypeEmbeddedDocument, nil
+	}
+
+	// Length header & first element’s type:
+	p.out = append(p.out, 0, 0, 0, 0, 0)
+
+	keyAt := len(p.out)
+	if err := p.appendKey(); err != nil {
+		return 0, err
+	}
+
+	if !topLevel {
+		if wrapper, isWrapper := extJSONWrappers[string(p.out[keyAt:len(p.out)-1])]; isWrapper {
+			p.out = p.out[:start]
+			return p.parseWrapper(wrapper)
+		}
+	}
+
+	if err := p.parseElementValue(keyAt - 1); err != nil {
+		return 0, err
+	}
+
+	if err := p.parseRemainingElements(start, '}', nil); err != nil {
+		return 0, err
+	}
+
+	return bson.TypeEmbeddedDocument, nil
+}
+
+// parseRemainingElements parses a document’s or array’s elements after the
+// first until the closing character. If nextKey is nil, keys are parsed
+// from the input; otherwise this is an array, and nextKey appends the next
+// index key.
+func (p *extJSONParser) parseRemainingElements(start int, closer byte, nextKey func()) error {
+	for {
+		p.skipSpace()
+
+		c, ok := p.peek()
+
+		switch {
+		case ok && c == closer:
+			p.pos++
+			p.out = append(p.out, 0)
+
+			return p.patchLength(start)
+		case ok && c == ',':
+			p.pos++
+		case !ok:
+			return p.errorf("expected %#q or %#q but found end of input", ',', closer)
+		default:
+			return p.errorf("expected %#q or %#q but found %#q", ',', closer, c)
+		}
+
+		typeAt := len(p.out)
+		p.out = append(p.out, 0)
+
+		if nextKey != nil {
+			nextKey()
+
+			if err := p.parseArrayElementValue(typeAt); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		p.skipSpace()
+
+		if err := p.appendKey(); err != nil {
+			return err
+		}
+
+		if err := p.parseElementValue(typeAt); err != nil {
+			return err
+		}
+	}
+}
+
+// appendKey appends a JSON object key to p.out as a C string.
+func (p *extJSONParser) appendKey() error {
+	if c, ok := p.peek(); !ok || c != '"' {
+		return p.errorf("expected a key")
+	}
+
+	keyAt := len(p.out)
+	keyPos := p.pos
+
+	var err error
+	p.out, err = p.appendJSONString(p.out)
+	if err != nil {
+		return err
+	}
+
+	if bytes.IndexByte(p.out[keyAt:], 0) != -1 {
+		p.pos = keyPos
+		return p.errorf("BSON field names cannot contain NUL")
+	}
+
+	p.out = append(p.out, 0)
+
+	return nil
+}
+
+// parseElementValue parses a `:` and value, then sets the element’s type
+// at p.out[typeAt].
+func (p *extJSONParser) parseElementValue(typeAt int) error {
+	if err := p.consume(':'); err != nil {
+		return err
+	}
+
+	bType, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	p.out[typeAt] = byte(bType)
+
+	return nil
+}
+
+func (p *extJSONParser) parseArray() error {
+	start := len(p.out)
+
+	p.pos++ // [
+	p.out = append(p.out, 0, 0, 0, 0)
+	p.skipSpace()
+
+	if c, ok := p.peek(); ok && c == ']' {
+		p.pos++
+		p.out = append(p.out, 0)
+
+		return p.patchLength(start)
+	}
+
+	p.out = append(p.out, 0, '0', 0)
+
+	if err := p.parseArrayElementValue(len(p.out) - 3); err != nil {
+		return err
+	}
+
+	index := 1
+
+	return p.parseRemainingElements(start, ']', func() {
+		p.out = strconv.AppendInt(p.out, int64(index), 10)
+		p.out = append(p.out, 0)
+		index++
+	})
+}
+
+func (p *extJSONParser) parseArrayElementValue(typeAt int) error {
+	bType, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	p.out[typeAt] = byte(bType)
+
+	return nil
+}
+
+// appendJSONString decodes a JSON string literal and appends its content.
+// This handles escapes the way the driver does, including replacing
+// invalid surrogates with U+FFFD.
+//
+//nolint:cyclop
+func (p *extJSONParser) appendJSONString(dst []byte) ([]byte, error) {
+	p.pos++ // opening quote
+
+	for {
+		// Copy unescaped bytes in bulk.
+		end := bytes.IndexAny(p.data[p.pos:], `"\`)
+		if end == -1 {
+			p.pos = len(p.data)
+			return nil, p.errorf("unterminated string")
+		}
+
+		dst = append(dst, p.data[p.pos:p.pos+end]...)
+		p.pos += end
+
+		if p.data[p.pos] == '"' {
+			p.pos++
+			return dst, nil
+		}
+
+		// Now we’re at a backslash.
+		if p.pos+1 >= len(p.data) {
+			return nil, p.errorf("unterminated string")
+		}
+
+		esc := p.data[p.pos+1]
+
+		switch esc {
+		case '"', '\\', '/':
+			dst = append(dst, esc)
+		case 'b':
+			dst = append(dst, '\b')
+		case 'f':
+			dst = append(dst, '\f')
+		case 'n':
+			dst = append(dst, '\n')
+		case 'r':
+			dst = append(dst, '\r')
+		case 't':
+			dst = append(dst, '\t')
+		case 'u':
+			var err error
+			dst, err = p.appendUnicodeEscape(dst)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		default:
+			return nil, p.errorf("invalid escape sequence %#q", "\\"+string(esc))
+		}
+
+		p.pos += 2
+	}
+}
+
+// appendUnicodeEscape decodes a \uXXXX escape (or a surrogate pair of them)
+// at p.pos.
+func (p *extJSONParser) appendUnicodeEscape(dst []byte) ([]byte, error) {
+	r, ok := parseUnicodeEscape(p.data[p.pos:])
+	if !ok {
+		return nil, p.errorf("invalid Unicode escape sequence")
+	}
+
+	p.pos += 6
+
+	if !utf16.IsSurrogate(r) {
+		return utf8.AppendRune(dst, r), nil
+	}
+
+	r2, ok := parseUnicodeEscape(p.data[p.pos:])
+	if !ok {
+		// A lone surrogate; let the next character parse normally.
+		return utf8.AppendRune(dst, utf8.RuneError), nil
+	}
+
+	p.pos += 6
+
+	if pair := utf16.DecodeRune(r, r2); pair != utf8.RuneError {
+		return utf8.AppendRune(dst, pair), nil
+	}
+
+	// NB: If r2 is also a surrogate, AppendRune writes U+FFFD for it.
+	dst = utf8.AppendRune(dst, utf8.RuneError)
+
+	return utf8.AppendRune(dst, r2), nil
+}
+
+func parseUnicodeEscape(data []byte) (rune, bool) {
+	if len(data) < 6 || data[0] != '\\' || data[1] != 'u' {
+		return 0, false
+	}
+
+	var decoded [2]byte
+	if _, err := hex.Decode(decoded[:], data[2:6]); err != nil {
+		return 0, false
+	}
+
+	return rune(decoded[0])<<8 | rune(decoded[1]), true
+}
+
+func (p *extJSONParser) appendBSONString() error {
+	lengthAt := len(p.out)
+	p.out = append(p.out, 0, 0, 0, 0)
+
+	var err error
+	p.out, err = p.appendJSONString(p.out)
+	if err != nil {
+		return err
+	}
+
+	p.out = append(p.out, 0)
+
+	// A BSON string’s length excludes the length header itself.
+	l, err := safecast.Convert[int32](len(p.out) - lengthAt - 4)
+	if err != nil {
+		return p.errorf("string too large for BSON (%d bytes)", len(p.out)-lengthAt)
+	}
+
+	binary.LittleEndian.PutUint32(p.out[lengthAt:], uint32(l))
+
+	return nil
+}
+
+// readScratchString reads a JSON string into p.scratch, which it returns.
+func (p *extJSONParser) readScratchString(what string) ([]byte, error) {
+	p.skipSpace()
+
+	if c, ok := p.peek(); !ok || c != '"' {
+		return nil, p.errorf("%s must be a string", what)
+	}
+
+	var err error
+	p.scratch, err = p.appendJSONString(p.scratch[:0])
+
+	return p.scratch, err
+}
+
+// jsonNumber is a JSON number’s parsed representation.
+type jsonNumber struct {
+	bType bson.Type
+	i64   int64
+	f64   float64
+}
+
+// readNumber parses a JSON number. Integers that fit in int32 or int64
+// become those types; other numbers become doubles.
+//
+//nolint:cyclop
+func (p *extJSONParser) readNumber() (jsonNumber, error) {
+	start := p.pos
+	isInteger := true
+
+	digits := func() int {
+		count := 0
+		for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+			p.pos++
+			count++
+		}
+
+		return count
+	}
+
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+
+	intStart := p.pos
+
+	switch intDigits := digits(); {
+	case intDigits == 0:
+		return jsonNumber{}, p.errorf("invalid number")
+	case intDigits > 1 && p.data[intStart] == '0':
+		p.pos = intStart
+		return jsonNumber{}, p.errorf("invalid number (leading zero)")
+	}
+
+	if c, ok := p.peek(); ok && c == '.' {
+		isInteger = false
+		p.pos++
+
+		if digits() == 0 {
+			return jsonNumber{}, p.errorf("invalid number (no digits after decimal point)")
+		}
+	}
+
+	if c, ok := p.peek(); ok && (c == 'e' || c == 'E') {
+		isInteger = false
+		p.pos++
+
+		if c, ok := p.peek(); ok && (c == '+' || c == '-') {
+			p.pos++
+		}
+
+		if digits() == 0 {
+			return jsonNumber{}, p.errorf("invalid number (no exponent digits)")
+		}
+	}
+
+	numStr := string(p.data[start:p.pos])
+
+	if isInteger {
+		if i64, err := strconv.ParseInt(numStr, 10, 64); err == nil {
+			if i64 < math.MinInt32 || i64 > math.MaxInt32 {
+				return jsonNumber{bType: bson.TypeInt64, i64: i64}, nil
+			}
+
+			return jsonNumber{bType: bson.TypeInt32, i64: i64}, nil
+		}
+	}
+
+	f64, err := strconv.ParseFloat(numStr, 64)
+	if err != nil {
+		p.pos = start
+		return jsonNumber{}, p.errorf("invalid number %#q: %v", numStr, err)
+	}
+
+	return jsonNumber{bType: bson.TypeDouble, f64: f64}, nil
+}
+
+func (p *extJSONParser) parseNumber() (bson.Type, error) {
+	num, err := p.readNumber()
+	if err != nil {
+		return 0, err
+	}
+
+	switch num.bType {
+	case bson.TypeInt32:
+		p.out = bsoncore.AppendInt32(p.out, int32(num.i64))
+	case bson.TypeInt64:
+		p.out = bsoncore.AppendInt64(p.out, num.i64)
+	default:
+		p.out = bsoncore.AppendDouble(p.out, num.f64)
+	}
+
+	return num.bType, nil
+}
+
+// extJSONWrapper identifies an Extended JSON type wrapper by its first key.
+type extJSONWrapper int
+
+const (
+	wrapInt32 extJSONWrapper = iota + 1
+	wrapInt64
+	wrapDouble
+	wrapDecimal
+	wrapObjectID
+	wrapSymbol
+	wrapBinary
+	wrapUUID
+	wrapCode
+	wrapScope
+	wrapTimestamp
+	wrapRegex
+	wrapDBPointer
+	wrapDate
+	wrapMinKey
+	wrapMaxKey
+	wrapUndefined
+)
+
+var extJSONWrappers = map[string]extJSONWrapper{
+	"$numberInt":         wrapInt32,
+	"$numberLong":        wrapInt64,
+	"$numberDouble":      wrapDouble,
+	"$numberDecimal":     wrapDecimal,
+	"$oid":               wrapObjectID,
+	"$symbol":            wrapSymbol,
+	"$binary":            wrapBinary,
+	"$uuid":              wrapUUID,
+	"$code":              wrapCode,
+	"$scope":             wrapScope,
+	"$timestamp":         wrapTimestamp,
+	"$regularExpression": wrapRegex,
+	"$dbPointer":         wrapDBPointer,
+	"$date":              wrapDate,
+	"$minKey":            wrapMinKey,
+	"$maxKey":            wrapMaxKey,
+	"$undefined":         wrapUndefined,
+}
+
+// parseWrapper parses a type wrapper’s value after its first key, up to &
+// including the closing brace.
+//
+//nolint:cyclop,funlen
+func (p *extJSONParser) parseWrapper(wrapper extJSONWrapper) (bson.Type, error) {
+	if err := p.consume(':'); err != nil {
+		return 0, err
+	}
+
+	var bType bson.Type
+	var err error
+
+	switch wrapper {
+	case wrapInt32, wrapInt64:
+		bType, err = p.parseIntegerWrapper(wrapper == wrapInt32)
+	case wrapDouble:
+		bType, err = bson.TypeDouble, p.parseDoubleWrapper()
+	case wrapDecimal:
+		var str []byte
+		if str, err = p.readScratchString("$numberDecimal"); err == nil {
+			var dec bson.Decimal128
+			if dec, err = bson.ParseDecimal128(string(str)); err != nil {
+				return 0, p.errorf("invalid $numberDecimal %#q", str)
+			}
+
+			h, l := dec.GetBytes()
+			p.out = bsoncore.AppendDecimal128(p.out, h, l)
+		}
+
+		bType = bson.TypeDecimal128
+	case wrapObjectID:
+		bType, err = bson.TypeObjectID, p.appendObjectID("$oid")
+	case wrapSymbol:
+		bType = bson.TypeSymbol
+		if c, ok := p.peekAfterSpace(); !ok || c != '"' {
+			return 0, p.errorf("$symbol must be a string")
+		}
+
+		err = p.appendBSONString()
+	case wrapBinary:
+		bType, err = bson.TypeBinary, p.parseBinaryWrapper()
+	case wrapUUID:
+		bType, err = bson.TypeBinary, p.parseUUIDWrapper()
+	case wrapCode:
+		// This consumes the closing brace itself.
+		return p.parseCodeWrapper()
+	case wrapScope:
+		return 0, p.errorf("$scope must follow $code")
+	case wrapTimestamp:
+		bType, err = bson.TypeTimestamp, p.parseTimestampWrapper()
+	case wrapRegex:
+		bType, err = bson.TypeRegex, p.parseRegexWrapper()
+	case wrapDBPointer:
+		bType, err = bson.TypeDBPointer, p.parseDBPointerWrapper()
+	case wrapDate:
+		bType, err = bson.TypeDateTime, p.parseDateWrapper()
+	case wrapMinKey, wrapMaxKey:
+		bType = bson.TypeMinKey
+		if wrapper == wrapMaxKey {
+			bType = bson.TypeMaxKey
+		}
+
+		p.skipSpace()
+
+		var num jsonNumber
+		if num, err = p.readNumberIfPresent(); err == nil && (num.bType != bson.TypeInt32 || num.i64 != 1) {
+			return 0, p.errorf("%s value must be 1", bType)
+		}
+	case wrapUndefined:
+		bType = bson.TypeUndefined
+
+		p.skipSpace()
+		err = p.consumeLiteral("true")
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := p.consume('}'); err != nil {
+		return 0, err
+	}
+
+	return bType, nil
+}
+
+func (p *extJSONParser) peekAfterSpace() (byte, bool) {
+	p.skipSpace()
+
+	return p.peek()
+}
+
+func (p *extJSONParser) readNumberIfPresent() (jsonNumber, error) {
+	if c, ok := p.peek(); !ok || (c != '-' && (c < '0' || c > '9')) {
+		return jsonNumber{}, p.errorf("expected a number")
+	}
+
+	return p.readNumber()
+}
+
+func (p *extJSONParser) parseIntegerWrapper(is32 bool) (bson.Type, error) {
+	what, bits, bType := "$numberLong", 64, bson.TypeInt64
+	if is32 {
+		what, bits, bType = "$numberInt", 32, bson.TypeInt32
+	}
+
+	str, err := p.readScratchString(what)
+	if err != nil {
+		return 0, err
+	}
+
+	i64, err := strconv.ParseInt(string(str), 10, bits)
+	if err != nil {
+		return 0, p.errorf("invalid %s %#q", what, str)
+	}
+
+	if is32 {
+		p.out = bsoncore.AppendInt32(p.out, int32(i64))
+	} else {
+		p.out = bsoncore.AppendInt64(p.out, i64)
+	}
+
+	return bType, nil
+}
+
+func (p *extJSONParser) parseDoubleWrapper() error {
+	str, err := p.readScratchString("$numberDouble")
+	if err != nil {
+		return err
+	}
+
+	var f64 float64
+
+	switch string(str) {
+	case "Infinity":
+		f64 = math.Inf(1)
+	case "-Infinity":
+		f64 = math.Inf(-1)
+	case "NaN":
+		f64 = math.NaN()
+	default:
+		f64, err = strconv.ParseFloat(string(str), 64)
+		if err != nil {
+			return p.errorf("invalid $numberDouble %#q", str)
+		}
+	}
+
+	p.out = bsoncore.AppendDouble(p.out, f64)
+
+	return nil
+}
+
+func (p *extJSONParser) appendObjectID(what string) error {
+	str, err := p.readScratchString(what)
+	if err != nil {
+		return err
+	}
+
+	oid, err := bson.ObjectIDFromHex(string(str))
+	if err != nil {
+		return p.errorf("invalid %s %#q", what, str)
+	}
+
+	p.out = bsoncore.AppendObjectID(p.out, oid)
+
+	return nil
+}
+
+// parseObjectFields parses a JSON object whose keys are all in the given
+// list, each at most once. It calls parseField to parse each field’s value.
+func (p *extJSONParser) parseObjectFields(
+	what string,
+	keys []string,
+	parseField func(key string) error,
+) error {
+	if err := p.consume('{'); err != nil {
+		return err
+	}
+
+	seen := make([]bool, len(keys))
+
+	for i := 0; ; i++ {
+		p.skipSpace()
+
+		if i > 0 {
+			if c, ok := p.peek(); ok && c == '}' {
+				break
+			}
+
+			if err := p.consume(','); err != nil {
+				return err
+			}
+
+			p.skipSpace()
+		}
+
+		if c, ok := p.peek(); !ok || c != '"' {
+			return p.errorf("expected a key in %s", what)
+		}
+
+		keyPos := p.pos
+
+		var err error
+		p.scratch, err = p.appendJSONString(p.scratch[:0])
+		if err != nil {
+			return err
+		}
+
+		keyIdx := slices.Index(keys, string(p.scratch))
+
+		switch {
+		case keyIdx == -1:
+			p.pos = keyPos
+			return p.errorf("invalid key %#q in %s", p.scratch, what)
+		case seen[keyIdx]:
+			p.pos = keyPos
+			return p.errorf("duplicate key %#q in %s", p.scratch, what)
+		}
+
+		seen[keyIdx] = true
+
+		if err := p.consume(':'); err != nil {
+			return err
+		}
+
+		if err := parseField(keys[keyIdx]); err != nil {
+			return err
+		}
+	}
+
+	for i, key := range keys {
+		if !seen[i] {
+			return p.errorf("missing %#q in %s", key, what)
+		}
+	}
+
+	p.pos++ // }
+
+	return nil
+}
+
+func (p *extJSONParser) parseBinaryWrapper() error {
+	var data []byte
+	var subtype byte
+
+	parseSubtype := func() error {
+		str, err := p.readScratchString("$binary subtype")
+		if err != nil {
+			return err
+		}
+
+		st, err := strconv.ParseUint(string(str), 16, 8)
+		if err != nil {
+			return p.errorf("invalid $binary subtype %#q", str)
+		}
+
+		subtype = byte(st)
+
+		return nil
+	}
+
+	parseBase64 := func() error {
+		str, err := p.readScratchString("$binary base64")
+		if err != nil {
+			return err
+		}
+
+		data, err = base64.StdEncoding.AppendDecode(nil, str)
+		if err != nil {
+			return p.errorf("invalid $binary base64 %#q", str)
+		}
+
+		return nil
+	}
+
+	if c, ok := p.peekAfterSpace(); ok && c == '"' {
+		// Legacy format: {"$binary": "<base64>", "$type": "<hex>"}
+		if err := parseBase64(); err != nil {
+			return err
+		}
+
+		if err := p.consume(','); err != nil {
+			return err
+		}
+
+		p.skipSpace()
+
+		key, err := p.readScratchString("key")
+		if err != nil {
+			return err
+		}
+
+		if string(key) != "$type" {
+			return p.errorf("expected %#q after legacy $binary", "$type")
+		}
+
+		if err := p.consume(':'); err != nil {
+			return err
+		}
+
+		if err := parseSubtype(); err != nil {
+			return err
+		}
+	} else {
+		err := p.parseObjectFields("$binary", []string{"base64", "subType"}, func(key string) error {
+			if key == "base64" {
+				return parseBase64()
+			}
+
+			return parseSubtype()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	p.out = bsoncore.AppendBinary(p.out, subtype, data)
+
+	return nil
+}
+
+func (p *extJSONParser) parseUUIDWrapper() error {
+	str, err := p.readScratchString("$uuid")
+	if err != nil {
+		return err
+	}
+
+	// RFC 4122 puts hyphens at these positions.
+	if len(str) != 36 || str[8] != '-' || str[13] != '-' || str[18] != '-' || str[23] != '-' {
+		return p.errorf("$uuid %#q is not in RFC 4122 format", str)
+	}
+
+	hexStr := slices.Concat(str[:8], str[9:13], str[14:18], str[19:23], str[24:])
+
+	var uuid [16]byte
+	if _, err := hex.Decode(uuid[:], hexStr); err != nil {
+		return p.errorf("$uuid %#q is not in RFC 4122 format", str)
+	}
+
+	p.out = bsoncore.AppendBinary(p.out, bson.TypeBinaryUUID, uuid[:])
+
+	return nil
+}
+
+// parseCodeWrapper parses JavaScript code, with or without a scope.
+func (p *extJSONParser) parseCodeWrapper() (bson.Type, error) {
+	if c, ok := p.peekAfterSpace(); !ok || c != '"' {
+		return 0, p.errorf("$code must be a string")
+	}
+
+	start := len(p.out)
+
+	// Reserve space for a code-with-scope’s length header.
+	p.out = append(p.out, 0, 0, 0, 0)
+
+	if err := p.appendBSONString(); err != nil {
+		return 0, err
+	}
+
+	if c, ok := p.peekAfterSpace(); ok && c == '}' {
+		p.pos++
+
+		// No scope, so remove the length header.
+		p.out = append(p.out[:start], p.out[start+4:]...)
+
+		return bson.TypeJavaScript, nil
+	}
+
+	if err := p.consume(','); err != nil {
+		return 0, err
+	}
+
+	p.skipSpace()
+
+	key, err := p.readScratchString("key")
+	if err != nil {
+		return 0, err
+	}
+
+	if string(key) != "$scope" {
+		return 0, p.errorf("unexpected key %#q after $code", key)
+	}
+
+	if err := p.consume(':'); err != nil {
+		return 0, err
+	}
+
+	if c, ok := p.peekAfterSpace(); !ok || c != '{' {
+		return 0, p.errorf("$scope must be an object")
+	}
+
+	if _, err := p.parseObject(true); err != nil {
+		return 0, err
+	}
+
+	if err := p.patchLength(start); err != nil {
+		return 0, err
+	}
+
+	if err := p.consume('}'); err != nil {
+		return 0, err
+	}
+
+	return bson.TypeCodeWithScope, nil
+}
+
+func (p *extJSONParser) parseTimestampWrapper() error {
+	var t, i uint32
+
+	err := p.parseObjectFields("$timestamp", []string{"t", "i"}, func(key string) error {
+		p.skipSpace()
+
+		num, err := p.readNumberIfPresent()
+		if err != nil {
+			return err
+		}
+
+		if num.bType == bson.TypeDouble || num.i64 < 0 || num.i64 > math.MaxUint32 {
+			return p.errorf("$timestamp %#q must be a uint32", key)
+		}
+
+		if key == "t" {
+			t = uint32(num.i64)
+		} else {
+			i = uint32(num.i64)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	p.out = bsoncore.AppendTimestamp(p.out, t, i)
+
+	return nil
+}
+
+func (p *extJSONParser) parseRegexWrapper() error {
+	var pattern, opts string
+
+	err := p.parseObjectFields("$regularExpression", []string{"pattern", "options"}, func(key string) error {
+		str, err := p.readScratchString("$regularExpression " + key)
+		if err != nil {
+			return err
+		}
+
+		if bytes.IndexByte(str, 0) != -1 {
+			return p.errorf("$regularExpression %s cannot contain NUL", key)
+		}
+
+		if key == "pattern" {
+			pattern = string(str)
+		} else {
+			// To match the driver:
+			optRunes := []rune(string(str))
+			slices.Sort(optRunes)
+			opts = string(optRunes)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	p.out = bsoncore.AppendRegex(p.out, pattern, opts)
+
+	return nil
+}
+
+func (p *extJSONParser) parseDBPointerWrapper() error {
+	var ns string
+	var oid bson.ObjectID
+
+	err := p.parseObjectFields("$dbPointer", []string{"$ref", "$id"}, func(key string) error {
+		if key == "$ref" {
+			str, err := p.readScratchString("$dbPointer $ref")
+			ns = string(str)
+
+			return err
+		}
+
+		return p.parseObjectFields("$dbPointer $id", []string{"$oid"}, func(string) error {
+			start := len(p.out)
+			if err := p.appendObjectID("$dbPointer $id"); err != nil {
+				return err
+			}
+
+			oid = bson.ObjectID(p.out[start:])
+			p.out = p.out[:start]
+
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	p.out = bsoncore.AppendDBPointer(p.out, ns, oid)
+
+	return nil
+}
+
+// extJSONTimeFormats are the formats that the driver accepts for datetimes.
+var extJSONTimeFormats = []string{extJSONTimeFormat, "2006-01-02T15:04:05.999Z0700"}
+
+func (p *extJSONParser) parseDateWrapper() error {
+	c, ok := p.peekAfterSpace()
+
+	switch {
+	case ok && c == '{':
+		return p.parseObjectFields("$date", []string{"$numberLong"}, func(string) error {
+			_, err := p.parseIntegerWrapper(false)
+			return err
+		})
+	case ok && c == '"':
+		str, err := p.readScratchString("$date")
+		if err != nil {
+			return err
+		}
+
+		for _, format := range extJSONTimeFormats {
+			if t, err := time.Parse(format, string(str)); err == nil {
+				p.out = bsoncore.AppendDateTime(p.out, int64(bson.NewDateTimeFromTime(t)))
+				return nil
+			}
+		}
+
+		return p.errorf("invalid $date %#q", str)
+	}
+
+	// Legacy format: a plain number
+	num, err := p.readNumberIfPresent()
+	if err != nil {
+		return p.errorf("$date must be an object, string, or integer")
+	}
+
+	if num.bType == bson.TypeDouble {
+		return p.errorf("$date must be an integer")
+	}
+
+	p.out = bsoncore.AppendDateTime(p.out, num.i64)
+
+	return nil
+}
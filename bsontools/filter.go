@@ -0,0 +1,682 @@
+package bsontools
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mongodb-labs/migration-tools/option"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// FilterError indicates that a query filter is invalid or uses unsupported
+// features.
+type FilterError struct {
+	// Path is the dotted path of the offending filter clause, or empty if
+	// the problem is at the top level.
+	Path string
+
+	// Reason describes what is wrong.
+	Reason string
+}
+
+func (fe FilterError) Error() string {
+	return fmt.Sprintf("invalid filter at %#q: %s", fe.Path, fe.Reason)
+}
+
+// Filter is a compiled MongoDB query filter (e.g., a find command’s
+// `filter` or an index’s `partialFilterExpression`). It evaluates documents
+// client-side with the server’s semantics, including:
+//   - Dotted paths traverse arrays of documents, and numeric path segments
+//     also index into arrays.
+//   - Most operators match an array if they match either the array itself or
+//     any of its elements.
+//   - Comparisons only match values of the same canonical type (“type
+//     bracketing”), except that MinKey & MaxKey compare with all types.
+//   - Equality with null also matches missing fields.
+//
+// The supported operators are `$eq`, `$ne`, `$gt`, `$gte`, `$lt`, `$lte`,
+// `$in`, `$nin`, `$exists`, `$type`, `$and`, `$or`, `$nor`, `$not`,
+// `$regex` (with `$options`), `$elemMatch`, `$size`, and `$all`.
+//
+// Strings compare bytewise, as with the simple collation. Regular
+// expressions use Go’s RE2 syntax, which lacks some PCRE features (e.g.,
+// backreferences); such patterns fail to compile.
+//
+// A Filter is safe for concurrent use.
+type Filter struct {
+	root filterExpr
+}
+
+// CompileFilter parses a query filter. A failure to parse the filter is
+// returned as FilterError.
+//
+// Example usage:
+//
+//	filter, err := bsontools.CompileFilter(partialFilterExpression)
+//	...
+//	matches, err := filter.Matches(doc)
+func CompileFilter[D ~[]byte](filter D) (*Filter, error) {
+	root, err := compileFilterDocument(bson.Raw(filter), "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{root: root}, nil
+}
+
+// Matches indicates whether the given document matches the filter. An error
+// is returned if the document is malformed.
+func (f *Filter) Matches(doc bson.Raw) (bool, error) {
+	return f.root.matchesDoc(doc)
+}
+
+func compileFilterDocument(filter bson.Raw, path string) (filterExpr, error) {
+	var clauses andFilter
+
+	for el, err := range RawElements(filter) {
+		if err != nil {
+			return nil, fmt.Errorf("parsing filter at %#q: %w", path, err)
+		}
+
+		key := el.Key()
+		val := el.Value()
+
+		var clause filterExpr
+
+		switch key {
+		case "$and", "$or", "$nor":
+			clause, err = compileLogicalFilter(key, val)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return nil, FilterError{
+					Path:   path,
+					Reason: fmt.Sprintf("unsupported operator %#q", key),
+				}
+			}
+
+			clause, err = compileFieldClause(key, val)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		clauses = append(clauses, clause)
+	}
+
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+
+	return clauses, nil
+}
+
+func compileLogicalFilter(op string, val bson.RawValue) (filterExpr, error) {
+	arr, ok := val.ArrayOK()
+	if !ok {
+		return nil, FilterError{Reason: fmt.Sprintf("%s argument must be an array", op)}
+	}
+
+	values, err := arr.Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", op, err)
+	}
+
+	if len(values) == 0 {
+		return nil, FilterError{Reason: fmt.Sprintf("%s argument must be a nonempty array", op)}
+	}
+
+	exprs := make([]filterExpr, 0, len(values))
+
+	for _, subVal := range values {
+		subDoc, ok := subVal.DocumentOK()
+		if !ok {
+			return nil, FilterError{Reason: fmt.Sprintf("%s array elements must be documents", op)}
+		}
+
+		expr, err := compileFilterDocument(subDoc, "")
+		if err != nil {
+			return nil, err
+		}
+
+		exprs = append(exprs, expr)
+	}
+
+	switch op {
+	case "$and":
+		return andFilter(exprs), nil
+	case "$or":
+		return orFilter(exprs), nil
+	}
+
+	return norFilter(exprs), nil
+}
+
+func compileFieldClause(path string, val bson.RawValue) (filterExpr, error) {
+	segments := strings.Split(path, ".")
+	if slices.Contains(segments, "") {
+		return nil, FilterError{Path: path, Reason: "empty field name"}
+	}
+
+	var matcher fieldMatcher
+	var err error
+
+	switch {
+	case val.Type == bson.TypeRegex:
+		matcher, err = compileRegexLiteral(val, path, true)
+	case isOperatorDocument(val):
+		matcher, err = compileOperators(val.Document(), path, true)
+	default:
+		matcher = predicateMatcher{&comparePredicate{op: compareEQ, operand: val, expand: true}}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fieldFilter{path: segments, matcher: matcher}, nil
+}
+
+// isOperatorDocument indicates whether a filter value is a document of
+// operators (e.g., `{$gt: 5}`) rather than a literal document. As with the
+// server, only the first field name matters, and DBRef fields are literal.
+func isOperatorDocument(val bson.RawValue) bool {
+	doc, ok := val.DocumentOK()
+	if !ok {
+		return false
+	}
+
+	first, err := doc.IndexErr(0)
+	if err != nil {
+		return false
+	}
+
+	switch key := first.Key(); key {
+	case "$ref", "$id", "$db":
+		return false
+	default:
+		return strings.HasPrefix(key, "$")
+	}
+}
+
+// compileOperators compiles a document of operators that apply to the same
+// path. If expand is false (i.e., within $elemMatch), predicates don’t
+// examine arrays’ elements.
+func compileOperators(ops bson.Raw, path string, expand bool) (fieldMatcher, error) {
+	var matchers andMatcher
+
+	var regex, regexOptions option.Option[bson.RawValue]
+
+	for el, err := range RawElements(ops) {
+		if err != nil {
+			return nil, fmt.Errorf("parsing filter at %#q: %w", path, err)
+		}
+
+		switch el.Key() {
+		case "$regex":
+			regex = option.Some(el.Value())
+		case "$options":
+			regexOptions = option.Some(el.Value())
+		default:
+			matcher, opErr := compileOperator(el.Key(), el.Value(), path, expand)
+			if opErr != nil {
+				return nil, opErr
+			}
+
+			matchers = append(matchers, matcher)
+		}
+	}
+
+	if regex.IsSome() || regexOptions.IsSome() {
+		matcher, err := compileRegexOperator(regex, regexOptions, path, expand)
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, matcher)
+	}
+
+	if len(matchers) == 1 {
+		return matchers[0], nil
+	}
+
+	return matchers, nil
+}
+
+//nolint:cyclop
+func compileOperator(op string, arg bson.RawValue, path string, expand bool) (fieldMatcher, error) {
+	switch op {
+	case "$eq", "$gt", "$gte", "$lt", "$lte":
+		return predicateMatcher{&comparePredicate{
+			op:      compareOps[op],
+			operand: arg,
+			expand:  expand,
+		}}, nil
+	case "$ne":
+		if arg.Type == bson.TypeRegex {
+			return nil, FilterError{Path: path, Reason: "$ne argument cannot be a regex"}
+		}
+
+		return notMatcher{predicateMatcher{&comparePredicate{
+			op:      compareEQ,
+			operand: arg,
+			expand:  expand,
+		}}}, nil
+	case "$in", "$nin":
+		pred, err := compileInPredicate(op, arg, path, expand)
+		if err != nil {
+			return nil, err
+		}
+
+		if op == "$nin" {
+			return notMatcher{predicateMatcher{pred}}, nil
+		}
+
+		return predicateMatcher{pred}, nil
+	case "$exists":
+		if !isTruthyFilterArg(arg) {
+			return notMatcher{predicateMatcher{existsPredicate{}}}, nil
+		}
+
+		return predicateMatcher{existsPredicate{}}, nil
+	case "$type":
+		pred, err := compileTypePredicate(arg, path, expand)
+		if err != nil {
+			return nil, err
+		}
+
+		return predicateMatcher{pred}, nil
+	case "$size":
+		pred, err := compileSizePredicate(arg, path)
+		if err != nil {
+			return nil, err
+		}
+
+		return predicateMatcher{pred}, nil
+	case "$all":
+		return compileAll(arg, path, expand)
+	case "$elemMatch":
+		pred, err := compileElemMatch(arg, path)
+		if err != nil {
+			return nil, err
+		}
+
+		return predicateMatcher{pred}, nil
+	case "$not":
+		return compileNot(arg, path, expand)
+	}
+
+	return nil, FilterError{
+		Path:   path,
+		Reason: fmt.Sprintf("unsupported operator %#q", op),
+	}
+}
+
+var compareOps = map[string]compareOp{
+	"$eq":  compareEQ,
+	"$gt":  compareGT,
+	"$gte": compareGTE,
+	"$lt":  compareLT,
+	"$lte": compareLTE,
+}
+
+func isTruthyFilterArg(arg bson.RawValue) bool {
+	switch arg.Type {
+	case bson.TypeBoolean:
+		return arg.Boolean()
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble, bson.TypeDecimal128:
+		num, err := toNumericValue(arg)
+		if err != nil {
+			return true
+		}
+
+		return num.isNaN || num.infSign != 0 || num.rat.Sign() != 0
+	case bson.TypeNull, bson.TypeUndefined:
+		return false
+	}
+
+	return true
+}
+
+func compileInPredicate(op string, arg bson.RawValue, path string, expand bool) (*inPredicate, error) {
+	arr, ok := arg.ArrayOK()
+	if !ok {
+		return nil, FilterError{Path: path, Reason: fmt.Sprintf("%s argument must be an array", op)}
+	}
+
+	values, err := arr.Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s at %#q: %w", op, path, err)
+	}
+
+	pred := &inPredicate{}
+
+	for _, val := range values {
+		if val.Type == bson.TypeRegex {
+			regexPred, regexErr := newRegexPredicate(val, path, expand)
+			if regexErr != nil {
+				return nil, regexErr
+			}
+
+			pred.regexes = append(pred.regexes, regexPred)
+
+			continue
+		}
+
+		if isOperatorDocument(val) {
+			return nil, FilterError{
+				Path:   path,
+				Reason: fmt.Sprintf("%s array cannot contain operators", op),
+			}
+		}
+
+		pred.equals = append(pred.equals, &comparePredicate{
+			op:      compareEQ,
+			operand: val,
+			expand:  expand,
+		})
+	}
+
+	return pred, nil
+}
+
+// typeAliases maps $type’s string aliases to BSON types.
+var typeAliases = map[string]bson.Type{
+	"double":              bson.TypeDouble,
+	"string":              bson.TypeString,
+	"object":              bson.TypeEmbeddedDocument,
+	"array":               bson.TypeArray,
+	"binData":             bson.TypeBinary,
+	"undefined":           bson.TypeUndefined,
+	"objectId":            bson.TypeObjectID,
+	"bool":                bson.TypeBoolean,
+	"date":                bson.TypeDateTime,
+	"null":                bson.TypeNull,
+	"regex":               bson.TypeRegex,
+	"dbPointer":           bson.TypeDBPointer,
+	"javascript":          bson.TypeJavaScript,
+	"symbol":              bson.TypeSymbol,
+	"javascriptWithScope": bson.TypeCodeWithScope,
+	"int":                 bson.TypeInt32,
+	"timestamp":           bson.TypeTimestamp,
+	"long":                bson.TypeInt64,
+	"decimal":             bson.TypeDecimal128,
+	"minKey":              bson.TypeMinKey,
+	"maxKey":              bson.TypeMaxKey,
+}
+
+var numberTypes = []bson.Type{
+	bson.TypeDouble,
+	bson.TypeInt32,
+	bson.TypeInt64,
+	bson.TypeDecimal128,
+}
+
+func compileTypePredicate(arg bson.RawValue, path string, expand bool) (*typePredicate, error) {
+	args := []bson.RawValue{arg}
+
+	if arr, ok := arg.ArrayOK(); ok {
+		var err error
+
+		args, err = arr.Values()
+		if err != nil {
+			return nil, fmt.Errorf("parsing $type at %#q: %w", path, err)
+		}
+
+		if len(args) == 0 {
+			return nil, FilterError{Path: path, Reason: "$type array must not be empty"}
+		}
+	}
+
+	pred := &typePredicate{expand: expand}
+
+	for _, typeArg := range args {
+		if alias, ok := typeArg.StringValueOK(); ok {
+			if alias == "number" {
+				pred.types = append(pred.types, numberTypes...)
+
+				continue
+			}
+
+			bType, known := typeAliases[alias]
+			if !known {
+				return nil, FilterError{Path: path, Reason: fmt.Sprintf("unknown $type alias %#q", alias)}
+			}
+
+			pred.types = append(pred.types, bType)
+
+			continue
+		}
+
+		code, ok := wholeNumberFilterArg(typeArg)
+		if !ok {
+			return nil, FilterError{Path: path, Reason: "$type argument must be a string or number"}
+		}
+
+		bType := bson.Type(code)
+		if _, known := canonicalTypeOrder[bType]; !known || code != int64(int8(code)) {
+			return nil, FilterError{Path: path, Reason: fmt.Sprintf("unknown $type code %d", code)}
+		}
+
+		pred.types = append(pred.types, bType)
+	}
+
+	return pred, nil
+}
+
+// wholeNumberFilterArg converts a numeric filter argument to int64 if it is
+// a whole number.
+func wholeNumberFilterArg(arg bson.RawValue) (int64, bool) {
+	switch arg.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		return arg.AsInt64OK()
+	case bson.TypeDouble:
+		f := arg.Double()
+		if f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+			return 0, false
+		}
+
+		return int64(f), true
+	case bson.TypeDecimal128:
+		num, err := toNumericValue(arg)
+		if err != nil || num.rat == nil || !num.rat.IsInt() || !num.rat.Num().IsInt64() {
+			return 0, false
+		}
+
+		return num.rat.Num().Int64(), true
+	}
+
+	return 0, false
+}
+
+func compileSizePredicate(arg bson.RawValue, path string) (sizePredicate, error) {
+	size, ok := wholeNumberFilterArg(arg)
+	switch {
+	case !ok:
+		return 0, FilterError{Path: path, Reason: "$size argument must be a whole number"}
+	case size < 0:
+		return 0, FilterError{Path: path, Reason: "$size argument must not be negative"}
+	}
+
+	return sizePredicate(size), nil
+}
+
+func compileAll(arg bson.RawValue, path string, expand bool) (fieldMatcher, error) {
+	arr, ok := arg.ArrayOK()
+	if !ok {
+		return nil, FilterError{Path: path, Reason: "$all argument must be an array"}
+	}
+
+	values, err := arr.Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing $all at %#q: %w", path, err)
+	}
+
+	if len(values) == 0 {
+		return nothingMatcher{}, nil
+	}
+
+	matchers := make(andMatcher, 0, len(values))
+
+	for _, val := range values {
+		var pred valuePredicate
+
+		switch {
+		case val.Type == bson.TypeRegex:
+			pred, err = newRegexPredicate(val, path, expand)
+		case isOperatorDocument(val):
+			first := val.Document().Index(0)
+			if first.Key() != "$elemMatch" {
+				return nil, FilterError{Path: path, Reason: "$all can only contain $elemMatch operators"}
+			}
+
+			pred, err = compileElemMatch(first.Value(), path)
+		default:
+			pred = &comparePredicate{op: compareEQ, operand: val, expand: expand}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, predicateMatcher{pred})
+	}
+
+	return matchers, nil
+}
+
+func compileElemMatch(arg bson.RawValue, path string) (*elemMatchPredicate, error) {
+	doc, ok := arg.DocumentOK()
+	if !ok {
+		return nil, FilterError{Path: path, Reason: "$elemMatch argument must be a document"}
+	}
+
+	if isOperatorDocument(arg) {
+		switch doc.Index(0).Key() {
+		case "$and", "$or", "$nor":
+		default:
+			matcher, err := compileOperators(doc, path, false)
+			if err != nil {
+				return nil, err
+			}
+
+			return &elemMatchPredicate{valueMatcher: matcher}, nil
+		}
+	}
+
+	expr, err := compileFilterDocument(doc, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &elemMatchPredicate{docFilter: expr}, nil
+}
+
+func compileNot(arg bson.RawValue, path string, expand bool) (fieldMatcher, error) {
+	switch {
+	case arg.Type == bson.TypeRegex:
+		inner, err := compileRegexLiteral(arg, path, expand)
+		if err != nil {
+			return nil, err
+		}
+
+		return notMatcher{inner}, nil
+	case isOperatorDocument(arg):
+		inner, err := compileOperators(arg.Document(), path, expand)
+		if err != nil {
+			return nil, err
+		}
+
+		return notMatcher{inner}, nil
+	}
+
+	return nil, FilterError{Path: path, Reason: "$not argument must be a regex or a document of operators"}
+}
+
+func compileRegexLiteral(val bson.RawValue, path string, expand bool) (fieldMatcher, error) {
+	pred, err := newRegexPredicate(val, path, expand)
+	if err != nil {
+		return nil, err
+	}
+
+	return predicateMatcher{pred}, nil
+}
+
+func compileRegexOperator(
+	regex, regexOptions option.Option[bson.RawValue],
+	path string,
+	expand bool,
+) (fieldMatcher, error) {
+	regexVal, hasRegex := regex.Get()
+	if !hasRegex {
+		return nil, FilterError{Path: path, Reason: "$options requires $regex"}
+	}
+
+	var pattern, options string
+
+	switch regexVal.Type {
+	case bson.TypeString:
+		pattern = regexVal.StringValue()
+	case bson.TypeRegex:
+		pattern, options = regexVal.Regex()
+	default:
+		return nil, FilterError{Path: path, Reason: "$regex argument must be a string or regex"}
+	}
+
+	if optionsVal, hasOptions := regexOptions.Get(); hasOptions {
+		if options != "" {
+			return nil, FilterError{Path: path, Reason: "options given in both $regex and $options"}
+		}
+
+		var ok bool
+
+		options, ok = optionsVal.StringValueOK()
+		if !ok {
+			return nil, FilterError{Path: path, Reason: "$options argument must be a string"}
+		}
+	}
+
+	return compileRegexLiteral(
+		bson.RawValue{Type: bson.TypeRegex, Value: bsoncore.AppendRegex(nil, pattern, options)},
+		path,
+		expand,
+	)
+}
+
+func newRegexPredicate(val bson.RawValue, path string, expand bool) (*regexPredicate, error) {
+	pattern, options := val.Regex()
+
+	var flags string
+
+	for _, opt := range options {
+		switch opt {
+		case 'i', 'm', 's':
+			flags += string(opt)
+		case 'u':
+			// PCRE’s UTF-8 mode, which Go always uses.
+		default:
+			return nil, FilterError{Path: path, Reason: fmt.Sprintf("unsupported regex option %#q", opt)}
+		}
+	}
+
+	goPattern := pattern
+	if flags != "" {
+		goPattern = "(?" + flags + ")" + pattern
+	}
+
+	re, err := regexp.Compile(goPattern)
+	if err != nil {
+		return nil, FilterError{Path: path, Reason: fmt.Sprintf("unsupported regex: %v", err)}
+	}
+
+	return &regexPredicate{
+		re:      re,
+		pattern: pattern,
+		options: options,
+		expand:  expand,
+	}, nil
+}
@@ -0,0 +1,482 @@
+package bsontools
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// filterExpr tests whole documents.
+type filterExpr interface {
+	matchesDoc(doc bson.Raw) (bool, error)
+}
+
+type andFilter []filterExpr
+
+func (af andFilter) matchesDoc(doc bson.Raw) (bool, error) {
+	for _, expr := range af {
+		matched, err := expr.matchesDoc(doc)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+type orFilter []filterExpr
+
+func (of orFilter) matchesDoc(doc bson.Raw) (bool, error) {
+	for _, expr := range of {
+		matched, err := expr.matchesDoc(doc)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+
+	return false, nil
+}
+
+type norFilter []filterExpr
+
+func (nf norFilter) matchesDoc(doc bson.Raw) (bool, error) {
+	matched, err := orFilter(nf).matchesDoc(doc)
+
+	return !matched && err == nil, err
+}
+
+// fieldFilter tests the values at a path.
+type fieldFilter struct {
+	path    []string
+	matcher fieldMatcher
+}
+
+func (ff fieldFilter) matchesDoc(doc bson.Raw) (bool, error) {
+	values, err := appendPathValues(
+		nil,
+		bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: doc},
+		ff.path,
+	)
+	if err != nil {
+		return false, fmt.Errorf("reading %#q: %w", ff.path, err)
+	}
+
+	return ff.matcher.matchesValues(values)
+}
+
+// appendPathValues appends the values that a path reaches from the given
+// value. A zero RawValue indicates a place where the path is missing.
+//
+// As with the server, a path segment that follows an array applies to each
+// of the array’s documents. If the segment is an array index, it also
+// selects the array element at that index.
+func appendPathValues(
+	values []bson.RawValue,
+	cur bson.RawValue,
+	path []string,
+) ([]bson.RawValue, error) {
+	if len(path) == 0 {
+		return append(values, cur), nil
+	}
+
+	switch cur.Type {
+	case bson.TypeEmbeddedDocument:
+		child, err := bson.Raw(cur.Value).LookupErr(path[0])
+		if errors.Is(err, bsoncore.ErrElementNotFound) {
+			return append(values, bson.RawValue{}), nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return appendPathValues(values, child, path[1:])
+	case bson.TypeArray:
+		return appendArrayPathValues(values, bson.RawArray(cur.Value), path)
+	}
+
+	return append(values, bson.RawValue{}), nil
+}
+
+func appendArrayPathValues(
+	values []bson.RawValue,
+	arr bson.RawArray,
+	path []string,
+) ([]bson.RawValue, error) {
+	startLen := len(values)
+
+	index, err := parseArrayIndex(path[0])
+	isIndex := err == nil
+
+	elements, err := arr.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	if isIndex && index < len(elements) {
+		values, err = appendPathValues(values, elements[index], path[1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, el := range elements {
+		if el.Type != bson.TypeEmbeddedDocument {
+			continue
+		}
+
+		child, lookupErr := el.Document().LookupErr(path[0])
+
+		switch {
+		case errors.Is(lookupErr, bsoncore.ErrElementNotFound):
+			if !isIndex {
+				values = append(values, bson.RawValue{})
+			}
+		case lookupErr != nil:
+			return nil, lookupErr
+		default:
+			values, err = appendPathValues(values, child, path[1:])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(values) == startLen {
+		values = append(values, bson.RawValue{})
+	}
+
+	return values, nil
+}
+
+// fieldMatcher tests the values that a path reaches. A zero RawValue
+// indicates a place where the path is missing.
+type fieldMatcher interface {
+	matchesValues(values []bson.RawValue) (bool, error)
+}
+
+// predicateMatcher matches if any of the values satisfies its predicate.
+type predicateMatcher struct {
+	pred valuePredicate
+}
+
+func (pm predicateMatcher) matchesValues(values []bson.RawValue) (bool, error) {
+	for _, val := range values {
+		var matched bool
+		var err error
+
+		if val.Type == 0 {
+			matched = pm.pred.matchesMissing()
+		} else {
+			matched, err = pm.pred.matchesValue(val)
+		}
+
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+
+	return false, nil
+}
+
+type notMatcher struct {
+	inner fieldMatcher
+}
+
+func (nm notMatcher) matchesValues(values []bson.RawValue) (bool, error) {
+	matched, err := nm.inner.matchesValues(values)
+
+	return !matched && err == nil, err
+}
+
+type andMatcher []fieldMatcher
+
+func (am andMatcher) matchesValues(values []bson.RawValue) (bool, error) {
+	for _, matcher := range am {
+		matched, err := matcher.matchesValues(values)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// nothingMatcher never matches, e.g., for `{$all: []}`.
+type nothingMatcher struct{}
+
+func (nothingMatcher) matchesValues([]bson.RawValue) (bool, error) {
+	return false, nil
+}
+
+// valuePredicate tests a single value at a path.
+type valuePredicate interface {
+	matchesValue(val bson.RawValue) (bool, error)
+	matchesMissing() bool
+}
+
+// matchesValueOrElements applies a test to a value and, if it is an array
+// and expand is set, to its elements.
+func matchesValueOrElements(
+	val bson.RawValue,
+	expand bool,
+	test func(bson.RawValue) (bool, error),
+) (bool, error) {
+	matched, err := test(val)
+	if err != nil || matched || !expand || val.Type != bson.TypeArray {
+		return matched, err
+	}
+
+	elements, err := bson.RawArray(val.Value).Values()
+	if err != nil {
+		return false, err
+	}
+
+	for _, el := range elements {
+		matched, err = test(el)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+
+	return false, nil
+}
+
+type compareOp int
+
+const (
+	compareEQ compareOp = iota
+	compareGT
+	compareGTE
+	compareLT
+	compareLTE
+)
+
+type comparePredicate struct {
+	op      compareOp
+	operand bson.RawValue
+	expand  bool
+}
+
+func (cp *comparePredicate) matchesValue(val bson.RawValue) (bool, error) {
+	return matchesValueOrElements(val, cp.expand, cp.matchesSingle)
+}
+
+func (cp *comparePredicate) matchesMissing() bool {
+	return cp.operand.Type == bson.TypeNull && cp.op != compareGT && cp.op != compareLT
+}
+
+func (cp *comparePredicate) matchesSingle(val bson.RawValue) (bool, error) {
+	var result int
+
+	switch {
+	case canonicalTypeOrder[val.Type] != canonicalTypeOrder[cp.operand.Type]:
+		// Type bracketing: only MinKey & MaxKey compare across types.
+		switch cp.operand.Type {
+		case bson.TypeMinKey:
+			result = 1
+		case bson.TypeMaxKey:
+			result = -1
+		default:
+			return false, nil
+		}
+	case isNaNValue(val) || isNaNValue(cp.operand):
+		// NaN only equals NaN; it is neither less nor greater than anything.
+		if !isNaNValue(val) || !isNaNValue(cp.operand) {
+			return false, nil
+		}
+	default:
+		var err error
+
+		result, err = CompareValues(val, cp.operand)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	switch cp.op {
+	case compareEQ:
+		return result == 0, nil
+	case compareGT:
+		return result > 0, nil
+	case compareGTE:
+		return result >= 0, nil
+	case compareLT:
+		return result < 0, nil
+	case compareLTE:
+		return result <= 0, nil
+	}
+
+	panic(fmt.Sprintf("unknown comparison %d", cp.op))
+}
+
+func isNaNValue(val bson.RawValue) bool {
+	switch val.Type {
+	case bson.TypeDouble:
+		f, ok := val.DoubleOK()
+
+		return ok && math.IsNaN(f)
+	case bson.TypeDecimal128:
+		dec, ok := val.Decimal128OK()
+
+		return ok && dec.IsNaN()
+	}
+
+	return false
+}
+
+// inPredicate implements $in.
+type inPredicate struct {
+	equals  []*comparePredicate
+	regexes []*regexPredicate
+}
+
+func (ip *inPredicate) matchesValue(val bson.RawValue) (bool, error) {
+	for _, pred := range ip.equals {
+		matched, err := pred.matchesValue(val)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+
+	for _, pred := range ip.regexes {
+		matched, err := pred.matchesValue(val)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+
+	return false, nil
+}
+
+func (ip *inPredicate) matchesMissing() bool {
+	return slices.ContainsFunc(ip.equals, (*comparePredicate).matchesMissing)
+}
+
+// existsPredicate implements `$exists: true`.
+type existsPredicate struct{}
+
+func (existsPredicate) matchesValue(bson.RawValue) (bool, error) {
+	return true, nil
+}
+
+func (existsPredicate) matchesMissing() bool {
+	return false
+}
+
+type typePredicate struct {
+	types  []bson.Type
+	expand bool
+}
+
+func (tp *typePredicate) matchesValue(val bson.RawValue) (bool, error) {
+	return matchesValueOrElements(val, tp.expand, func(v bson.RawValue) (bool, error) {
+		return slices.Contains(tp.types, v.Type), nil
+	})
+}
+
+func (tp *typePredicate) matchesMissing() bool {
+	return false
+}
+
+// sizePredicate implements $size, which only matches arrays.
+type sizePredicate int
+
+func (sp sizePredicate) matchesValue(val bson.RawValue) (bool, error) {
+	if val.Type != bson.TypeArray {
+		return false, nil
+	}
+
+	count, err := CountRawElements(val.Value)
+	if err != nil {
+		return false, err
+	}
+
+	return count == int(sp), nil
+}
+
+func (sp sizePredicate) matchesMissing() bool {
+	return false
+}
+
+// elemMatchPredicate implements $elemMatch, which only matches arrays. If
+// docFilter is set, an array element must be a document or array that
+// matches it; otherwise the element itself must satisfy valueMatcher.
+type elemMatchPredicate struct {
+	docFilter    filterExpr
+	valueMatcher fieldMatcher
+}
+
+func (ep *elemMatchPredicate) matchesValue(val bson.RawValue) (bool, error) {
+	if val.Type != bson.TypeArray {
+		return false, nil
+	}
+
+	elements, err := bson.RawArray(val.Value).Values()
+	if err != nil {
+		return false, err
+	}
+
+	for _, el := range elements {
+		var matched bool
+
+		switch {
+		case ep.valueMatcher != nil:
+			matched, err = ep.valueMatcher.matchesValues([]bson.RawValue{el})
+		case el.Type == bson.TypeEmbeddedDocument || el.Type == bson.TypeArray:
+			matched, err = ep.docFilter.matchesDoc(el.Value)
+		}
+
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+
+	return false, nil
+}
+
+func (ep *elemMatchPredicate) matchesMissing() bool {
+	return false
+}
+
+// regexPredicate matches strings & symbols against a regular expression. It
+// also matches BSON regexes that are identical to its own.
+type regexPredicate struct {
+	re               *regexp.Regexp
+	pattern, options string
+	expand           bool
+}
+
+func (rp *regexPredicate) matchesValue(val bson.RawValue) (bool, error) {
+	return matchesValueOrElements(val, rp.expand, rp.matchesSingle)
+}
+
+func (rp *regexPredicate) matchesSingle(val bson.RawValue) (bool, error) {
+	switch val.Type {
+	case bson.TypeString, bson.TypeSymbol:
+		str, err := readStringBytes(val.Value)
+		if err != nil {
+			return false, fmt.Errorf("parsing BSON %s: %w", val.Type, err)
+		}
+
+		return rp.re.Match(str), nil
+	case bson.TypeRegex:
+		pattern, options, ok := val.RegexOK()
+		if !ok {
+			return false, fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		return pattern == rp.pattern && options == rp.options, nil
+	}
+
+	return false, nil
+}
+
+func (rp *regexPredicate) matchesMissing() bool {
+	return false
+}
@@ -0,0 +1,351 @@
+package bsontools
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestFilter(t *testing.T) {
+	docs := map[string]bson.D{
+		"empty":     {},
+		"int":       {{"a", int32(5)}},
+		"double":    {{"a", 5.0}},
+		"string":    {{"a", "5"}},
+		"null":      {{"a", nil}},
+		"nan":       {{"a", math.NaN()}},
+		"array":     {{"a", bson.A{int32(1), int32(5), int32(9)}}},
+		"nested":    {{"a", bson.A{bson.A{int32(5)}}}},
+		"subdocs":   {{"a", bson.A{bson.D{{"b", int32(1)}}, bson.D{{"b", int32(2)}, {"c", "x"}}}}},
+		"partial":   {{"a", bson.A{bson.D{{"b", int32(1)}}, bson.D{{"c", "x"}}}}},
+		"subdoc":    {{"a", bson.D{{"b", int32(2)}}}},
+		"text":      {{"a", "Hello\nWorld"}},
+		"texts":     {{"a", bson.A{"foo", "BAR"}}},
+		"regex":     {{"a", bson.Regex{Pattern: "^f", Options: "i"}}},
+		"emptyArr":  {{"a", bson.A{}}},
+		"twoFields": {{"a", int32(5)}, {"b", "x"}},
+	}
+
+	cases := []struct {
+		filter  bson.D
+		matches []string
+	}{
+		{
+			filter: bson.D{},
+			matches: []string{
+				"empty", "int", "double", "string", "null", "nan", "array", "nested",
+				"subdocs", "partial", "subdoc", "text", "texts", "regex", "emptyArr", "twoFields",
+			},
+		},
+		{
+			filter:  bson.D{{"a", int32(5)}},
+			matches: []string{"int", "double", "array", "twoFields"},
+		},
+		{
+			filter:  bson.D{{"a", bson.A{int32(5)}}},
+			matches: []string{"nested"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$eq", "5"}}}},
+			matches: []string{"string"},
+		},
+		{
+			filter:  bson.D{{"a", nil}},
+			matches: []string{"empty", "null"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$gte", nil}}}},
+			matches: []string{"empty", "null"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$gt", nil}}}},
+			matches: nil,
+		},
+		{
+			filter:  bson.D{{"a", math.NaN()}},
+			matches: []string{"nan"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$lt", 100}}}},
+			matches: []string{"int", "double", "array", "twoFields"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$gt", int32(2)}, {"$lt", int32(4)}}}},
+			matches: []string{"array"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$gt", "4"}}}},
+			matches: []string{"string", "text", "texts"},
+		},
+		{
+			filter: bson.D{{"a", bson.D{{"$gt", bson.MinKey{}}}}},
+			matches: []string{
+				"int", "double", "string", "null", "nan", "array", "nested", "subdocs",
+				"partial", "subdoc", "text", "texts", "regex", "emptyArr", "twoFields",
+			},
+		},
+		{
+			filter: bson.D{{"a", bson.D{{"$ne", int32(5)}}}},
+			matches: []string{
+				"empty", "string", "null", "nan", "nested", "subdocs", "partial", "subdoc",
+				"text", "texts", "regex", "emptyArr",
+			},
+		},
+		{
+			filter:  bson.D{{"a.b", int32(2)}},
+			matches: []string{"subdocs", "subdoc"},
+		},
+		{
+			filter: bson.D{{"a.b", nil}},
+			matches: []string{
+				"empty", "int", "double", "string", "null", "nan", "array", "nested", "partial",
+				"text", "texts", "regex", "emptyArr", "twoFields",
+			},
+		},
+		{
+			filter:  bson.D{{"a.1", int32(5)}},
+			matches: []string{"array"},
+		},
+		{
+			filter:  bson.D{{"a.0.b", int32(1)}},
+			matches: []string{"subdocs", "partial"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$in", bson.A{int32(9), "5", bson.Regex{Pattern: "^b", Options: "i"}}}}}},
+			matches: []string{"string", "array", "texts"},
+		},
+		{
+			filter: bson.D{{"a", bson.D{{"$nin", bson.A{int32(5), nil}}}}},
+			matches: []string{
+				"string", "nan", "nested", "subdocs", "partial", "subdoc", "text", "texts",
+				"regex", "emptyArr",
+			},
+		},
+		{
+			filter: bson.D{{"a", bson.D{{"$exists", true}}}},
+			matches: []string{
+				"int", "double", "string", "null", "nan", "array", "nested", "subdocs",
+				"partial", "subdoc", "text", "texts", "regex", "emptyArr", "twoFields",
+			},
+		},
+		{
+			filter: bson.D{{"a.c", bson.D{{"$exists", 0}}}},
+			matches: []string{
+				"empty", "int", "double", "string", "null", "nan", "array", "nested", "subdoc",
+				"text", "texts", "regex", "emptyArr", "twoFields",
+			},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$type", "number"}}}},
+			matches: []string{"int", "double", "nan", "array", "twoFields"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$type", bson.A{"array", int32(2)}}}}},
+			matches: []string{"string", "array", "nested", "subdocs", "partial", "text", "texts", "emptyArr"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$size", int32(0)}}}},
+			matches: []string{"emptyArr"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$size", 2.0}}}},
+			matches: []string{"subdocs", "partial", "texts"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$all", bson.A{int32(9), int32(1)}}}}},
+			matches: []string{"array"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$all", bson.A{}}}}},
+			matches: nil,
+		},
+		{
+			filter: bson.D{{"a", bson.D{{"$all", bson.A{
+				bson.D{{"$elemMatch", bson.D{{"b", int32(1)}}}},
+				bson.D{{"$elemMatch", bson.D{{"c", "x"}}}},
+			}}}}},
+			matches: []string{"subdocs", "partial"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$elemMatch", bson.D{{"$gt", int32(3)}, {"$lt", int32(6)}}}}}},
+			matches: []string{"array"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$elemMatch", bson.D{{"b", int32(2)}, {"c", "x"}}}}}},
+			matches: []string{"subdocs"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$elemMatch", bson.D{{"$eq", int32(5)}}}}}},
+			matches: []string{"array"},
+		},
+		{
+			filter: bson.D{{"a", bson.D{{"$not", bson.D{{"$gt", int32(2)}}}}}},
+			matches: []string{
+				"empty", "string", "null", "nan", "nested", "subdocs", "partial", "subdoc",
+				"text", "texts", "regex", "emptyArr",
+			},
+		},
+		{
+			filter:  bson.D{{"a", bson.Regex{Pattern: "^world", Options: "im"}}},
+			matches: []string{"text"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$regex", "^F"}, {"$options", "i"}}}},
+			matches: []string{"texts"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$regex", "o.W"}}}},
+			matches: nil,
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"$regex", bson.Regex{Pattern: "o.W", Options: "s"}}}}},
+			matches: []string{"text"},
+		},
+		{
+			filter: bson.D{{"a", bson.D{{"$not", bson.Regex{Pattern: "o"}}}}},
+			matches: []string{
+				"empty", "int", "double", "string", "null", "nan", "array", "nested", "subdocs",
+				"partial", "subdoc", "regex", "emptyArr", "twoFields",
+			},
+		},
+		{
+			filter:  bson.D{{"a", int32(5)}, {"b", "x"}},
+			matches: []string{"twoFields"},
+		},
+		{
+			filter:  bson.D{{"$or", bson.A{bson.D{{"a", "5"}}, bson.D{{"a.b", int32(2)}}}}},
+			matches: []string{"string", "subdocs", "subdoc"},
+		},
+		{
+			filter:  bson.D{{"$nor", bson.A{bson.D{{"a", bson.D{{"$exists", true}}}}, bson.D{{"b", "x"}}}}},
+			matches: []string{"empty"},
+		},
+		{
+			filter: bson.D{{"$and", bson.A{
+				bson.D{{"a", bson.D{{"$type", "int"}}}},
+				bson.D{{"a", bson.D{{"$gte", 5.0}}}},
+			}}},
+			matches: []string{"int", "array", "twoFields"},
+		},
+		{
+			filter:  bson.D{{"a", bson.D{{"b", int32(2)}}}},
+			matches: []string{"subdoc"},
+		},
+	}
+
+	for _, c := range cases {
+		filter, err := CompileFilter(lo.Must(bson.Marshal(c.filter)))
+		require.NoError(t, err, "%v", c.filter)
+
+		var matched []string
+
+		for name, doc := range docs {
+			ok, matchErr := filter.Matches(lo.Must(bson.Marshal(doc)))
+			require.NoError(t, matchErr, "%v on %s", c.filter, name)
+
+			if ok {
+				matched = append(matched, name)
+			}
+		}
+
+		assert.ElementsMatch(t, c.matches, matched, "%v", c.filter)
+	}
+}
+
+func TestFilter_MaxKey(t *testing.T) {
+	filter, err := CompileFilter(lo.Must(bson.Marshal(bson.D{{"a", bson.D{{"$lt", bson.MaxKey{}}}}})))
+	require.NoError(t, err)
+
+	for _, val := range []any{int32(1), "x", bson.D{}, bson.MinKey{}} {
+		matched, matchErr := filter.Matches(lo.Must(bson.Marshal(bson.D{{"a", val}})))
+		require.NoError(t, matchErr)
+		assert.True(t, matched, "%v", val)
+	}
+
+	matched, err := filter.Matches(lo.Must(bson.Marshal(bson.D{{"a", bson.MaxKey{}}})))
+	require.NoError(t, err)
+	assert.False(t, matched)
+}
+
+func TestFilter_CompileErrors(t *testing.T) {
+	cases := []struct {
+		filter       bson.D
+		path         string
+		errSubstring string
+	}{
+		{
+			filter:       bson.D{{"$where", "true"}},
+			errSubstring: "$where",
+		},
+		{
+			filter:       bson.D{{"a", bson.D{{"$mod", bson.A{2, 0}}}}},
+			path:         "a",
+			errSubstring: "$mod",
+		},
+		{
+			filter:       bson.D{{"a.b", bson.D{{"$ne", bson.Regex{Pattern: "x"}}}}},
+			path:         "a.b",
+			errSubstring: "regex",
+		},
+		{
+			filter:       bson.D{{"a", bson.D{{"$size", 1.5}}}},
+			path:         "a",
+			errSubstring: "whole number",
+		},
+		{
+			filter:       bson.D{{"a", bson.D{{"$size", -1}}}},
+			path:         "a",
+			errSubstring: "negative",
+		},
+		{
+			filter:       bson.D{{"a", bson.Regex{Pattern: "x", Options: "x"}}},
+			path:         "a",
+			errSubstring: "option",
+		},
+		{
+			filter:       bson.D{{"a", bson.D{{"$options", "i"}}}},
+			path:         "a",
+			errSubstring: "requires $regex",
+		},
+		{
+			filter:       bson.D{{"a", bson.D{{"$type", "nope"}}}},
+			path:         "a",
+			errSubstring: "nope",
+		},
+		{
+			filter:       bson.D{{"a", bson.D{{"$in", int32(1)}}}},
+			path:         "a",
+			errSubstring: "must be an array",
+		},
+		{
+			filter:       bson.D{{"$or", bson.A{}}},
+			errSubstring: "nonempty",
+		},
+		{
+			filter:       bson.D{{"a", bson.D{{"$elemMatch", bson.D{{"b", bson.D{{"$near", 1}}}}}}}},
+			path:         "b",
+			errSubstring: "$near",
+		},
+		{
+			filter:       bson.D{{"a..b", 1}},
+			path:         "a..b",
+			errSubstring: "empty field name",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := CompileFilter(lo.Must(bson.Marshal(c.filter)))
+		require.Error(t, err, "%v", c.filter)
+
+		var filterErr FilterError
+		require.True(t, errors.As(err, &filterErr), "%v: %v", c.filter, err)
+
+		assert.Equal(t, c.path, filterErr.Path, "%v", c.filter)
+		assert.ErrorContains(t, err, c.errSubstring, "%v", c.filter)
+	}
+}
@@ -0,0 +1,330 @@
+package bsontools
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// DocumentHash is a 16-byte digest of a BSON document.
+type DocumentHash [16]byte
+
+func (dh DocumentHash) String() string {
+	return fmt.Sprintf("%x", dh[:])
+}
+
+// HashOptions controls which differences between documents HashDocument
+// ignores. The zero value ignores nothing, i.e., only bytewise-identical
+// documents hash alike.
+type HashOptions struct {
+	// IgnoreTopLevelFieldOrder makes the hash insensitive to the order of
+	// the top-level document’s fields, as if the document had been sorted
+	// with SortFields.
+	IgnoreTopLevelFieldOrder bool
+
+	// IgnoreNestedFieldOrder is like IgnoreTopLevelFieldOrder but applies
+	// to embedded documents (including those inside arrays). Array elements’
+	// order always matters.
+	IgnoreNestedFieldOrder bool
+
+	// NormalizeNumbers makes numbers hash by mathematical value rather than
+	// by BSON type, so int32(1), int64(1), 1.0, and Decimal128 1.00 all hash
+	// alike, as do -0 and 0. All NaNs hash alike.
+	NormalizeNumbers bool
+}
+
+func (ho HashOptions) isBytewise() bool {
+	return ho == HashOptions{}
+}
+
+// These tags stand in for BSON types in the hash input. They don’t collide
+// with any BSON type.
+const (
+	hashTagUnorderedDoc byte = 0x60 + iota
+	hashTagInteger
+	hashTagDouble
+	hashTagRational
+	hashTagNaN
+)
+
+// HashDocument computes a stable hash of a BSON document. Documents that are
+// equal under the given options always hash alike, so comparing hashes is a
+// cheap way to find likely-equal documents (e.g., across clusters).
+//
+// The hash is a truncated SHA-256 and is stable across processes and
+// releases of this library, so it is safe to persist.
+//
+// When field order is ignored, fields’ hashes are combined commutatively, so
+// no sorted copy of the document is made. Note, though, that this also
+// ignores the relative order of duplicate field names, which SortFields
+// would preserve.
+//
+// An error is returned if the document is malformed.
+func HashDocument[D ~[]byte](doc D, opts HashOptions) (DocumentHash, error) {
+	h := newDocHasher()
+
+	if opts.isBytewise() {
+		if _, err := elementsBlock(doc); err != nil {
+			return DocumentHash{}, err
+		}
+
+		h.levels[0].Write(doc)
+	} else {
+		h.opts = opts
+
+		if err := h.writeDocument(0, doc, !opts.IgnoreTopLevelFieldOrder); err != nil {
+			return DocumentHash{}, err
+		}
+	}
+
+	var dh DocumentHash
+	copy(dh[:], h.levels[0].Sum(h.sum[:0]))
+
+	return dh, nil
+}
+
+// docHasher holds one hash.Hash per nesting level so that fields’ hashes
+// can be computed (for order-insensitive hashing) without allocating a new
+// hash.Hash per field.
+type docHasher struct {
+	opts    HashOptions
+	levels  []hash.Hash
+	sum     [sha256.Size]byte
+	scratch [binary.MaxVarintLen64 + 8]byte
+}
+
+func newDocHasher() *docHasher {
+	return &docHasher{
+		levels: []hash.Hash{sha256.New()},
+	}
+}
+
+func (h *docHasher) level(depth int) hash.Hash {
+	for len(h.levels) <= depth {
+		h.levels = append(h.levels, sha256.New())
+	}
+
+	return h.levels[depth]
+}
+
+// writeDocument writes a document’s (or array’s) elements to the hash at
+// the given depth. If the fields are unordered, their individual hashes use
+// the next level down.
+func (h *docHasher) writeDocument(depth int, doc []byte, ordered bool) error {
+	elements, err := elementsBlock(doc)
+	if err != nil {
+		return err
+	}
+
+	out := h.level(depth)
+
+	if ordered {
+		for len(elements) > 0 {
+			var el bsoncore.Element
+			var ok bool
+
+			el, elements, ok = bsoncore.ReadElement(elements)
+			if !ok {
+				return bsoncore.NewInsufficientBytesError(doc, elements)
+			}
+
+			if err := h.writeElement(depth, el); err != nil {
+				return err
+			}
+		}
+
+		// No element begins with a NUL, so this delimits the document.
+		out.Write([]byte{0})
+
+		return nil
+	}
+
+	// For order-insensitivity we sum the fields’ individual hashes. This
+	// 128-bit sum is commutative, so the fields’ order doesn’t matter.
+	var sumHi, sumLo uint64
+	var count uint64
+
+	fieldHash := h.level(depth + 1)
+
+	for len(elements) > 0 {
+		var el bsoncore.Element
+		var ok bool
+
+		el, elements, ok = bsoncore.ReadElement(elements)
+		if !ok {
+			return bsoncore.NewInsufficientBytesError(doc, elements)
+		}
+
+		fieldHash.Reset()
+
+		if err := h.writeElement(depth+1, el); err != nil {
+			return err
+		}
+
+		sum := fieldHash.Sum(h.sum[:0])
+
+		var carry uint64
+		lo := binary.BigEndian.Uint64(sum[8:16])
+		sumLo, carry = addWithCarry(sumLo, lo)
+		sumHi += binary.BigEndian.Uint64(sum[:8]) + carry
+
+		count++
+	}
+
+	buf := h.scratch[:0]
+	buf = append(buf, hashTagUnorderedDoc)
+	buf = binary.AppendUvarint(buf, count)
+	out.Write(buf)
+
+	buf = binary.BigEndian.AppendUint64(h.scratch[:0], sumHi)
+	buf = binary.BigEndian.AppendUint64(buf, sumLo)
+	out.Write(buf)
+
+	return nil
+}
+
+func addWithCarry(a, b uint64) (uint64, uint64) {
+	sum := a + b
+	if sum < a {
+		return sum, 1
+	}
+
+	return sum, 0
+}
+
+// writeElement writes one element to the hash at the given depth.
+func (h *docHasher) writeElement(depth int, el bsoncore.Element) error {
+	key, err := el.KeyBytesErr()
+	if err != nil {
+		return err
+	}
+
+	val, err := el.ValueErr()
+	if err != nil {
+		return fmt.Errorf("parsing %#q: %w", key, err)
+	}
+
+	bType := bson.Type(val.Type)
+	out := h.level(depth)
+
+	if h.opts.NormalizeNumbers && isNumericType(bType) {
+		if err := h.writeNumber(out, key, bson.RawValue{Type: bType, Value: val.Data}); err != nil {
+			return fmt.Errorf("hashing %#q: %w", key, err)
+		}
+
+		return nil
+	}
+
+	out.Write(el[:len(key)+2])
+
+	switch bType {
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+		ordered := bType == bson.TypeArray || !h.opts.IgnoreNestedFieldOrder
+
+		if err := h.writeDocument(depth, val.Data, ordered); err != nil {
+			return fmt.Errorf("hashing %#q: %w", key, err)
+		}
+	default:
+		// Other values’ encodings are self-delimiting. (Code-with-scope’s
+		// scope is hashed bytewise.)
+		out.Write(val.Data)
+	}
+
+	return nil
+}
+
+func isNumericType(t bson.Type) bool {
+	switch t {
+	case bson.TypeDouble, bson.TypeInt32, bson.TypeInt64, bson.TypeDecimal128:
+		return true
+	}
+
+	return false
+}
+
+// writeNumber writes a number’s key & value such that all numbers that
+// CompareValues considers equal yield the same hash input.
+func (h *docHasher) writeNumber(out hash.Hash, key []byte, val bson.RawValue) error {
+	buf := h.scratch[:0]
+
+	writeHeader := func(tag byte) {
+		out.Write([]byte{tag})
+		out.Write(key)
+		out.Write([]byte{0})
+	}
+
+	switch val.Type {
+	case bson.TypeInt32, bson.TypeInt64:
+		i64, ok := val.AsInt64OK()
+		if !ok {
+			return fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		writeHeader(hashTagInteger)
+		out.Write(binary.BigEndian.AppendUint64(buf, uint64(i64)))
+
+		return nil
+	case bson.TypeDouble:
+		f, ok := val.DoubleOK()
+		if !ok {
+			return fmt.Errorf("invalid BSON %s", val.Type)
+		}
+
+		h.writeFloat(out, writeHeader, f)
+
+		return nil
+	}
+
+	// Decimal128 is the slow path since it needs exact arithmetic.
+	dec, ok := val.Decimal128OK()
+	if !ok {
+		return fmt.Errorf("invalid BSON %s", val.Type)
+	}
+
+	if i64, acc, err := Decimal128ToInt64(dec, big.ToZero); err == nil && acc == big.Exact {
+		writeHeader(hashTagInteger)
+		out.Write(binary.BigEndian.AppendUint64(buf, uint64(i64)))
+
+		return nil
+	}
+
+	// NB: This also handles NaN & infinities.
+	if f, acc := Decimal128ToFloat64(dec, big.ToNearestEven); acc == big.Exact {
+		h.writeFloat(out, writeHeader, f)
+
+		return nil
+	}
+
+	// No double or integer equals this value, so its exact rational form
+	// is canonical.
+	writeHeader(hashTagRational)
+
+	ratStr := decomposeDecimal128(dec).rat().RatString()
+	buf = binary.AppendUvarint(buf, uint64(len(ratStr)))
+	out.Write(buf)
+	out.Write([]byte(ratStr))
+
+	return nil
+}
+
+func (h *docHasher) writeFloat(out hash.Hash, writeHeader func(byte), f float64) {
+	buf := h.scratch[:0]
+
+	switch {
+	case math.IsNaN(f):
+		writeHeader(hashTagNaN)
+	case f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64:
+		// NB: This also folds -0 into 0.
+		writeHeader(hashTagInteger)
+		out.Write(binary.BigEndian.AppendUint64(buf, uint64(int64(f))))
+	default:
+		writeHeader(hashTagDouble)
+		out.Write(binary.BigEndian.AppendUint64(buf, math.Float64bits(f)))
+	}
+}
@@ -0,0 +1,125 @@
+package bsontools
+
+import (
+	"math"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestHashDocument_FieldOrder(t *testing.T) {
+	a := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"b", bson.D{{"x", "x"}, {"y", "y"}}},
+	}))
+	topSwapped := lo.Must(bson.Marshal(bson.D{
+		{"b", bson.D{{"x", "x"}, {"y", "y"}}},
+		{"a", int32(1)},
+	}))
+	bothSwapped := lo.Must(bson.Marshal(bson.D{
+		{"b", bson.D{{"y", "y"}, {"x", "x"}}},
+		{"a", int32(1)},
+	}))
+
+	hash := func(doc bson.Raw, opts HashOptions) DocumentHash {
+		return lo.Must(HashDocument(doc, opts))
+	}
+
+	for _, opts := range []HashOptions{
+		{},
+		{IgnoreTopLevelFieldOrder: true},
+		{IgnoreNestedFieldOrder: true},
+		{IgnoreTopLevelFieldOrder: true, IgnoreNestedFieldOrder: true, NormalizeNumbers: true},
+	} {
+		assert.Equal(t, hash(a, opts), hash(a, opts), "equal docs, %+v", opts)
+	}
+
+	assert.NotEqual(t, hash(a, HashOptions{}), hash(topSwapped, HashOptions{}))
+
+	topOnly := HashOptions{IgnoreTopLevelFieldOrder: true}
+	assert.Equal(t, hash(a, topOnly), hash(topSwapped, topOnly))
+	assert.NotEqual(t, hash(a, topOnly), hash(bothSwapped, topOnly))
+
+	nestedOnly := HashOptions{IgnoreNestedFieldOrder: true}
+	assert.NotEqual(t, hash(a, nestedOnly), hash(topSwapped, nestedOnly))
+	assert.Equal(t, hash(topSwapped, nestedOnly), hash(bothSwapped, nestedOnly))
+
+	all := HashOptions{IgnoreTopLevelFieldOrder: true, IgnoreNestedFieldOrder: true}
+	assert.Equal(t, hash(a, all), hash(bothSwapped, all))
+
+	// Array order always matters.
+	arr1 := lo.Must(bson.Marshal(bson.D{{"arr", bson.A{1, 2}}}))
+	arr2 := lo.Must(bson.Marshal(bson.D{{"arr", bson.A{2, 1}}}))
+	assert.NotEqual(t, hash(arr1, all), hash(arr2, all))
+
+	// Moving a value between fields must change the hash.
+	moved1 := lo.Must(bson.Marshal(bson.D{{"a", "x"}, {"b", "y"}}))
+	moved2 := lo.Must(bson.Marshal(bson.D{{"a", "y"}, {"b", "x"}}))
+	assert.NotEqual(t, hash(moved1, all), hash(moved2, all))
+}
+
+func TestHashDocument_NormalizeNumbers(t *testing.T) {
+	normalize := HashOptions{NormalizeNumbers: true}
+
+	equalGroups := [][]any{
+		{
+			int32(1),
+			int64(1),
+			float64(1),
+			lo.Must(bson.ParseDecimal128("1.00")),
+			lo.Must(bson.ParseDecimal128("0.1E1")),
+		},
+		{float64(0), math.Copysign(0, -1), int32(0), lo.Must(bson.ParseDecimal128("-0.0"))},
+		{float64(0.5), lo.Must(bson.ParseDecimal128("0.50"))},
+		{math.NaN(), lo.Must(bson.ParseDecimal128("NaN"))},
+		{math.Inf(-1), lo.Must(bson.ParseDecimal128("-Infinity"))},
+		{lo.Must(bson.ParseDecimal128("0.1")), lo.Must(bson.ParseDecimal128("0.100"))},
+	}
+
+	hashes := make([]DocumentHash, len(equalGroups))
+
+	for g, group := range equalGroups {
+		for i, num := range group {
+			doc := lo.Must(bson.Marshal(bson.D{{"n", num}}))
+
+			hash, err := HashDocument(doc, normalize)
+			require.NoError(t, err)
+
+			if i == 0 {
+				hashes[g] = hash
+				continue
+			}
+
+			assert.Equal(t, hashes[g], hash, "%v (%T) should hash like %v", num, num, group[0])
+		}
+	}
+
+	assert.Len(t, lo.Uniq(hashes), len(hashes), "groups should hash differently")
+
+	// Without normalization, numeric types matter.
+	i32 := lo.Must(bson.Marshal(bson.D{{"n", int32(1)}}))
+	i64 := lo.Must(bson.Marshal(bson.D{{"n", int64(1)}}))
+	assert.NotEqual(
+		t,
+		lo.Must(HashDocument(i32, HashOptions{IgnoreTopLevelFieldOrder: true})),
+		lo.Must(HashDocument(i64, HashOptions{IgnoreTopLevelFieldOrder: true})),
+	)
+
+	// Double 0.1 isn’t Decimal128 0.1.
+	dbl := lo.Must(bson.Marshal(bson.D{{"n", 0.1}}))
+	dec := lo.Must(bson.Marshal(bson.D{{"n", lo.Must(bson.ParseDecimal128("0.1"))}}))
+	assert.NotEqual(t, lo.Must(HashDocument(dbl, normalize)), lo.Must(HashDocument(dec, normalize)))
+}
+
+func TestHashDocument_Invalid(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{{"a", bson.D{{"b", "c"}}}}))
+	doc[8] = 0xff
+
+	for _, opts := range []HashOptions{{}, {IgnoreNestedFieldOrder: true}} {
+		_, err := HashDocument(doc[:len(doc)-1], opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+}
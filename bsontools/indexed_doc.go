@@ -0,0 +1,227 @@
+package bsontools
+
+import (
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// IndexedDoc is a view of a BSON document that speeds up repeated lookups.
+// Whereas bson.Raw.LookupErr and RawLookup rescan the document on every
+// call, IndexedDoc scans each (embedded) document once, on its first lookup,
+// and caches its elements’ offsets. Later lookups take constant time per
+// pointer node.
+//
+// The view tolerates in-place edits to the document’s bytes: each lookup
+// rereads the element at the cached offset, so edits that change values
+// in place (e.g., ConvertLegacyUUIDs) are visible, and if the element there
+// no longer has the expected key (e.g., after SortFields), the view
+// reindexes. A key that is missing from the cached offsets (e.g., after
+// RenameInRaw) also causes a reindex before the lookup reports the element
+// as missing. Edits that yield a new buffer (e.g., ReplaceInRaw) require a
+// call to Reset.
+//
+// IndexedDoc is not concurrency-safe since lookups update its cache.
+//
+// Example usage:
+//
+//	indexed := bsontools.NewIndexedDoc(doc)
+//	id, err := indexed.Lookup("_id")
+//	...
+//	ts, err := bsontools.IndexedLookup[bson.Timestamp](indexed, "meta", "ts")
+//	...
+//	doc, _, err = bsontools.ReplaceInRaw(doc, newVal, "meta", "ts")
+//	...
+//	indexed.Reset(doc)
+type IndexedDoc struct {
+	doc  bson.Raw
+	root *docIndex
+}
+
+// docIndex caches one (embedded) document’s element offsets.
+type docIndex struct {
+	// offsets maps field names to the offsets of their elements within
+	// the top-level document. If a field name repeats, its first
+	// element wins, as with bson.Raw.LookupErr.
+	offsets map[string]int
+
+	// children are the indexes of embedded documents & arrays that
+	// lookups have traversed.
+	children map[string]*docIndex
+}
+
+// NewIndexedDoc returns an IndexedDoc for the given document. This does not
+// scan the document; that happens on the first lookup.
+func NewIndexedDoc(doc bson.Raw) *IndexedDoc {
+	return &IndexedDoc{doc: doc}
+}
+
+// Raw returns the underlying document.
+func (id *IndexedDoc) Raw() bson.Raw {
+	return id.doc
+}
+
+// Reset points the view at a new document and discards the cached offsets.
+func (id *IndexedDoc) Reset(doc bson.Raw) {
+	id.doc = doc
+	id.root = nil
+}
+
+// Invalidate discards the cached offsets. Lookups detect most in-place
+// edits on their own, but an edit that moves an element to where another
+// element with the same key used to be (e.g., in a document with duplicate
+// field names) can escape that detection.
+func (id *IndexedDoc) Invalidate() {
+	id.root = nil
+}
+
+// Lookup is like bson.Raw.LookupErr. A missing referent causes an error
+// that wraps bsoncore.ErrElementNotFound. If any nonfinal node in the
+// pointer is a scalar value, a PointerTooDeepError is returned.
+func (id *IndexedDoc) Lookup(pointer ...string) (bson.RawValue, error) {
+	if len(pointer) == 0 {
+		return bson.RawValue{}, bsoncore.ErrEmptyKey
+	}
+
+	val, stale, err := id.lookup(pointer)
+	if stale {
+		id.Invalidate()
+
+		val, stale, err = id.lookup(pointer)
+		if stale {
+			return bson.RawValue{}, fmt.Errorf(
+				"document changed while looking up %#q",
+				formatPointerForDisplay(pointer),
+			)
+		}
+	}
+
+	return val, err
+}
+
+// IndexedLookup is like RawLookup but uses an IndexedDoc.
+func IndexedLookup[T unmarshalTargets](id *IndexedDoc, pointer ...string) (T, error) {
+	rv, err := id.Lookup(pointer...)
+	if err != nil {
+		return *new(T), fmt.Errorf("extracting %#q: %w", pointer, err)
+	}
+
+	val, err := RawValueTo[T](rv)
+	if err != nil {
+		return *new(T), fmt.Errorf("casting %#q: %w", pointer, err)
+	}
+
+	return val, nil
+}
+
+// lookup returns the pointer’s referent. Its returned bool indicates that
+// the cached offsets are stale.
+func (id *IndexedDoc) lookup(pointer []string) (bson.RawValue, bool, error) {
+	// If the offsets were cached before this lookup, a missing key may
+	// just mean that they’re stale.
+	wasCached := id.root != nil
+
+	if id.root == nil {
+		root, err := indexDocument(id.doc, 0, nil)
+		if err != nil {
+			return bson.RawValue{}, false, err
+		}
+
+		id.root = root
+	}
+
+	node := id.root
+
+	for i, key := range pointer {
+		offset, ok := node.offsets[key]
+		if !ok {
+			if wasCached {
+				return bson.RawValue{}, true, nil
+			}
+
+			return bson.RawValue{}, false, fmt.Errorf(
+				"%#q: %w",
+				formatPointerForDisplay(pointer[:i+1]),
+				bsoncore.ErrElementNotFound,
+			)
+		}
+
+		if offset >= len(id.doc) {
+			return bson.RawValue{}, true, nil
+		}
+
+		el, _, ok := bsoncore.ReadElement(id.doc[offset:])
+		if !ok || string(el.KeyBytes()) != key {
+			return bson.RawValue{}, true, nil
+		}
+
+		val := bson.RawValue{Type: bson.Type(el[0]), Value: el.Value().Data}
+
+		if i == len(pointer)-1 {
+			return val, false, nil
+		}
+
+		switch val.Type {
+		case bson.TypeEmbeddedDocument, bson.TypeArray:
+		default:
+			return bson.RawValue{}, false, PointerTooDeepError{
+				givenPointer:   slices.Clone(pointer),
+				elementType:    val.Type,
+				elementPointer: slices.Clone(pointer[:i+1]),
+			}
+		}
+
+		child := node.children[key]
+		if child == nil {
+			// The value follows the type byte and the NUL-terminated key.
+			valueAt := offset + 1 + len(key) + 1
+
+			var err error
+
+			child, err = indexDocument(val.Value, valueAt, pointer[:i+1])
+			if err != nil {
+				return bson.RawValue{}, false, err
+			}
+
+			if node.children == nil {
+				node.children = map[string]*docIndex{}
+			}
+
+			node.children[key] = child
+		}
+
+		node = child
+	}
+
+	panic("unreachable")
+}
+
+// indexDocument scans an (embedded) document that starts at the given
+// offset within the top-level document.
+func indexDocument(doc bson.Raw, docAt int, pointer []string) (*docIndex, error) {
+	index := &docIndex{offsets: map[string]int{}}
+
+	// Elements start after the length header.
+	offset := docAt + 4
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return nil, fmt.Errorf("indexing %s: %w", formatPointerForDisplay(pointer), err)
+		}
+
+		key, err := el.KeyErr()
+		if err != nil {
+			return nil, fmt.Errorf("indexing %s: %w", formatPointerForDisplay(pointer), err)
+		}
+
+		if _, exists := index.offsets[key]; !exists {
+			index.offsets[key] = offset
+		}
+
+		offset += len(el)
+	}
+
+	return index, nil
+}
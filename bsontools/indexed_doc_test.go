@@ -0,0 +1,116 @@
+package bsontools
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+func TestIndexedDoc_Lookup(t *testing.T) {
+	doc := bson.Raw(lo.Must(bson.Marshal(bson.D{
+		{"_id", int32(1)},
+		{"meta", bson.D{
+			{"ts", bson.Timestamp{T: 5, I: 6}},
+			{"tags", bson.A{"a", bson.D{{"b", "c"}}}},
+		}},
+		{"name", "foo"},
+		{"name", "dupe"},
+	})))
+
+	indexed := NewIndexedDoc(doc)
+
+	pointers := [][]string{
+		{"_id"},
+		{"meta"},
+		{"meta", "ts"},
+		{"meta", "tags", "0"},
+		{"meta", "tags", "1", "b"},
+		{"name"},
+	}
+
+	// Twice, to exercise both the initial scan & the cache:
+	for range 2 {
+		for _, pointer := range pointers {
+			expected := lo.Must(doc.LookupErr(pointer...))
+			assert.Equal(t, expected, lo.Must(indexed.Lookup(pointer...)), "%#q", pointer)
+		}
+	}
+
+	assert.Equal(t, int32(1), lo.Must(IndexedLookup[int32](indexed, "_id")))
+	assert.Equal(t, "c", lo.Must(IndexedLookup[string](indexed, "meta", "tags", "1", "b")))
+	assert.Equal(t, "foo", lo.Must(IndexedLookup[string](indexed, "name")), "first duplicate wins")
+
+	_, err := IndexedLookup[string](indexed, "_id")
+	assert.ErrorContains(t, err, "casting")
+
+	_, err = indexed.Lookup("meta", "missing")
+	assert.ErrorIs(t, err, bsoncore.ErrElementNotFound)
+
+	_, err = indexed.Lookup("name", "x")
+	assert.ErrorAs(t, err, &PointerTooDeepError{})
+
+	_, err = indexed.Lookup()
+	assert.ErrorIs(t, err, bsoncore.ErrEmptyKey)
+
+	_, err = NewIndexedDoc(doc[:len(doc)-1]).Lookup("_id")
+	assert.Error(t, err, "malformed document")
+}
+
+func TestIndexedDoc_InPlaceEdits(t *testing.T) {
+	oid := bson.NewObjectID()
+	uuid := lo.Must(EncodeUUID(testUUID, UUIDJavaLegacy))
+
+	doc := bson.Raw(lo.Must(bson.Marshal(bson.D{
+		{"z", int32(1)},
+		{"sub", bson.D{
+			{"y", "why"},
+			{"x", oid},
+		}},
+		{"uuid", uuid},
+	})))
+
+	indexed := NewIndexedDoc(doc)
+
+	assert.Equal(t, "why", lo.Must(IndexedLookup[string](indexed, "sub", "y")))
+	assert.Equal(t, uuid, lo.Must(indexed.Lookup("uuid")))
+
+	// An in-place value edit is visible without reindexing.
+	lo.Must(ConvertLegacyUUIDs(doc, LegacyUUIDOptions{From: UUIDJavaLegacy}))
+	assert.Equal(t, lo.Must(EncodeUUID(testUUID, UUIDStandard)), lo.Must(indexed.Lookup("uuid")))
+
+	// Reordering fields moves the cached elements.
+	require.NoError(t, SortFields(doc))
+
+	assert.Equal(t, int32(1), lo.Must(IndexedLookup[int32](indexed, "z")))
+	assert.Equal(t, "why", lo.Must(IndexedLookup[string](indexed, "sub", "y")))
+	assert.Equal(t, oid, lo.Must(IndexedLookup[bson.ObjectID](indexed, "sub", "x")))
+
+	// An in-place rename makes the cached offsets miss the new key.
+	doc, found, err := RenameInRaw(doc, "w", "z")
+	require.NoError(t, err)
+	require.True(t, found)
+
+	assert.Equal(t, int32(1), lo.Must(IndexedLookup[int32](indexed, "w")))
+
+	_, err = indexed.Lookup("z")
+	assert.ErrorIs(t, err, bsoncore.ErrElementNotFound)
+
+	doc, _, err = RenameInRaw(doc, "z", "w")
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), lo.Must(IndexedLookup[int32](indexed, "z")))
+
+	// A new buffer requires Reset.
+	newDoc, found, err := ReplaceInRaw(doc, ToRawValue("a longer value"), "sub", "y")
+	require.NoError(t, err)
+	require.True(t, found)
+
+	indexed.Reset(newDoc)
+
+	assert.Equal(t, "a longer value", lo.Must(IndexedLookup[string](indexed, "sub", "y")))
+	assert.Equal(t, int32(1), lo.Must(IndexedLookup[int32](indexed, "z")))
+}
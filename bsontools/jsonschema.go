@@ -0,0 +1,517 @@
+package bsontools
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb-labs/migration-tools/option"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// SchemaError indicates that a `$jsonSchema` document is invalid or uses
+// unsupported keywords.
+type SchemaError struct {
+	// Path is the dotted location of the offending keyword within the
+	// schema, e.g., `properties.a.bsonType`.
+	Path string
+
+	// Reason describes what is wrong.
+	Reason string
+}
+
+func (se SchemaError) Error() string {
+	return fmt.Sprintf("invalid $jsonSchema at %#q: %s", se.Path, se.Reason)
+}
+
+// JSONSchema is a compiled `$jsonSchema` document, as used in collection
+// validators. It evaluates documents client-side with the server’s
+// semantics. The supported keywords are:
+//   - `bsonType` & `type` (except the unsupported `integer`)
+//   - `enum`, `allOf`, `anyOf`, `oneOf`, & `not`
+//   - `minimum`, `maximum`, `exclusiveMinimum`, & `exclusiveMaximum`
+//   - `minLength`, `maxLength`, & `pattern`
+//   - `required`, `properties`, `patternProperties`,
+//     `additionalProperties`, `minProperties`, & `maxProperties`
+//   - `items`, `additionalItems`, `minItems`, `maxItems`, & `uniqueItems`
+//   - `title` & `description`, which are ignored
+//
+// As with other JSON Schema implementations, keywords that constrain a
+// particular type (e.g., `minLength`) ignore values of other types.
+// `enum` & `uniqueItems` compare values as CompareValues does, except that
+// embedded documents’ field order is ignored.
+//
+// Regular expressions use Go’s RE2 syntax, which lacks some PCRE features
+// (e.g., backreferences); such patterns fail to compile.
+//
+// A JSONSchema is safe for concurrent use.
+type JSONSchema struct {
+	root *schemaNode
+}
+
+type schemaNode struct {
+	// typeKeyword is `bsonType` or `type`, whichever restricts types.
+	typeKeyword string
+	types       []bson.Type
+	typeNames   []string
+
+	enum                []bson.RawValue
+	allOf, anyOf, oneOf []*schemaNode
+	not                 *schemaNode
+
+	minimum, maximum                   option.Option[bson.RawValue]
+	exclusiveMinimum, exclusiveMaximum bool
+
+	minLength, maxLength option.Option[int]
+	pattern              *regexp.Regexp
+
+	required                     []string
+	properties                   map[string]*schemaNode
+	patternProperties            []patternSchema
+	additionalProperties         schemaAdditional
+	minProperties, maxProperties option.Option[int]
+
+	// items applies to all elements. tupleItems applies to elements by
+	// position, and additionalItems applies to the elements beyond them.
+	items              *schemaNode
+	tupleItems         []*schemaNode
+	additionalItems    schemaAdditional
+	minItems, maxItems option.Option[int]
+	uniqueItems        bool
+}
+
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *schemaNode
+}
+
+// schemaAdditional is `additionalProperties` or `additionalItems`, which
+// may be a boolean or a schema.
+type schemaAdditional struct {
+	forbidden bool
+	schema    *schemaNode
+}
+
+// jsonTypes maps the `type` keyword’s JSON types to BSON types.
+var jsonTypes = map[string][]bson.Type{
+	"object":  {bson.TypeEmbeddedDocument},
+	"array":   {bson.TypeArray},
+	"number":  numberTypes,
+	"boolean": {bson.TypeBoolean},
+	"string":  {bson.TypeString},
+	"null":    {bson.TypeNull},
+}
+
+// CompileJSONSchema parses a `$jsonSchema` document, i.e., the value of a
+// collection validator’s `$jsonSchema` field. A failure to parse the schema
+// is returned as SchemaError.
+//
+// Example usage:
+//
+//	schema, err := bsontools.CompileJSONSchema(validator.Lookup("$jsonSchema").Document())
+//	...
+//	violations, err := schema.Validate(doc)
+func CompileJSONSchema[D ~[]byte](schema D) (*JSONSchema, error) {
+	root, err := compileSchema(bson.Raw(schema), "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONSchema{root: root}, nil
+}
+
+func compileSchema(doc bson.Raw, path string) (*schemaNode, error) {
+	node := &schemaNode{}
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return nil, fmt.Errorf("parsing $jsonSchema at %#q: %w", path, err)
+		}
+
+		keyword := el.Key()
+
+		kwErr := node.compileKeyword(keyword, el.Value(), appendSchemaPath(path, keyword))
+		if kwErr != nil {
+			return nil, kwErr
+		}
+	}
+
+	if node.exclusiveMinimum && !node.minimum.IsSome() {
+		return nil, SchemaError{
+			Path:   appendSchemaPath(path, "exclusiveMinimum"),
+			Reason: "requires minimum",
+		}
+	}
+
+	if node.exclusiveMaximum && !node.maximum.IsSome() {
+		return nil, SchemaError{
+			Path:   appendSchemaPath(path, "exclusiveMaximum"),
+			Reason: "requires maximum",
+		}
+	}
+
+	return node, nil
+}
+
+func appendSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+//nolint:cyclop,funlen
+func (node *schemaNode) compileKeyword(keyword string, arg bson.RawValue, path string) error {
+	var err error
+
+	switch keyword {
+	case "bsonType", "type":
+		err = node.compileType(keyword, arg, path)
+	case "enum":
+		node.enum, err = schemaEnumArg(arg, path)
+	case "allOf":
+		node.allOf, err = compileSchemaList(arg, path)
+	case "anyOf":
+		node.anyOf, err = compileSchemaList(arg, path)
+	case "oneOf":
+		node.oneOf, err = compileSchemaList(arg, path)
+	case "not":
+		node.not, err = compileSubschema(arg, path)
+	case "minimum":
+		node.minimum, err = schemaNumberArg(arg, path)
+	case "maximum":
+		node.maximum, err = schemaNumberArg(arg, path)
+	case "exclusiveMinimum":
+		node.exclusiveMinimum, err = schemaBoolArg(arg, path)
+	case "exclusiveMaximum":
+		node.exclusiveMaximum, err = schemaBoolArg(arg, path)
+	case "minLength":
+		node.minLength, err = schemaCountArg(arg, path)
+	case "maxLength":
+		node.maxLength, err = schemaCountArg(arg, path)
+	case "pattern":
+		node.pattern, err = schemaPatternArg(arg, path)
+	case "required":
+		node.required, err = schemaRequiredArg(arg, path)
+	case "properties":
+		err = node.compileProperties(arg, path)
+	case "patternProperties":
+		err = node.compilePatternProperties(arg, path)
+	case "additionalProperties":
+		node.additionalProperties, err = compileSchemaAdditional(arg, path)
+	case "minProperties":
+		node.minProperties, err = schemaCountArg(arg, path)
+	case "maxProperties":
+		node.maxProperties, err = schemaCountArg(arg, path)
+	case "items":
+		err = node.compileItems(arg, path)
+	case "additionalItems":
+		node.additionalItems, err = compileSchemaAdditional(arg, path)
+	case "minItems":
+		node.minItems, err = schemaCountArg(arg, path)
+	case "maxItems":
+		node.maxItems, err = schemaCountArg(arg, path)
+	case "uniqueItems":
+		node.uniqueItems, err = schemaBoolArg(arg, path)
+	case "title", "description":
+		if arg.Type != bson.TypeString {
+			err = SchemaError{Path: path, Reason: "must be a string"}
+		}
+	default:
+		err = SchemaError{Path: path, Reason: "unsupported keyword"}
+	}
+
+	return err
+}
+
+func (node *schemaNode) compileType(keyword string, arg bson.RawValue, path string) error {
+	if node.typeKeyword != "" {
+		return SchemaError{Path: path, Reason: "cannot use both bsonType and type"}
+	}
+
+	names := []string{}
+
+	switch arg.Type {
+	case bson.TypeString:
+		names = append(names, arg.StringValue())
+	case bson.TypeArray:
+		values, err := schemaArrayArg(arg, path)
+		if err != nil {
+			return err
+		}
+
+		for _, val := range values {
+			name, ok := val.StringValueOK()
+			if !ok {
+				return SchemaError{Path: path, Reason: "array elements must be strings"}
+			}
+
+			names = append(names, name)
+		}
+	default:
+		return SchemaError{Path: path, Reason: "must be a string or an array of strings"}
+	}
+
+	for _, name := range names {
+		bsonTypes, err := schemaTypeName(keyword, name, path)
+		if err != nil {
+			return err
+		}
+
+		node.types = append(node.types, bsonTypes...)
+	}
+
+	node.typeKeyword = keyword
+	node.typeNames = names
+
+	return nil
+}
+
+func schemaTypeName(keyword, name, path string) ([]bson.Type, error) {
+	if keyword == "type" {
+		bsonTypes, ok := jsonTypes[name]
+		if !ok {
+			return nil, SchemaError{Path: path, Reason: fmt.Sprintf("unsupported type %#q", name)}
+		}
+
+		return bsonTypes, nil
+	}
+
+	if name == "number" {
+		return numberTypes, nil
+	}
+
+	bsonType, ok := typeAliases[name]
+	if !ok {
+		return nil, SchemaError{Path: path, Reason: fmt.Sprintf("unknown bsonType %#q", name)}
+	}
+
+	return []bson.Type{bsonType}, nil
+}
+
+func schemaArrayArg(arg bson.RawValue, path string) ([]bson.RawValue, error) {
+	arr, ok := arg.ArrayOK()
+	if !ok {
+		return nil, SchemaError{Path: path, Reason: "must be an array"}
+	}
+
+	values, err := arr.Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing $jsonSchema at %#q: %w", path, err)
+	}
+
+	if len(values) == 0 {
+		return nil, SchemaError{Path: path, Reason: "must be a nonempty array"}
+	}
+
+	return values, nil
+}
+
+// schemaEnumArg sorts the enum values’ fields so that validation can
+// ignore field order.
+func schemaEnumArg(arg bson.RawValue, path string) ([]bson.RawValue, error) {
+	values, err := schemaArrayArg(arg, path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, val := range values {
+		values[i], err = withSortedFields(val)
+		if err != nil {
+			return nil, fmt.Errorf("parsing $jsonSchema at %#q: %w", path, err)
+		}
+	}
+
+	return values, nil
+}
+
+func schemaNumberArg(arg bson.RawValue, path string) (option.Option[bson.RawValue], error) {
+	if !slices.Contains(numberTypes, arg.Type) {
+		return option.None[bson.RawValue](), SchemaError{Path: path, Reason: "must be a number"}
+	}
+
+	return option.Some(arg), nil
+}
+
+func schemaBoolArg(arg bson.RawValue, path string) (bool, error) {
+	val, ok := arg.BooleanOK()
+	if !ok {
+		return false, SchemaError{Path: path, Reason: "must be a boolean"}
+	}
+
+	return val, nil
+}
+
+func schemaCountArg(arg bson.RawValue, path string) (option.Option[int], error) {
+	count, ok := wholeNumberFilterArg(arg)
+	if !ok || count < 0 || count > int64(MaxUserDocumentSize) {
+		return option.None[int](), SchemaError{Path: path, Reason: "must be a nonnegative whole number"}
+	}
+
+	return option.Some(int(count)), nil
+}
+
+func schemaPatternArg(arg bson.RawValue, path string) (*regexp.Regexp, error) {
+	pattern, ok := arg.StringValueOK()
+	if !ok {
+		return nil, SchemaError{Path: path, Reason: "must be a string"}
+	}
+
+	return compileSchemaPattern(pattern, path)
+}
+
+func compileSchemaPattern(pattern, path string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, SchemaError{Path: path, Reason: fmt.Sprintf("unsupported regex: %v", err)}
+	}
+
+	return re, nil
+}
+
+func schemaRequiredArg(arg bson.RawValue, path string) ([]string, error) {
+	values, err := schemaArrayArg(arg, path)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(values))
+
+	for _, val := range values {
+		field, ok := val.StringValueOK()
+		if !ok {
+			return nil, SchemaError{Path: path, Reason: "array elements must be strings"}
+		}
+
+		if slices.Contains(fields, field) {
+			return nil, SchemaError{Path: path, Reason: fmt.Sprintf("duplicate field %#q", field)}
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+func compileSubschema(arg bson.RawValue, path string) (*schemaNode, error) {
+	doc, ok := arg.DocumentOK()
+	if !ok {
+		return nil, SchemaError{Path: path, Reason: "must be a document"}
+	}
+
+	return compileSchema(doc, path)
+}
+
+func compileSchemaList(arg bson.RawValue, path string) ([]*schemaNode, error) {
+	values, err := schemaArrayArg(arg, path)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*schemaNode, 0, len(values))
+
+	for i, val := range values {
+		sub, subErr := compileSubschema(val, appendSchemaPath(path, strconv.Itoa(i)))
+		if subErr != nil {
+			return nil, subErr
+		}
+
+		nodes = append(nodes, sub)
+	}
+
+	return nodes, nil
+}
+
+func compileSchemaAdditional(arg bson.RawValue, path string) (schemaAdditional, error) {
+	if allowed, ok := arg.BooleanOK(); ok {
+		return schemaAdditional{forbidden: !allowed}, nil
+	}
+
+	if arg.Type != bson.TypeEmbeddedDocument {
+		return schemaAdditional{}, SchemaError{Path: path, Reason: "must be a boolean or a document"}
+	}
+
+	sub, err := compileSubschema(arg, path)
+	if err != nil {
+		return schemaAdditional{}, err
+	}
+
+	return schemaAdditional{schema: sub}, nil
+}
+
+func (node *schemaNode) compileProperties(arg bson.RawValue, path string) error {
+	doc, ok := arg.DocumentOK()
+	if !ok {
+		return SchemaError{Path: path, Reason: "must be a document"}
+	}
+
+	node.properties = map[string]*schemaNode{}
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return fmt.Errorf("parsing $jsonSchema at %#q: %w", path, err)
+		}
+
+		field := el.Key()
+
+		sub, subErr := compileSubschema(el.Value(), appendSchemaPath(path, field))
+		if subErr != nil {
+			return subErr
+		}
+
+		node.properties[field] = sub
+	}
+
+	return nil
+}
+
+func (node *schemaNode) compilePatternProperties(arg bson.RawValue, path string) error {
+	doc, ok := arg.DocumentOK()
+	if !ok {
+		return SchemaError{Path: path, Reason: "must be a document"}
+	}
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return fmt.Errorf("parsing $jsonSchema at %#q: %w", path, err)
+		}
+
+		subPath := appendSchemaPath(path, el.Key())
+
+		re, reErr := compileSchemaPattern(el.Key(), subPath)
+		if reErr != nil {
+			return reErr
+		}
+
+		sub, subErr := compileSubschema(el.Value(), subPath)
+		if subErr != nil {
+			return subErr
+		}
+
+		node.patternProperties = append(node.patternProperties, patternSchema{re: re, schema: sub})
+	}
+
+	return nil
+}
+
+func (node *schemaNode) compileItems(arg bson.RawValue, path string) error {
+	var err error
+
+	switch arg.Type {
+	case bson.TypeEmbeddedDocument:
+		node.items, err = compileSubschema(arg, path)
+	case bson.TypeArray:
+		node.tupleItems, err = compileSchemaList(arg, path)
+	default:
+		err = SchemaError{Path: path, Reason: "must be a document or an array of documents"}
+	}
+
+	return err
+}
+
+func (node *schemaNode) typeDescription() string {
+	return strings.Join(node.typeNames, " or ")
+}
@@ -0,0 +1,435 @@
+package bsontools
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// SchemaViolation describes one way in which a document fails a JSONSchema.
+type SchemaViolation struct {
+	// Path is the location of the offending value. For `required` and
+	// `additionalProperties` this includes the offending field name. Array
+	// elements’ indexes are given as strings.
+	Path []string
+
+	// Keyword is the schema keyword that the value fails, e.g., `bsonType`.
+	Keyword string
+
+	// Reason describes the failure.
+	Reason string
+}
+
+func (sv SchemaViolation) String() string {
+	return fmt.Sprintf("%s at %#q: %s", sv.Keyword, sv.Path, sv.Reason)
+}
+
+// Validate evaluates a document against the schema. It returns every
+// violation that it finds rather than stopping at the first; the document
+// conforms if there are none. An error is returned if the document is
+// malformed.
+//
+// Violations within `anyOf`, `oneOf`, and `not` subschemas are summarized
+// as a single violation of that keyword.
+func (s *JSONSchema) Validate(doc bson.Raw) ([]SchemaViolation, error) {
+	sv := schemaValidator{}
+
+	err := sv.validate(s.root, bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: doc})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sv.violations) == 0 {
+		return nil, nil
+	}
+
+	return sv.violations, nil
+}
+
+type schemaValidator struct {
+	path       []string
+	violations []SchemaViolation
+}
+
+func (sv *schemaValidator) report(keyword, reason string) {
+	sv.violations = append(sv.violations, SchemaViolation{
+		Path:    slices.Clone(sv.path),
+		Keyword: keyword,
+		Reason:  reason,
+	})
+}
+
+func (sv *schemaValidator) validate(node *schemaNode, val bson.RawValue) error {
+	if len(node.types) > 0 && !slices.Contains(node.types, val.Type) {
+		sv.report(
+			node.typeKeyword,
+			fmt.Sprintf("value is %s; expected %s", val.Type, node.typeDescription()),
+		)
+	}
+
+	if err := sv.validateEnum(node, val); err != nil {
+		return err
+	}
+
+	if err := sv.validateCombinators(node, val); err != nil {
+		return err
+	}
+
+	switch val.Type {
+	case bson.TypeDouble, bson.TypeInt32, bson.TypeInt64, bson.TypeDecimal128:
+		return sv.validateNumber(node, val)
+	case bson.TypeString:
+		return sv.validateString(node, val)
+	case bson.TypeEmbeddedDocument:
+		return sv.validateDocument(node, val.Value)
+	case bson.TypeArray:
+		return sv.validateArray(node, val.Value)
+	}
+
+	return nil
+}
+
+// matches indicates whether a value satisfies a subschema, without
+// reporting any violations.
+func (sv *schemaValidator) matches(node *schemaNode, val bson.RawValue) (bool, error) {
+	start := len(sv.violations)
+
+	err := sv.validate(node, val)
+	matched := len(sv.violations) == start
+	sv.violations = sv.violations[:start]
+
+	return matched, err
+}
+
+func (sv *schemaValidator) countMatches(nodes []*schemaNode, val bson.RawValue) (int, error) {
+	count := 0
+
+	for _, node := range nodes {
+		matched, err := sv.matches(node, val)
+		if err != nil {
+			return 0, err
+		}
+
+		if matched {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (sv *schemaValidator) validateEnum(node *schemaNode, val bson.RawValue) error {
+	if node.enum == nil {
+		return nil
+	}
+
+	// The enum’s values’ fields are already sorted.
+	val, err := withSortedFields(val)
+	if err != nil {
+		return fmt.Errorf("parsing %#q: %w", sv.path, err)
+	}
+
+	for _, allowed := range node.enum {
+		result, err := CompareValues(val, allowed)
+		if err != nil {
+			return fmt.Errorf("comparing %#q with enum: %w", sv.path, err)
+		}
+
+		if result == 0 {
+			return nil
+		}
+	}
+
+	sv.report("enum", "value is not among the enum’s values")
+
+	return nil
+}
+
+func (sv *schemaValidator) validateCombinators(node *schemaNode, val bson.RawValue) error {
+	for _, sub := range node.allOf {
+		if err := sv.validate(sub, val); err != nil {
+			return err
+		}
+	}
+
+	if node.anyOf != nil {
+		count, err := sv.countMatches(node.anyOf, val)
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			sv.report("anyOf", "value matches none of the anyOf schemas")
+		}
+	}
+
+	if node.oneOf != nil {
+		count, err := sv.countMatches(node.oneOf, val)
+		if err != nil {
+			return err
+		}
+
+		if count != 1 {
+			sv.report("oneOf", fmt.Sprintf("value matches %d of the oneOf schemas; expected 1", count))
+		}
+	}
+
+	if node.not != nil {
+		matched, err := sv.matches(node.not, val)
+		if err != nil {
+			return err
+		}
+
+		if matched {
+			sv.report("not", "value matches the not schema")
+		}
+	}
+
+	return nil
+}
+
+func (sv *schemaValidator) validateNumber(node *schemaNode, val bson.RawValue) error {
+	if minimum, ok := node.minimum.Get(); ok {
+		result, err := CompareValues(val, minimum)
+		if err != nil {
+			return fmt.Errorf("comparing %#q with minimum: %w", sv.path, err)
+		}
+
+		if result < 0 || (result == 0 && node.exclusiveMinimum) {
+			sv.report("minimum", "value is less than "+schemaBoundDescription(minimum, !node.exclusiveMinimum))
+		}
+	}
+
+	if maximum, ok := node.maximum.Get(); ok {
+		result, err := CompareValues(val, maximum)
+		if err != nil {
+			return fmt.Errorf("comparing %#q with maximum: %w", sv.path, err)
+		}
+
+		if result > 0 || (result == 0 && node.exclusiveMaximum) {
+			sv.report("maximum", "value is greater than "+schemaBoundDescription(maximum, !node.exclusiveMaximum))
+		}
+	}
+
+	return nil
+}
+
+func schemaBoundDescription(bound bson.RawValue, inclusive bool) string {
+	str := string(lo.Must(MarshalValueExtJSON(nil, bound, ExtJSONRelaxed)))
+
+	if inclusive {
+		return str
+	}
+
+	return "or equal to " + str
+}
+
+func (sv *schemaValidator) validateString(node *schemaNode, val bson.RawValue) error {
+	str, err := readStringBytes(val.Value)
+	if err != nil {
+		return fmt.Errorf("parsing %#q: %w", sv.path, err)
+	}
+
+	length := utf8.RuneCount(str)
+
+	if minLength, ok := node.minLength.Get(); ok && length < minLength {
+		sv.report("minLength", fmt.Sprintf("length is %d; minimum is %d", length, minLength))
+	}
+
+	if maxLength, ok := node.maxLength.Get(); ok && length > maxLength {
+		sv.report("maxLength", fmt.Sprintf("length is %d; maximum is %d", length, maxLength))
+	}
+
+	if node.pattern != nil && !node.pattern.Match(str) {
+		sv.report("pattern", fmt.Sprintf("value does not match %#q", node.pattern))
+	}
+
+	return nil
+}
+
+func (sv *schemaValidator) validateDocument(node *schemaNode, doc bson.Raw) error {
+	count := 0
+
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return fmt.Errorf("parsing %#q: %w", sv.path, err)
+		}
+
+		count++
+
+		sv.path = append(sv.path, el.Key())
+
+		propErr := sv.validateProperty(node, el.Key(), el.Value())
+		if propErr != nil {
+			return propErr
+		}
+
+		sv.path = sv.path[:len(sv.path)-1]
+	}
+
+	if minProperties, ok := node.minProperties.Get(); ok && count < minProperties {
+		sv.report("minProperties", fmt.Sprintf("document has %d fields; minimum is %d", count, minProperties))
+	}
+
+	if maxProperties, ok := node.maxProperties.Get(); ok && count > maxProperties {
+		sv.report("maxProperties", fmt.Sprintf("document has %d fields; maximum is %d", count, maxProperties))
+	}
+
+	for _, field := range node.required {
+		_, err := doc.LookupErr(field)
+
+		switch {
+		case errors.Is(err, bsoncore.ErrElementNotFound):
+			sv.path = append(sv.path, field)
+			sv.report("required", "required field is missing")
+			sv.path = sv.path[:len(sv.path)-1]
+		case err != nil:
+			return fmt.Errorf("parsing %#q: %w", sv.path, err)
+		}
+	}
+
+	return nil
+}
+
+// validateProperty checks a document’s field, which is the last element
+// of sv.path.
+func (sv *schemaValidator) validateProperty(node *schemaNode, field string, val bson.RawValue) error {
+	matched := false
+
+	if sub, ok := node.properties[field]; ok {
+		matched = true
+
+		if err := sv.validate(sub, val); err != nil {
+			return err
+		}
+	}
+
+	for _, pp := range node.patternProperties {
+		if !pp.re.MatchString(field) {
+			continue
+		}
+
+		matched = true
+
+		if err := sv.validate(pp.schema, val); err != nil {
+			return err
+		}
+	}
+
+	if matched {
+		return nil
+	}
+
+	return sv.validateAdditional(node.additionalProperties, "additionalProperties", val)
+}
+
+func (sv *schemaValidator) validateAdditional(
+	additional schemaAdditional,
+	keyword string,
+	val bson.RawValue,
+) error {
+	switch {
+	case additional.forbidden:
+		sv.report(keyword, "value is not allowed")
+	case additional.schema != nil:
+		return sv.validate(additional.schema, val)
+	}
+
+	return nil
+}
+
+func (sv *schemaValidator) validateArray(node *schemaNode, arr bson.RawArray) error {
+	elements, err := arr.Values()
+	if err != nil {
+		return fmt.Errorf("parsing %#q: %w", sv.path, err)
+	}
+
+	for i, el := range elements {
+		sv.path = append(sv.path, strconv.Itoa(i))
+
+		switch {
+		case node.items != nil:
+			err = sv.validate(node.items, el)
+		case i < len(node.tupleItems):
+			err = sv.validate(node.tupleItems[i], el)
+		case node.tupleItems != nil:
+			err = sv.validateAdditional(node.additionalItems, "additionalItems", el)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		sv.path = sv.path[:len(sv.path)-1]
+	}
+
+	if minItems, ok := node.minItems.Get(); ok && len(elements) < minItems {
+		sv.report("minItems", fmt.Sprintf("array has %d elements; minimum is %d", len(elements), minItems))
+	}
+
+	if maxItems, ok := node.maxItems.Get(); ok && len(elements) > maxItems {
+		sv.report("maxItems", fmt.Sprintf("array has %d elements; maximum is %d", len(elements), maxItems))
+	}
+
+	if node.uniqueItems {
+		return sv.validateUniqueItems(elements)
+	}
+
+	return nil
+}
+
+func (sv *schemaValidator) validateUniqueItems(elements []bson.RawValue) error {
+	elements = slices.Clone(elements)
+
+	for i, el := range elements {
+		var err error
+
+		elements[i], err = withSortedFields(el)
+		if err != nil {
+			return fmt.Errorf("parsing element %d of %#q: %w", i, sv.path, err)
+		}
+	}
+
+	for i := 1; i < len(elements); i++ {
+		for j := range i {
+			result, err := CompareValues(elements[j], elements[i])
+			if err != nil {
+				return fmt.Errorf("comparing elements of %#q: %w", sv.path, err)
+			}
+
+			if result == 0 {
+				sv.report("uniqueItems", fmt.Sprintf("elements %d and %d are equal", j, i))
+
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// withSortedFields returns a copy of a document or array with its embedded
+// documents’ fields sorted, recursively. Comparing such copies with
+// CompareValues ignores field order, as the server does for `enum` &
+// `uniqueItems`. Other values are returned as is.
+func withSortedFields(val bson.RawValue) (bson.RawValue, error) {
+	switch val.Type {
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+	default:
+		return val, nil
+	}
+
+	sorted := bson.RawValue{Type: val.Type, Value: slices.Clone(val.Value)}
+
+	if err := sortInPlaceInternal(sorted.Value, val.Type == bson.TypeArray); err != nil {
+		return bson.RawValue{}, err
+	}
+
+	return sorted, nil
+}
@@ -0,0 +1,294 @@
+package bsontools
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestJSONSchema(t *testing.T) {
+	schema, err := CompileJSONSchema(lo.Must(bson.Marshal(bson.D{
+		{"bsonType", "object"},
+		{"required", bson.A{"_id", "name"}},
+		{"properties", bson.D{
+			{"_id", bson.D{{"bsonType", "objectId"}}},
+			{"name", bson.D{{"bsonType", "string"}, {"minLength", 1}, {"maxLength", 5}}},
+			{"age", bson.D{
+				{"bsonType", bson.A{"int", "long"}},
+				{"minimum", 0},
+				{"maximum", 150},
+				{"exclusiveMaximum", true},
+			}},
+			{"score", bson.D{{"type", "number"}}},
+			{"status", bson.D{{"enum", bson.A{"active", "inactive", nil}}}},
+			{"code", bson.D{{"type", "string"}, {"pattern", "^[A-Z]{3}$"}}},
+			{"tags", bson.D{
+				{"bsonType", "array"},
+				{"items", bson.D{{"bsonType", "string"}}},
+				{"minItems", 1},
+				{"uniqueItems", true},
+			}},
+			{"point", bson.D{
+				{"bsonType", "array"},
+				{"items", bson.A{bson.D{{"type", "number"}}, bson.D{{"type", "number"}}}},
+				{"additionalItems", false},
+			}},
+			{"address", bson.D{
+				{"bsonType", "object"},
+				{"required", bson.A{"city"}},
+				{"properties", bson.D{{"city", bson.D{{"bsonType", "string"}}}}},
+				{"additionalProperties", false},
+			}},
+			{"contact", bson.D{{"oneOf", bson.A{
+				bson.D{{"bsonType", "string"}},
+				bson.D{{"bsonType", "object"}, {"required", bson.A{"email"}}},
+			}}}},
+		}},
+		{"patternProperties", bson.D{
+			{"^x_", bson.D{{"bsonType", "bool"}}},
+		}},
+	})))
+	require.NoError(t, err)
+
+	oid := bson.NewObjectID()
+
+	cases := []struct {
+		doc        bson.D
+		violations []SchemaViolation
+	}{
+		{
+			doc: bson.D{
+				{"_id", oid},
+				{"name", "José"},
+				{"age", int64(149)},
+				{"score", 1.5},
+				{"status", nil},
+				{"code", "ABC"},
+				{"tags", bson.A{"a", "b"}},
+				{"point", bson.A{int32(1), 2.5}},
+				{"address", bson.D{{"city", "Lima"}}},
+				{"contact", bson.D{{"email", "x@y"}}},
+				{"x_flag", true},
+				{"other", "anything"},
+			},
+		},
+		{
+			doc: bson.D{{"_id", "str"}},
+			violations: []SchemaViolation{
+				{Path: []string{"_id"}, Keyword: "bsonType"},
+				{Path: []string{"name"}, Keyword: "required"},
+			},
+		},
+		{
+			doc: bson.D{
+				{"_id", oid},
+				{"name", ""},
+				{"age", int32(150)},
+				{"score", "high"},
+				{"status", "gone"},
+				{"code", "abc"},
+			},
+			violations: []SchemaViolation{
+				{Path: []string{"name"}, Keyword: "minLength"},
+				{Path: []string{"age"}, Keyword: "maximum"},
+				{Path: []string{"score"}, Keyword: "type"},
+				{Path: []string{"status"}, Keyword: "enum"},
+				{Path: []string{"code"}, Keyword: "pattern"},
+			},
+		},
+		{
+			doc: bson.D{
+				{"_id", oid},
+				{"name", "abcdef"},
+				{"age", 3.0},
+				{"tags", bson.A{"a", int32(1), "a"}},
+			},
+			violations: []SchemaViolation{
+				{Path: []string{"name"}, Keyword: "maxLength"},
+				{Path: []string{"age"}, Keyword: "bsonType"},
+				{Path: []string{"tags", "1"}, Keyword: "bsonType"},
+				{Path: []string{"tags"}, Keyword: "uniqueItems"},
+			},
+		},
+		{
+			doc: bson.D{
+				{"_id", oid},
+				{"name", "n"},
+				{"age", int32(-1)},
+				{"tags", bson.A{}},
+				{"point", bson.A{int32(1), "2", int32(3)}},
+			},
+			violations: []SchemaViolation{
+				{Path: []string{"age"}, Keyword: "minimum"},
+				{Path: []string{"tags"}, Keyword: "minItems"},
+				{Path: []string{"point", "1"}, Keyword: "type"},
+				{Path: []string{"point", "2"}, Keyword: "additionalItems"},
+			},
+		},
+		{
+			doc: bson.D{
+				{"_id", oid},
+				{"name", "n"},
+				{"address", bson.D{{"zip", "12345"}}},
+				{"contact", int32(5)},
+				{"x_flag", "yes"},
+			},
+			violations: []SchemaViolation{
+				{Path: []string{"address", "zip"}, Keyword: "additionalProperties"},
+				{Path: []string{"address", "city"}, Keyword: "required"},
+				{Path: []string{"contact"}, Keyword: "oneOf"},
+				{Path: []string{"x_flag"}, Keyword: "bsonType"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		violations, validateErr := schema.Validate(lo.Must(bson.Marshal(c.doc)))
+		require.NoError(t, validateErr, "%v", c.doc)
+
+		for i := range violations {
+			assert.NotEmpty(t, violations[i].Reason, "%v", violations[i])
+			violations[i].Reason = ""
+		}
+
+		assert.Equal(t, c.violations, violations, "%v", c.doc)
+	}
+}
+
+func TestJSONSchema_Combinators(t *testing.T) {
+	schema, err := CompileJSONSchema(lo.Must(bson.Marshal(bson.D{
+		{"properties", bson.D{
+			{"a", bson.D{
+				{"allOf", bson.A{bson.D{{"type", "number"}}, bson.D{{"minimum", 10}}}},
+				{"not", bson.D{{"enum", bson.A{int32(13)}}}},
+			}},
+			{"b", bson.D{{"anyOf", bson.A{
+				bson.D{{"bsonType", "null"}},
+				bson.D{{"bsonType", "string"}, {"maxLength", 2}},
+			}}}},
+		}},
+		{"minProperties", 1},
+		{"maxProperties", 2},
+	})))
+	require.NoError(t, err)
+
+	cases := []struct {
+		doc      bson.D
+		keywords []string
+	}{
+		{doc: bson.D{{"a", int32(10)}, {"b", nil}}},
+		{doc: bson.D{{"b", "ab"}}},
+		{doc: bson.D{}, keywords: []string{"minProperties"}},
+		{doc: bson.D{{"a", int32(13)}}, keywords: []string{"not"}},
+		{doc: bson.D{{"a", int32(9)}}, keywords: []string{"minimum"}},
+		{doc: bson.D{{"a", "x"}}, keywords: []string{"type"}},
+		{doc: bson.D{{"b", "abc"}}, keywords: []string{"anyOf"}},
+		{doc: bson.D{{"a", 10.0}, {"b", nil}, {"c", 1}}, keywords: []string{"maxProperties"}},
+	}
+
+	for _, c := range cases {
+		violations, validateErr := schema.Validate(lo.Must(bson.Marshal(c.doc)))
+		require.NoError(t, validateErr, "%v", c.doc)
+
+		var keywords []string
+		for _, violation := range violations {
+			keywords = append(keywords, violation.Keyword)
+		}
+
+		assert.Equal(t, c.keywords, keywords, "%v", c.doc)
+	}
+}
+
+func TestJSONSchema_FieldOrder(t *testing.T) {
+	schema, err := CompileJSONSchema(lo.Must(bson.Marshal(bson.D{
+		{"properties", bson.D{
+			{"point", bson.D{{"enum", bson.A{
+				bson.D{{"a", int32(1)}, {"b", bson.D{{"c", int32(3)}, {"d", int32(4)}}}},
+			}}}},
+			{"points", bson.D{{"uniqueItems", true}}},
+		}},
+	})))
+	require.NoError(t, err)
+
+	cases := []struct {
+		doc      bson.D
+		keywords []string
+	}{
+		{doc: bson.D{{"point", bson.D{{"a", int32(1)}, {"b", bson.D{{"c", int32(3)}, {"d", int32(4)}}}}}}},
+		{doc: bson.D{{"point", bson.D{{"b", bson.D{{"d", int64(4)}, {"c", 3.0}}}, {"a", int32(1)}}}}},
+		{
+			doc:      bson.D{{"point", bson.D{{"b", bson.D{{"d", int32(4)}}}, {"a", int32(1)}}}},
+			keywords: []string{"enum"},
+		},
+		{doc: bson.D{{"points", bson.A{bson.D{{"a", 1}, {"b", 2}}, bson.D{{"a", 1}, {"b", 3}}}}}},
+		{
+			doc:      bson.D{{"points", bson.A{bson.D{{"a", 1}, {"b", 2}}, bson.D{{"b", 2}, {"a", 1}}}}},
+			keywords: []string{"uniqueItems"},
+		},
+		{
+			doc: bson.D{{"points", bson.A{
+				bson.A{bson.D{{"x", 1}, {"y", 2}}},
+				bson.A{bson.D{{"y", 2}, {"x", 1}}},
+			}}},
+			keywords: []string{"uniqueItems"},
+		},
+	}
+
+	for _, c := range cases {
+		doc := lo.Must(bson.Marshal(c.doc))
+		orig := slices.Clone(doc)
+
+		violations, validateErr := schema.Validate(doc)
+		require.NoError(t, validateErr, "%v", c.doc)
+		assert.Equal(t, orig, doc, "validation leaves the document unmodified")
+
+		var keywords []string
+		for _, violation := range violations {
+			keywords = append(keywords, violation.Keyword)
+		}
+
+		assert.Equal(t, c.keywords, keywords, "%v", c.doc)
+	}
+}
+
+func TestCompileJSONSchema_Errors(t *testing.T) {
+	cases := []struct {
+		schema bson.D
+		path   string
+	}{
+		{schema: bson.D{{"$ref", "#/definitions/x"}}, path: "$ref"},
+		{schema: bson.D{{"type", "integer"}}, path: "type"},
+		{schema: bson.D{{"bsonType", "nope"}}, path: "bsonType"},
+		{schema: bson.D{{"bsonType", "int"}, {"type", "number"}}, path: "type"},
+		{schema: bson.D{{"required", bson.A{}}}, path: "required"},
+		{schema: bson.D{{"required", bson.A{"a", "a"}}}, path: "required"},
+		{schema: bson.D{{"minLength", -1}}, path: "minLength"},
+		{schema: bson.D{{"minimum", "1"}}, path: "minimum"},
+		{schema: bson.D{{"exclusiveMinimum", true}}, path: "exclusiveMinimum"},
+		{schema: bson.D{{"pattern", "(a"}}, path: "pattern"},
+		{schema: bson.D{{"additionalProperties", "no"}}, path: "additionalProperties"},
+		{
+			schema: bson.D{{"properties", bson.D{{"a", bson.D{{"items", bson.A{1}}}}}}},
+			path:   "properties.a.items.0",
+		},
+		{
+			schema: bson.D{{"anyOf", bson.A{bson.D{}, bson.D{{"format", "email"}}}}},
+			path:   "anyOf.1.format",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := CompileJSONSchema(lo.Must(bson.Marshal(c.schema)))
+		require.Error(t, err, "%v", c.schema)
+
+		var schemaErr SchemaError
+		require.True(t, errors.As(err, &schemaErr), "%v: %v", c.schema, err)
+
+		assert.Equal(t, c.path, schemaErr.Path, "%v: %v", c.schema, err)
+	}
+}
@@ -0,0 +1,210 @@
+package bsontools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PathSyntaxError indicates that a document path could not be parsed.
+type PathSyntaxError struct {
+	// Path is the path as given.
+	Path string
+
+	// SegmentIndex is the 0-based index of the offending segment.
+	SegmentIndex int
+
+	// Segment is the offending segment as given (i.e., still escaped).
+	Segment string
+
+	// Reason describes what is wrong with the segment.
+	Reason string
+}
+
+func (pse PathSyntaxError) Error() string {
+	return fmt.Sprintf(
+		"invalid path %#q: segment %d (%#q) %s",
+		pse.Path,
+		pse.SegmentIndex,
+		pse.Segment,
+		pse.Reason,
+	)
+}
+
+// ParseDottedPath parses a MongoDB-style dotted path (e.g., `a.b.0.c`) into
+// a document pointer suitable for functions like ReplaceInRaw. Array indexes
+// are given as ordinary segments.
+//
+// Since dotted paths have no escaping, they cannot express field names that
+// contain “.”. Use ParseJSONPointer for such paths.
+//
+// Example usage:
+//
+//	pointer, err := ParseDottedPath(userPath)
+//	...
+//	rawDoc, found, err = RemoveFromRaw(rawDoc, pointer...)
+func ParseDottedPath(path string) ([]string, error) {
+	if path == "" {
+		return nil, PathSyntaxError{Path: path, Reason: "is empty"}
+	}
+
+	pointer := strings.Split(path, ".")
+
+	for i, segment := range pointer {
+		if problem := dottedSegmentProblem(segment); problem != "" {
+			return nil, PathSyntaxError{
+				Path:         path,
+				SegmentIndex: i,
+				Segment:      segment,
+				Reason:       problem,
+			}
+		}
+	}
+
+	return pointer, nil
+}
+
+// ParseJSONPointer parses an [RFC 6901] JSON Pointer (e.g., `/a/b/0/c`) into
+// a document pointer suitable for functions like ReplaceInRaw. It decodes
+// the `~0` & `~1` escapes, which denote “~” & “/” respectively.
+//
+// An empty string, which in RFC 6901 refers to the whole document, yields
+// an empty pointer.
+//
+// [RFC 6901]: https://www.rfc-editor.org/rfc/rfc6901
+func ParseJSONPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return []string{}, nil
+	}
+
+	if ptr[0] != '/' {
+		firstSegment, _, _ := strings.Cut(ptr, "/")
+
+		return nil, PathSyntaxError{
+			Path:    ptr,
+			Segment: firstSegment,
+			Reason:  "is not preceded by “/”",
+		}
+	}
+
+	rawSegments := strings.Split(ptr[1:], "/")
+	pointer := make([]string, len(rawSegments))
+
+	for i, rawSegment := range rawSegments {
+		segment, problem := unescapeJSONPointerSegment(rawSegment)
+		if problem == "" {
+			problem = jsonPointerSegmentProblem(segment)
+		}
+
+		if problem != "" {
+			return nil, PathSyntaxError{
+				Path:         ptr,
+				SegmentIndex: i,
+				Segment:      rawSegment,
+				Reason:       problem,
+			}
+		}
+
+		pointer[i] = segment
+	}
+
+	return pointer, nil
+}
+
+// FormatDottedPath is ParseDottedPath’s inverse. It returns an error if any
+// segment cannot be expressed in a dotted path.
+func FormatDottedPath(pointer []string) (string, error) {
+	if len(pointer) == 0 {
+		return "", fmt.Errorf("dotted paths cannot be empty")
+	}
+
+	for i, segment := range pointer {
+		problem := dottedSegmentProblem(segment)
+		if problem == "" && strings.Contains(segment, ".") {
+			problem = "contains “.”"
+		}
+
+		if problem != "" {
+			return "", fmt.Errorf("segment %d (%#q) %s", i, segment, problem)
+		}
+	}
+
+	return strings.Join(pointer, "."), nil
+}
+
+// FormatJSONPointer is ParseJSONPointer’s inverse.
+func FormatJSONPointer(pointer []string) string {
+	var sb strings.Builder
+
+	for _, segment := range pointer {
+		sb.WriteByte('/')
+		sb.WriteString(jsonPointerEscaper.Replace(segment))
+	}
+
+	return sb.String()
+}
+
+// formatPointerForDisplay renders a pointer in the notation that users are
+// likeliest to recognize: a dotted path if possible, or a JSON Pointer if not.
+func formatPointerForDisplay(pointer []string) string {
+	if dotted, err := FormatDottedPath(pointer); err == nil {
+		return dotted
+	}
+
+	return FormatJSONPointer(pointer)
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// unescapeJSONPointerSegment decodes a JSON Pointer segment. If the segment
+// is invalid, the returned string describes the problem.
+func unescapeJSONPointerSegment(rawSegment string) (string, string) {
+	if !strings.Contains(rawSegment, "~") {
+		return rawSegment, ""
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(rawSegment); i++ {
+		if rawSegment[i] != '~' {
+			sb.WriteByte(rawSegment[i])
+			continue
+		}
+
+		if i+1 == len(rawSegment) {
+			return "", "ends with an incomplete “~” escape"
+		}
+
+		i++
+
+		switch rawSegment[i] {
+		case '0':
+			sb.WriteByte('~')
+		case '1':
+			sb.WriteByte('/')
+		default:
+			return "", fmt.Sprintf("contains invalid escape “~%c”", rawSegment[i])
+		}
+	}
+
+	return sb.String(), ""
+}
+
+// dottedSegmentProblem describes why a segment is invalid in a dotted path,
+// or returns empty if the segment is valid.
+func dottedSegmentProblem(segment string) string {
+	if segment == "" {
+		return "is empty"
+	}
+
+	return jsonPointerSegmentProblem(segment)
+}
+
+// jsonPointerSegmentProblem is like dottedSegmentProblem but for JSON
+// Pointers, which (like BSON) allow empty field names.
+func jsonPointerSegmentProblem(segment string) string {
+	if strings.ContainsRune(segment, 0) {
+		return "contains NUL, which BSON field names forbid"
+	}
+
+	return ""
+}
@@ -0,0 +1,111 @@
+package bsontools
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParseDottedPath(t *testing.T) {
+	pointer, err := ParseDottedPath("a.b.0.c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "0", "c"}, pointer)
+
+	pointer, err = ParseDottedPath("a/b~c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/b~c"}, pointer)
+
+	for path, badSegment := range map[string]int{
+		"":        0,
+		".a":      0,
+		"a..b":    1,
+		"a.b.":    2,
+		"a.b\x00": 1,
+	} {
+		_, err := ParseDottedPath(path)
+
+		var pse PathSyntaxError
+		require.ErrorAs(t, err, &pse, "%#q", path)
+		assert.Equal(t, badSegment, pse.SegmentIndex, "%#q", path)
+		assert.Equal(t, path, pse.Path)
+	}
+}
+
+func TestParseJSONPointer(t *testing.T) {
+	for ptr, expected := range map[string][]string{
+		"":             {},
+		"/":            {""},
+		"/a/b/0/c":     {"a", "b", "0", "c"},
+		"/a~1b/c~0d":   {"a/b", "c~d"},
+		"/~01":         {"~1"},
+		"/a.b//c":      {"a.b", "", "c"},
+		"/x~1~1~0~0/y": {"x//~~", "y"},
+	} {
+		pointer, err := ParseJSONPointer(ptr)
+		require.NoError(t, err, "%#q", ptr)
+		assert.Equal(t, expected, pointer, "%#q", ptr)
+
+		assert.Equal(t, ptr, FormatJSONPointer(pointer), "round trip %#q", ptr)
+	}
+
+	for ptr, badSegment := range map[string]int{
+		"a/b":       0,
+		"/a/b~":     1,
+		"/a/b~2":    1,
+		"/a/b/\x00": 2,
+	} {
+		_, err := ParseJSONPointer(ptr)
+
+		var pse PathSyntaxError
+		require.ErrorAs(t, err, &pse, "%#q", ptr)
+		assert.Equal(t, badSegment, pse.SegmentIndex, "%#q", ptr)
+	}
+
+	_, err := ParseJSONPointer("/a/b~2/c")
+	assert.ErrorContains(t, err, "segment 1 (`b~2`)")
+	assert.ErrorContains(t, err, "~2")
+}
+
+func TestFormatDottedPath(t *testing.T) {
+	path, err := FormatDottedPath([]string{"a", "0", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, "a.0.b", path)
+
+	for _, pointer := range [][]string{
+		{},
+		{"a.b"},
+		{"a", ""},
+	} {
+		_, err := FormatDottedPath(pointer)
+		assert.Error(t, err, "%#q", pointer)
+	}
+}
+
+func TestPointerTooDeepError_Notation(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{
+		{"a", bson.D{{"b.c", int32(1)}}},
+		{"x", bson.D{{"y", int32(1)}}},
+	}))
+
+	pointer := lo.Must(ParseDottedPath("x.y.z"))
+
+	_, _, err := RemoveFromRaw(doc, pointer...)
+	assert.ErrorContains(t, err, "`x.y.z`")
+	assert.ErrorContains(t, err, "`x.y`")
+
+	pointer = lo.Must(ParseJSONPointer("/a/b.c/d"))
+
+	_, _, err = ReplaceInRaw(doc, ToRawValue("hey"), pointer...)
+	assert.ErrorContains(t, err, "`/a/b.c/d`")
+	assert.ErrorContains(t, err, "`/a/b.c`")
+}
+
+func TestReplaceInRaw_EmptyPointer(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{{"a", int32(1)}}))
+
+	_, _, err := ReplaceInRaw(doc, ToRawValue("hey"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,532 @@
+package bsontools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// ProjectionError indicates that a projection document is invalid or uses
+// unsupported features.
+type ProjectionError struct {
+	// Path is the dotted path of the offending projection field.
+	Path string
+
+	// Reason describes what is wrong.
+	Reason string
+}
+
+func (pe ProjectionError) Error() string {
+	return fmt.Sprintf("invalid projection at %#q: %s", pe.Path, pe.Reason)
+}
+
+type projectionOp int
+
+const (
+	projectInterior projectionOp = iota
+	projectInclude
+	projectExclude
+	projectSlice
+)
+
+type projectionNode struct {
+	op projectionOp
+
+	// children is only used for interior nodes.
+	children map[string]*projectionNode
+
+	// skip & limit are only used for $slice. If hasSkip is false, limit
+	// is $slice’s single argument, which may be negative.
+	skip, limit int
+	hasSkip     bool
+}
+
+// Projection applies a MongoDB find projection to raw BSON documents.
+// The following are supported, with the server’s semantics (as of 4.4):
+//   - inclusion & exclusion of fields, including `_id` handling
+//   - dotted & nested-document paths, which traverse arrays
+//   - `$slice`, with either one argument or `[skip, limit]`
+//
+// Other projection operators (e.g., `$elemMatch`, `$meta`, and positional
+// `$`) and computed fields are rejected.
+//
+// A Projection is safe for concurrent use.
+type Projection struct {
+	root      *projectionNode
+	inclusion bool
+}
+
+// NewProjection parses a projection document (e.g., `{_id: 0, "a.b": 1}`).
+// A failure to parse the document is returned as ProjectionError.
+func NewProjection[D ~[]byte](spec D) (*Projection, error) {
+	p := &Projection{
+		root: &projectionNode{children: map[string]*projectionNode{}},
+	}
+
+	var excluded string
+
+	err := p.parse(bson.Raw(spec), "", func(path string, op projectionOp) error {
+		// NB: The top-level _id may be included or excluded regardless of
+		// the projection’s type.
+		if path == "_id" {
+			return nil
+		}
+
+		switch op {
+		case projectInclude:
+			if excluded != "" {
+				return ProjectionError{
+					Path: path,
+					Reason: fmt.Sprintf(
+						"cannot include in exclusion projection (%#q is excluded)",
+						excluded,
+					),
+				}
+			}
+
+			p.inclusion = true
+		case projectExclude:
+			if p.inclusion {
+				return ProjectionError{
+					Path:   path,
+					Reason: "cannot exclude in inclusion projection",
+				}
+			}
+
+			excluded = path
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	idNode, hasID := p.root.children["_id"]
+
+	switch {
+	case !hasID && p.inclusion:
+		p.root.children["_id"] = &projectionNode{op: projectInclude}
+	case hasID && excluded == "" && idNode.op == projectInclude:
+		// As with the server, e.g., `{_id: 1}` is an inclusion projection.
+		p.inclusion = true
+	}
+
+	return p, nil
+}
+
+// parse adds a projection document’s fields to the tree. The given prefix
+// is the dotted path to the document. checkOp is called for each inclusion
+// & exclusion.
+func (p *Projection) parse(
+	spec bson.Raw,
+	prefix string,
+	checkOp func(string, projectionOp) error,
+) error {
+	for el, err := range RawElements(spec) {
+		if err != nil {
+			return fmt.Errorf("parsing projection at %#q: %w", prefix, err)
+		}
+
+		key, err := el.KeyErr()
+		if err != nil {
+			return fmt.Errorf("parsing projection at %#q: %w", prefix, err)
+		}
+
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		val, err := el.ValueErr()
+		if err != nil {
+			return fmt.Errorf("parsing projection at %#q: %w", path, err)
+		}
+
+		node, err := parseProjectionValue(val, path)
+		if err != nil {
+			return err
+		}
+
+		if node == nil {
+			// A nested projection document.
+			if err := p.parse(val.Document(), path, checkOp); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := checkOp(path, node.op); err != nil {
+			return err
+		}
+
+		if err := p.insert(path, node); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseProjectionValue parses a projection field’s value. It returns nil if
+// the value is a nested projection document.
+func parseProjectionValue(val bson.RawValue, path string) (*projectionNode, error) {
+	switch val.Type {
+	case bson.TypeBoolean:
+		return projectionBoolNode(val.Boolean()), nil
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble, bson.TypeDecimal128:
+		num, err := toNumericValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("parsing projection at %#q: %w", path, err)
+		}
+
+		return projectionBoolNode(num.isNaN || num.infSign != 0 || num.rat.Sign() != 0), nil
+	case bson.TypeEmbeddedDocument:
+		doc := val.Document()
+
+		first, err := doc.IndexErr(0)
+		if err != nil {
+			return nil, ProjectionError{Path: path, Reason: "empty nested projection"}
+		}
+
+		if !strings.HasPrefix(first.Key(), "$") {
+			return nil, nil
+		}
+
+		if first.Key() != "$slice" {
+			return nil, ProjectionError{
+				Path:   path,
+				Reason: fmt.Sprintf("unsupported operator %#q", first.Key()),
+			}
+		}
+
+		if count, _ := CountRawElements(doc); count != 1 {
+			return nil, ProjectionError{Path: path, Reason: "$slice must be the only field"}
+		}
+
+		return parseSliceArgs(first.Value(), path)
+	}
+
+	return nil, ProjectionError{
+		Path:   path,
+		Reason: fmt.Sprintf("unsupported projection value (BSON %s)", val.Type),
+	}
+}
+
+func projectionBoolNode(include bool) *projectionNode {
+	if include {
+		return &projectionNode{op: projectInclude}
+	}
+
+	return &projectionNode{op: projectExclude}
+}
+
+func parseSliceArgs(arg bson.RawValue, path string) (*projectionNode, error) {
+	if arg.Type != bson.TypeArray {
+		limit, ok := sliceArgToInt(arg)
+		if !ok {
+			return nil, ProjectionError{
+				Path:   path,
+				Reason: "$slice argument must be a number or an array",
+			}
+		}
+
+		return &projectionNode{op: projectSlice, limit: limit}, nil
+	}
+
+	args, err := arg.Array().Values()
+	if err != nil {
+		return nil, fmt.Errorf("parsing $slice at %#q: %w", path, err)
+	}
+
+	if len(args) != 2 {
+		return nil, ProjectionError{Path: path, Reason: "$slice array must have 2 elements"}
+	}
+
+	skip, skipOK := sliceArgToInt(args[0])
+	limit, limitOK := sliceArgToInt(args[1])
+
+	switch {
+	case !skipOK || !limitOK:
+		return nil, ProjectionError{Path: path, Reason: "$slice array elements must be numbers"}
+	case limit <= 0:
+		return nil, ProjectionError{Path: path, Reason: "$slice limit must be positive"}
+	}
+
+	return &projectionNode{op: projectSlice, skip: skip, limit: limit, hasSkip: true}, nil
+}
+
+// sliceArgToInt converts a $slice argument to an int. As with the server,
+// doubles are truncated.
+func sliceArgToInt(val bson.RawValue) (int, bool) {
+	switch val.Type {
+	case bson.TypeInt32:
+		return int(val.Int32()), true
+	case bson.TypeInt64:
+		return int(val.Int64()), true
+	case bson.TypeDouble:
+		f := val.Double()
+		if math.IsNaN(f) {
+			return 0, true
+		}
+
+		return int(max(math.MinInt32, min(math.MaxInt32, f))), true
+	}
+
+	return 0, false
+}
+
+// insert adds a leaf node at the given dotted path.
+func (p *Projection) insert(path string, leaf *projectionNode) error {
+	node := p.root
+	segments := strings.Split(path, ".")
+
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+			return ProjectionError{Path: path, Reason: "empty field name"}
+		case strings.HasPrefix(segment, "$"):
+			return ProjectionError{
+				Path:   path,
+				Reason: fmt.Sprintf("unsupported field name %#q", segment),
+			}
+		}
+
+		child, exists := node.children[segment]
+
+		if i == len(segments)-1 {
+			if exists {
+				return ProjectionError{Path: path, Reason: "path collision"}
+			}
+
+			node.children[segment] = leaf
+
+			return nil
+		}
+
+		if !exists {
+			child = &projectionNode{children: map[string]*projectionNode{}}
+			node.children[segment] = child
+		} else if child.op != projectInterior {
+			return ProjectionError{Path: path, Reason: "path collision"}
+		}
+
+		node = child
+	}
+
+	panic("unreachable")
+}
+
+// Apply applies the projection to a document and appends the result to
+// dst. It returns the projected document (i.e., the appended part of dst).
+//
+// The input document is not modified.
+func (p *Projection) Apply(dst, doc []byte) (bson.Raw, error) {
+	start := len(dst)
+
+	out, err := p.projectDocument(dst, doc, p.root)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.Raw(out[start:]), nil
+}
+
+func (p *Projection) projectDocument(out, doc []byte, node *projectionNode) ([]byte, error) {
+	remaining, err := elementsBlock(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	docAt := len(out)
+	out = append(out, 0, 0, 0, 0)
+
+	for len(remaining) > 0 {
+		var el bsoncore.Element
+		var ok bool
+
+		el, remaining, ok = bsoncore.ReadElement(remaining)
+		if !ok {
+			return nil, bsoncore.NewInsufficientBytesError(doc, remaining)
+		}
+
+		key := el.KeyBytes()
+
+		child, inSpec := node.children[string(key)]
+		if !inSpec {
+			if !p.inclusion {
+				out = append(out, el...)
+			}
+
+			continue
+		}
+
+		val, err := el.ValueErr()
+		if err != nil {
+			return nil, fmt.Errorf("parsing %#q: %w", key, err)
+		}
+
+		rawVal := bson.RawValue{Type: bson.Type(val.Type), Value: val.Data}
+
+		valAt := len(out)
+		out = append(out, byte(val.Type))
+		out = append(out, key...)
+		out = append(out, 0)
+
+		var keep bool
+
+		out, keep, err = p.projectValue(out, rawVal, child)
+		if err != nil {
+			return nil, fmt.Errorf("projecting %#q: %w", key, err)
+		}
+
+		if !keep {
+			out = out[:valAt]
+		}
+	}
+
+	out = append(out, 0)
+
+	return out, putDocLength(out, docAt)
+}
+
+// projectValue appends the projection of a value. It returns false if the
+// value should be omitted, in which case the output is unspecified.
+func (p *Projection) projectValue(
+	out []byte,
+	val bson.RawValue,
+	node *projectionNode,
+) ([]byte, bool, error) {
+	switch node.op {
+	case projectInclude:
+		return append(out, val.Value...), true, nil
+	case projectExclude:
+		return out, false, nil
+	}
+
+	switch val.Type {
+	case bson.TypeEmbeddedDocument:
+		if node.op == projectSlice {
+			return append(out, val.Value...), true, nil
+		}
+
+		out, err := p.projectDocument(out, val.Value, node)
+
+		return out, err == nil, err
+	case bson.TypeArray:
+		out, err := p.projectArray(out, val.Value, node)
+
+		return out, err == nil, err
+	}
+
+	// A scalar where the projection expects a document or array is kept only
+	// in exclusion projections. $slice leaves non-arrays unchanged.
+	if node.op == projectSlice || !p.inclusion {
+		return append(out, val.Value...), true, nil
+	}
+
+	return out, false, nil
+}
+
+// projectArray appends the projection of an array. Interior nodes apply to
+// each of the array’s elements; in inclusion projections, elements that are
+// neither documents nor arrays are omitted.
+func (p *Projection) projectArray(out, arr []byte, node *projectionNode) ([]byte, error) {
+	if node.op == projectSlice {
+		return appendSlicedArray(out, arr, node)
+	}
+
+	remaining, err := elementsBlock(arr)
+	if err != nil {
+		return nil, err
+	}
+
+	arrAt := len(out)
+	out = append(out, 0, 0, 0, 0)
+
+	index := 0
+
+	for len(remaining) > 0 {
+		var el bsoncore.Element
+		var ok bool
+
+		el, remaining, ok = bsoncore.ReadElement(remaining)
+		if !ok {
+			return nil, bsoncore.NewInsufficientBytesError(arr, remaining)
+		}
+
+		val, err := el.ValueErr()
+		if err != nil {
+			return nil, fmt.Errorf("parsing array element %#q: %w", el.Key(), err)
+		}
+
+		valAt := len(out)
+		out = append(out, byte(val.Type))
+		out = strconv.AppendInt(out, int64(index), 10)
+		out = append(out, 0)
+
+		var keep bool
+
+		out, keep, err = p.projectValue(
+			out,
+			bson.RawValue{Type: bson.Type(val.Type), Value: val.Data},
+			node,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("projecting array element %d: %w", index, err)
+		}
+
+		if keep {
+			index++
+		} else {
+			out = out[:valAt]
+		}
+	}
+
+	out = append(out, 0)
+
+	return out, putDocLength(out, arrAt)
+}
+
+func appendSlicedArray(out, arr []byte, node *projectionNode) ([]byte, error) {
+	values, err := bson.RawArray(arr).Values()
+	if err != nil {
+		return nil, err
+	}
+
+	var start, end int
+
+	switch {
+	case node.hasSkip:
+		start = node.skip
+		if start < 0 {
+			start = max(0, len(values)+start)
+		}
+
+		start = min(start, len(values))
+		end = min(len(values), start+node.limit)
+	case node.limit >= 0:
+		end = min(len(values), node.limit)
+	default:
+		start = max(0, len(values)+node.limit)
+		end = len(values)
+	}
+
+	arrAt := len(out)
+	out = append(out, 0, 0, 0, 0)
+
+	var keyBuf [20]byte
+
+	for i, val := range values[start:end] {
+		out = appendRawElement(out, strconv.AppendInt(keyBuf[:0], int64(i), 10), val)
+	}
+
+	out = append(out, 0)
+
+	return out, putDocLength(out, arrAt)
+}
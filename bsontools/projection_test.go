@@ -0,0 +1,194 @@
+package bsontools
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestProjection(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{
+		{"_id", int32(1)},
+		{"a", bson.D{{"b", "ab"}, {"c", "ac"}}},
+		{"arr", bson.A{
+			int32(1),
+			bson.D{{"b", "b0"}, {"c", "c0"}},
+			bson.A{bson.D{{"b", "nested"}}, "scalar"},
+			bson.D{{"c", "c3"}},
+		}},
+		{"nums", bson.A{int32(0), int32(1), int32(2), int32(3), int32(4)}},
+		{"s", "str"},
+	}))
+
+	cases := []struct {
+		projection bson.D
+		expected   bson.D
+	}{
+		{
+			projection: bson.D{},
+			expected: bson.D{
+				{"_id", int32(1)},
+				{"a", bson.D{{"b", "ab"}, {"c", "ac"}}},
+				{"arr", bson.A{
+					int32(1),
+					bson.D{{"b", "b0"}, {"c", "c0"}},
+					bson.A{bson.D{{"b", "nested"}}, "scalar"},
+					bson.D{{"c", "c3"}},
+				}},
+				{"nums", bson.A{int32(0), int32(1), int32(2), int32(3), int32(4)}},
+				{"s", "str"},
+			},
+		},
+		{
+			projection: bson.D{{"s", 1}},
+			expected:   bson.D{{"_id", int32(1)}, {"s", "str"}},
+		},
+		{
+			projection: bson.D{{"s", true}, {"_id", false}},
+			expected:   bson.D{{"s", "str"}},
+		},
+		{
+			projection: bson.D{{"_id", 1}},
+			expected:   bson.D{{"_id", int32(1)}},
+		},
+		{
+			projection: bson.D{{"_id", 0}},
+			expected: bson.D{
+				{"a", bson.D{{"b", "ab"}, {"c", "ac"}}},
+				{"arr", bson.A{
+					int32(1),
+					bson.D{{"b", "b0"}, {"c", "c0"}},
+					bson.A{bson.D{{"b", "nested"}}, "scalar"},
+					bson.D{{"c", "c3"}},
+				}},
+				{"nums", bson.A{int32(0), int32(1), int32(2), int32(3), int32(4)}},
+				{"s", "str"},
+			},
+		},
+		{
+			projection: bson.D{{"a.b", 1}, {"arr.b", 1}, {"s.x", 1}},
+			expected: bson.D{
+				{"_id", int32(1)},
+				{"a", bson.D{{"b", "ab"}}},
+				{"arr", bson.A{
+					bson.D{{"b", "b0"}},
+					bson.A{bson.D{{"b", "nested"}}},
+					bson.D{},
+				}},
+			},
+		},
+		{
+			projection: bson.D{{"a", bson.D{{"c", 1}}}},
+			expected:   bson.D{{"_id", int32(1)}, {"a", bson.D{{"c", "ac"}}}},
+		},
+		{
+			projection: bson.D{{"a.b", 0}, {"arr.c", 0}, {"nums", 0}, {"s.x", 0}},
+			expected: bson.D{
+				{"_id", int32(1)},
+				{"a", bson.D{{"c", "ac"}}},
+				{"arr", bson.A{
+					int32(1),
+					bson.D{{"b", "b0"}},
+					bson.A{bson.D{{"b", "nested"}}, "scalar"},
+					bson.D{},
+				}},
+				{"s", "str"},
+			},
+		},
+		{
+			projection: bson.D{{"nums", bson.D{{"$slice", 2}}}, {"_id", 0}, {"a", 0}, {"arr", 0}},
+			expected: bson.D{
+				{"nums", bson.A{int32(0), int32(1)}},
+				{"s", "str"},
+			},
+		},
+		{
+			projection: bson.D{{"nums", bson.D{{"$slice", -2}}}, {"s", 1}},
+			expected: bson.D{
+				{"_id", int32(1)},
+				{"nums", bson.A{int32(3), int32(4)}},
+				{"s", "str"},
+			},
+		},
+		{
+			projection: bson.D{{"nums", bson.D{{"$slice", bson.A{-3, 2}}}}, {"_id", 0}, {"s", 1}},
+			expected: bson.D{
+				{"nums", bson.A{int32(2), int32(3)}},
+				{"s", "str"},
+			},
+		},
+		{
+			projection: bson.D{
+				{"nums", bson.D{{"$slice", bson.A{4, 10}}}},
+				{"s", bson.D{{"$slice", 1}}},
+				{"_id", 0},
+				{"arr", 0},
+				{"a", 0},
+			},
+			expected: bson.D{
+				{"nums", bson.A{int32(4)}},
+				{"s", "str"},
+			},
+		},
+		{
+			projection: bson.D{
+				{"arr.b", bson.D{{"$slice", 1}}},
+				{"_id", 0},
+				{"a", 0},
+				{"nums", 0},
+				{"s", 0},
+			},
+			expected: bson.D{
+				{"arr", bson.A{
+					int32(1),
+					bson.D{{"b", "b0"}, {"c", "c0"}},
+					bson.A{bson.D{{"b", "nested"}}, "scalar"},
+					bson.D{{"c", "c3"}},
+				}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		spec := lo.Must(bson.Marshal(c.projection))
+
+		proj, err := NewProjection(spec)
+		require.NoError(t, err, "%v", c.projection)
+
+		prefix := []byte("prefix")
+
+		got, err := proj.Apply(prefix, doc)
+		require.NoError(t, err, "%v", c.projection)
+
+		assert.Equal(t, bson.Raw(lo.Must(bson.Marshal(c.expected))), got, "%v", c.projection)
+	}
+}
+
+func TestProjection_Errors(t *testing.T) {
+	cases := []bson.D{
+		{{"a", 1}, {"b", 0}},
+		{{"a", 0}, {"b", 1}},
+		{{"a", 1}, {"a.b", 1}},
+		{{"a.b", 1}, {"a", 1}},
+		{{"a", bson.D{}}},
+		{{"a", bson.D{{"$elemMatch", bson.D{}}}}},
+		{{"a", bson.D{{"$slice", "x"}}}},
+		{{"a", bson.D{{"$slice", bson.A{1, 0}}}}},
+		{{"a", bson.D{{"$slice", bson.A{1}}}}},
+		{{"a.$", 1}},
+		{{"a..b", 1}},
+		{{"a", "literal"}},
+	}
+
+	for _, spec := range cases {
+		_, err := NewProjection(lo.Must(bson.Marshal(spec)))
+		require.Error(t, err, "%v", spec)
+
+		var projErr ProjectionError
+		assert.True(t, errors.As(err, &projErr), "%v: %v", spec, err)
+	}
+}
@@ -33,6 +33,10 @@ type unmarshalTargets interface {
 		// (because we don’t have to parse a Go `any` value when casting).
 		bson.CodeWithScope |
 
+		// This works for casting but not for marshaling (because a zero
+		// bson.Vector has no dtype).
+		bson.Vector |
+
 		// Convenience:
 		time.Time
 }
@@ -99,26 +103,31 @@ func RawValueToBinary(in bson.RawValue) (bson.Binary, error) {
 // rather than allocating a new string.
 func RawValueToStringBytes(in bson.RawValue) ([]byte, error) {
 	if in.Type == bson.TypeString {
+		return readStringBytes(in.Value)
+	}
 
-		// length + trailing NUL
-		if len(in.Value) < 5 {
-			return nil, fmt.Errorf("too few bytes (%d) in BSON string", len(in.Value))
-		}
+	return nil, fmt.Errorf("expected BSON %s but found %s", bson.TypeString, in.Type)
+}
 
-		strlen := binary.LittleEndian.Uint32(in.Value)
+// readStringBytes parses a BSON string’s encoded value (i.e., length header,
+// content, and trailing NUL). Symbols and JavaScript code share this layout.
+func readStringBytes(value []byte) ([]byte, error) {
+	// length + trailing NUL
+	if len(value) < 5 {
+		return nil, fmt.Errorf("too few bytes (%d) in BSON string", len(value))
+	}
 
-		if len(in.Value)-4 != int(strlen) {
-			return nil, fmt.Errorf(
-				"BSON string header says %d bytes but found %d",
-				strlen,
-				len(in.Value),
-			)
-		}
+	strlen := binary.LittleEndian.Uint32(value)
 
-		return in.Value[4 : len(in.Value)-1], nil
+	if len(value)-4 != int(strlen) {
+		return nil, fmt.Errorf(
+			"BSON string header says %d bytes but found %d",
+			strlen,
+			len(value),
+		)
 	}
 
-	return nil, fmt.Errorf("expected BSON %s but found %s", bson.TypeString, in.Type)
+	return value[4 : len(value)-1], nil
 }
 
 // RawValueTo is a bit like bson.UnmarshalValue, but it’s much faster because
@@ -160,6 +169,11 @@ func RawValueTo[T unmarshalTargets](in bson.RawValue) (T, error) {
 				Data:    buf,
 			}).(T), nil
 		}
+	case bson.Vector:
+		if in.Type == bson.TypeBinary {
+			vec, err := RawValueToVector(in)
+			return any(vec).(T), err
+		}
 	case bson.Undefined:
 		if in.Type == bson.TypeUndefined {
 			return any(zero).(T), nil
@@ -0,0 +1,184 @@
+package bsontools
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RenameInRaw “surgically” renames a field in a BSON document. The field
+// keeps its position in its enclosing document, and all other bytes (aside
+// from enclosing length headers) stay the same. Its returned bool indicates
+// whether the field was found.
+//
+// As with the server’s `$rename`, if the enclosing document already contains
+// a field named newName, that field is removed.
+//
+// Array elements cannot be renamed. A nonfinal pointer node that is a scalar
+// value causes a PointerTooDeepError.
+//
+// Example usage (renames /role/title to /role/jobTitle):
+//
+//	rawDoc, found, err = RenameInRaw(rawDoc, "jobTitle", "role", "title")
+func RenameInRaw[T ~[]byte](raw T, newName string, pointer ...string) (T, bool, error) {
+	if len(pointer) == 0 {
+		return nil, false, fmt.Errorf("document pointer must not be empty")
+	}
+
+	if strings.ContainsRune(newName, 0) {
+		return nil, false, fmt.Errorf("new field name (%#q) contains NUL", newName)
+	}
+
+	buf := []byte(raw)
+	oldName := pointer[len(pointer)-1]
+
+	docAts, parentType, found, err := locateParentDocuments(buf, pointer)
+	if err != nil || !found {
+		return raw, false, err
+	}
+
+	if parentType == bson.TypeArray {
+		return nil, false, fmt.Errorf(
+			"cannot rename %#q because it is an array element",
+			formatPointerForDisplay(pointer),
+		)
+	}
+
+	parentAt := docAts[len(docAts)-1]
+
+	info, _, found, err := locateElement(buf, parentAt, oldName)
+	if err != nil || !found {
+		return raw, false, err
+	}
+
+	if oldName == newName {
+		return raw, true, nil
+	}
+
+	delta := len(newName) - len(oldName)
+
+	// Remove any preexisting field with the new name.
+	clobbered, _, clobberedFound, err := locateElement(buf, parentAt, newName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if clobberedFound {
+		clobberedEnd := clobbered.valueAt + clobbered.valueSize
+		buf = slices.Delete(buf, clobbered.pos, clobberedEnd)
+		delta -= clobberedEnd - clobbered.pos
+
+		if clobbered.pos < info.pos {
+			info.pos -= clobberedEnd - clobbered.pos
+		}
+	}
+
+	keyAt := info.pos + 1
+	buf = slices.Replace(buf, keyAt, keyAt+len(oldName), []byte(newName)...)
+
+	for _, docAt := range docAts {
+		if err := addToDocLength(buf, docAt, delta); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return T(buf), true, nil
+}
+
+// MoveInRaw moves a value from one location in a BSON document to another.
+// This is equivalent to RemoveFromRaw on the source followed by SetInRaw on
+// the destination; thus, like the server’s `$rename`, it puts the value at
+// the end of its new enclosing document and creates any needed intermediate
+// documents. Use RenameInRaw to rename a field without moving it.
+//
+// The returned bool indicates whether the source value was found. If it was
+// not, or if the destination is invalid, the document is left unchanged.
+//
+// Example usage (moves /role/title to /title):
+//
+//	rawDoc, found, err = MoveInRaw(rawDoc, []string{"role", "title"}, []string{"title"})
+func MoveInRaw[T ~[]byte](raw T, from, to []string) (T, bool, error) {
+	if len(from) == 0 || len(to) == 0 {
+		return nil, false, fmt.Errorf("document pointers must not be empty")
+	}
+
+	shorter := min(len(from), len(to))
+	if slices.Equal(from[:shorter], to[:shorter]) {
+		return nil, false, fmt.Errorf(
+			"cannot move %#q to %#q because one contains the other",
+			formatPointerForDisplay(from),
+			formatPointerForDisplay(to),
+		)
+	}
+
+	docAts, _, found, err := locateParentDocuments(raw, from)
+	if err != nil || !found {
+		return raw, false, err
+	}
+
+	info, _, found, err := locateElement(raw, docAts[len(docAts)-1], from[len(from)-1])
+	if err != nil || !found {
+		return raw, false, err
+	}
+
+	// RemoveFromRaw edits the buffer in place, so ensure that SetInRaw
+	// will succeed before removing anything.
+	if err := checkSetPointer(raw, to); err != nil {
+		return nil, false, err
+	}
+
+	// NB: We copy the value since we’re about to alter the document buffer.
+	val := bson.RawValue{
+		Type:  info.bsonType,
+		Value: slices.Clone(raw[info.valueAt : info.valueAt+info.valueSize]),
+	}
+
+	raw, found, err = RemoveFromRaw(raw, from...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !found {
+		return raw, false, nil
+	}
+
+	raw, err = SetInRaw(raw, val, to...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return raw, true, nil
+}
+
+// locateParentDocuments finds the embedded documents (or arrays) that
+// enclose the given pointer’s referent. It returns their offsets—starting
+// with the top-level document’s (i.e., 0)—and the BSON type of the last one.
+func locateParentDocuments[T ~[]byte](
+	buf T,
+	pointer []string,
+) ([]int, bson.Type, bool, error) {
+	docAts := []int{0}
+	docType := bson.TypeEmbeddedDocument
+
+	for i, segment := range pointer[:len(pointer)-1] {
+		info, _, found, err := locateElement(buf, docAts[len(docAts)-1], segment)
+		if err != nil || !found {
+			return nil, 0, false, err
+		}
+
+		if info.bsonType != bson.TypeEmbeddedDocument && info.bsonType != bson.TypeArray {
+			return nil, 0, false, PointerTooDeepError{
+				givenPointer:   slices.Clone(pointer),
+				elementType:    info.bsonType,
+				elementPointer: slices.Clone(pointer[:i+1]),
+			}
+		}
+
+		docAts = append(docAts, info.valueAt)
+		docType = info.bsonType
+	}
+
+	return docAts, docType, true, nil
+}
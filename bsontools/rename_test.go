@@ -0,0 +1,139 @@
+package bsontools
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRenameInRaw(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"role", bson.D{
+			{"jobTitle", "old"},
+			{"title", "engineer"},
+			{"level", int32(3)},
+		}},
+		{"z", true},
+	}))
+
+	raw, found, err := RenameInRaw(raw, "jobTitle", "role", "title")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	expected := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"role", bson.D{
+			{"jobTitle", "engineer"},
+			{"level", int32(3)},
+		}},
+		{"z", true},
+	}))
+	assert.Equal(t, bson.Raw(expected), bson.Raw(raw))
+
+	raw, found, err = RenameInRaw(raw, "aLongerName", "a")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	expected = lo.Must(bson.Marshal(bson.D{
+		{"aLongerName", int32(1)},
+		{"role", bson.D{
+			{"jobTitle", "engineer"},
+			{"level", int32(3)},
+		}},
+		{"z", true},
+	}))
+	assert.Equal(t, bson.Raw(expected), bson.Raw(raw))
+
+	orig := bytes.Clone(raw)
+
+	raw, found, err = RenameInRaw(raw, "x", "role", "missing")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, orig, raw)
+}
+
+func TestRenameInRaw_Errors(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"arr", bson.A{int32(1)}},
+	}))
+
+	_, _, err := RenameInRaw(raw, "x", "arr", "0")
+	assert.ErrorContains(t, err, "array element")
+
+	_, _, err = RenameInRaw(raw, "x", "a", "b")
+	assert.ErrorAs(t, err, &PointerTooDeepError{})
+
+	_, _, err = RenameInRaw(raw, "x\x00", "a")
+	assert.ErrorContains(t, err, "NUL")
+}
+
+func TestMoveInRaw(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"role", bson.D{
+			{"title", "engineer"},
+			{"level", int32(3)},
+		}},
+		{"z", true},
+	}))
+
+	raw, found, err := MoveInRaw(raw, []string{"role", "title"}, []string{"meta", "title"})
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	expected := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"role", bson.D{
+			{"level", int32(3)},
+		}},
+		{"z", true},
+		{"meta", bson.D{{"title", "engineer"}}},
+	}))
+	assert.Equal(t, bson.Raw(expected), bson.Raw(raw))
+
+	raw, found, err = MoveInRaw(raw, []string{"a"}, []string{"z"})
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	expected = lo.Must(bson.Marshal(bson.D{
+		{"role", bson.D{
+			{"level", int32(3)},
+		}},
+		{"z", int32(1)},
+		{"meta", bson.D{{"title", "engineer"}}},
+	}))
+	assert.Equal(t, bson.Raw(expected), bson.Raw(raw))
+
+	orig := bytes.Clone(raw)
+
+	raw, found, err = MoveInRaw(raw, []string{"nope"}, []string{"b"})
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, orig, raw)
+
+	_, _, err = MoveInRaw(raw, []string{"role"}, []string{"role", "sub"})
+	assert.ErrorContains(t, err, "contains")
+
+	// A failed move leaves the input as it was.
+	raw = lo.Must(bson.Marshal(bson.D{
+		{"s", "x"},
+		{"a", int32(1)},
+		{"b", int32(2)},
+		{"arr", bson.A{"y"}},
+	}))
+	orig = bytes.Clone(raw)
+
+	_, _, err = MoveInRaw(raw, []string{"a"}, []string{"b", "c"})
+	assert.ErrorAs(t, err, &PointerTooDeepError{})
+	assert.Equal(t, orig, raw, "move under a scalar")
+
+	_, _, err = MoveInRaw(raw, []string{"a"}, []string{"arr", "x"})
+	assert.ErrorContains(t, err, "array index")
+	assert.Equal(t, orig, raw, "move to a non-index key of an array")
+}
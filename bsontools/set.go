@@ -0,0 +1,279 @@
+package bsontools
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/ccoveille/go-safecast/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// SetInRaw is like ReplaceInRaw, but if the pointer’s referent is missing,
+// SetInRaw creates it, along with any missing intermediate documents. This
+// mimics the server’s `$set` update operator:
+//   - New fields go at the end of their enclosing document.
+//   - Missing intermediate nodes are created as embedded documents, even if
+//     their names are numeric.
+//   - Setting an index past the end of an existing array pads the array
+//     with nulls.
+//
+// Bytes outside the edited element (and the enclosing length headers) are
+// left as they were.
+//
+// If any nonfinal node in the pointer is a scalar value, a
+// PointerTooDeepError is returned. A non-index pointer segment into an array
+// is also an error.
+//
+// Example usage (sets /role/title, creating /role if needed):
+//
+//	rawDoc, err = SetInRaw(rawDoc, newRoleTitle, "role", "title")
+func SetInRaw[T ~[]byte](raw T, value bson.RawValue, pointer ...string) (T, error) {
+	if len(pointer) == 0 {
+		return nil, fmt.Errorf("document pointer must not be empty")
+	}
+
+	buf, _, err := setInDocAt([]byte(raw), 0, false, value, pointer)
+	if err != nil {
+		var pe PointerTooDeepError
+		if errors.As(err, &pe) {
+			return nil, pe
+		}
+
+		return nil, fmt.Errorf("setting %#q: %w", formatPointerForDisplay(pointer), err)
+	}
+
+	return T(buf), nil
+}
+
+// checkSetPointer checks, without editing the document, that SetInRaw can
+// set a value at the given pointer. It returns the error that SetInRaw
+// would.
+func checkSetPointer[T ~[]byte](raw T, pointer []string) error {
+	docAt, isArray := 0, false
+
+	for i, segment := range pointer {
+		info, _, found, err := locateElement(raw, docAt, segment)
+		if err != nil {
+			return fmt.Errorf("setting %#q: %w", formatPointerForDisplay(pointer), err)
+		}
+
+		if !found {
+			// SetInRaw creates the rest of the pointer’s nodes, which
+			// fails only if the first is a non-index key into an array.
+			if isArray {
+				if _, err := parseArrayIndex(segment); err != nil {
+					return fmt.Errorf("setting %#q: %w", formatPointerForDisplay(pointer), err)
+				}
+			}
+
+			return nil
+		}
+
+		if i == len(pointer)-1 {
+			return nil
+		}
+
+		if info.bsonType != bson.TypeEmbeddedDocument && info.bsonType != bson.TypeArray {
+			return PointerTooDeepError{
+				givenPointer:   slices.Clone(pointer),
+				elementType:    info.bsonType,
+				elementPointer: slices.Clone(pointer[:i+1]),
+			}
+		}
+
+		docAt, isArray = info.valueAt, info.bsonType == bson.TypeArray
+	}
+
+	return nil
+}
+
+// setInDocAt sets a value in the document (or array) that starts at the
+// given offset. It returns the updated buffer and the change in its length.
+func setInDocAt(
+	buf []byte,
+	docAt int,
+	isArray bool,
+	value bson.RawValue,
+	pointer []string,
+) ([]byte, int, error) {
+	info, elsCount, found, err := locateElement(buf, docAt, pointer[0])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var delta int
+
+	switch {
+	case found && len(pointer) == 1:
+		buf[info.pos] = byte(value.Type)
+		buf = slices.Replace(buf, info.valueAt, info.valueAt+info.valueSize, value.Value...)
+		delta = len(value.Value) - info.valueSize
+	case found:
+		if info.bsonType != bson.TypeEmbeddedDocument && info.bsonType != bson.TypeArray {
+			return nil, 0, PointerTooDeepError{
+				givenPointer:   slices.Clone(pointer),
+				elementType:    info.bsonType,
+				elementPointer: slices.Clone(pointer[:1]),
+			}
+		}
+
+		buf, delta, err = setInDocAt(
+			buf,
+			info.valueAt,
+			info.bsonType == bson.TypeArray,
+			value,
+			pointer[1:],
+		)
+		if err != nil {
+			return nil, 0, prependPointerToErr(err, pointer[0])
+		}
+	default:
+		newEls, err := buildMissingElements(isArray, elsCount, value, pointer)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		docEnd := docAt + int(binary.LittleEndian.Uint32(buf[docAt:])) - 1
+		buf = slices.Insert(buf, docEnd, newEls...)
+		delta = len(newEls)
+	}
+
+	if err := addToDocLength(buf, docAt, delta); err != nil {
+		return nil, 0, err
+	}
+
+	return buf, delta, nil
+}
+
+// locateElement finds the first element with the given key in the document
+// at the given offset. If the key is absent, the returned count is the
+// document’s number of elements.
+func locateElement[T ~[]byte](buf T, docAt int, key string) (elementInfo, int, bool, error) {
+	docLen, _, ok := bsoncore.ReadLength(buf[docAt:])
+	if !ok || docLen < 5 || docAt+int(docLen) > len(buf) {
+		return elementInfo{}, 0, false, fmt.Errorf("invalid BSON document at offset %d", docAt)
+	}
+
+	docEnd := docAt + int(docLen) - 1
+	count := 0
+
+	for pos := docAt + 4; pos < docEnd; count++ {
+		el, _, ok := bsoncore.ReadElement([]byte(buf[pos:docEnd]))
+		if !ok {
+			return elementInfo{}, 0, false, fmt.Errorf("invalid BSON element at offset %d", pos)
+		}
+
+		keyBytes := el.KeyBytes()
+
+		if string(keyBytes) == key {
+			return elementInfo{
+				pos:       pos,
+				valueAt:   pos + 1 + len(keyBytes) + 1,
+				valueSize: len(el) - len(keyBytes) - 2,
+				keyBytes:  keyBytes,
+				bsonType:  bson.Type(el[0]),
+			}, count, true, nil
+		}
+
+		pos += len(el)
+	}
+
+	return elementInfo{}, count, false, nil
+}
+
+// buildMissingElements creates the element(s) to add to a document that
+// lacks pointer[0]. If the document is an array, this includes any needed
+// null padding.
+func buildMissingElements(
+	isArray bool,
+	elsCount int,
+	value bson.RawValue,
+	pointer []string,
+) ([]byte, error) {
+	var buf []byte
+
+	if isArray {
+		idx, err := parseArrayIndex(pointer[0])
+		if err != nil {
+			return nil, err
+		}
+
+		for i := elsCount; i < idx; i++ {
+			buf = bsoncore.AppendNullElement(buf, strconv.Itoa(i))
+		}
+	}
+
+	return appendNestedElement(buf, value, pointer)
+}
+
+// appendNestedElement appends a {p0: {p1: {…: value}}} element to the buffer.
+func appendNestedElement(buf []byte, value bson.RawValue, pointer []string) ([]byte, error) {
+	if len(pointer) == 1 {
+		return bsoncore.AppendValueElement(buf, pointer[0], bsoncore.Value{
+			Type: bsoncore.Type(value.Type),
+			Data: value.Value,
+		}), nil
+	}
+
+	buf = bsoncore.AppendHeader(buf, bsoncore.TypeEmbeddedDocument, pointer[0])
+	docAt := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+
+	buf, err := appendNestedElement(buf, value, pointer[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	buf = append(buf, 0)
+
+	return buf, addToDocLength(buf, docAt, len(buf)-docAt)
+}
+
+// parseArrayIndex parses an array key, which must be a non-negative decimal
+// integer without superfluous leading zeros.
+func parseArrayIndex(key string) (int, error) {
+	idx, err := strconv.Atoi(key)
+	if err != nil || idx < 0 || strconv.Itoa(idx) != key {
+		return 0, fmt.Errorf("%#q is not a valid array index", key)
+	}
+
+	return idx, nil
+}
+
+// addToDocLength adds a delta to the length header of the document at the
+// given offset.
+func addToDocLength(buf []byte, docAt int, delta int) error {
+	oldLen := int(binary.LittleEndian.Uint32(buf[docAt:]))
+
+	newLen, err := safecast.Convert[uint32](oldLen + delta)
+	if err == nil && newLen > math.MaxInt32 {
+		err = fmt.Errorf("%d exceeds BSON maximum", newLen)
+	}
+
+	if err != nil {
+		return fmt.Errorf("new document length: %w", err)
+	}
+
+	binary.LittleEndian.PutUint32(buf[docAt:], newLen)
+
+	return nil
+}
+
+// prependPointerToErr adds a pointer segment to a PointerTooDeepError so that
+// it reflects the full pointer. Other errors are returned as-is.
+func prependPointerToErr(err error, segment string) error {
+	var pe PointerTooDeepError
+	if errors.As(err, &pe) {
+		pe.givenPointer = append([]string{segment}, pe.givenPointer...)
+		pe.elementPointer = append([]string{segment}, pe.elementPointer...)
+
+		return pe
+	}
+
+	return err
+}
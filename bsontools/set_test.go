@@ -0,0 +1,140 @@
+package bsontools
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestSetInRaw(t *testing.T) {
+	in := bson.D{
+		{"a", int32(1)},
+		{"sub", bson.D{{"x", "y"}}},
+		{"arr", bson.A{"zero", bson.D{{"k", "v"}}}},
+		{"z", true},
+	}
+
+	cases := []struct {
+		pointer []string
+		value   any
+		expect  bson.D
+	}{
+		{
+			pointer: []string{"a"},
+			value:   "replaced",
+			expect: bson.D{
+				{"a", "replaced"},
+				{"sub", bson.D{{"x", "y"}}},
+				{"arr", bson.A{"zero", bson.D{{"k", "v"}}}},
+				{"z", true},
+			},
+		},
+		{
+			pointer: []string{"new"},
+			value:   int64(3),
+			expect: bson.D{
+				{"a", int32(1)},
+				{"sub", bson.D{{"x", "y"}}},
+				{"arr", bson.A{"zero", bson.D{{"k", "v"}}}},
+				{"z", true},
+				{"new", int64(3)},
+			},
+		},
+		{
+			pointer: []string{"sub", "new"},
+			value:   bson.D{{"deep", true}},
+			expect: bson.D{
+				{"a", int32(1)},
+				{"sub", bson.D{{"x", "y"}, {"new", bson.D{{"deep", true}}}}},
+				{"arr", bson.A{"zero", bson.D{{"k", "v"}}}},
+				{"z", true},
+			},
+		},
+		{
+			pointer: []string{"p", "q", "0", "r"},
+			value:   "made",
+			expect: bson.D{
+				{"a", int32(1)},
+				{"sub", bson.D{{"x", "y"}}},
+				{"arr", bson.A{"zero", bson.D{{"k", "v"}}}},
+				{"z", true},
+				{"p", bson.D{{"q", bson.D{{"0", bson.D{{"r", "made"}}}}}}},
+			},
+		},
+		{
+			pointer: []string{"arr", "1", "k2"},
+			value:   "v2",
+			expect: bson.D{
+				{"a", int32(1)},
+				{"sub", bson.D{{"x", "y"}}},
+				{"arr", bson.A{"zero", bson.D{{"k", "v"}, {"k2", "v2"}}}},
+				{"z", true},
+			},
+		},
+		{
+			pointer: []string{"arr", "4"},
+			value:   "four",
+			expect: bson.D{
+				{"a", int32(1)},
+				{"sub", bson.D{{"x", "y"}}},
+				{"arr", bson.A{"zero", bson.D{{"k", "v"}}, nil, nil, "four"}},
+				{"z", true},
+			},
+		},
+		{
+			pointer: []string{"arr", "2", "x"},
+			value:   int32(2),
+			expect: bson.D{
+				{"a", int32(1)},
+				{"sub", bson.D{{"x", "y"}}},
+				{"arr", bson.A{"zero", bson.D{{"k", "v"}}, bson.D{{"x", int32(2)}}}},
+				{"z", true},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		raw := lo.Must(bson.Marshal(in))
+
+		bType, buf := lo.Must2(bson.MarshalValue(c.value))
+
+		raw, err := SetInRaw(raw, bson.RawValue{Type: bType, Value: buf}, c.pointer...)
+		require.NoError(t, err, "%#q", c.pointer)
+		require.NoError(t, bson.Raw(raw).Validate(), "%#q", c.pointer)
+
+		expected := lo.Must(bson.Marshal(c.expect))
+		assert.Equal(t, bson.Raw(expected), bson.Raw(raw), "%#q", c.pointer)
+	}
+}
+
+func TestSetInRaw_Errors(t *testing.T) {
+	raw := lo.Must(bson.Marshal(bson.D{
+		{"a", int32(1)},
+		{"arr", bson.A{int32(1)}},
+	}))
+
+	_, err := SetInRaw(raw, ToRawValue("x"), "a", "b", "c")
+
+	var pe PointerTooDeepError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, []string{"a", "b", "c"}, pe.givenPointer)
+	assert.Equal(t, []string{"a"}, pe.elementPointer)
+
+	_, err = SetInRaw(raw, ToRawValue("x"), "arr", "0", "c")
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, []string{"arr", "0", "c"}, pe.givenPointer)
+	assert.Equal(t, []string{"arr", "0"}, pe.elementPointer)
+
+	_, err = SetInRaw(raw, ToRawValue("x"), "arr", "foo")
+	assert.ErrorContains(t, err, "array index")
+	assert.ErrorContains(t, err, "arr.foo")
+
+	_, err = SetInRaw(raw, ToRawValue("x"), "arr", "01")
+	assert.ErrorContains(t, err, "array index")
+
+	_, err = SetInRaw(raw, ToRawValue("x"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+package bsontools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// DefaultMaxStreamDocumentSize is ReadDocuments’s default maximum document
+// size. It is the server’s internal maximum (16 MiB plus 16 KiB), which
+// oplog entries and thus some mongodump output can reach.
+const DefaultMaxStreamDocumentSize = 16*1024*1024 + 16*1024
+
+const streamBufferSize = 64 * 1024
+
+// ReadDocuments returns an iterator over BSON documents that are
+// concatenated in a stream, as in a mongodump .bson file. A stream that
+// ends cleanly between documents ends the iteration.
+//
+// Each document’s length header is checked against maxSize; if maxSize is
+// 0, DefaultMaxStreamDocumentSize is used. Each document must also end with
+// the BSON document terminator. The documents’ contents are not validated.
+//
+// To avoid allocations, each yielded document reuses a single buffer. Thus,
+// a yielded document is only valid until the next iteration; clone it if
+// you need it longer.
+//
+// If the iterator returns an error but the caller continues iterating,
+// a panic will ensue.
+//
+// Example usage:
+//
+//	for doc, err := range bsontools.ReadDocuments(file, 0) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func ReadDocuments(r io.Reader, maxSize int) iter.Seq2[bson.Raw, error] {
+	if maxSize == 0 {
+		maxSize = DefaultMaxStreamDocumentSize
+	}
+
+	return func(yield func(bson.Raw, error) bool) {
+		yieldErr := func(err error) {
+			if yield(nil, err) {
+				panic(fmt.Errorf("must stop iteration after error (%w)", err))
+			}
+		}
+
+		br := bufio.NewReaderSize(r, streamBufferSize)
+
+		var buf []byte
+		var offset int64
+
+		for docNum := 0; ; docNum++ {
+			var err error
+
+			buf, err = readStreamDocument(br, buf, maxSize)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if err != nil {
+				yieldErr(fmt.Errorf("reading document %d (offset %d): %w", docNum, offset, err))
+				return
+			}
+
+			if !yield(bson.Raw(buf), nil) {
+				return
+			}
+
+			offset += int64(len(buf))
+		}
+	}
+}
+
+// readStreamDocument reads one document into the given buffer, which it
+// grows if needed. It returns io.EOF only if the stream ends cleanly before
+// the document.
+func readStreamDocument(r io.Reader, buf []byte, maxSize int) ([]byte, error) {
+	// NB: We read the header into buf since a local array would escape to
+	// the heap via the io.Reader interface.
+	const headerLen = 4
+
+	if cap(buf) < headerLen {
+		buf = make([]byte, headerLen, streamBufferSize)
+	}
+
+	if _, err := io.ReadFull(r, buf[:headerLen]); err != nil {
+		return nil, err
+	}
+
+	declared, _, _ := bsoncore.ReadLength(buf[:headerLen])
+	length := int(declared)
+
+	switch {
+	case length < 5:
+		return nil, fmt.Errorf("declared document length (%d) is below BSON minimum (5)", length)
+	case length > maxSize:
+		return nil, fmt.Errorf(
+			"declared document length (%d) exceeds maximum (%d)",
+			length,
+			maxSize,
+		)
+	}
+
+	if cap(buf) < length {
+		buf = append(make([]byte, 0, length), buf[:headerLen]...)
+	}
+
+	buf = buf[:length]
+
+	if _, err := io.ReadFull(r, buf[headerLen:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, fmt.Errorf("reading %d-byte document: %w", length, err)
+	}
+
+	if buf[length-1] != 0 {
+		return nil, fmt.Errorf(
+			"BSON document missing trailing NUL terminator (last byte is 0x%02x)",
+			buf[length-1],
+		)
+	}
+
+	return buf, nil
+}
+
+// WriteDocument writes a BSON document to a stream, e.g., a mongodump .bson
+// file. It checks the document’s framing (length header & terminator) but
+// not its contents.
+//
+// For efficiency, the writer should be buffered.
+func WriteDocument[D ~[]byte](w io.Writer, doc D) error {
+	if _, err := elementsBlock([]byte(doc)); err != nil {
+		return err
+	}
+
+	if _, err := w.Write([]byte(doc)); err != nil {
+		return fmt.Errorf("writing %d-byte document: %w", len(doc), err)
+	}
+
+	return nil
+}
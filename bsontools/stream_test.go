@@ -0,0 +1,115 @@
+package bsontools
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestReadWriteDocuments(t *testing.T) {
+	docs := []bson.Raw{
+		lo.Must(bson.Marshal(bson.D{{"_id", int32(1)}, {"s", "hello"}})),
+		lo.Must(bson.Marshal(bson.D{})),
+		lo.Must(bson.Marshal(bson.D{{"_id", int32(3)}, {"big", bytes.Repeat([]byte("x"), 1000)}})),
+	}
+
+	var stream bytes.Buffer
+	for _, doc := range docs {
+		require.NoError(t, WriteDocument(&stream, doc))
+	}
+
+	var got []bson.Raw
+
+	for doc, err := range ReadDocuments(&stream, 0) {
+		require.NoError(t, err)
+
+		got = append(got, slices.Clone(doc))
+	}
+
+	assert.Equal(t, docs, got)
+
+	for _, err := range ReadDocuments(&bytes.Buffer{}, 0) {
+		require.NoError(t, err, "empty stream should yield nothing")
+	}
+}
+
+func TestReadDocuments_Errors(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{{"s", "hello"}}))
+
+	cases := []struct {
+		label  string
+		stream []byte
+		max    int
+		errStr string
+	}{
+		{
+			label:  "truncated header",
+			stream: append(slices.Clone(doc), 1, 2),
+			errStr: io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			label:  "truncated body",
+			stream: append(slices.Clone(doc), doc[:len(doc)-1]...),
+			errStr: io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			label:  "too small",
+			stream: []byte{4, 0, 0, 0},
+			errStr: "below BSON minimum",
+		},
+		{
+			label:  "too big",
+			stream: doc,
+			max:    len(doc) - 1,
+			errStr: "exceeds maximum",
+		},
+		{
+			label:  "missing terminator",
+			stream: append(slices.Clone(doc[:len(doc)-1]), 1),
+			errStr: "terminator",
+		},
+	}
+
+	for _, c := range cases {
+		var docsCount int
+		var lastErr error
+
+		for _, err := range ReadDocuments(bytes.NewReader(c.stream), c.max) {
+			if err != nil {
+				lastErr = err
+				break
+			}
+
+			docsCount++
+		}
+
+		require.Error(t, lastErr, c.label)
+		assert.ErrorContains(t, lastErr, c.errStr, c.label)
+	}
+
+	assert.Error(t, WriteDocument(io.Discard, doc[:len(doc)-1]))
+}
+
+func TestReadDocuments_ReusesBuffer(t *testing.T) {
+	var stream bytes.Buffer
+	for i := range 100 {
+		require.NoError(t, WriteDocument(&stream, lo.Must(bson.Marshal(bson.D{{"i", i}}))))
+	}
+
+	allocs := testing.AllocsPerRun(1, func() {
+		for _, err := range ReadDocuments(bytes.NewReader(stream.Bytes()), 0) {
+			if err != nil {
+				panic(err)
+			}
+		}
+	})
+
+	// The bufio.Reader, the document buffer, & a few closures:
+	assert.Less(t, allocs, float64(10))
+}
@@ -0,0 +1,320 @@
+package bsontools
+
+import (
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// UUIDRepresentation identifies how a UUID is stored as BSON binary.
+//
+// Modern drivers store UUIDs as binary subtype 4 in RFC 4122 byte order.
+// Older drivers used subtype 3, and each reordered the UUID’s bytes
+// differently, so a subtype-3 UUID’s meaning depends on which driver wrote
+// it. Nothing in the BSON itself records that.
+type UUIDRepresentation int
+
+const (
+	// UUIDStandard is subtype 4 in RFC 4122 byte order.
+	UUIDStandard UUIDRepresentation = iota
+
+	// UUIDPythonLegacy is subtype 3 in RFC 4122 byte order, as the legacy
+	// Python driver wrote it.
+	UUIDPythonLegacy
+
+	// UUIDJavaLegacy is subtype 3 with each 8-byte half reversed, as the
+	// legacy Java driver wrote it.
+	UUIDJavaLegacy
+
+	// UUIDCSharpLegacy is subtype 3 with the first three groups (4, 2, & 2
+	// bytes) each reversed, as the legacy C# driver wrote it.
+	UUIDCSharpLegacy
+)
+
+func (ur UUIDRepresentation) String() string {
+	switch ur {
+	case UUIDStandard:
+		return "standard"
+	case UUIDPythonLegacy:
+		return "Python legacy"
+	case UUIDJavaLegacy:
+		return "Java legacy"
+	case UUIDCSharpLegacy:
+		return "C# legacy"
+	}
+
+	return fmt.Sprintf("UUIDRepresentation(%d)", int(ur))
+}
+
+func (ur UUIDRepresentation) validate() error {
+	switch ur {
+	case UUIDStandard, UUIDPythonLegacy, UUIDJavaLegacy, UUIDCSharpLegacy:
+		return nil
+	}
+
+	return fmt.Errorf("unknown UUID representation: %d", int(ur))
+}
+
+func (ur UUIDRepresentation) subtype() byte {
+	if ur == UUIDStandard {
+		return bson.TypeBinaryUUID
+	}
+
+	return bson.TypeBinaryUUIDOld
+}
+
+const uuidLength = 16
+
+// IsUUID indicates whether a BSON value is a UUID, i.e., a 16-byte binary
+// of subtype 3 or 4.
+func IsUUID(val bson.RawValue) bool {
+	bin, err := RawValueToBinary(val)
+	if err != nil {
+		return false
+	}
+
+	switch bin.Subtype {
+	case bson.TypeBinaryUUID, bson.TypeBinaryUUIDOld:
+		return len(bin.Data) == uuidLength
+	}
+
+	return false
+}
+
+// DecodeUUID reads a UUID that is stored in the given representation. The
+// returned UUID is in RFC 4122 byte order.
+//
+// This fails if the value is not a 16-byte binary of the representation’s
+// subtype, or if the representation is unknown.
+func DecodeUUID(val bson.RawValue, rep UUIDRepresentation) ([uuidLength]byte, error) {
+	if err := rep.validate(); err != nil {
+		return [uuidLength]byte{}, err
+	}
+
+	bin, err := RawValueToBinary(val)
+	if err != nil {
+		return [uuidLength]byte{}, err
+	}
+
+	if bin.Subtype != rep.subtype() {
+		return [uuidLength]byte{}, fmt.Errorf(
+			"%s UUIDs are binary subtype %d, not %d",
+			rep,
+			rep.subtype(),
+			bin.Subtype,
+		)
+	}
+
+	if len(bin.Data) != uuidLength {
+		return [uuidLength]byte{}, fmt.Errorf(
+			"UUIDs are %d bytes, not %d",
+			uuidLength,
+			len(bin.Data),
+		)
+	}
+
+	uuid := [uuidLength]byte(bin.Data)
+	reorderUUIDBytes(uuid[:], rep)
+
+	return uuid, nil
+}
+
+// EncodeUUID stores a UUID, given in RFC 4122 byte order, in the given
+// representation. This fails if the representation is unknown.
+func EncodeUUID(uuid [uuidLength]byte, rep UUIDRepresentation) (bson.RawValue, error) {
+	if err := rep.validate(); err != nil {
+		return bson.RawValue{}, err
+	}
+
+	reorderUUIDBytes(uuid[:], rep)
+
+	return ToRawValue(bson.Binary{
+		Subtype: rep.subtype(),
+		Data:    uuid[:],
+	}), nil
+}
+
+// PlausibleUUIDRepresentations returns the legacy representations under which
+// a subtype-3 UUID decodes to a valid RFC 4122 UUID, i.e., one with the
+// RFC 4122 variant and a known version (1-8). This can help to confirm which
+// driver wrote a collection’s UUIDs.
+//
+// Since the Python representation doesn’t reorder bytes, a UUID that fits it
+// might also fit the others, or vice versa. A random value can also fit by
+// chance, so sample more than one UUID.
+func PlausibleUUIDRepresentations(val bson.RawValue) ([]UUIDRepresentation, error) {
+	var plausible []UUIDRepresentation
+
+	for _, rep := range []UUIDRepresentation{UUIDPythonLegacy, UUIDJavaLegacy, UUIDCSharpLegacy} {
+		uuid, err := DecodeUUID(val, rep)
+		if err != nil {
+			return nil, err
+		}
+
+		version := uuid[6] >> 4
+		isRFC4122Variant := uuid[8]>>6 == 0b10
+
+		if isRFC4122Variant && version >= 1 && version <= 8 {
+			plausible = append(plausible, rep)
+		}
+	}
+
+	return plausible, nil
+}
+
+// reorderUUIDBytes converts a UUID between RFC 4122 byte order and the
+// representation’s. Every representation’s reordering is its own inverse,
+// so this works in both directions. The caller must validate the
+// representation.
+func reorderUUIDBytes(uuid []byte, rep UUIDRepresentation) {
+	switch rep {
+	case UUIDStandard, UUIDPythonLegacy:
+	case UUIDJavaLegacy:
+		slices.Reverse(uuid[:8])
+		slices.Reverse(uuid[8:])
+	case UUIDCSharpLegacy:
+		slices.Reverse(uuid[:4])
+		slices.Reverse(uuid[4:6])
+		slices.Reverse(uuid[6:8])
+	default:
+		panic(fmt.Sprintf("unknown UUID representation: %d", rep))
+	}
+}
+
+// LegacyUUIDOptions configures ConvertLegacyUUIDs.
+type LegacyUUIDOptions struct {
+	// From is the legacy representation of the document’s subtype-3 UUIDs.
+	From UUIDRepresentation
+
+	// Paths, if nonempty, limits conversion to the values at these
+	// document pointers. Array elements are given by index. Otherwise,
+	// every subtype-3 UUID in the document is converted.
+	Paths [][]string
+}
+
+// ConvertLegacyUUIDs converts a BSON document’s legacy (subtype 3) UUIDs,
+// recursively, to the standard representation (subtype 4). It modifies the
+// provided bson.Raw directly and returns the number of UUIDs converted.
+//
+// Subtype-3 values that aren’t 16 bytes long are invalid and cause an
+// error, in which case the document is left unmodified. Values at
+// opts.Paths that aren’t subtype-3 binaries (e.g., because they’ve already
+// been converted) are ignored.
+//
+// Example usage:
+//
+//	converted, err := bsontools.ConvertLegacyUUIDs(doc, bsontools.LegacyUUIDOptions{
+//		From: bsontools.UUIDJavaLegacy,
+//	})
+func ConvertLegacyUUIDs(doc bson.Raw, opts LegacyUUIDOptions) (int, error) {
+	if err := opts.From.validate(); err != nil {
+		return 0, err
+	}
+
+	if opts.From == UUIDStandard {
+		return 0, fmt.Errorf("cannot convert from %s UUIDs", opts.From)
+	}
+
+	converter := legacyUUIDConverter{opts: opts}
+
+	// Find & validate every UUID before modifying any, so that an invalid
+	// UUID leaves the document as it was.
+	if err := converter.convertDocument(doc, nil); err != nil {
+		return 0, err
+	}
+
+	for _, uuid := range converter.uuids {
+		// The binary’s value is a 4-byte length, the subtype, and the data.
+		uuid[4] = bson.TypeBinaryUUID
+		reorderUUIDBytes(uuid[5:], opts.From)
+	}
+
+	return len(converter.uuids), nil
+}
+
+type legacyUUIDConverter struct {
+	opts LegacyUUIDOptions
+
+	// uuids are the binary values, as sub-slices of the document, to
+	// convert.
+	uuids [][]byte
+}
+
+func (c *legacyUUIDConverter) convertDocument(doc bson.Raw, pointer []string) error {
+	for el, err := range RawElements(doc) {
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", formatPointerForDisplay(pointer), err)
+		}
+
+		key, err := el.KeyErr()
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", formatPointerForDisplay(pointer), err)
+		}
+
+		elPointer := append(slices.Clip(pointer), key)
+
+		if err := c.convertValue(el, elPointer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *legacyUUIDConverter) convertValue(el bson.RawElement, pointer []string) error {
+	val, err := el.ValueErr()
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", formatPointerForDisplay(pointer), err)
+	}
+
+	switch val.Type {
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+		if !c.mayContainPaths(pointer) {
+			return nil
+		}
+
+		return c.convertDocument(val.Value, pointer)
+	case bson.TypeBinary:
+	default:
+		return nil
+	}
+
+	subtype, data, ok := val.BinaryOK()
+	if !ok {
+		return fmt.Errorf("parsing %s: invalid BSON %s", formatPointerForDisplay(pointer), val.Type)
+	}
+
+	if subtype != bson.TypeBinaryUUIDOld || !c.isConvertedPath(pointer) {
+		return nil
+	}
+
+	if len(data) != uuidLength {
+		return fmt.Errorf(
+			"%s: legacy UUIDs are %d bytes, not %d",
+			formatPointerForDisplay(pointer),
+			uuidLength,
+			len(data),
+		)
+	}
+
+	// NB: Since `val.Value` is a sub-slice of the document, modifying it
+	// later will modify the document.
+	c.uuids = append(c.uuids, val.Value)
+
+	return nil
+}
+
+func (c *legacyUUIDConverter) isConvertedPath(pointer []string) bool {
+	return len(c.opts.Paths) == 0 || slices.ContainsFunc(c.opts.Paths, func(path []string) bool {
+		return slices.Equal(path, pointer)
+	})
+}
+
+// mayContainPaths indicates whether the value at the given pointer may
+// contain converted UUIDs.
+func (c *legacyUUIDConverter) mayContainPaths(pointer []string) bool {
+	return len(c.opts.Paths) == 0 || slices.ContainsFunc(c.opts.Paths, func(path []string) bool {
+		return len(path) > len(pointer) && slices.Equal(path[:len(pointer)], pointer)
+	})
+}
@@ -0,0 +1,160 @@
+package bsontools
+
+import (
+	"encoding/hex"
+	"slices"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// testUUID is 00112233-4455-4677-8899-aabbccddeeff, a version-4 UUID.
+var testUUID = [16]byte(lo.Must(hex.DecodeString("00112233445546778899aabbccddeeff")))
+
+// testUUIDEncodings are testUUID’s encodings in each representation.
+var testUUIDEncodings = map[UUIDRepresentation]bson.Binary{
+	UUIDStandard: {
+		Subtype: bson.TypeBinaryUUID,
+		Data:    lo.Must(hex.DecodeString("00112233445546778899aabbccddeeff")),
+	},
+	UUIDPythonLegacy: {
+		Subtype: bson.TypeBinaryUUIDOld,
+		Data:    lo.Must(hex.DecodeString("00112233445546778899aabbccddeeff")),
+	},
+	UUIDJavaLegacy: {
+		Subtype: bson.TypeBinaryUUIDOld,
+		Data:    lo.Must(hex.DecodeString("7746554433221100ffeeddccbbaa9988")),
+	},
+	UUIDCSharpLegacy: {
+		Subtype: bson.TypeBinaryUUIDOld,
+		Data:    lo.Must(hex.DecodeString("33221100554477468899aabbccddeeff")),
+	},
+}
+
+func TestUUIDEncoding(t *testing.T) {
+	for rep, bin := range testUUIDEncodings {
+		encoded, err := EncodeUUID(testUUID, rep)
+		require.NoError(t, err, "encode %s", rep)
+		assert.Equal(t, ToRawValue(bin), encoded, "encode %s", rep)
+		assert.True(t, IsUUID(encoded), "%s is a UUID", rep)
+
+		decoded, err := DecodeUUID(ToRawValue(bin), rep)
+		require.NoError(t, err, "decode %s", rep)
+		assert.Equal(t, testUUID, decoded, "decode %s", rep)
+	}
+
+	_, err := DecodeUUID(ToRawValue(testUUIDEncodings[UUIDStandard]), UUIDJavaLegacy)
+	assert.ErrorContains(t, err, "subtype", "wrong subtype")
+
+	_, err = DecodeUUID(ToRawValue(bson.Binary{Subtype: bson.TypeBinaryUUID, Data: []byte{1}}), UUIDStandard)
+	assert.ErrorContains(t, err, "bytes", "wrong length")
+
+	_, err = DecodeUUID(ToRawValue("00112233445546778899aabbccddeeff"), UUIDStandard)
+	assert.Error(t, err, "not binary")
+
+	_, err = DecodeUUID(ToRawValue(testUUIDEncodings[UUIDStandard]), UUIDRepresentation(9))
+	assert.ErrorContains(t, err, "unknown", "decode unknown representation")
+
+	_, err = EncodeUUID(testUUID, UUIDRepresentation(9))
+	assert.ErrorContains(t, err, "unknown", "encode unknown representation")
+
+	assert.False(t, IsUUID(ToRawValue(bson.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: []byte{1}})))
+	assert.False(t, IsUUID(ToRawValue(bson.Binary{Data: testUUID[:]})))
+	assert.False(t, IsUUID(ToRawValue(int32(1))))
+}
+
+func TestPlausibleUUIDRepresentations(t *testing.T) {
+	plausible, err := PlausibleUUIDRepresentations(ToRawValue(testUUIDEncodings[UUIDJavaLegacy]))
+	require.NoError(t, err)
+	assert.Equal(t, []UUIDRepresentation{UUIDJavaLegacy}, plausible)
+
+	// C#’s reordering leaves the version nibble at byte 6 as 7, so the
+	// Python representation also fits.
+	plausible, err = PlausibleUUIDRepresentations(ToRawValue(testUUIDEncodings[UUIDCSharpLegacy]))
+	require.NoError(t, err)
+	assert.Equal(t, []UUIDRepresentation{UUIDPythonLegacy, UUIDCSharpLegacy}, plausible)
+
+	_, err = PlausibleUUIDRepresentations(ToRawValue(testUUIDEncodings[UUIDStandard]))
+	assert.Error(t, err, "subtype 4 isn’t legacy")
+}
+
+func TestConvertLegacyUUIDs(t *testing.T) {
+	legacy := testUUIDEncodings[UUIDCSharpLegacy]
+	standard := testUUIDEncodings[UUIDStandard]
+	notUUID := bson.Binary{Data: []byte{1, 2, 3}}
+
+	doc := bson.Raw(lo.Must(bson.Marshal(bson.D{
+		{"_id", legacy},
+		{"other", notUUID},
+		{"modern", standard},
+		{"sub", bson.D{{"id", legacy}}},
+		{"arr", bson.A{legacy, "x", bson.D{{"id", legacy}}}},
+	})))
+
+	all := slices.Clone(doc)
+
+	converted, err := ConvertLegacyUUIDs(all, LegacyUUIDOptions{From: UUIDCSharpLegacy})
+	require.NoError(t, err)
+	assert.Equal(t, 4, converted)
+
+	assert.Equal(
+		t,
+		bson.Raw(lo.Must(bson.Marshal(bson.D{
+			{"_id", standard},
+			{"other", notUUID},
+			{"modern", standard},
+			{"sub", bson.D{{"id", standard}}},
+			{"arr", bson.A{standard, "x", bson.D{{"id", standard}}}},
+		}))),
+		all,
+	)
+
+	someConverted := slices.Clone(doc)
+
+	converted, err = ConvertLegacyUUIDs(someConverted, LegacyUUIDOptions{
+		From:  UUIDCSharpLegacy,
+		Paths: [][]string{{"sub", "id"}, {"arr", "2", "id"}, {"other"}, {"missing"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, converted)
+
+	assert.Equal(
+		t,
+		bson.Raw(lo.Must(bson.Marshal(bson.D{
+			{"_id", legacy},
+			{"other", notUUID},
+			{"modern", standard},
+			{"sub", bson.D{{"id", standard}}},
+			{"arr", bson.A{legacy, "x", bson.D{{"id", standard}}}},
+		}))),
+		someConverted,
+	)
+
+	_, err = ConvertLegacyUUIDs(slices.Clone(doc), LegacyUUIDOptions{From: UUIDStandard})
+	assert.Error(t, err, "standard isn’t a legacy representation")
+
+	_, err = ConvertLegacyUUIDs(slices.Clone(doc), LegacyUUIDOptions{From: UUIDRepresentation(9)})
+	assert.ErrorContains(t, err, "unknown", "unknown representation")
+
+	badDoc := lo.Must(bson.Marshal(bson.D{
+		{"a", bson.D{{"b", bson.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: []byte{1}}}}},
+	}))
+
+	_, err = ConvertLegacyUUIDs(badDoc, LegacyUUIDOptions{From: UUIDJavaLegacy})
+	assert.ErrorContains(t, err, "a.b", "wrong-length legacy UUID")
+
+	// A bad UUID after a good one leaves the good one unconverted.
+	partlyBad := bson.Raw(lo.Must(bson.Marshal(bson.D{
+		{"a", legacy},
+		{"b", bson.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: []byte{1, 2, 3, 4, 5}}},
+	})))
+	original := slices.Clone(partlyBad)
+
+	converted, err = ConvertLegacyUUIDs(partlyBad, LegacyUUIDOptions{From: UUIDCSharpLegacy})
+	assert.ErrorContains(t, err, "b: legacy UUIDs are 16 bytes, not 5")
+	assert.Zero(t, converted)
+	assert.Equal(t, original, partlyBad, "document is unmodified")
+}
@@ -0,0 +1,350 @@
+package bsontools
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/mongodb-labs/migration-tools/option"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+const (
+	// MaxUserDocumentSize is the largest document that the server accepts
+	// from clients (16 MiB).
+	MaxUserDocumentSize = 16 * 1024 * 1024
+
+	// MaxNestingDepth is the deepest nesting that the server accepts in
+	// stored documents. The top-level document is at depth 1, and each
+	// embedded document or array adds a level.
+	MaxNestingDepth = 100
+)
+
+// ValidationProblemKind indicates what is wrong with a document.
+type ValidationProblemKind int
+
+const (
+	// ProblemTooLarge means that the document exceeds MaxUserDocumentSize.
+	ProblemTooLarge ValidationProblemKind = iota + 1
+
+	// ProblemTooDeep means that the document nests deeper than
+	// MaxNestingDepth. Validate does not descend beyond that depth.
+	ProblemTooDeep
+
+	// ProblemInvalidUTF8 means that a field name or string-like value
+	// (string, symbol, JavaScript code, regex, or DBPointer namespace) is
+	// not valid UTF-8.
+	ProblemInvalidUTF8
+
+	// ProblemDuplicateField means that a document contains the same field
+	// name more than once.
+	ProblemDuplicateField
+
+	// ProblemArrayKeySequence means that an array’s keys are not "0", "1",
+	// "2", etc., in order.
+	ProblemArrayKeySequence
+
+	// ProblemDollarPrefixedField means that the target server would reject
+	// the field name because it starts with “$”.
+	ProblemDollarPrefixedField
+
+	// ProblemDottedField means that the target server would reject the
+	// field name because it contains “.”.
+	ProblemDottedField
+)
+
+func (pk ValidationProblemKind) String() string {
+	switch pk {
+	case ProblemTooLarge:
+		return "document too large"
+	case ProblemTooDeep:
+		return "nesting too deep"
+	case ProblemInvalidUTF8:
+		return "invalid UTF-8"
+	case ProblemDuplicateField:
+		return "duplicate field"
+	case ProblemArrayKeySequence:
+		return "array key out of sequence"
+	case ProblemDollarPrefixedField:
+		return "$-prefixed field name"
+	case ProblemDottedField:
+		return "dotted field name"
+	}
+
+	return fmt.Sprintf("ValidationProblemKind(%d)", int(pk))
+}
+
+// ValidationProblem describes one problem that Validate found.
+type ValidationProblem struct {
+	Kind ValidationProblemKind
+
+	// Path is the location of the problem. For field-name problems this
+	// includes the offending field name. Array elements’ indexes are given
+	// as their (possibly invalid) BSON keys.
+	Path []string
+}
+
+func (vp ValidationProblem) String() string {
+	return fmt.Sprintf("%s at %#q", vp.Kind, vp.Path)
+}
+
+// ValidationReport is Validate’s result.
+type ValidationReport struct {
+	Problems []ValidationProblem
+}
+
+// Valid indicates whether the report is free of problems.
+func (vr ValidationReport) Valid() bool {
+	return len(vr.Problems) == 0
+}
+
+// ServerVersion is a MongoDB server release’s major & minor version.
+type ServerVersion struct {
+	Major, Minor int
+}
+
+func (sv ServerVersion) String() string {
+	return fmt.Sprintf("%d.%d", sv.Major, sv.Minor)
+}
+
+// AtLeast indicates whether sv is the given version or later.
+func (sv ServerVersion) AtLeast(major, minor int) bool {
+	return sv.Major > major || (sv.Major == major && sv.Minor >= minor)
+}
+
+// ValidateOptions configures Validate.
+type ValidateOptions struct {
+	// TargetServer, if set, makes Validate flag field names that the given
+	// server version would reject on insert:
+	//   - Before 3.6, field names may neither start with “$” nor contain
+	//     “.” at any depth.
+	//   - Before 5.0, field names may not start with “$” at any depth.
+	//
+	// In both cases the DBRef fields `$ref`, `$id`, and `$db` are permitted
+	// below the top level.
+	TargetServer option.Option[ServerVersion]
+}
+
+// Validate checks a BSON document, recursively, for problems that would
+// make the server reject it on insert. (See ValidationProblemKind.)
+//
+// Validate reports all such problems rather than stopping at the first. It
+// only returns an error if the document is structurally malformed (e.g., a
+// bad length header), which precludes further validation.
+//
+// Example usage:
+//
+//	report, err := bsontools.Validate(doc, bsontools.ValidateOptions{
+//		TargetServer: option.Some(bsontools.ServerVersion{Major: 4, Minor: 4}),
+//	})
+//	...
+//	for _, problem := range report.Problems {
+//		...
+//	}
+func Validate[D ~[]byte](doc D, opts ValidateOptions) (ValidationReport, error) {
+	v := validator{opts: opts}
+
+	if len(doc) > MaxUserDocumentSize {
+		v.report(ProblemTooLarge)
+	}
+
+	if err := v.validateDocument(doc, false); err != nil {
+		return ValidationReport{}, err
+	}
+
+	return ValidationReport{Problems: v.problems}, nil
+}
+
+type validator struct {
+	opts     ValidateOptions
+	problems []ValidationProblem
+
+	// path is the current location, as BSON keys. Its length is the
+	// current nesting depth minus 1.
+	path [][]byte
+
+	// keys is scratch space for finding duplicate field names.
+	keys [][]byte
+
+	// indexBuf is scratch space for array keys.
+	indexBuf []byte
+}
+
+// report records a problem at v.path.
+func (v *validator) report(kind ValidationProblemKind) {
+	path := make([]string, len(v.path))
+	for i, key := range v.path {
+		path[i] = string(key)
+	}
+
+	v.problems = append(v.problems, ValidationProblem{
+		Kind: kind,
+		Path: path,
+	})
+}
+
+func (v *validator) pathString() string {
+	return string(bytes.Join(v.path, []byte(".")))
+}
+
+func (v *validator) validateDocument(doc []byte, isArray bool) error {
+	if len(v.path) >= MaxNestingDepth {
+		v.report(ProblemTooDeep)
+
+		return nil
+	}
+
+	rem, err := elementsBlock(doc)
+	if err != nil {
+		return fmt.Errorf("parsing document at %#q: %w", v.pathString(), err)
+	}
+
+	keysStart := len(v.keys)
+	defer func() { v.keys = v.keys[:keysStart] }()
+
+	for i := 0; len(rem) > 0; i++ {
+		el, next, ok := bsoncore.ReadElement(rem)
+		if !ok {
+			return fmt.Errorf(
+				"parsing document at %#q: %w",
+				v.pathString(),
+				bsoncore.NewInsufficientBytesError(doc, rem),
+			)
+		}
+
+		rem = next
+
+		key := el.KeyBytes()
+		v.path = append(v.path, key)
+
+		if isArray {
+			v.indexBuf = strconv.AppendInt(v.indexBuf[:0], int64(i), 10)
+			if !bytes.Equal(key, v.indexBuf) {
+				v.report(ProblemArrayKeySequence)
+			}
+		} else {
+			v.keys = append(v.keys, key)
+			v.validateFieldName(key)
+		}
+
+		val, err := el.ValueErr()
+		if err != nil {
+			return fmt.Errorf("parsing %#q: %w", v.pathString(), err)
+		}
+
+		err = v.validateValue(bson.RawValue{Type: bson.Type(val.Type), Value: val.Data})
+		if err != nil {
+			return err
+		}
+
+		v.path = v.path[:len(v.path)-1]
+	}
+
+	v.reportDuplicates(v.keys[keysStart:])
+
+	return nil
+}
+
+// validateFieldName checks the last key in v.path.
+func (v *validator) validateFieldName(key []byte) {
+	if !utf8.Valid(key) {
+		v.report(ProblemInvalidUTF8)
+	}
+
+	target, ok := v.opts.TargetServer.Get()
+	if !ok {
+		return
+	}
+
+	if !target.AtLeast(5, 0) && len(key) > 0 && key[0] == '$' && !v.isNestedDBRefField(key) {
+		v.report(ProblemDollarPrefixedField)
+	}
+
+	if !target.AtLeast(3, 6) && bytes.IndexByte(key, '.') != -1 {
+		v.report(ProblemDottedField)
+	}
+}
+
+func (v *validator) isNestedDBRefField(key []byte) bool {
+	if len(v.path) == 1 {
+		return false
+	}
+
+	switch string(key) {
+	case "$ref", "$id", "$db":
+		return true
+	}
+
+	return false
+}
+
+// reportDuplicates reports each field name that occurs more than once
+// among the given keys, which belong to the document at v.path. It
+// reorders the keys.
+func (v *validator) reportDuplicates(keys [][]byte) {
+	slices.SortFunc(keys, bytes.Compare)
+
+	for i := 1; i < len(keys); i++ {
+		if bytes.Equal(keys[i], keys[i-1]) && (i == 1 || !bytes.Equal(keys[i], keys[i-2])) {
+			v.path = append(v.path, keys[i])
+			v.report(ProblemDuplicateField)
+			v.path = v.path[:len(v.path)-1]
+		}
+	}
+}
+
+// validateValue checks the value at v.path.
+func (v *validator) validateValue(val bson.RawValue) error {
+	var ok bool
+
+	switch val.Type {
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+		return v.validateDocument(val.Value, val.Type == bson.TypeArray)
+	case bson.TypeString:
+		var str string
+		str, ok = val.StringValueOK()
+		v.checkUTF8(str)
+	case bson.TypeSymbol:
+		var str string
+		str, ok = val.SymbolOK()
+		v.checkUTF8(str)
+	case bson.TypeJavaScript:
+		var str string
+		str, ok = val.JavaScriptOK()
+		v.checkUTF8(str)
+	case bson.TypeRegex:
+		var pattern, options string
+		pattern, options, ok = val.RegexOK()
+		v.checkUTF8(pattern + options)
+	case bson.TypeDBPointer:
+		var ns string
+		ns, _, ok = val.DBPointerOK()
+		v.checkUTF8(ns)
+	case bson.TypeCodeWithScope:
+		var code string
+		var scope bson.Raw
+		code, scope, ok = val.CodeWithScopeOK()
+		if ok {
+			v.checkUTF8(code)
+
+			return v.validateDocument(scope, false)
+		}
+	default:
+		return nil
+	}
+
+	if !ok {
+		return fmt.Errorf("invalid BSON %s at %#q", val.Type, v.pathString())
+	}
+
+	return nil
+}
+
+func (v *validator) checkUTF8(str string) {
+	if !utf8.ValidString(str) {
+		v.report(ProblemInvalidUTF8)
+	}
+}
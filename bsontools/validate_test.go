@@ -0,0 +1,162 @@
+package bsontools
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mongodb-labs/migration-tools/option"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+func TestValidate_Valid(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{
+		{"_id", int32(1)},
+		{"s", "héllo"},
+		{"arr", bson.A{"a", bson.D{{"x", bson.A{}}}}},
+		{"ref", bson.D{{"$ref", "coll"}, {"$id", int32(1)}, {"$db", "db"}}},
+	}))
+
+	for _, target := range []option.Option[ServerVersion]{
+		option.None[ServerVersion](),
+		option.Some(ServerVersion{3, 4}),
+		option.Some(ServerVersion{8, 0}),
+	} {
+		report, err := Validate(doc, ValidateOptions{TargetServer: target})
+		require.NoError(t, err)
+		assert.True(t, report.Valid(), "%v: %v", target, report.Problems)
+	}
+}
+
+func TestValidate_Problems(t *testing.T) {
+	badUTF8 := string([]byte{'a', 0xff})
+
+	doc := bsoncore.NewDocumentBuilder().
+		AppendString("a", "x").
+		AppendInt32("a", 1).
+		AppendString(badUTF8, "key").
+		AppendDocument("sub", bsoncore.NewDocumentBuilder().
+			AppendString("s", badUTF8).
+			AppendRegex("re", "^a", badUTF8).
+			AppendInt32("b", 1).
+			AppendInt32("b", 2).
+			AppendInt32("b", 3).
+			Build(),
+		).
+		AppendArray("arr", bsoncore.NewDocumentBuilder().
+			AppendInt32("0", 1).
+			AppendInt32("2", 2).
+			AppendSymbol("3", badUTF8).
+			Build(),
+		).
+		AppendCodeWithScope("cws", badUTF8, bsoncore.NewDocumentBuilder().
+			AppendInt32("z", 1).
+			AppendInt32("z", 1).
+			Build(),
+		).
+		Build()
+
+	report, err := Validate(doc, ValidateOptions{})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(
+		t,
+		[]ValidationProblem{
+			{ProblemInvalidUTF8, []string{badUTF8}},
+			{ProblemInvalidUTF8, []string{"sub", "s"}},
+			{ProblemInvalidUTF8, []string{"sub", "re"}},
+			{ProblemDuplicateField, []string{"sub", "b"}},
+			{ProblemArrayKeySequence, []string{"arr", "2"}},
+			{ProblemArrayKeySequence, []string{"arr", "3"}},
+			{ProblemInvalidUTF8, []string{"arr", "3"}},
+			{ProblemInvalidUTF8, []string{"cws"}},
+			{ProblemDuplicateField, []string{"cws", "z"}},
+			{ProblemDuplicateField, []string{"a"}},
+		},
+		report.Problems,
+	)
+	assert.False(t, report.Valid())
+}
+
+func TestValidate_FieldNames(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{
+		{"$top", 1},
+		{"a.b", 1},
+		{"sub", bson.D{{"$x", 1}, {"$id", 1}, {"c.d", 1}}},
+		{"$ref", 1},
+	}))
+
+	cases := []struct {
+		target   ServerVersion
+		expected []ValidationProblem
+	}{
+		{
+			target: ServerVersion{3, 4},
+			expected: []ValidationProblem{
+				{ProblemDollarPrefixedField, []string{"$top"}},
+				{ProblemDottedField, []string{"a.b"}},
+				{ProblemDollarPrefixedField, []string{"sub", "$x"}},
+				{ProblemDottedField, []string{"sub", "c.d"}},
+				{ProblemDollarPrefixedField, []string{"$ref"}},
+			},
+		},
+		{
+			target: ServerVersion{4, 4},
+			expected: []ValidationProblem{
+				{ProblemDollarPrefixedField, []string{"$top"}},
+				{ProblemDollarPrefixedField, []string{"sub", "$x"}},
+				{ProblemDollarPrefixedField, []string{"$ref"}},
+			},
+		},
+		{
+			target: ServerVersion{5, 0},
+		},
+	}
+
+	for _, c := range cases {
+		report, err := Validate(doc, ValidateOptions{TargetServer: option.Some(c.target)})
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, report.Problems, c.target)
+	}
+
+	report, err := Validate(doc, ValidateOptions{})
+	require.NoError(t, err)
+	assert.True(t, report.Valid(), "no target server means no field-name checks")
+}
+
+func TestValidate_Limits(t *testing.T) {
+	nested := func(levels int) bson.Raw {
+		doc := bsoncore.NewDocumentBuilder().Build()
+		for range levels - 1 {
+			doc = bsoncore.NewDocumentBuilder().AppendDocument("x", doc).Build()
+		}
+
+		return bson.Raw(doc)
+	}
+
+	report, err := Validate(nested(MaxNestingDepth), ValidateOptions{})
+	require.NoError(t, err)
+	assert.True(t, report.Valid())
+
+	report, err = Validate(nested(MaxNestingDepth+1), ValidateOptions{})
+	require.NoError(t, err)
+	require.Len(t, report.Problems, 1)
+	assert.Equal(t, ProblemTooDeep, report.Problems[0].Kind)
+	assert.Len(t, report.Problems[0].Path, MaxNestingDepth)
+
+	big := lo.Must(bson.Marshal(bson.D{{"s", string(bytes.Repeat([]byte("x"), MaxUserDocumentSize))}}))
+	report, err = Validate(big, ValidateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []ValidationProblem{{ProblemTooLarge, []string{}}}, report.Problems)
+}
+
+func TestValidate_Malformed(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{{"a", bson.D{{"b", "c"}}}}))
+	doc[8] = 0xff
+
+	_, err := Validate(doc, ValidateOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,249 @@
+package bsontools
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// vectorHeaderLength is the length of a BSON vector’s header, i.e., its
+// dtype & padding bytes.
+const vectorHeaderLength = 2
+
+func vectorTypeName(dtype byte) string {
+	switch dtype {
+	case bson.Int8Vector:
+		return "INT8"
+	case bson.Float32Vector:
+		return "FLOAT32"
+	case bson.PackedBitVector:
+		return "PACKED_BIT"
+	}
+
+	return fmt.Sprintf("unknown dtype (0x%02x)", dtype)
+}
+
+// ValidateVector checks a binary against the BSON vector (subtype 9) spec.
+// Besides what bson.NewVectorFromBinary checks, this requires the ignored
+// bits of a PACKED_BIT vector’s final byte to be zero.
+func ValidateVector(bin bson.Binary) error {
+	if bin.Subtype != bson.TypeBinaryVector {
+		return fmt.Errorf("vectors are binary subtype %d, not %d", bson.TypeBinaryVector, bin.Subtype)
+	}
+
+	if len(bin.Data) < vectorHeaderLength {
+		return fmt.Errorf(
+			"vector header is %d bytes, but binary has only %d",
+			vectorHeaderLength,
+			len(bin.Data),
+		)
+	}
+
+	dtype, padding, data := bin.Data[0], bin.Data[1], bin.Data[vectorHeaderLength:]
+
+	switch dtype {
+	case bson.Int8Vector, bson.Float32Vector:
+		if padding != 0 {
+			return fmt.Errorf("%s vector’s padding (%d) must be 0", vectorTypeName(dtype), padding)
+		}
+
+		if dtype == bson.Float32Vector && len(data)%4 != 0 {
+			return fmt.Errorf(
+				"%s vector’s data length (%d) must be a multiple of 4",
+				vectorTypeName(dtype),
+				len(data),
+			)
+		}
+	case bson.PackedBitVector:
+		switch {
+		case padding > 7:
+			return fmt.Errorf("%s vector’s padding (%d) must not exceed 7", vectorTypeName(dtype), padding)
+		case padding > 0 && len(data) == 0:
+			return fmt.Errorf("empty %s vector’s padding (%d) must be 0", vectorTypeName(dtype), padding)
+		case padding > 0 && data[len(data)-1]&(1<<padding-1) != 0:
+			return fmt.Errorf(
+				"%s vector’s %d ignored bit(s) must be 0",
+				vectorTypeName(dtype),
+				padding,
+			)
+		}
+	default:
+		return fmt.Errorf("vector has %s", vectorTypeName(dtype))
+	}
+
+	return nil
+}
+
+// RawValueToVector decodes a BSON vector (binary subtype 9). It fails if
+// ValidateVector rejects the binary.
+func RawValueToVector(in bson.RawValue) (bson.Vector, error) {
+	bin, err := RawValueToBinary(in)
+	if err != nil {
+		return bson.Vector{}, cannotCastError[bson.Vector]{in.Type}
+	}
+
+	if err := ValidateVector(bin); err != nil {
+		return bson.Vector{}, err
+	}
+
+	return bson.NewVectorFromBinary(bin)
+}
+
+// VectorToArray expands a vector into a BSON array. INT8 elements become
+// int32s, and FLOAT32 elements become doubles. PACKED_BIT vectors become
+// their bytes as int32s (0-255), as other drivers represent them; the
+// padding is not recorded.
+func VectorToArray(vec bson.Vector) (bson.RawArray, error) {
+	var values []bson.RawValue
+
+	switch vec.Type() {
+	case bson.Int8Vector:
+		for _, n := range vec.Int8() {
+			values = append(values, ToRawValue(int32(n)))
+		}
+	case bson.Float32Vector:
+		for _, f := range vec.Float32() {
+			values = append(values, ToRawValue(float64(f)))
+		}
+	case bson.PackedBitVector:
+		bits, _ := vec.PackedBit()
+		for _, b := range bits {
+			values = append(values, ToRawValue(int32(b)))
+		}
+	default:
+		return nil, fmt.Errorf("vector has %s", vectorTypeName(vec.Type()))
+	}
+
+	arr, err := buildRawArray(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.RawArray(arr.Value), nil
+}
+
+// ArrayToVector compacts a BSON array of numbers into a vector of the given
+// dtype. This is the inverse of VectorToArray:
+//   - INT8 elements must be whole numbers from -128 to 127.
+//   - FLOAT32 elements may be any number. They round to the nearest float32,
+//     but finite values beyond float32’s range are an error.
+//   - PACKED_BIT elements must be whole numbers from 0 to 255, one per byte.
+//     The given padding must fit ValidateVector’s rules.
+//
+// The padding must be 0 for the other dtypes.
+//
+// Example usage:
+//
+//	vec, err := bsontools.ArrayToVector(embedding, bson.Float32Vector, 0)
+func ArrayToVector(arr bson.RawArray, dtype byte, padding uint8) (bson.Vector, error) {
+	if dtype != bson.PackedBitVector && padding != 0 {
+		return bson.Vector{}, fmt.Errorf("%s vector’s padding (%d) must be 0", vectorTypeName(dtype), padding)
+	}
+
+	values, err := arr.Values()
+	if err != nil {
+		return bson.Vector{}, fmt.Errorf("parsing array: %w", err)
+	}
+
+	switch dtype {
+	case bson.Int8Vector:
+		nums, err := arrayToVectorElements(values, wholeNumberToInt8)
+		if err != nil {
+			return bson.Vector{}, err
+		}
+
+		return bson.NewVector(nums), nil
+	case bson.Float32Vector:
+		nums, err := arrayToVectorElements(values, numberToFloat32)
+		if err != nil {
+			return bson.Vector{}, err
+		}
+
+		return bson.NewVector(nums), nil
+	case bson.PackedBitVector:
+		bits, err := arrayToVectorElements(values, wholeNumberToByte)
+		if err != nil {
+			return bson.Vector{}, err
+		}
+
+		bin := bson.Binary{
+			Subtype: bson.TypeBinaryVector,
+			Data:    append([]byte{dtype, padding}, bits...),
+		}
+
+		if err := ValidateVector(bin); err != nil {
+			return bson.Vector{}, err
+		}
+
+		return bson.NewVectorFromBinary(bin)
+	}
+
+	return bson.Vector{}, fmt.Errorf("cannot create vector with %s", vectorTypeName(dtype))
+}
+
+func arrayToVectorElements[T any](
+	values []bson.RawValue,
+	convert func(bson.RawValue) (T, error),
+) ([]T, error) {
+	elements := make([]T, 0, len(values))
+
+	for i, val := range values {
+		el, err := convert(val)
+		if err != nil {
+			return nil, fmt.Errorf("array element %d: %w", i, err)
+		}
+
+		elements = append(elements, el)
+	}
+
+	return elements, nil
+}
+
+func wholeNumberToInt8(val bson.RawValue) (int8, error) {
+	n, ok := wholeNumberFilterArg(val)
+	if !ok || n < math.MinInt8 || n > math.MaxInt8 {
+		return 0, fmt.Errorf(
+			"INT8 vector elements must be whole numbers from %d to %d, not %s",
+			math.MinInt8,
+			math.MaxInt8,
+			val,
+		)
+	}
+
+	return int8(n), nil
+}
+
+func wholeNumberToByte(val bson.RawValue) (byte, error) {
+	n, ok := wholeNumberFilterArg(val)
+	if !ok || n < 0 || n > math.MaxUint8 {
+		return 0, fmt.Errorf(
+			"PACKED_BIT vector elements must be whole numbers from 0 to %d, not %s",
+			math.MaxUint8,
+			val,
+		)
+	}
+
+	return byte(n), nil
+}
+
+func numberToFloat32(val bson.RawValue) (float32, error) {
+	var f float64
+
+	switch val.Type {
+	case bson.TypeDouble, bson.TypeInt32, bson.TypeInt64:
+		f, _ = val.AsFloat64OK()
+	case bson.TypeDecimal128:
+		f, _ = Decimal128ToFloat64(val.Decimal128(), big.ToNearestEven)
+	default:
+		return 0, fmt.Errorf("FLOAT32 vector elements must be numbers, not BSON %s", val.Type)
+	}
+
+	f32 := float32(f)
+	if math.IsInf(float64(f32), 0) && !math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%s exceeds FLOAT32 vector elements’ range", val)
+	}
+
+	return f32, nil
+}
@@ -0,0 +1,162 @@
+package bsontools
+
+import (
+	"math"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRawValueToVector(t *testing.T) {
+	vectors := []bson.Vector{
+		bson.NewVector([]int8{}),
+		bson.NewVector([]int8{127, -128, 0, 7}),
+		bson.NewVector([]float32{}),
+		bson.NewVector([]float32{1.5, -0.25, float32(math.Inf(1))}),
+		lo.Must(bson.NewPackedBitVector([]byte{}, 0)),
+		lo.Must(bson.NewPackedBitVector([]byte{0xff, 0b1110_0000}, 5)),
+	}
+
+	for _, vec := range vectors {
+		viaMarshal := mustConvertToRawValue(t, vec)
+
+		assert.Equal(t, vec, lo.Must(RawValueToVector(viaMarshal)))
+		assert.Equal(t, vec, lo.Must(RawValueTo[bson.Vector](viaMarshal)))
+	}
+
+	_, err := RawValueTo[bson.Vector](ToRawValue("abc"))
+	assert.ErrorAs(t, err, &cannotCastError[bson.Vector]{})
+
+	_, err = RawValueToVector(ToRawValue(bson.Binary{Data: []byte{bson.Int8Vector, 0}}))
+	assert.ErrorContains(t, err, "subtype")
+}
+
+func TestValidateVector(t *testing.T) {
+	valid := [][]byte{
+		{bson.Int8Vector, 0},
+		{bson.Int8Vector, 0, 1, 2, 3},
+		{bson.Float32Vector, 0},
+		{bson.Float32Vector, 0, 0, 0, 0x80, 0x3f},
+		{bson.PackedBitVector, 0},
+		{bson.PackedBitVector, 7, 0b1000_0000},
+		{bson.PackedBitVector, 1, 0xff, 0b1111_1110},
+	}
+
+	for _, data := range valid {
+		bin := bson.Binary{Subtype: bson.TypeBinaryVector, Data: data}
+		assert.NoError(t, ValidateVector(bin), "%v", data)
+	}
+
+	invalid := []struct {
+		data   []byte
+		reason string
+	}{
+		{[]byte{}, "header"},
+		{[]byte{bson.Int8Vector}, "header"},
+		{[]byte{0x42, 0}, "unknown dtype (0x42)"},
+		{[]byte{bson.Int8Vector, 1, 1}, "padding (1) must be 0"},
+		{[]byte{bson.Float32Vector, 1, 0, 0, 0, 0}, "padding (1) must be 0"},
+		{[]byte{bson.Float32Vector, 0, 0, 0, 0}, "multiple of 4"},
+		{[]byte{bson.PackedBitVector, 8, 0}, "must not exceed 7"},
+		{[]byte{bson.PackedBitVector, 1}, "empty"},
+		{[]byte{bson.PackedBitVector, 3, 0b0000_0100}, "ignored bit"},
+	}
+
+	for _, tc := range invalid {
+		bin := bson.Binary{Subtype: bson.TypeBinaryVector, Data: tc.data}
+		assert.ErrorContains(t, ValidateVector(bin), tc.reason, "%v", tc.data)
+	}
+
+	err := ValidateVector(bson.Binary{Subtype: bson.TypeBinaryGeneric, Data: []byte{bson.Int8Vector, 0}})
+	assert.ErrorContains(t, err, "subtype")
+}
+
+func TestVectorToArray(t *testing.T) {
+	cases := []struct {
+		vec      bson.Vector
+		expected bson.A
+	}{
+		{bson.NewVector([]int8{}), bson.A{}},
+		{bson.NewVector([]int8{-128, 5}), bson.A{int32(-128), int32(5)}},
+		{bson.NewVector([]float32{0.5, -2}), bson.A{0.5, -2.0}},
+		{lo.Must(bson.NewPackedBitVector([]byte{0xff, 0b1000_0000}, 7)), bson.A{int32(255), int32(128)}},
+	}
+
+	for _, tc := range cases {
+		arr, err := VectorToArray(tc.vec)
+		require.NoError(t, err)
+
+		assert.Equal(t, tc.expected, lo.Must(UnmarshalArray(arr)))
+
+		padding := byte(0)
+		if _, p, ok := tc.vec.PackedBitOK(); ok {
+			padding = p
+		}
+
+		roundTrip, err := ArrayToVector(arr, tc.vec.Type(), padding)
+		require.NoError(t, err)
+		assert.Equal(t, tc.vec, roundTrip, "round-trip")
+	}
+
+	_, err := VectorToArray(bson.Vector{})
+	assert.ErrorContains(t, err, "unknown dtype", "zero-value vector")
+}
+
+func TestArrayToVector(t *testing.T) {
+	arr := lo.Must(MarshalA([]byte(nil), bson.A{int32(1), int64(-2), 3.0, lo.Must(bson.ParseDecimal128("4"))}))
+
+	vec, err := ArrayToVector(arr, bson.Int8Vector, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int8{1, -2, 3, 4}, vec.Int8())
+
+	vec, err = ArrayToVector(arr, bson.Float32Vector, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1, -2, 3, 4}, vec.Float32())
+
+	arr = lo.Must(MarshalA([]byte(nil), bson.A{0.1, math.Inf(-1)}))
+
+	vec, err = ArrayToVector(arr, bson.Float32Vector, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.1, float32(math.Inf(-1))}, vec.Float32(), "rounds to nearest float32")
+
+	arr = lo.Must(MarshalA([]byte(nil), bson.A{int32(0b1010_0000)}))
+
+	vec, err = ArrayToVector(arr, bson.PackedBitVector, 5)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		bson.Binary{Subtype: bson.TypeBinaryVector, Data: []byte{bson.PackedBitVector, 5, 0b1010_0000}},
+		vec.Binary(),
+	)
+}
+
+func TestArrayToVector_Errors(t *testing.T) {
+	cases := []struct {
+		elements bson.A
+		dtype    byte
+		padding  uint8
+		reason   string
+	}{
+		{bson.A{int32(128)}, bson.Int8Vector, 0, "element 0"},
+		{bson.A{int32(1), 1.5}, bson.Int8Vector, 0, "element 1"},
+		{bson.A{"1"}, bson.Int8Vector, 0, "whole numbers"},
+		{bson.A{int32(1)}, bson.Int8Vector, 1, "padding (1) must be 0"},
+		{bson.A{true}, bson.Float32Vector, 0, "must be numbers"},
+		{bson.A{math.MaxFloat64}, bson.Float32Vector, 0, "range"},
+		{bson.A{int32(256)}, bson.PackedBitVector, 0, "from 0 to 255"},
+		{bson.A{int32(-1)}, bson.PackedBitVector, 0, "from 0 to 255"},
+		{bson.A{int32(1)}, bson.PackedBitVector, 1, "ignored bit"},
+		{bson.A{}, bson.PackedBitVector, 1, "empty"},
+		{bson.A{}, 0x42, 0, "unknown dtype"},
+	}
+
+	for _, tc := range cases {
+		arr := lo.Must(MarshalA([]byte(nil), tc.elements))
+
+		_, err := ArrayToVector(arr, tc.dtype, tc.padding)
+		assert.ErrorContains(t, err, tc.reason, "%v", tc.elements)
+	}
+}
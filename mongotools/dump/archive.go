@@ -0,0 +1,551 @@
+package dump
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/mongodb-labs/migration-tools/bsontools"
+	"github.com/mongodb-labs/migration-tools/option"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/x/bsonx/bsoncore"
+)
+
+// ArchiveMagicNumber begins every mongodump archive. It is stored as a
+// little-endian uint32.
+const ArchiveMagicNumber uint32 = 0x8199e26d
+
+// ArchiveFormatVersion is the archive format version that this package writes.
+const ArchiveFormatVersion = "0.1"
+
+// archiveTerminator ends an archive’s prelude and each of its blocks. It is
+// the length header of an (impossible) -1-byte BSON document.
+const archiveTerminator uint32 = 0xffffffff
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// ArchiveHeader is the first document in a mongodump archive.
+type ArchiveHeader struct {
+	ConcurrentCollections int32  `bson:"concurrent_collections"`
+	FormatVersion         string `bson:"version"`
+	ServerVersion         string `bson:"server_version"`
+	ToolVersion           string `bson:"tool_version"`
+}
+
+// ArchiveCollection describes one of a mongodump archive’s collections.
+type ArchiveCollection struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"collection"`
+
+	// Metadata is the collection’s metadata file, in extended JSON.
+	// ParseMetadata parses it.
+	Metadata string `bson:"metadata"`
+
+	// Size is the collection’s data size, in bytes, as of the dump.
+	Size int `bson:"size"`
+
+	Type string `bson:"type"`
+}
+
+// Namespace returns the collection’s namespace.
+func (ac ArchiveCollection) Namespace() Namespace {
+	return Namespace{Database: ac.Database, Collection: ac.Collection}
+}
+
+// ParseMetadata parses the collection’s Metadata. The result’s index specs
+// suit index.DescribeSpecDifferences.
+func (ac ArchiveCollection) ParseMetadata() (CollectionMetadata, error) {
+	md, err := ReadMetadata(strings.NewReader(ac.Metadata))
+	if err != nil {
+		return CollectionMetadata{}, fmt.Errorf("%s: %w", ac.Namespace(), err)
+	}
+
+	return md, nil
+}
+
+// ArchivePrelude is the part of a mongodump archive that precedes its
+// documents.
+type ArchivePrelude struct {
+	Header      ArchiveHeader
+	Collections []ArchiveCollection
+}
+
+// Namespace identifies a collection within an archive.
+type Namespace struct {
+	Database   string
+	Collection string
+}
+
+func (ns Namespace) String() string {
+	return ns.Database + "." + ns.Collection
+}
+
+// archiveBlockHeader precedes each block of an archive’s body. If EOF is
+// set, the block is empty, and CRC is the namespace’s CRC-64 (ECMA) over all
+// of its documents’ bytes.
+type archiveBlockHeader struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"collection"`
+	EOF        bool   `bson:"EOF"`
+	CRC        int64  `bson:"CRC"`
+}
+
+// ArchiveReader reads a mongodump archive (i.e., the output of
+// `mongodump --archive`).
+type ArchiveReader struct {
+	r       io.Reader
+	prelude ArchivePrelude
+}
+
+// NewArchiveReader reads an archive’s prelude and returns an ArchiveReader
+// from which the rest of the archive can be read.
+//
+// Example usage:
+//
+//	ar, err := dump.NewArchiveReader(bufio.NewReader(file))
+//	...
+//	for archiveDoc, err := range ar.Documents() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	var magic [4]byte
+
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, fmt.Errorf("reading archive magic number: %w", err)
+	}
+
+	if got := binary.LittleEndian.Uint32(magic[:]); got != ArchiveMagicNumber {
+		return nil, fmt.Errorf(
+			"archive magic number (0x%08x) should be 0x%08x",
+			got,
+			ArchiveMagicNumber,
+		)
+	}
+
+	ar := &ArchiveReader{r: r}
+
+	buf, isTerminator, err := readArchiveDocument(r, nil)
+	if err == nil && isTerminator {
+		err = errors.New("found terminator")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading archive header: %w", err)
+	}
+
+	if err := bson.Unmarshal(buf, &ar.prelude.Header); err != nil {
+		return nil, fmt.Errorf("parsing archive header: %w", err)
+	}
+
+	for {
+		buf, isTerminator, err = readArchiveDocument(r, buf)
+		if err != nil {
+			return nil, fmt.Errorf("reading archive prelude: %w", err)
+		}
+
+		if isTerminator {
+			break
+		}
+
+		var coll ArchiveCollection
+		if err := bson.Unmarshal(buf, &coll); err != nil {
+			return nil, fmt.Errorf("parsing archive prelude: %w", err)
+		}
+
+		ar.prelude.Collections = append(ar.prelude.Collections, coll)
+	}
+
+	return ar, nil
+}
+
+// Prelude returns the archive’s prelude.
+func (ar *ArchiveReader) Prelude() ArchivePrelude {
+	return ar.prelude
+}
+
+// ArchiveDocument is a document from an archive, with its namespace.
+type ArchiveDocument struct {
+	Namespace Namespace
+	Document  bson.Raw
+}
+
+// Documents returns an iterator over the archive’s documents. Documents from
+// different namespaces may be interleaved. Each namespace’s checksum is
+// verified once all of its documents are read.
+//
+// As with bsontools.ReadDocuments, each yielded document is only valid
+// until the next iteration, and continuing iteration after an error will
+// cause a panic.
+//
+// This should only be called once.
+func (ar *ArchiveReader) Documents() iter.Seq2[ArchiveDocument, error] {
+	return func(yield func(ArchiveDocument, error) bool) {
+		yieldErr := func(err error) {
+			if yield(ArchiveDocument{}, err) {
+				panic(fmt.Errorf("must stop iteration after error (%w)", err))
+			}
+		}
+
+		hashes := map[Namespace]hash.Hash64{}
+
+		var buf []byte
+
+		for {
+			var header archiveBlockHeader
+			var err error
+
+			buf, header, err = readArchiveBlockHeader(ar.r, buf)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if err != nil {
+				yieldErr(err)
+				return
+			}
+
+			ns := Namespace{Database: header.Database, Collection: header.Collection}
+
+			hasher, ok := hashes[ns]
+			if !ok {
+				hasher = crc64.New(crcTable)
+				hashes[ns] = hasher
+			}
+
+			if header.EOF {
+				if err := finishArchiveNamespace(ar.r, ns, header, hasher); err != nil {
+					yieldErr(err)
+					return
+				}
+
+				continue
+			}
+
+			for {
+				var isTerminator bool
+
+				buf, isTerminator, err = readArchiveDocument(ar.r, buf)
+				if err != nil {
+					yieldErr(fmt.Errorf("reading %s document: %w", ns, err))
+					return
+				}
+
+				if isTerminator {
+					break
+				}
+
+				// hash.Hash never returns an error.
+				_, _ = hasher.Write(buf)
+
+				if !yield(ArchiveDocument{Namespace: ns, Document: buf}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// readArchiveBlockHeader reads a block header. It returns io.EOF only if
+// the stream ends cleanly before the header.
+func readArchiveBlockHeader(r io.Reader, buf []byte) ([]byte, archiveBlockHeader, error) {
+	var header archiveBlockHeader
+
+	buf, isTerminator, err := readArchiveDocument(r, buf)
+	if errors.Is(err, io.EOF) {
+		return nil, header, err
+	}
+
+	if err == nil && isTerminator {
+		err = errors.New("found terminator")
+	}
+
+	if err != nil {
+		return nil, header, fmt.Errorf("reading archive block header: %w", err)
+	}
+
+	if err := bson.Unmarshal(buf, &header); err != nil {
+		return nil, header, fmt.Errorf("parsing archive block header: %w", err)
+	}
+
+	return buf, header, nil
+}
+
+// finishArchiveNamespace verifies a namespace’s checksum and reads the
+// terminator that follows its EOF header.
+func finishArchiveNamespace(
+	r io.Reader,
+	ns Namespace,
+	header archiveBlockHeader,
+	hasher hash.Hash64,
+) error {
+	if got := int64(hasher.Sum64()); got != header.CRC { //nolint:gosec
+		return fmt.Errorf(
+			"%s: checksum of documents (%d) mismatches archive (%d)",
+			ns,
+			got,
+			header.CRC,
+		)
+	}
+
+	_, isTerminator, err := readArchiveDocument(r, nil)
+	if err == nil && !isTerminator {
+		err = errors.New("found document")
+	}
+
+	if err != nil {
+		return fmt.Errorf("reading %s terminator: %w", ns, err)
+	}
+
+	return nil
+}
+
+// readArchiveDocument reads either a BSON document or a terminator into the
+// given buffer, which it grows if needed. It returns io.EOF only if the
+// stream ends cleanly before the document.
+func readArchiveDocument(r io.Reader, buf []byte) ([]byte, bool, error) {
+	const headerLen = 4
+
+	if cap(buf) < headerLen {
+		buf = make([]byte, headerLen)
+	}
+
+	buf = buf[:headerLen]
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, false, err
+	}
+
+	if binary.LittleEndian.Uint32(buf) == archiveTerminator {
+		return buf, true, nil
+	}
+
+	declared, _, _ := bsoncore.ReadLength(buf)
+	length := int(declared)
+
+	if length < 5 || length > bsontools.DefaultMaxStreamDocumentSize {
+		return nil, false, fmt.Errorf("invalid BSON document length (%d)", length)
+	}
+
+	if cap(buf) < length {
+		buf = append(make([]byte, 0, length), buf...)
+	}
+
+	buf = buf[:length]
+
+	if _, err := io.ReadFull(r, buf[headerLen:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, false, fmt.Errorf("reading %d-byte document: %w", length, err)
+	}
+
+	if buf[length-1] != 0 {
+		return nil, false, fmt.Errorf(
+			"BSON document missing trailing NUL terminator (last byte is 0x%02x)",
+			buf[length-1],
+		)
+	}
+
+	return buf, false, nil
+}
+
+// ArchiveWriter writes a mongodump archive that mongorestore can read.
+//
+// Example usage:
+//
+//	aw, err := dump.NewArchiveWriter(bufWriter, prelude)
+//	...
+//	for _, doc := range docs {
+//		err = aw.WriteDocument(ns, doc)
+//		...
+//	}
+//	err = aw.Close()
+//	...
+//	err = bufWriter.Flush()
+type ArchiveWriter struct {
+	w io.Writer
+
+	// hashes holds the namespaces that are still open.
+	hashes map[Namespace]hash.Hash64
+
+	// order is the namespaces in the order that they were opened.
+	order []Namespace
+
+	// curBlock is the namespace whose block is in progress, if any.
+	curBlock option.Option[Namespace]
+}
+
+// NewArchiveWriter writes an archive’s prelude and returns an ArchiveWriter
+// that writes the rest of the archive. If the header’s FormatVersion is
+// empty, ArchiveFormatVersion is written. Each prelude collection’s
+// namespace is opened.
+//
+// The given writer should be buffered.
+func NewArchiveWriter(w io.Writer, prelude ArchivePrelude) (*ArchiveWriter, error) {
+	aw := &ArchiveWriter{
+		w:      w,
+		hashes: map[Namespace]hash.Hash64{},
+	}
+
+	header := prelude.Header
+	if header.FormatVersion == "" {
+		header.FormatVersion = ArchiveFormatVersion
+	}
+
+	buf := binary.LittleEndian.AppendUint32(nil, ArchiveMagicNumber)
+
+	headerBytes, err := bson.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling archive header: %w", err)
+	}
+
+	buf = append(buf, headerBytes...)
+
+	for _, coll := range prelude.Collections {
+		collBytes, err := bson.Marshal(coll)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling %s’s prelude entry: %w", coll.Namespace(), err)
+		}
+
+		buf = append(buf, collBytes...)
+
+		aw.open(coll.Namespace())
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, archiveTerminator)
+
+	if _, err := w.Write(buf); err != nil {
+		return nil, fmt.Errorf("writing archive prelude: %w", err)
+	}
+
+	return aw, nil
+}
+
+// WriteDocument writes a document to the given namespace. If the namespace
+// has been closed, an error is returned.
+func (aw *ArchiveWriter) WriteDocument(ns Namespace, doc bson.Raw) error {
+	if curNS, inBlock := aw.curBlock.Get(); !inBlock || curNS != ns {
+		if err := aw.startBlock(ns); err != nil {
+			return err
+		}
+	}
+
+	if err := bsontools.WriteDocument(aw.w, doc); err != nil {
+		return fmt.Errorf("writing %s document: %w", ns, err)
+	}
+
+	// hash.Hash never returns an error.
+	_, _ = aw.hashes[ns].Write(doc)
+
+	return nil
+}
+
+// CloseNamespace writes the given namespace’s end-of-file marker and
+// checksum. Once this is done, no more documents can be written to the
+// namespace.
+func (aw *ArchiveWriter) CloseNamespace(ns Namespace) error {
+	if err := aw.endBlock(); err != nil {
+		return err
+	}
+
+	hasher, isOpen := aw.hashes[ns]
+	if !isOpen {
+		return fmt.Errorf("namespace %s is already closed", ns)
+	}
+
+	buf, err := bson.Marshal(archiveBlockHeader{
+		Database:   ns.Database,
+		Collection: ns.Collection,
+		EOF:        true,
+		CRC:        int64(hasher.Sum64()), //nolint:gosec
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling %s EOF header: %w", ns, err)
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, archiveTerminator)
+
+	if _, err := aw.w.Write(buf); err != nil {
+		return fmt.Errorf("writing %s EOF header: %w", ns, err)
+	}
+
+	delete(aw.hashes, ns)
+
+	return nil
+}
+
+// Close closes all open namespaces in the order that they were opened.
+// It does not close the underlying writer.
+func (aw *ArchiveWriter) Close() error {
+	for _, ns := range aw.order {
+		if _, isOpen := aw.hashes[ns]; !isOpen {
+			continue
+		}
+
+		if err := aw.CloseNamespace(ns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (aw *ArchiveWriter) open(ns Namespace) {
+	if _, isOpen := aw.hashes[ns]; !isOpen {
+		aw.hashes[ns] = crc64.New(crcTable)
+		aw.order = append(aw.order, ns)
+	}
+}
+
+func (aw *ArchiveWriter) startBlock(ns Namespace) error {
+	if err := aw.endBlock(); err != nil {
+		return err
+	}
+
+	if _, isOpen := aw.hashes[ns]; !isOpen && slices.Contains(aw.order, ns) {
+		return fmt.Errorf("namespace %s is already closed", ns)
+	}
+
+	aw.open(ns)
+
+	buf, err := bson.Marshal(archiveBlockHeader{
+		Database:   ns.Database,
+		Collection: ns.Collection,
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling %s block header: %w", ns, err)
+	}
+
+	if _, err := aw.w.Write(buf); err != nil {
+		return fmt.Errorf("writing %s block header: %w", ns, err)
+	}
+
+	aw.curBlock = option.Some(ns)
+
+	return nil
+}
+
+func (aw *ArchiveWriter) endBlock() error {
+	ns, inBlock := aw.curBlock.Get()
+	if !inBlock {
+		return nil
+	}
+
+	if _, err := aw.w.Write(binary.LittleEndian.AppendUint32(nil, archiveTerminator)); err != nil {
+		return fmt.Errorf("writing %s block terminator: %w", ns, err)
+	}
+
+	aw.curBlock = option.None[Namespace]()
+
+	return nil
+}
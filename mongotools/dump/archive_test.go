@@ -0,0 +1,192 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc64"
+	"slices"
+	"testing"
+
+	"github.com/mongodb-labs/migration-tools/mongotools/index"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestArchive_RoundTrip(t *testing.T) {
+	metadata := string(lo.Must(MarshalMetadata(CollectionMetadata{
+		CollectionName: "c1",
+		Indexes: []bson.Raw{
+			lo.Must(bson.Marshal(bson.D{{"v", 2}, {"key", bson.D{{"_id", 1}}}, {"name", "_id_"}})),
+		},
+	})))
+
+	prelude := ArchivePrelude{
+		Header: ArchiveHeader{
+			ConcurrentCollections: 4,
+			ServerVersion:         "8.0.0",
+			ToolVersion:           "100.10.0",
+		},
+		Collections: []ArchiveCollection{
+			{Database: "db", Collection: "c1", Metadata: metadata, Size: 123, Type: "collection"},
+			{Database: "db", Collection: "empty", Metadata: "{}", Type: "collection"},
+		},
+	}
+
+	ns1 := Namespace{"db", "c1"}
+	ns2 := Namespace{"db", "c2"}
+
+	written := []ArchiveDocument{
+		{ns1, lo.Must(bson.Marshal(bson.D{{"_id", 1}}))},
+		{ns1, lo.Must(bson.Marshal(bson.D{{"_id", 2}}))},
+		{ns2, lo.Must(bson.Marshal(bson.D{{"_id", "a"}}))},
+		{ns1, lo.Must(bson.Marshal(bson.D{{"_id", 3}}))},
+	}
+
+	var archive bytes.Buffer
+
+	aw, err := NewArchiveWriter(&archive, prelude)
+	require.NoError(t, err)
+
+	for _, ad := range written {
+		require.NoError(t, aw.WriteDocument(ad.Namespace, ad.Document))
+	}
+
+	require.NoError(t, aw.CloseNamespace(ns2))
+	assert.ErrorContains(t, aw.WriteDocument(ns2, written[2].Document), "closed")
+	require.NoError(t, aw.Close())
+
+	assert.Equal(
+		t,
+		[]byte{0x6d, 0xe2, 0x99, 0x81},
+		archive.Bytes()[:4],
+		"magic number",
+	)
+
+	ar, err := NewArchiveReader(&archive)
+	require.NoError(t, err)
+
+	expectedPrelude := prelude
+	expectedPrelude.Header.FormatVersion = ArchiveFormatVersion
+	assert.Equal(t, expectedPrelude, ar.Prelude())
+
+	var read []ArchiveDocument
+
+	for ad, err := range ar.Documents() {
+		require.NoError(t, err)
+
+		ad.Document = slices.Clone(ad.Document)
+		read = append(read, ad)
+	}
+
+	assert.Equal(t, written, read)
+
+	md, err := ar.Prelude().Collections[0].ParseMetadata()
+	require.NoError(t, err)
+	require.Len(t, md.Indexes, 1)
+
+	diff, err := index.DescribeSpecDifferences(
+		md.Indexes[0],
+		lo.Must(bson.Marshal(bson.D{{"v", 1}, {"key", bson.D{{"_id", 1}}}, {"name", "_id_"}})),
+	)
+	require.NoError(t, err)
+	assert.True(t, diff.IsNone(), "index specs should match")
+}
+
+// This builds an archive by hand to verify that the reader parses
+// mongodump’s format.
+func TestArchiveReader_Format(t *testing.T) {
+	doc := lo.Must(bson.Marshal(bson.D{{"_id", 1}}))
+	crc := crc64.Checksum(doc, crc64.MakeTable(crc64.ECMA))
+
+	terminator := []byte{0xff, 0xff, 0xff, 0xff}
+
+	archive := binary.LittleEndian.AppendUint32(nil, ArchiveMagicNumber)
+	archive = append(archive, lo.Must(bson.Marshal(bson.D{
+		{"concurrent_collections", int32(4)},
+		{"version", "0.1"},
+		{"server_version", "7.0.2"},
+		{"tool_version", "100.9.0"},
+	}))...)
+	archive = append(archive, lo.Must(bson.Marshal(bson.D{
+		{"db", "test"},
+		{"collection", "coll"},
+		{"metadata", `{"indexes":[],"collectionName":"coll"}`},
+		{"size", int32(16)},
+		{"type", "collection"},
+	}))...)
+	archive = append(archive, terminator...)
+
+	archive = append(archive, lo.Must(bson.Marshal(bson.D{
+		{"db", "test"},
+		{"collection", "coll"},
+		{"EOF", false},
+		{"CRC", int64(0)},
+	}))...)
+	archive = append(archive, doc...)
+	archive = append(archive, terminator...)
+
+	eofHeader := lo.Must(bson.Marshal(bson.D{
+		{"db", "test"},
+		{"collection", "coll"},
+		{"EOF", true},
+		{"CRC", int64(crc)},
+	}))
+	archive = append(archive, eofHeader...)
+	archive = append(archive, terminator...)
+
+	ar, err := NewArchiveReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+
+	assert.Equal(t, "7.0.2", ar.Prelude().Header.ServerVersion)
+	require.Len(t, ar.Prelude().Collections, 1)
+	assert.Equal(t, 16, ar.Prelude().Collections[0].Size)
+
+	var docs []bson.Raw
+
+	for ad, err := range ar.Documents() {
+		require.NoError(t, err)
+		assert.Equal(t, Namespace{"test", "coll"}, ad.Namespace)
+
+		docs = append(docs, slices.Clone(ad.Document))
+	}
+
+	assert.Equal(t, []bson.Raw{doc}, docs)
+
+	// Now corrupt the checksum.
+	badCRCHeader := lo.Must(bson.Marshal(bson.D{
+		{"db", "test"},
+		{"collection", "coll"},
+		{"EOF", true},
+		{"CRC", int64(crc + 1)},
+	}))
+	badArchive := bytes.Replace(archive, eofHeader, badCRCHeader, 1)
+
+	ar, err = NewArchiveReader(bytes.NewReader(badArchive))
+	require.NoError(t, err)
+
+	var lastErr error
+	for _, err := range ar.Documents() {
+		if err != nil {
+			lastErr = err
+			break
+		}
+	}
+
+	assert.ErrorContains(t, lastErr, "checksum")
+}
+
+func TestArchiveReader_Errors(t *testing.T) {
+	_, err := NewArchiveReader(bytes.NewReader([]byte{1, 2, 3, 4}))
+	assert.ErrorContains(t, err, "magic number")
+
+	_, err = NewArchiveReader(bytes.NewReader(nil))
+	assert.Error(t, err)
+
+	truncated := binary.LittleEndian.AppendUint32(nil, ArchiveMagicNumber)
+	truncated = append(truncated, lo.Must(bson.Marshal(ArchiveHeader{}))...)
+
+	_, err = NewArchiveReader(bytes.NewReader(truncated))
+	assert.ErrorContains(t, err, "prelude")
+}
@@ -0,0 +1,89 @@
+// Package dump reads & writes mongodump’s output formats.
+//
+// See bsontools.ReadDocuments & bsontools.WriteDocument for mongodump’s
+// .bson files.
+package dump
+
+import (
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// MetadataFileSuffix is the suffix that mongodump appends to a collection’s
+// name to form its metadata file’s name.
+const MetadataFileSuffix = ".metadata.json"
+
+// CollectionMetadata is the content of a mongodump metadata file, which
+// accompanies each collection’s .bson file.
+type CollectionMetadata struct {
+	// Options are the collection’s creation options, as given to `create`.
+	Options bson.Raw `bson:"options"`
+
+	// Indexes are the collection’s index specifications.
+	Indexes []bson.Raw `bson:"indexes"`
+
+	// UUID is the collection’s UUID as hex, without dashes. It’s absent if
+	// the source server predates collection UUIDs.
+	UUID string `bson:"uuid,omitempty"`
+
+	CollectionName string `bson:"collectionName"`
+
+	// Type is the collection’s type (e.g., `collection`, `view`, or
+	// `timeseries`). It’s absent if the source server predates types.
+	Type string `bson:"type,omitempty"`
+}
+
+// ReadMetadata parses a mongodump metadata file. Both canonical & relaxed
+// extended JSON are accepted.
+func ReadMetadata(r io.Reader) (CollectionMetadata, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return CollectionMetadata{}, fmt.Errorf("reading collection metadata: %w", err)
+	}
+
+	var md CollectionMetadata
+
+	if err := bson.UnmarshalExtJSON(data, false, &md); err != nil {
+		return CollectionMetadata{}, fmt.Errorf("parsing collection metadata: %w", err)
+	}
+
+	return md, nil
+}
+
+// WriteMetadata writes a mongodump metadata file. As mongodump does, this
+// writes canonical extended JSON. Nil Options or Indexes are written as
+// empty.
+func WriteMetadata(w io.Writer, md CollectionMetadata) error {
+	data, err := MarshalMetadata(md)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("writing collection metadata: %w", err)
+	}
+
+	return nil
+}
+
+// MarshalMetadata is like WriteMetadata but returns the file content.
+func MarshalMetadata(md CollectionMetadata) ([]byte, error) {
+	if md.Options == nil {
+		md.Options = emptyDocument
+	}
+
+	if md.Indexes == nil {
+		md.Indexes = []bson.Raw{}
+	}
+
+	data, err := bson.MarshalExtJSON(md, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling collection metadata: %w", err)
+	}
+
+	return data, nil
+}
+
+var emptyDocument = bson.Raw{5, 0, 0, 0, 0}
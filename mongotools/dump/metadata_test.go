@@ -0,0 +1,64 @@
+package dump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestMetadata_RoundTrip(t *testing.T) {
+	// This is what mongodump writes.
+	fromMongodump := `{"options":{"capped":true,"size":{"$numberLong":"4096"}},` +
+		`"indexes":[{"v":{"$numberInt":"2"},"key":{"_id":{"$numberInt":"1"}},"name":"_id_"}],` +
+		`"uuid":"5a4bd1b2c4d64a4e9e3f1f3c2b1a0d9e","collectionName":"mycoll","type":"collection"}`
+
+	md, err := ReadMetadata(strings.NewReader(fromMongodump))
+	require.NoError(t, err)
+
+	assert.Equal(t, "mycoll", md.CollectionName)
+	assert.Equal(t, "collection", md.Type)
+	assert.Equal(t, "5a4bd1b2c4d64a4e9e3f1f3c2b1a0d9e", md.UUID)
+	assert.Equal(t, int64(4096), md.Options.Lookup("size").Int64())
+	require.Len(t, md.Indexes, 1)
+	assert.Equal(t, "_id_", md.Indexes[0].Lookup("name").StringValue())
+
+	var out bytes.Buffer
+	require.NoError(t, WriteMetadata(&out, md))
+	assert.Equal(t, fromMongodump, out.String())
+}
+
+func TestMetadata_Relaxed(t *testing.T) {
+	md, err := ReadMetadata(strings.NewReader(
+		`{"options":{},"indexes":[{"v":2,"key":{"_id":1},"name":"_id_"}],"collectionName":"c"}`,
+	))
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), md.Indexes[0].Lookup("v").Int32())
+	assert.Empty(t, md.UUID)
+	assert.Empty(t, md.Type)
+}
+
+func TestMetadata_Empty(t *testing.T) {
+	data, err := MarshalMetadata(CollectionMetadata{CollectionName: "c"})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"options":{},"indexes":[],"collectionName":"c"}`, string(data))
+
+	md, err := ReadMetadata(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		bson.Raw(lo.Must(bson.Marshal(bson.D{}))),
+		md.Options,
+	)
+}
+
+func TestMetadata_Invalid(t *testing.T) {
+	_, err := ReadMetadata(strings.NewReader(`{"options":`))
+	assert.Error(t, err)
+}
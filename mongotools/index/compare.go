@@ -7,7 +7,6 @@ import (
 	"math"
 	"slices"
 
-	"github.com/ccoveille/go-safecast/v2"
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/mongodb-labs/migration-tools/bsontools"
 	"github.com/mongodb-labs/migration-tools/option"
@@ -40,6 +39,17 @@ var optsToIgnore = mapset.NewSet(
 	"background",
 )
 
+// ignoredOptsRemover strips optsToIgnore from index specs in a single pass.
+var ignoredOptsRemover = func() *bsontools.EditPlan {
+	plan := &bsontools.EditPlan{}
+
+	for field := range optsToIgnore.Iter() {
+		lo.Must0(plan.Remove(field))
+	}
+
+	return plan
+}()
+
 // SpecDiff describes the difference between two index specifications.
 type SpecDiff struct {
 	// JSONPatch is a diff between the two indexes in ext JSON. It won’t
@@ -94,20 +104,27 @@ func DescribeSpecDifferences(specA, specB bson.Raw) (option.Option[SpecDiff], er
 		return option.None[SpecDiff](), err
 	}
 
-	equalNoOrder, err := equalIgnoringOrder(specA, specB)
+	equalNoOrder, err := bsontools.EqualIgnoringOrder(
+		specA,
+		specB,
+		bsontools.EqualOptions{
+			Mode:    bsontools.EqualIgnoreOrder,
+			Doubles: bsontools.DoublesServer,
+		},
+	)
 	if err != nil {
 		return option.None[SpecDiff](), err
 	}
 
 	if !equalNoOrder {
-		specAExtJSON, err := bson.MarshalExtJSON(specA, true, false)
+		specAExtJSON, err := bsontools.MarshalExtJSON(nil, specA, bsontools.ExtJSONCanonical)
 		if err != nil {
 			return option.Some(SpecDiff{
 				jsonPatchErr: fmt.Errorf("marshal spec A to ext JSON: %w", err),
 			}), nil
 		}
 
-		specBExtJSON, err := bson.MarshalExtJSON(specB, true, false)
+		specBExtJSON, err := bsontools.MarshalExtJSON(nil, specB, bsontools.ExtJSONCanonical)
 		if err != nil {
 			return option.Some(SpecDiff{
 				jsonPatchErr: fmt.Errorf("marshal spec B to ext JSON: %w", err),
@@ -154,11 +171,9 @@ func prepareIndexSpecForEqualityCheck(spec bson.Raw) (bson.Raw, error) {
 		return nil, fmt.Errorf("normalizing spec types: %w", err)
 	}
 
-	for field := range optsToIgnore.Iter() {
-		spec, _, err = bsontools.RemoveFromRaw(spec, field)
-		if err != nil {
-			return nil, err
-		}
+	spec, _, err = ignoredOptsRemover.Apply(nil, spec)
+	if err != nil {
+		return nil, fmt.Errorf("removing ignored options: %w", err)
 	}
 
 	spec, err = normalizeTypesInKey(spec)
@@ -195,43 +210,30 @@ func normalizeTypesInKey(spec bson.Raw) (bson.Raw, error) {
 }
 
 func normalizeKeyEl(spec bson.Raw, el bson.RawElement) (bson.Raw, error) {
-	var i32 int32
-	var err error
-
 	elType := bson.Type(el[0])
 
 	switch elType {
-	case bson.TypeInt32:
+	case bson.TypeInt64, bson.TypeDouble:
+	default:
 		return spec, nil
-	case bson.TypeInt64:
-		val := lo.Must(el.ValueErr())
-
-		i32, err = safecast.Convert[int32](val.Int64())
-		if err != nil {
-			return nil, fmt.Errorf("%#q (int64 %d) to %T: %w", el.Key(), val.Int64(), i32, err)
-		}
-
-	case bson.TypeDouble:
-		val := lo.Must(el.ValueErr())
+	}
 
-		i32, err = safecast.Convert[int32](val.Double())
-		if err != nil {
-			return nil, fmt.Errorf("%#q (float64 %f) to %T: %w", el.Key(), val.Double(), i32, err)
-		}
+	val := lo.Must(el.ValueErr())
 
-		if float64(i32) != val.Double() {
-			// We can’t normalize this, so just let it be.
-			return spec, nil
-		}
+	i32Val, err := bsontools.Convert(val, bson.TypeInt32, bsontools.ConvertOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%#q (%s %s) to %s: %w", el.Key(), elType, val, bson.TypeInt32, err)
+	}
 
-	default:
+	if elType == bson.TypeDouble && float64(i32Val.Int32()) != val.Double() {
+		// We can’t normalize this, so just let it be.
 		return spec, nil
 	}
 
 	fieldName := lo.Must(el.KeyErr())
 
 	var found bool
-	spec, found, err = bsontools.ReplaceInRaw(spec, bsontools.ToRawValue(i32), "key", fieldName)
+	spec, found, err = bsontools.ReplaceInRaw(spec, i32Val, "key", fieldName)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"replacing %#q (%s) with %s: %w",
@@ -353,9 +355,10 @@ func convertBitsSpecToInt32(spec bson.Raw) (bson.Raw, error) {
 }
 
 // convertToInt32 converts the value of the given key in the spec to an int32. It expects the original value of the key
-// to be numeric. Additionally, this function should only be used for index spec values in the server that fit within a
-// 32-bit signed integer range. This is because the server uses static_cast<int> in C++ to perform $toInt which can result
-// in undefined behavior on overflow whereas Go does well-defined truncation when converting to int32. For more details, see:
+// to be numeric. Non-integral values are truncated, as the server’s $toInt does. Additionally, this function should only
+// be used for index spec values in the server that fit within a 32-bit signed integer range. This is because the server
+// uses static_cast<int> in C++ to perform $toInt which can result in undefined behavior on overflow, whereas
+// bsontools.Convert fails on overflow. For more details, see:
 // https://github.com/10gen/mongo/blob/84ff3493467477ffee5b92b663622c843d06fd9e/src/mongo/db/exec/expression/evaluate_math.cpp#L1158
 func convertToInt32(spec bson.Raw, keyName string, maxBound int32) (bson.Raw, error) {
 	val, err := spec.LookupErr(keyName)
@@ -370,15 +373,7 @@ func convertToInt32(spec bson.Raw, keyName string, maxBound int32) (bson.Raw, er
 	switch val.Type {
 	case bson.TypeInt32:
 		return spec, nil
-	case bson.TypeInt64, bson.TypeDouble:
-		if val.AsFloat64() > float64(maxBound) {
-			return nil, fmt.Errorf(
-				"%#q value (%f) cannot exceed %d",
-				keyName,
-				val.AsFloat64(),
-				maxBound,
-			)
-		}
+	case bson.TypeInt64, bson.TypeDouble, bson.TypeDecimal128:
 	default:
 		return nil, fmt.Errorf(
 			"expected %#q to be numeric but got %s",
@@ -387,20 +382,26 @@ func convertToInt32(spec bson.Raw, keyName string, maxBound int32) (bson.Raw, er
 		)
 	}
 
-	i32, err := safecast.Convert[int32](val.AsFloat64())
+	i32Val, err := bsontools.Convert(val, bson.TypeInt32, bsontools.ConvertOptions{})
 	if err != nil {
 		return nil, fmt.Errorf(
-			"%#q value (%v) must be expressible as int32",
+			"%#q value (%v) must be expressible as int32: %w",
 			keyName,
 			val,
+			err,
 		)
 	}
 
-	newSpec, found, err := bsontools.ReplaceInRaw(
-		spec,
-		bsontools.ToRawValue(i32),
-		keyName,
-	)
+	if i32Val.Int32() > maxBound {
+		return nil, fmt.Errorf(
+			"%#q value (%v) cannot exceed %d",
+			keyName,
+			val,
+			maxBound,
+		)
+	}
+
+	newSpec, found, err := bsontools.ReplaceInRaw(spec, i32Val, keyName)
 
 	// We shouldn’t be here if keyName isn’t in the spec.
 	lo.Assert(found, "must have found %#q", keyName)
@@ -434,11 +435,12 @@ func convertSparseSpecToBool(spec bson.Raw) (bson.Raw, error) {
 		)
 	}
 
-	newSpec, found, err := bsontools.ReplaceInRaw(
-		spec,
-		bsontools.ToRawValue(val.AsFloat64() != 0),
-		keyName,
-	)
+	boolVal, err := bsontools.Convert(val, bson.TypeBoolean, bsontools.ConvertOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("converting `sparse` (%v) to %s: %w", val, bson.TypeBoolean, err)
+	}
+
+	newSpec, found, err := bsontools.ReplaceInRaw(spec, boolVal, keyName)
 
 	lo.Assert(found, "must have found %#q", keyName)
 
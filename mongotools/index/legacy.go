@@ -2,7 +2,6 @@ package index
 
 import (
 	"fmt"
-	"math/big"
 
 	"github.com/mongodb-labs/migration-tools/bsontools"
 	"github.com/samber/lo"
@@ -140,13 +139,7 @@ func shouldModernizeValue(value bson.RawValue) bool {
 	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble:
 		return value.AsFloat64() == 0
 	case bson.TypeDecimal128:
-		if bi, _, err := value.Decimal128().BigInt(); err == nil {
-			if bi.Cmp(big.NewInt(0)) == 0 {
-				return true
-			}
-		}
-
-		return false
+		return bsontools.Decimal128IsZero(value.Decimal128())
 	case bson.TypeString:
 		return value.StringValue() == ""
 	default:
@@ -151,6 +151,19 @@ func (s *UnitTestSuite) TestSameSpec() {
 			},
 			label: "spec field order; sparse type",
 		},
+		{
+			a: bson.D{
+				{"v", 2},
+				{"key", bson.D{{"loc", "2d"}}},
+				{"min", math.Copysign(0, -1)},
+			},
+			b: bson.D{
+				{"v", 2},
+				{"key", bson.D{{"loc", "2d"}}},
+				{"min", 0.0},
+			},
+			label: "-0 equals 0",
+		},
 	}
 
 	for _, curCase := range cases {
@@ -337,12 +350,16 @@ func (s *UnitTestSuite) Test_ConvertLegacyIndexKeys_Decimal0() {
 		{"key2", decimalZero},
 		{"key3", decimalOne},
 		{"key4", decimalZero1},
+		{"key5", lo.Must(bson.ParseDecimal128("-0E+3"))},
+		{"key6", lo.Must(bson.ParseDecimal128("NaN"))},
 	}
 	convertedKey := bson.D{
 		{"key1", decimalNOne},
 		{"key2", int32(1)},
 		{"key3", decimalOne},
 		{"key4", int32(1)},
+		{"key5", int32(1)},
+		{"key6", lo.Must(bson.ParseDecimal128("NaN"))},
 	}
 	s.testIndexKeyConversions(legacyKey, convertedKey, true)
 }
@@ -457,6 +474,18 @@ func (s *UnitTestSuite) TestConvertTTLSpecToInt32() {
 		spec,
 		"float64 TTL should be converted to int32",
 	)
+
+	spec = lo.Must(bson.Marshal(bson.D{
+		{"expireAfterSeconds", lo.Must(bson.ParseDecimal128("1000.9"))},
+	}))
+	spec, err = convertTTLSpecToInt32(spec)
+	s.Require().NoError(err)
+
+	s.Assert().Equal(
+		lo.Must(bson.Marshal(bson.D{{"expireAfterSeconds", int32(1000)}})),
+		spec,
+		"decimal TTL should be truncated to int32",
+	)
 }
 
 // TestConvertBitsSpecToInt32 only tests some `bits` conversions since